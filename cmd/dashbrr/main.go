@@ -10,7 +10,6 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -26,6 +25,7 @@ import (
 	"github.com/autobrr/dashbrr/internal/database"
 	"github.com/autobrr/dashbrr/internal/logger"
 	"github.com/autobrr/dashbrr/internal/services"
+	"github.com/autobrr/dashbrr/internal/services/servicesync"
 	"github.com/autobrr/dashbrr/web"
 )
 
@@ -35,7 +35,20 @@ func init() {
 
 func main() {
 	if len(os.Args) > 1 && os.Args[1] == "run" {
-		if err := executor.ExecuteCommand(os.Args[2:]); err != nil {
+		if handled, err := executor.ExecuteStandalone(os.Args[2:]); handled {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		cfg, err := config.Load(config.DefaultPath(), config.Flags{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := executor.ExecuteCommand(cfg, os.Args[2:]); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
@@ -52,78 +65,43 @@ func startServer() {
 		Str("build_date", buildinfo.Date).
 		Msg("Starting dashbrr")
 
-	// Check environment variable first, then fall back to flag
-	defaultConfigPath := "config.toml"
-	if envPath := os.Getenv(config.EnvConfigPath); envPath != "" {
-		defaultConfigPath = envPath
-	} else {
-		// Check user config directory
-		userConfigDir, err := os.UserConfigDir()
-		if err != nil {
-			log.Error().Err(err).Msg("failed to get user config directory")
-		}
-
-		base := []string{filepath.Join(userConfigDir, "dashbrr"), "/config"}
-		configs := []string{"config.toml", "config.yaml", "config.yml"}
-
-		for _, b := range base {
-			for _, c := range configs {
-				p := filepath.Join(b, c)
-				if _, err := os.Stat(p); err == nil {
-					defaultConfigPath = p
-					break
-				}
-			}
-			if defaultConfigPath != "config.toml" {
-				break
-			}
-		}
-	}
-	configPath := flag.String("config", defaultConfigPath, "path to config file")
-
-	var dbPath string
-	flag.StringVar(&dbPath, "db", "", "path to database file")
-	listenAddr := flag.String("listen", ":8080", "address to listen on")
+	configPath := flag.String("config", config.DefaultPath(), "path to config file")
+	dbPath := flag.String("db", "", "path to database file")
+	listenAddr := flag.String("listen", "", "address to listen on (default \":8080\")")
 	flag.Parse()
 
-	// If dbPath wasn't set via flag, use config directory
-	if dbPath == "" {
-		configDir := filepath.Dir(*configPath)
-		dbPath = filepath.Join(configDir, "data", "dashbrr.db")
+	flags := config.Flags{
+		ListenAddr: *listenAddr,
+		DBPath:     *dbPath,
 	}
-
-	var cfg *config.Config
-	var err error
-
-	if config.HasRequiredEnvVars() {
-		cfg = &config.Config{}
-		if err := config.LoadEnvOverrides(cfg); err != nil {
-			log.Fatal().Err(err).Msg("Failed to load environment variables")
-		}
-	} else {
-		log.Debug().Str("path", *configPath).Msg("Using config file")
-
-		cfg, err = config.LoadConfig(*configPath)
-		if err != nil {
-			cfg = &config.Config{
-				Server: config.ServerConfig{
-					ListenAddr: *listenAddr,
-				},
-				Database: config.DatabaseConfig{
-					Path: dbPath,
-				},
-			}
-			log.Warn().Err(err).Msg("Failed to load configuration file, using defaults")
-		}
+	cfg, err := config.Load(*configPath, flags)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
+	if err := logger.SetLevel(cfg.Logging.Level); err != nil {
+		log.Error().Err(err).Msg("Invalid log level, logging everything")
+	}
+	if cfg.Path != "" {
+		log.Debug().Str("path", cfg.Path).Msg("Using config file")
+		warnConfigProblems(cfg.Path)
+	} else if !config.HasRequiredEnvVars() {
+		log.Warn().Str("path", *configPath).Msg("Config file not found, using defaults and environment variables")
 	}
 
-	db, err := database.InitDB(cfg.Database.Path)
+	db, err := database.InitDBWithConfig(database.NewConfigFromSettings(cfg.Database))
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize database")
 	}
 	defer db.Close()
 
+	if _, err := servicesync.Reconcile(db, cfg.Services, cfg.ServiceSync.Policy); err != nil {
+		log.Fatal().Err(err).Msg("Failed to reconcile services from config file")
+	}
+
 	healthService := services.NewHealthService()
+	if interval := time.Duration(cfg.Health.CheckInterval); interval > 0 {
+		healthService.CheckInterval = interval
+	}
 
 	if os.Getenv("GIN_MODE") == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -135,22 +113,22 @@ func startServer() {
 	r.Use(middleware.Logger())
 	r.Use(gin.Recovery())
 
-	if gin.Mode() == gin.DebugMode {
+	switch {
+	case len(cfg.Server.TrustedProxies) > 0:
+		err = r.SetTrustedProxies(cfg.Server.TrustedProxies)
+	case gin.Mode() == gin.DebugMode:
 		err = r.SetTrustedProxies(nil)
-	} else {
+	default:
 		err = r.SetTrustedProxies([]string{"127.0.0.1", "::1"})
 	}
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to set trusted proxies")
 	}
 
-	r.Use(middleware.SetupCORS())
-
-	cacheStore := routes.SetupRoutes(r, db, healthService)
+	runtime := routes.SetupRoutes(r, db, healthService, cfg)
 	defer func() {
-		if err := cacheStore.Close(); err != nil {
-			cacheType := strings.ToLower(os.Getenv("CACHE_TYPE"))
-			if cacheType == "redis" {
+		if err := runtime.Store.Close(); err != nil {
+			if strings.EqualFold(cfg.Cache.Type, "redis") {
 				log.Error().Err(err).Msg("Failed to close Redis cache connection")
 			} else {
 				log.Debug().Err(err).Msg("Cache cleanup completed")
@@ -158,7 +136,7 @@ func startServer() {
 		}
 	}()
 
-	web.ServeStatic(r)
+	web.ServeStatic(r, cfg.Server.BasePath)
 
 	srv := &http.Server{
 		Addr:         cfg.Server.ListenAddr,
@@ -179,6 +157,17 @@ func startServer() {
 		}
 	}()
 
+	// Apply changes to the config file, or on SIGHUP, without a restart
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	reloader := config.NewReloader(cfg, *configPath, flags, func(old, updated *config.Config) {
+		applyConfig(db, runtime, old, updated)
+	})
+	go reloader.Watch(reloadCtx, config.DefaultWatchInterval, hup)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -193,3 +182,40 @@ func startServer() {
 
 	log.Info().Msg("Server exiting")
 }
+
+// applyConfig applies a reloaded configuration to the running server and
+// reports the changes that need a restart
+func applyConfig(db *database.DB, runtime *routes.Runtime, old, updated *config.Config) {
+	if err := logger.SetLevel(updated.Logging.Level); err != nil {
+		log.Error().Err(err).Msg("Invalid log level, keeping the current one")
+	}
+
+	runtime.Apply(updated)
+
+	if _, err := servicesync.Reconcile(db, updated.Services, updated.ServiceSync.Policy); err != nil {
+		log.Error().Err(err).Msg("Failed to reconcile services from config file")
+	}
+
+	if fields := config.RestartRequired(old, updated); len(fields) > 0 {
+		log.Warn().Strs("fields", fields).Msg("Changed settings take effect after a restart")
+	}
+	log.Info().Msg("Configuration reloaded")
+}
+
+// warnConfigProblems logs the problems found in the config file, such as
+// misspelled keys that would otherwise be ignored
+func warnConfigProblems(path string) {
+	problems, err := config.ValidateFile(path)
+	if err != nil {
+		return
+	}
+	for _, problem := range problems {
+		log.Warn().
+			Int("line", problem.Line).
+			Str("key", problem.Key).
+			Msg(problem.Message)
+	}
+	if len(problems) > 0 {
+		log.Warn().Str("path", path).Msg("Config file has problems, run 'dashbrr run config validate' for details")
+	}
+}
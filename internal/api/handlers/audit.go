@@ -0,0 +1,118 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+const maxAuditLimit = 1000
+
+type AuditHandler struct {
+	db *database.DB
+}
+
+func NewAuditHandler(db *database.DB) *AuditHandler {
+	return &AuditHandler{
+		db: db,
+	}
+}
+
+// GetEvents returns audit events, newest first.
+// Supported query parameters: action, actor, target, since (RFC3339), limit, offset.
+func (h *AuditHandler) GetEvents(c *gin.Context) {
+	filter := models.AuditFilter{
+		Action: c.Query("action"),
+		Actor:  c.Query("actor"),
+		Target: c.Query("target"),
+	}
+
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since parameter, expected RFC3339 timestamp"})
+			return
+		}
+		filter.Since = t
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+			return
+		}
+		if n > maxAuditLimit {
+			n = maxAuditLimit
+		}
+		filter.Limit = n
+	}
+
+	if offset := c.Query("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset parameter"})
+			return
+		}
+		filter.Offset = n
+	}
+
+	events, err := h.db.ListAuditEvents(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list audit events")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// recordAudit stores an audit event for the current request. The actor is
+// taken from the authenticated session unless the event already names one.
+// Failures are logged and never interrupt the request.
+func recordAudit(c *gin.Context, db *database.DB, event models.AuditEvent) {
+	if db == nil {
+		return
+	}
+
+	event.IP = c.ClientIP()
+	if event.Actor == "" {
+		event.Actor, event.ActorID = auditActor(c, db)
+	}
+
+	if err := db.CreateAuditEvent(&event); err != nil {
+		log.Error().Err(err).Str("action", event.Action).Msg("Failed to record audit event")
+	}
+}
+
+// auditActor resolves the name and ID of the authenticated user
+func auditActor(c *gin.Context, db *database.DB) (string, int64) {
+	if userID := c.GetInt64("user_id"); userID != 0 {
+		user, err := db.GetUserByID(userID)
+		if err == nil && user != nil {
+			return user.Username, user.ID
+		}
+		return "user:" + strconv.FormatInt(userID, 10), userID
+	}
+
+	authType := c.GetString("auth_type")
+	if session, ok := c.Get("session"); ok {
+		if data, ok := session.(types.SessionData); ok && data.Subject != "" {
+			return authType + ":" + data.Subject, 0
+		}
+	}
+	if authType != "" {
+		return authType, 0
+	}
+	return "anonymous", 0
+}
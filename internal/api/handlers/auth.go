@@ -4,60 +4,139 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/oauth2"
 
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/oidc"
 	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
 )
 
+// oidcStateTTL bounds how long a login may take at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcSessionTTL is the lifetime of the dashbrr session created after login,
+// independent of the (usually much shorter) access token lifetime
+const oidcSessionTTL = 24 * time.Hour
+
+var defaultOIDCScopes = []string{"openid", "profile", "email"}
+
 type AuthHandler struct {
 	config       *types.AuthConfig
+	db           *database.DB
 	cache        cache.Store
 	oauth2Config *oauth2.Config
+	httpClient   *http.Client
+
+	providerMu sync.Mutex
+	provider   *oidc.Provider
 }
 
-func NewAuthHandler(config *types.AuthConfig, store cache.Store) *AuthHandler {
-	// Ensure issuer URL doesn't have trailing slash
-	issuer := strings.TrimRight(config.Issuer, "/")
+// oidcLoginState is stored between Login and Callback
+type oidcLoginState struct {
+	FrontendURL  string `json:"frontendUrl"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+}
+
+func NewAuthHandler(config *types.AuthConfig, db *database.DB, store cache.Store) *AuthHandler {
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultOIDCScopes
+	}
 
+	// The endpoints are filled in from the provider's discovery document
+	// on first use, see getProvider
 	oauth2Config := &oauth2.Config{
 		ClientID:     config.ClientID,
 		ClientSecret: config.ClientSecret,
 		RedirectURL:  config.RedirectURL,
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  fmt.Sprintf("%s/authorize", issuer),
-			TokenURL: fmt.Sprintf("%s/oauth/token", issuer),
-		},
-		Scopes: []string{"openid", "profile", "email"},
+		Scopes:       scopes,
 	}
 
 	return &AuthHandler{
 		config:       config,
+		db:           db,
 		cache:        store,
 		oauth2Config: oauth2Config,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
 	}
 }
 
-// generateSecureRandomString generates a cryptographically secure random string
-func generateSecureRandomString(length int) (string, error) {
-	bytes := make([]byte, length)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+// getProvider returns the discovered OpenID provider. Discovery happens
+// lazily so dashbrr can start while the identity provider is down.
+func (h *AuthHandler) getProvider(ctx context.Context) (*oidc.Provider, error) {
+	h.providerMu.Lock()
+	defer h.providerMu.Unlock()
+
+	if h.provider != nil {
+		return h.provider, nil
+	}
+
+	provider, err := oidc.Discover(ctx, h.httpClient, h.config.Issuer)
+	if err != nil {
+		return nil, err
 	}
-	return base64.URLEncoding.EncodeToString(bytes)[:length], nil
+
+	h.oauth2Config.Endpoint = oauth2.Endpoint{
+		AuthURL:  provider.AuthorizationEndpoint,
+		TokenURL: provider.TokenEndpoint,
+	}
+	h.provider = provider
+	return provider, nil
 }
 
-// Login initiates the OIDC authentication flow
+// oauth2Context makes the oauth2 package use the handler's HTTP client
+func (h *AuthHandler) oauth2Context(c *gin.Context) context.Context {
+	return context.WithValue(c.Request.Context(), oauth2.HTTPClient, h.httpClient)
+}
+
+// validFrontendURL reports whether a post-login redirect target is safe.
+// Only http(s) URLs on the host serving the request or the configured
+// callback host are accepted, so the login flow cannot be used as an open
+// redirect.
+func (h *AuthHandler) validFrontendURL(c *gin.Context, raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+
+	allowed := []string{hostname(c.Request.Host)}
+	if redirect, err := url.Parse(h.config.RedirectURL); err == nil && redirect.Host != "" {
+		allowed = append(allowed, redirect.Hostname())
+	}
+	for _, host := range allowed {
+		if strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostname strips the port from a host[:port] value
+func hostname(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
+
+// Login initiates the OIDC authorization code flow with PKCE
 func (h *AuthHandler) Login(c *gin.Context) {
 	log.Info().Msg("initiating login flow")
 
@@ -68,101 +147,112 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Frontend URL is required"})
 		return
 	}
+	if !h.validFrontendURL(c, frontendUrl) {
+		log.Warn().Str("frontendUrl", frontendUrl).Msg("rejected frontend URL")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid frontend URL"})
+		return
+	}
 
-	// Generate state parameter
-	state, err := generateSecureRandomString(32)
+	if _, err := h.getProvider(c.Request.Context()); err != nil {
+		log.Error().Err(err).Msg("failed to discover OIDC provider")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	state, err := utils.GenerateSecureToken(32)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to generate state")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	// Generate nonce parameter
-	nonce, err := generateSecureRandomString(32)
+	nonce, err := utils.GenerateSecureToken(32)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to generate nonce")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	// Store state and nonce in cache
-	stateKey := fmt.Sprintf("oidc:state:%s", state)
-	nonceKey := fmt.Sprintf("oidc:nonce:%s", nonce)
-
-	// Store both state and frontend URL
-	stateData := map[string]interface{}{
-		"timestamp":   time.Now().Unix(),
-		"frontendUrl": frontendUrl,
+	loginState := oidcLoginState{
+		FrontendURL:  frontendUrl,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
 	}
 
-	if err := h.cache.Set(c, stateKey, stateData, 5*time.Minute); err != nil {
+	stateKey := fmt.Sprintf("oidc:state:%s", state)
+	if err := h.cache.Set(c, stateKey, loginState, oidcStateTTL); err != nil {
 		log.Error().Err(err).Msg("failed to store state in cache")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	if err := h.cache.Set(c, nonceKey, time.Now().Unix(), 5*time.Minute); err != nil {
-		log.Error().Err(err).Msg("failed to store nonce in cache")
-		_ = h.cache.Delete(c, stateKey)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	// Build Auth0 authorize URL with additional parameters
 	authURL := h.oauth2Config.AuthCodeURL(
 		state,
 		oauth2.SetAuthURLParam("nonce", nonce),
-		oauth2.SetAuthURLParam("response_type", "code"),
+		oauth2.S256ChallengeOption(loginState.CodeVerifier),
 	)
 
 	c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
-// Callback handles the OIDC provider callback
+// Callback handles the OIDC provider callback. The ID token is verified
+// and the browser receives only an HttpOnly session cookie; no tokens are
+// passed to the frontend.
 func (h *AuthHandler) Callback(c *gin.Context) {
 	code := c.Query("code")
 	state := c.Query("state")
 
 	if code == "" {
+		if idpError := c.Query("error"); idpError != "" {
+			log.Warn().Str("error", idpError).Str("description", c.Query("error_description")).Msg("identity provider returned an error")
+			c.Redirect(http.StatusTemporaryRedirect, middleware.BasePath(c)+"/login?error="+url.QueryEscape(idpError))
+			return
+		}
 		log.Error().Msg("no code in callback")
-		c.Redirect(http.StatusTemporaryRedirect, "/login?error=no_code")
+		c.Redirect(http.StatusTemporaryRedirect, middleware.BasePath(c)+"/login?error=no_code")
 		return
 	}
 
-	// Verify state and get frontend URL
+	// Verify state and get the login parameters
 	stateKey := fmt.Sprintf("oidc:state:%s", state)
-	var stateData map[string]interface{}
-	if err := h.cache.Get(c, stateKey, &stateData); err != nil {
+	var loginState oidcLoginState
+	if err := h.cache.Get(c, stateKey, &loginState); err != nil {
 		if err == cache.ErrKeyNotFound {
 			log.Debug().Msg("state not found or expired")
 		} else {
 			log.Error().Err(err).Msg("failed to get state from cache")
 		}
-		c.Redirect(http.StatusTemporaryRedirect, "/login?error=invalid_state")
+		c.Redirect(http.StatusTemporaryRedirect, middleware.BasePath(c)+"/login?error=invalid_state")
 		return
 	}
 
-	frontendUrl, ok := stateData["frontendUrl"].(string)
-	if !ok {
-		log.Error().Msg("no frontend URL in state data")
-		c.Redirect(http.StatusTemporaryRedirect, "/login?error=invalid_state")
+	// State is single use
+	if err := h.cache.Delete(c, stateKey); err != nil && err != cache.ErrKeyNotFound {
+		log.Error().Err(err).Msg("failed to delete state from cache")
+	}
+
+	frontendUrl := loginState.FrontendURL
+	if frontendUrl == "" || loginState.Nonce == "" || loginState.CodeVerifier == "" {
+		log.Error().Msg("incomplete login state")
+		c.Redirect(http.StatusTemporaryRedirect, middleware.BasePath(c)+"/login?error=invalid_state")
 		return
 	}
 
-	// Clean up used state
-	if err := h.cache.Delete(c, stateKey); err != nil && err != cache.ErrKeyNotFound {
-		log.Error().Err(err).Msg("failed to delete state from cache")
+	provider, err := h.getProvider(c.Request.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to discover OIDC provider")
+		c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/login?error=provider_unavailable", frontendUrl))
+		return
 	}
 
-	// Exchange code for token
-	token, err := h.oauth2Config.Exchange(c, code)
+	// Exchange code for token, proving possession of the PKCE verifier
+	token, err := h.oauth2Config.Exchange(h.oauth2Context(c), code, oauth2.VerifierOption(loginState.CodeVerifier))
 	if err != nil {
 		log.Error().Err(err).Msg("code exchange failed")
 		c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/login?error=exchange_failed", frontendUrl))
 		return
 	}
 
-	// Extract ID Token claims
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
 		log.Error().Msg("no id_token in token response")
@@ -170,7 +260,33 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 		return
 	}
 
-	// Store session
+	idToken, err := provider.Verify(c.Request.Context(), rawIDToken, oidc.VerifyOptions{
+		ClientID: h.config.ClientID,
+		Nonce:    loginState.Nonce,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("id_token verification failed")
+		c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/login?error=invalid_id_token", frontendUrl))
+		return
+	}
+
+	subject := claimString(idToken.Claims, "email")
+	if subject == "" {
+		subject = idToken.Subject
+	}
+
+	// Store session under a random ID rather than the access token, so the
+	// cookie value is useless outside dashbrr. OIDC sessions belong to no
+	// local account, so unlike password sessions they are not indexed in
+	// the database: they are not listed or revoked through the session
+	// endpoints and end at logout or when their cache entry expires.
+	sessionID, err := utils.GenerateSecureToken(48)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate session ID")
+		c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/login?error=session_failed", frontendUrl))
+		return
+	}
+
 	sessionData := types.SessionData{
 		AccessToken:  token.AccessToken,
 		TokenType:    token.TokenType,
@@ -178,35 +294,53 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 		IDToken:      rawIDToken,
 		ExpiresAt:    token.Expiry,
 		AuthType:     "oidc",
+		Role:         h.config.RoleForGroups(claimStrings(idToken.Claims, h.groupsClaim())),
+		Subject:      subject,
 	}
 
-	sessionKey := fmt.Sprintf("oidc:session:%s", token.AccessToken)
-	if err := h.cache.Set(c, sessionKey, sessionData, time.Until(token.Expiry)); err != nil {
+	sessionKey := fmt.Sprintf("oidc:session:%s", sessionID)
+	if err := h.cache.Set(c, sessionKey, sessionData, oidcSessionTTL); err != nil {
 		log.Error().Err(err).Msg("failed to store session in cache")
 		c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/login?error=session_failed", frontendUrl))
 		return
 	}
 
-	// Set secure cookie with session ID
+	// Lax is required for the cookie to survive the redirect back from the
+	// identity provider
+	c.SetSameSite(http.SameSiteLaxMode)
 	c.SetCookie(
 		"session",
-		token.AccessToken,
-		int(time.Until(token.Expiry).Seconds()),
-		"/",
+		sessionID,
+		int(oidcSessionTTL.Seconds()),
+		middleware.CookiePath(c),
 		"",
 		true, // Secure
 		true, // HttpOnly
 	)
 
-	// Redirect to frontend with tokens
-	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s?access_token=%s&id_token=%s",
-		frontendUrl,
-		token.AccessToken,
-		rawIDToken,
-	))
+	recordAudit(c, h.db, models.AuditEvent{
+		Actor:   "oidc:" + subject,
+		Action:  models.AuditLogin,
+		Details: map[string]interface{}{"method": "oidc", "role": sessionData.Role},
+	})
+
+	c.Redirect(http.StatusTemporaryRedirect, withQueryParam(frontendUrl, "auth", "oidc"))
 }
 
-// Logout handles user logout
+// withQueryParam adds a query parameter to a URL, keeping existing ones
+func withQueryParam(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Set(key, value)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Logout handles user logout. When the provider supports RP-initiated
+// logout the browser is sent there so the IdP session ends too.
 func (h *AuthHandler) Logout(c *gin.Context) {
 	// Get frontend URL from query parameter
 	frontendUrl := c.Query("frontendUrl")
@@ -215,6 +349,11 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Frontend URL is required"})
 		return
 	}
+	if !h.validFrontendURL(c, frontendUrl) {
+		log.Warn().Str("frontendUrl", frontendUrl).Msg("rejected frontend URL")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid frontend URL"})
+		return
+	}
 
 	// Get session cookie
 	sessionID, err := c.Cookie("session")
@@ -224,8 +363,13 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	// Delete session from cache
 	sessionKey := fmt.Sprintf("oidc:session:%s", sessionID)
+	var sessionData types.SessionData
+	if err := h.cache.Get(c, sessionKey, &sessionData); err != nil && err != cache.ErrKeyNotFound {
+		log.Error().Err(err).Msg("failed to get session from cache")
+	}
+
+	// Delete session from cache
 	if err := h.cache.Delete(c, sessionKey); err != nil && err != cache.ErrKeyNotFound {
 		log.Error().Err(err).Msg("failed to delete session from cache")
 	}
@@ -235,18 +379,26 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		"session",
 		"",
 		-1,
-		"/",
+		middleware.CookiePath(c),
 		"",
 		true,
 		true,
 	)
 
-	// Redirect to Auth0 logout
-	logoutURL := fmt.Sprintf("%s/v2/logout?client_id=%s&returnTo=%s",
-		strings.TrimRight(h.config.Issuer, "/"),
-		h.config.ClientID,
-		frontendUrl,
-	)
+	provider, err := h.getProvider(c.Request.Context())
+	if err != nil || provider.EndSessionEndpoint == "" {
+		if err != nil {
+			log.Error().Err(err).Msg("failed to discover OIDC provider")
+		}
+		c.Redirect(http.StatusTemporaryRedirect, frontendUrl)
+		return
+	}
+
+	logoutURL := withQueryParam(provider.EndSessionEndpoint, "post_logout_redirect_uri", frontendUrl)
+	logoutURL = withQueryParam(logoutURL, "client_id", h.config.ClientID)
+	if sessionData.IDToken != "" {
+		logoutURL = withQueryParam(logoutURL, "id_token_hint", sessionData.IDToken)
+	}
 	c.Redirect(http.StatusTemporaryRedirect, logoutURL)
 }
 
@@ -307,45 +459,40 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		Expiry:       sessionData.ExpiresAt,
 	}
 
+	if _, err := h.getProvider(c.Request.Context()); err != nil {
+		log.Error().Err(err).Msg("failed to discover OIDC provider")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
 	// Refresh the token
-	newToken, err := h.oauth2Config.TokenSource(c, token).Token()
+	newToken, err := h.oauth2Config.TokenSource(h.oauth2Context(c), token).Token()
 	if err != nil {
 		log.Error().Err(err).Msg("token refresh failed")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
 
-	// Update session with new token data
+	// Update session with new token data. The session ID, and therefore
+	// the cookie, stays the same.
 	sessionData.AccessToken = newToken.AccessToken
-	sessionData.RefreshToken = newToken.RefreshToken
+	if newToken.RefreshToken != "" {
+		sessionData.RefreshToken = newToken.RefreshToken
+	}
 	sessionData.ExpiresAt = newToken.Expiry
 	if rawIDToken, ok := newToken.Extra("id_token").(string); ok {
 		sessionData.IDToken = rawIDToken
 	}
 
-	// Store updated session
-	if err := h.cache.Set(c, sessionKey, sessionData, time.Until(newToken.Expiry)); err != nil {
+	if err := h.cache.Set(c, sessionKey, sessionData, oidcSessionTTL); err != nil {
 		log.Error().Err(err).Msg("failed to update session in cache")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
 		return
 	}
 
-	// Update session cookie
-	c.SetCookie(
-		"session",
-		newToken.AccessToken,
-		int(time.Until(newToken.Expiry).Seconds()),
-		"/",
-		"",
-		true,
-		true,
-	)
-
 	c.JSON(http.StatusOK, gin.H{
-		"access_token":  newToken.AccessToken,
-		"token_type":    newToken.TokenType,
-		"expires_in":    int(time.Until(newToken.Expiry).Seconds()),
-		"refresh_token": newToken.RefreshToken,
+		"message":    "Session refreshed",
+		"expires_in": int(time.Until(newToken.Expiry).Seconds()),
 	})
 }
 
@@ -372,9 +519,20 @@ func (h *AuthHandler) UserInfo(c *gin.Context) {
 		return
 	}
 
-	// Make request to userinfo endpoint
-	userinfoURL := fmt.Sprintf("%s/userinfo", strings.TrimRight(h.config.Issuer, "/"))
-	req, err := http.NewRequest("GET", userinfoURL, nil)
+	provider, err := h.getProvider(c.Request.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to discover OIDC provider")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	// Not every provider has a userinfo endpoint; fall back to the session
+	if provider.UserInfoEndpoint == "" {
+		c.JSON(http.StatusOK, gin.H{"sub": sessionData.Subject, "role": sessionData.Role})
+		return
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, provider.UserInfoEndpoint, nil)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to create userinfo request")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -383,7 +541,7 @@ func (h *AuthHandler) UserInfo(c *gin.Context) {
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", sessionData.AccessToken))
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := h.httpClient.Do(req)
 	if err != nil {
 		log.Error().Err(err).Msg("userinfo request failed")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
@@ -409,6 +567,38 @@ func (h *AuthHandler) UserInfo(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process user info"})
 		return
 	}
+	userInfo["role"] = sessionData.Role
 
 	c.JSON(http.StatusOK, userInfo)
 }
+
+// groupsClaim returns the id_token claim that holds the user's groups
+func (h *AuthHandler) groupsClaim() string {
+	if h.config.GroupsClaim != "" {
+		return h.config.GroupsClaim
+	}
+	return "groups"
+}
+
+// claimString returns a string claim, or an empty string if it is missing
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// claimStrings returns a claim that may be a single string or a list of strings
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
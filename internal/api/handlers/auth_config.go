@@ -5,27 +5,42 @@ package handlers
 
 import (
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetAuthConfig returns the available authentication methods
-func GetAuthConfig(c *gin.Context) {
-	hasOIDC := os.Getenv("OIDC_ISSUER") != "" &&
-		os.Getenv("OIDC_CLIENT_ID") != "" &&
-		os.Getenv("OIDC_CLIENT_SECRET") != ""
+// AuthMethods lists the authentication methods that are enabled
+type AuthMethods struct {
+	OIDC bool
+	// LDAP logins use the built-in login form
+	LDAP bool
+	// With forward auth the proxy has logged the user in already, so the
+	// UI skips the login screen
+	Proxy bool
+	// Passkeys sign in to local accounts
+	Passkey bool
+}
 
+// GetAuthConfig returns a handler listing the available authentication
+// methods
+func GetAuthConfig(methods AuthMethods) gin.HandlerFunc {
 	defaultMethod := "builtin"
-	if hasOIDC {
+	if methods.Proxy {
+		defaultMethod = "proxy"
+	} else if methods.OIDC {
 		defaultMethod = "oidc"
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"methods": map[string]bool{
-			"builtin": !hasOIDC, // Built-in auth is only available when OIDC is not configured
-			"oidc":    hasOIDC,
-		},
-		"default": defaultMethod,
-	})
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"methods": map[string]bool{
+				"builtin": !methods.OIDC || methods.LDAP, // Built-in auth is only available when OIDC is not configured
+				"ldap":    methods.LDAP,
+				"oidc":    methods.OIDC,
+				"proxy":   methods.Proxy,
+				"passkey": methods.Passkey,
+			},
+			"default": defaultMethod,
+		})
+	}
 }
@@ -5,9 +5,11 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -15,6 +17,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/oidc/oidctest"
 	"github.com/autobrr/dashbrr/internal/types"
 )
 
@@ -114,6 +119,61 @@ func (m *MockStore) Expire(ctx context.Context, key string, expiration time.Dura
 	return errors.New("unknown error")
 }
 
+func (m *MockStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	args := m.safeArgs(m.Called(ctx, prefix))
+	if err, ok := args.Get(1).(error); ok {
+		return 0, err
+	}
+	return args.Int(0), nil
+}
+
+func (m *MockStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	args := m.safeArgs(m.Called(ctx, prefix))
+	if err, ok := args.Get(1).(error); ok {
+		return nil, err
+	}
+	keys, _ := args.Get(0).([]string)
+	return keys, nil
+}
+
+func (m *MockStore) GetMulti(ctx context.Context, keys []string) (map[string]json.RawMessage, error) {
+	args := m.safeArgs(m.Called(ctx, keys))
+	if err, ok := args.Get(1).(error); ok {
+		return nil, err
+	}
+	values, _ := args.Get(0).(map[string]json.RawMessage)
+	return values, nil
+}
+
+func (m *MockStore) SetMulti(ctx context.Context, values map[string]interface{}, expiration time.Duration) error {
+	args := m.safeArgs(m.Called(ctx, values, expiration))
+	if args.Get(0) == nil {
+		return nil
+	}
+	if err, ok := args.Get(0).(error); ok {
+		return err
+	}
+	return errors.New("unknown error")
+}
+
+func (m *MockStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	args := m.safeArgs(m.Called(ctx, key, value, expiration))
+	if err, ok := args.Get(1).(error); ok {
+		return false, err
+	}
+	stored, _ := args.Get(0).(bool)
+	return stored, nil
+}
+
+func (m *MockStore) Stats(ctx context.Context) (cache.Stats, error) {
+	args := m.safeArgs(m.Called(ctx))
+	if err, ok := args.Get(1).(error); ok {
+		return cache.Stats{}, err
+	}
+	stats, _ := args.Get(0).(cache.Stats)
+	return stats, nil
+}
+
 func (m *MockStore) Close() error {
 	args := m.safeArgs(m.Called())
 	if args.Get(0) == nil {
@@ -134,7 +194,7 @@ func TestNewAuthHandler(t *testing.T) {
 	}
 	mockStore := new(MockStore)
 
-	handler := NewAuthHandler(config, mockStore)
+	handler := NewAuthHandler(config, nil, mockStore)
 
 	assert.NotNil(t, handler)
 	assert.Equal(t, config, handler.config)
@@ -216,3 +276,160 @@ func TestLogout_NoFrontendURL(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	mockStore.AssertExpectations(t)
 }
+
+func TestClaims_RoleMapping(t *testing.T) {
+	claims := map[string]interface{}{
+		"sub":    "123",
+		"email":  "a@example.com",
+		"groups": []interface{}{"Media-Admins", "users"},
+	}
+	assert.Equal(t, "a@example.com", claimString(claims, "email"))
+
+	groups := claimStrings(claims, "groups")
+	assert.Equal(t, []string{"Media-Admins", "users"}, groups)
+
+	tests := []struct {
+		name   string
+		config types.AuthConfig
+		want   string
+	}{
+		{"no mapping", types.AuthConfig{}, types.RoleAdmin},
+		{"admin group", types.AuthConfig{AdminGroups: []string{"media-admins"}}, types.RoleAdmin},
+		{"operator group", types.AuthConfig{OperatorGroups: []string{"users"}}, types.RoleOperator},
+		{"no match", types.AuthConfig{AdminGroups: []string{"other"}}, types.RoleViewer},
+		{"default role", types.AuthConfig{AdminGroups: []string{"other"}, DefaultRole: types.RoleOperator}, types.RoleOperator},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.config.RoleForGroups(groups))
+		})
+	}
+
+	assert.Equal(t, []string{"solo"}, claimStrings(map[string]interface{}{"groups": "solo"}, "groups"))
+	assert.Nil(t, claimStrings(claims, "missing"))
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	idp := oidctest.NewServer(t, "dashbrr", "secret")
+	idp.Claims["groups"] = []string{"media-admins"}
+
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	handler := NewAuthHandler(&types.AuthConfig{
+		Issuer:       idp.Issuer(),
+		ClientID:     "dashbrr",
+		ClientSecret: "secret",
+		RedirectURL:  "http://dashbrr.local/api/auth/oidc/callback",
+		AdminGroups:  []string{"media-admins"},
+	}, nil, store)
+
+	router := gin.New()
+	router.GET("/api/auth/oidc/login", handler.Login)
+	router.GET("/api/auth/oidc/callback", handler.Callback)
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Host = "dashbrr.local"
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Login sends the browser to the discovered authorization endpoint
+	w := serve("/api/auth/oidc/login?frontendUrl=" + url.QueryEscape("http://dashbrr.local/"))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, idp.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, authURL.Query().Get("nonce"))
+
+	// The stand-in IdP logs the user in and redirects back with a code
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL.String())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	callbackURL, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+
+	w = serve("/api/auth/oidc/callback?" + callbackURL.RawQuery)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	location := w.Header().Get("Location")
+	assert.Equal(t, "http://dashbrr.local/?auth=oidc", location)
+	assert.NotContains(t, location, "token")
+
+	var sessionID string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "session" {
+			sessionID = cookie.Value
+			assert.True(t, cookie.HttpOnly)
+		}
+	}
+	assert.NotEmpty(t, sessionID)
+
+	var session types.SessionData
+	assert.NoError(t, store.Get(context.Background(), "oidc:session:"+sessionID, &session))
+	assert.Equal(t, types.RoleAdmin, session.Role)
+	assert.Equal(t, "user@example.com", session.Subject)
+	assert.NotEqual(t, session.AccessToken, sessionID)
+
+	// State is single use
+	w = serve("/api/auth/oidc/callback?" + callbackURL.RawQuery)
+	assert.Equal(t, "/login?error=invalid_state", w.Header().Get("Location"))
+}
+
+func TestOIDCLogin_RejectsForeignFrontendURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewAuthHandler(&types.AuthConfig{
+		Issuer:      "http://127.0.0.1:1",
+		ClientID:    "dashbrr",
+		RedirectURL: "http://dashbrr.local/api/auth/oidc/callback",
+	}, nil, new(MockStore))
+
+	for _, frontendURL := range []string{"https://evil.example.com/", "javascript:alert(1)", "//evil.example.com"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/login?frontendUrl="+url.QueryEscape(frontendURL), nil)
+		c.Request.Host = "dashbrr.local"
+
+		handler.Login(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, frontendURL)
+	}
+}
+
+func TestCallback_ProviderError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/callback?error=access_denied&state=abc", nil)
+
+	handler := &AuthHandler{config: &types.AuthConfig{}, cache: new(MockStore)}
+	handler.Callback(c)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/login?error=access_denied", w.Header().Get("Location"))
+}
+
+func TestCallback_BasePath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockStore := new(MockStore)
+	mockStore.On("Get", mock.Anything, "oidc:state:unknown", mock.Anything).Return(cache.ErrKeyNotFound)
+
+	handler := &AuthHandler{config: &types.AuthConfig{}, cache: mockStore}
+	router := gin.New()
+	router.Use(middleware.Cookies("/dashbrr", http.SameSiteLaxMode))
+	router.GET("/dashbrr/api/auth/oidc/callback", handler.Callback)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashbrr/api/auth/oidc/callback?code=abc&state=unknown", nil))
+
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/dashbrr/login?error=invalid_state", w.Header().Get("Location"))
+	mockStore.AssertExpectations(t)
+}
@@ -49,27 +49,10 @@ func (h *AutobrrHandler) GetAutobrrReleaseStats(c *gin.Context) {
 		Str("instanceId", instanceId).
 		Msg("GetAutobrrReleaseStats called")
 
-	cacheKey := statsPrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var stats autobrr.AutobrrStats
-	err := h.store.Get(ctx, cacheKey, &stats)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Interface("stats", stats).
-			Msg("Serving Autobrr release stats from cache")
-
-		c.JSON(http.StatusOK, stats)
-
-		// Refresh cache in background without delay
-		go h.refreshStatsCache(instanceId, cacheKey)
-		return
-	}
-
-	// If not in cache, fetch from service
-	stats, err = h.fetchAndCacheStats(instanceId, cacheKey)
+	// Serve from cache, refreshing in the background once it expires
+	stats, err := cache.Fetch(c.Request.Context(), h.store, statsPrefix+instanceId, autobrrStatsCacheDuration, func(context.Context) (autobrr.AutobrrStats, error) {
+		return h.fetchStats(instanceId)
+	})
 	if err != nil {
 		if err.Error() == "service not configured" {
 			// Return empty response for unconfigured service
@@ -94,7 +77,7 @@ func (h *AutobrrHandler) GetAutobrrReleaseStats(c *gin.Context) {
 	log.Debug().
 		Str("instanceId", instanceId).
 		Interface("stats", stats).
-		Msg("Successfully retrieved and cached autobrr release stats")
+		Msg("Retrieved autobrr release stats")
 
 	c.JSON(http.StatusOK, stats)
 }
@@ -107,25 +90,10 @@ func (h *AutobrrHandler) GetAutobrrIRCStatus(c *gin.Context) {
 		return
 	}
 
-	cacheKey := ircPrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var status []autobrr.IRCStatus
-	err := h.store.Get(ctx, cacheKey, &status)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Msg("Serving Autobrr IRC status from cache")
-		c.JSON(http.StatusOK, status)
-
-		// Refresh cache in background without delay
-		go h.refreshIRCCache(instanceId, cacheKey)
-		return
-	}
-
-	// If not in cache, fetch from service
-	status, err = h.fetchAndCacheIRC(instanceId, cacheKey)
+	// Serve from cache, refreshing in the background once it expires
+	status, err := cache.Fetch(c.Request.Context(), h.store, ircPrefix+instanceId, autobrrIRCCacheDuration, func(context.Context) ([]autobrr.IRCStatus, error) {
+		return h.fetchIRC(instanceId)
+	})
 	if err != nil {
 		if err.Error() == "service not configured" {
 			// Return empty response for unconfigured service
@@ -146,12 +114,13 @@ func (h *AutobrrHandler) GetAutobrrIRCStatus(c *gin.Context) {
 
 	log.Debug().
 		Str("instanceId", instanceId).
-		Msg("Successfully retrieved and cached Autobrr IRC status")
+		Msg("Retrieved Autobrr IRC status")
 
 	c.JSON(http.StatusOK, status)
 }
 
-func (h *AutobrrHandler) fetchAndCacheStats(instanceId, cacheKey string) (autobrr.AutobrrStats, error) {
+// fetchStats fetches the release stats of an autobrr instance
+func (h *AutobrrHandler) fetchStats(instanceId string) (autobrr.AutobrrStats, error) {
 	autobrrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		return autobrr.AutobrrStats{}, err
@@ -165,24 +134,11 @@ func (h *AutobrrHandler) fetchAndCacheStats(instanceId, cacheKey string) (autobr
 		ServiceCore: core.ServiceCore{},
 	}
 
-	stats, err := service.GetReleaseStats(autobrrConfig.URL, autobrrConfig.APIKey)
-	if err != nil {
-		return autobrr.AutobrrStats{}, err
-	}
-
-	// Cache the results
-	ctx := context.Background()
-	if err := h.store.Set(ctx, cacheKey, stats, autobrrStatsCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Autobrr release stats")
-	}
-
-	return stats, nil
+	return service.GetReleaseStats(autobrrConfig.URL, autobrrConfig.APIKey)
 }
 
-func (h *AutobrrHandler) fetchAndCacheIRC(instanceId, cacheKey string) ([]autobrr.IRCStatus, error) {
+// fetchIRC fetches the IRC network status of an autobrr instance
+func (h *AutobrrHandler) fetchIRC(instanceId string) ([]autobrr.IRCStatus, error) {
 	autobrrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		return nil, err
@@ -196,49 +152,5 @@ func (h *AutobrrHandler) fetchAndCacheIRC(instanceId, cacheKey string) ([]autobr
 		ServiceCore: core.ServiceCore{},
 	}
 
-	status, err := service.GetIRCStatus(autobrrConfig.URL, autobrrConfig.APIKey)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache the results
-	ctx := context.Background()
-	if err := h.store.Set(ctx, cacheKey, status, autobrrIRCCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Autobrr IRC status")
-	}
-
-	return status, nil
-}
-
-func (h *AutobrrHandler) refreshStatsCache(instanceId, cacheKey string) {
-	_, err := h.fetchAndCacheStats(instanceId, cacheKey)
-	if err != nil && err.Error() != "service not configured" {
-		log.Error().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to refresh Autobrr release stats cache")
-		return
-	}
-
-	log.Debug().
-		Str("instanceId", instanceId).
-		Msg("Successfully refreshed Autobrr release stats cache")
-}
-
-func (h *AutobrrHandler) refreshIRCCache(instanceId, cacheKey string) {
-	_, err := h.fetchAndCacheIRC(instanceId, cacheKey)
-	if err != nil && err.Error() != "service not configured" {
-		log.Error().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to refresh autobrr IRC status cache")
-		return
-	}
-
-	log.Debug().
-		Str("instanceId", instanceId).
-		Msg("Successfully refreshed autobrr IRC status cache")
+	return service.GetIRCStatus(autobrrConfig.URL, autobrrConfig.APIKey)
 }
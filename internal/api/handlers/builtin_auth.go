@@ -4,28 +4,43 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
+	"github.com/autobrr/dashbrr/internal/api/middleware"
 	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/ldap"
+	"github.com/autobrr/dashbrr/internal/services/lockout"
 	"github.com/autobrr/dashbrr/internal/types"
 	"github.com/autobrr/dashbrr/internal/utils"
 )
 
 type BuiltinAuthHandler struct {
-	db    *database.DB
-	cache cache.Store
+	db      *database.DB
+	cache   cache.Store
+	ldap    *ldap.Authenticator
+	lockout *lockout.Guard
 }
 
-func NewBuiltinAuthHandler(db *database.DB, cache cache.Store) *BuiltinAuthHandler {
+// NewBuiltinAuthHandler creates the password login handler. ldapAuth adds
+// directory logins next to local accounts and guard throttles password
+// guessing; both may be nil.
+func NewBuiltinAuthHandler(db *database.DB, cache cache.Store, ldapAuth *ldap.Authenticator, guard *lockout.Guard) *BuiltinAuthHandler {
 	return &BuiltinAuthHandler{
-		db:    db,
-		cache: cache,
+		db:      db,
+		cache:   cache,
+		ldap:    ldapAuth,
+		lockout: guard,
 	}
 }
 
@@ -43,26 +58,68 @@ func (h *BuiltinAuthHandler) CheckRegistrationStatus(c *gin.Context) {
 	})
 }
 
-// Register handles user registration
-func (h *BuiltinAuthHandler) Register(c *gin.Context) {
-	// Check if any users exist
-	hasUsers, err := h.db.HasUsers()
+// GetInvite reports whether an invite token can be used to register
+func (h *BuiltinAuthHandler) GetInvite(c *gin.Context) {
+	invite, err := h.db.GetInviteByToken(c.Param("token"))
 	if err != nil {
-		log.Error().Err(err).Msg("failed to check existing users")
+		log.Error().Err(err).Msg("failed to get invite")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
-	if hasUsers {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled. A user already exists."})
+	if invite == nil || !invite.Usable() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found or expired"})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invite.Email,
+		"role":       invite.Role,
+		"expires_at": invite.ExpiresAt,
+	})
+}
+
+// Register handles user registration. The first user registers freely and
+// becomes an admin; everyone after that needs an invite.
+func (h *BuiltinAuthHandler) Register(c *gin.Context) {
 	var req types.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
 
+	// Check if any users exist
+	hasUsers, err := h.db.HasUsers()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check existing users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	role := types.RoleAdmin
+	var invite *types.Invite
+	if hasUsers {
+		if req.InviteToken == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled. A user already exists."})
+			return
+		}
+
+		invite, err = h.db.GetInviteByToken(req.InviteToken)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get invite")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if invite == nil || !invite.Usable() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invite not found or expired"})
+			return
+		}
+		if invite.Email != "" && !strings.EqualFold(invite.Email, req.Email) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invite is for a different email address"})
+			return
+		}
+		role = invite.Role
+	}
+
 	// Validate password
 	if err := utils.ValidatePassword(req.Password); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -101,25 +158,45 @@ func (h *BuiltinAuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Create user
+	// Create user, redeeming the invite in the same transaction so it can
+	// only be used once and is kept if the user cannot be created
 	user := &types.User{
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: hashedPassword,
+		Role:         role,
 	}
 
-	if err := h.db.CreateUser(user); err != nil {
+	if invite != nil {
+		err = h.db.CreateInvitedUser(user, invite.ID)
+	} else {
+		err = h.db.CreateUser(user)
+	}
+	if errors.Is(err, database.ErrInviteUnavailable) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invite not found or expired"})
+		return
+	}
+	if err != nil {
 		log.Error().Err(err).Msg("failed to create user")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
+	recordAudit(c, h.db, models.AuditEvent{
+		Actor:   user.Username,
+		ActorID: user.ID,
+		Action:  models.AuditUserCreate,
+		Target:  user.Username,
+		Details: map[string]interface{}{"source": "register", "role": user.Role, "invite": invite != nil},
+	})
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User registered successfully",
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
 			"email":    user.Email,
+			"role":     user.Role,
 		},
 	})
 }
@@ -132,24 +209,82 @@ func (h *BuiltinAuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Get user by username
-	user, err := h.db.GetUserByUsername(req.Username)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to get user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	if h.throttled(c, req.Username) {
 		return
 	}
+
+	// Directory accounts are tried first. Local accounts stay usable when
+	// the user is not in the directory or the directory is unreachable.
+	var user *types.User
+	method := "builtin"
+	if h.ldap != nil {
+		ldapUser, err := h.ldap.Authenticate(req.Username, req.Password)
+		switch {
+		case err == nil:
+			user, err = h.provisionLDAPUser(c, ldapUser)
+			if errors.Is(err, errLDAPAccountConflict) {
+				log.Warn().Str("username", ldapUser.Username).Msg("refusing LDAP login that collides with an account outside the directory")
+				h.auditLoginFailure(c, req.Username, map[string]interface{}{"method": "ldap", "reason": "account conflict"})
+				c.JSON(http.StatusForbidden, gin.H{"error": "This username belongs to an account that is not linked to the directory"})
+				return
+			}
+			if err != nil {
+				log.Error().Err(err).Str("username", ldapUser.Username).Msg("failed to create LDAP user")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
+			method = "ldap"
+		case errors.Is(err, ldap.ErrInvalidCredentials):
+			h.recordLoginFailure(c, req.Username, "invalid password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		case errors.Is(err, ldap.ErrUserNotFound):
+		default:
+			log.Error().Err(err).Msg("LDAP authentication failed, trying local accounts")
+		}
+	}
+
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		var err error
+		user, err = h.db.GetUserByUsername(req.Username)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get user")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if user == nil {
+			h.recordLoginFailure(c, req.Username, "unknown user")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+
+		// Check password
+		if !utils.CheckPassword(req.Password, user.PasswordHash) {
+			h.recordLoginFailure(c, req.Username, "invalid password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			return
+		}
+	}
+
+	if user.Disabled {
+		h.auditLoginFailure(c, req.Username, map[string]interface{}{"method": "builtin", "reason": "account disabled"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
 		return
 	}
 
-	// Check password
-	if !utils.CheckPassword(req.Password, user.PasswordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// Accounts with two-factor authentication get a short-lived challenge
+	// instead of a session, redeemed with a code at /api/auth/login/2fa
+	if user.TOTPEnabled {
+		h.startTwoFactorChallenge(c, user, method)
 		return
 	}
 
+	h.createSession(c, user, method)
+}
+
+// createSession starts a session for an authenticated user, sets the
+// session cookie and writes the login response
+func (h *BuiltinAuthHandler) createSession(c *gin.Context, user *types.User, method string) {
 	// Generate session token
 	sessionToken, err := utils.GenerateSecureToken(32)
 	if err != nil {
@@ -159,7 +294,20 @@ func (h *BuiltinAuthHandler) Login(c *gin.Context) {
 	}
 
 	// Create session
-	expiresAt := time.Now().Add(24 * time.Hour)
+	expiresAt := time.Now().Add(types.SessionTTL)
+	session := &types.Session{
+		UserID:    user.ID,
+		Device:    utils.DeviceName(c.Request.UserAgent()),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		ExpiresAt: expiresAt,
+	}
+	if err := h.db.CreateSession(session, sessionToken); err != nil {
+		log.Error().Err(err).Msg("failed to record session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
 	sessionData := types.SessionData{
 		AccessToken: sessionToken,
 		TokenType:   "Bearer",
@@ -181,12 +329,26 @@ func (h *BuiltinAuthHandler) Login(c *gin.Context) {
 		"session",
 		sessionToken,
 		int(time.Until(expiresAt).Seconds()),
-		"/",
+		middleware.CookiePath(c),
 		"",
 		true, // Secure
 		true, // HttpOnly
 	)
 
+	if h.lockout != nil {
+		if err := h.lockout.Reset(user.Username); err != nil {
+			log.Error().Err(err).Str("username", user.Username).Msg("failed to reset login failures")
+		}
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Actor:   user.Username,
+		ActorID: user.ID,
+		Action:  models.AuditLogin,
+		Target:  user.Username,
+		Details: map[string]interface{}{"method": method, "two_factor": user.TOTPEnabled},
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"access_token": sessionToken,
 		"token_type":   "Bearer",
@@ -195,10 +357,161 @@ func (h *BuiltinAuthHandler) Login(c *gin.Context) {
 			"id":       user.ID,
 			"username": user.Username,
 			"email":    user.Email,
+			"role":     user.Role,
 		},
 	})
 }
 
+// errLDAPAccountConflict is returned when a directory login collides with
+// an account that was not created by the directory
+var errLDAPAccountConflict = errors.New("username or email belongs to an account outside the directory")
+
+// provisionLDAPUser returns the local account for a directory user,
+// creating it on first login. Directory users have no local password.
+// When groups are mapped to roles the role follows the directory groups.
+// Only accounts the directory created are reused; a directory user whose
+// username or email belongs to any other account is refused.
+func (h *BuiltinAuthHandler) provisionLDAPUser(c *gin.Context, ldapUser *ldap.User) (*types.User, error) {
+	mapping := h.ldap.RoleMapping()
+
+	user, err := h.db.GetUserByUsername(ldapUser.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil {
+		switch user.AuthSource {
+		case types.AuthSourceLDAP:
+		case types.AuthSourceExternal:
+			// Passwordless accounts from before sources were recorded
+			// are claimed by the directory
+			if err := h.db.UpdateUserAuthSource(user.ID, types.AuthSourceLDAP); err != nil {
+				return nil, err
+			}
+			user.AuthSource = types.AuthSourceLDAP
+		default:
+			return nil, errLDAPAccountConflict
+		}
+	}
+
+	if user == nil {
+		email := ldapUser.Email
+		if email == "" {
+			email = ldapUser.Username
+		}
+		existing, err := h.db.GetUserByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, errLDAPAccountConflict
+		}
+
+		hasUsers, err := h.db.HasUsers()
+		if err != nil {
+			return nil, err
+		}
+
+		user = &types.User{
+			Username:   ldapUser.Username,
+			Email:      email,
+			Role:       mapping.InitialRole(ldapUser.Groups, !hasUsers),
+			AuthSource: types.AuthSourceLDAP,
+		}
+		if err := h.db.CreateUser(user); err != nil {
+			return nil, err
+		}
+
+		log.Info().Str("username", user.Username).Str("role", user.Role).Msg("created user from LDAP login")
+		recordAudit(c, h.db, models.AuditEvent{
+			Actor:   "ldap",
+			Action:  models.AuditUserCreate,
+			Target:  user.Username,
+			Details: map[string]interface{}{"method": "ldap", "role": user.Role},
+		})
+		return user, nil
+	}
+
+	if mapping.MapsGroups() {
+		if role := mapping.RoleForGroups(ldapUser.Groups); role != user.Role {
+			if err := h.db.UpdateUserRole(user.ID, role); err != nil {
+				return nil, err
+			}
+			recordAudit(c, h.db, models.AuditEvent{
+				Actor:   "ldap",
+				Action:  models.AuditUserRoleChange,
+				Target:  user.Username,
+				Changes: map[string]models.AuditChange{"role": {Before: user.Role, After: role}},
+			})
+			user.Role = role
+		}
+	}
+
+	return user, nil
+}
+
+// recordLoginFailure counts a failed login against the username and stores
+// it in the audit log together with the client IP
+func (h *BuiltinAuthHandler) recordLoginFailure(c *gin.Context, username, reason string) {
+	details := map[string]interface{}{"method": "builtin", "reason": reason}
+
+	if h.lockout != nil {
+		state, locked, err := h.lockout.Fail(username, c.ClientIP())
+		if err != nil {
+			log.Error().Err(err).Str("username", username).Msg("failed to record login failure")
+		} else {
+			details["failures"] = state.Failures
+			if locked {
+				recordAudit(c, h.db, models.AuditEvent{
+					Actor:   username,
+					Action:  models.AuditLockout,
+					Target:  username,
+					Status:  models.AuditStatusFailure,
+					Details: map[string]interface{}{"failures": state.Failures, "locked_until": state.LockedUntil},
+				})
+			}
+		}
+	}
+
+	h.auditLoginFailure(c, username, details)
+}
+
+// auditLoginFailure stores a failed login attempt in the audit log
+func (h *BuiltinAuthHandler) auditLoginFailure(c *gin.Context, username string, details map[string]interface{}) {
+	recordAudit(c, h.db, models.AuditEvent{
+		Actor:   username,
+		Action:  models.AuditLoginFailed,
+		Target:  username,
+		Status:  models.AuditStatusFailure,
+		Details: details,
+	})
+}
+
+// throttled refuses a login attempt while the username is backing off or
+// locked out. Unknown usernames are throttled the same way.
+func (h *BuiltinAuthHandler) throttled(c *gin.Context, username string) bool {
+	if h.lockout == nil {
+		return false
+	}
+
+	wait, err := h.lockout.RetryAfter(username)
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to check login lockout")
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Please try again later.",
+		"retry_after": seconds,
+	})
+	return true
+}
+
 // Verify verifies the session token
 func (h *BuiltinAuthHandler) Verify(c *gin.Context) {
 	// Get session cookie
@@ -221,12 +534,25 @@ func (h *BuiltinAuthHandler) Verify(c *gin.Context) {
 		return
 	}
 
-	// Check if session is expired
+	// Check if session is expired or was revoked
 	if time.Now().After(sessionData.ExpiresAt) {
 		_ = h.cache.Delete(c, sessionKey)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
 		return
 	}
+	if sessionData.UserID != 0 {
+		session, err := h.db.GetSessionByToken(sessionToken)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get session")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if session == nil {
+			_ = h.cache.Delete(c, sessionKey)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Token is valid",
@@ -245,48 +571,50 @@ func (h *BuiltinAuthHandler) Logout(c *gin.Context) {
 
 	// Delete session from cache
 	sessionKey := fmt.Sprintf("session:%s", sessionToken)
+	var sessionData types.SessionData
+	if err := h.cache.Get(c, sessionKey, &sessionData); err == nil && sessionData.UserID != 0 {
+		c.Set("user_id", sessionData.UserID)
+		recordAudit(c, h.db, models.AuditEvent{Action: models.AuditLogout})
+	}
 	if err := h.cache.Delete(c, sessionKey); err != nil && err != cache.ErrKeyNotFound {
 		log.Error().Err(err).Msg("failed to delete session from cache")
 	}
+	if err := h.db.DeleteSessionByToken(sessionToken); err != nil {
+		log.Error().Err(err).Msg("failed to delete session")
+	}
+
+	clearSessionCookie(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
 
-	// Clear session cookie
+// clearSessionCookie removes the session cookie from the browser
+func clearSessionCookie(c *gin.Context) {
 	c.SetCookie(
 		"session",
 		"",
 		-1,
-		"/",
+		middleware.CookiePath(c),
 		"",
 		true,
 		true,
 	)
-
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
 // GetUserInfo returns the current user's information
 func (h *BuiltinAuthHandler) GetUserInfo(c *gin.Context) {
-	// Get session cookie
-	sessionToken, err := c.Cookie("session")
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "No session found"})
-		return
-	}
-
-	// Get session from cache
-	sessionKey := fmt.Sprintf("session:%s", sessionToken)
-	var sessionData types.SessionData
-	if err := h.cache.Get(c, sessionKey, &sessionData); err != nil {
-		if err == cache.ErrKeyNotFound {
-			log.Debug().Msg("session not found or expired")
-		} else {
-			log.Error().Err(err).Msg("failed to get session from cache")
+	// Proxy-authenticated requests and API tokens carry no session cookie
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		sessionData, ok := h.sessionFromCookie(c)
+		if !ok {
+			return
 		}
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found"})
-		return
+		userID = sessionData.UserID
 	}
 
 	// Get user from database
-	user, err := h.db.GetUserByID(sessionData.UserID)
+	user, err := h.db.GetUserByID(userID)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get user")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -301,5 +629,30 @@ func (h *BuiltinAuthHandler) GetUserInfo(c *gin.Context) {
 		"id":       user.ID,
 		"username": user.Username,
 		"email":    user.Email,
+		"role":     user.Role,
 	})
 }
+
+// sessionFromCookie loads the built-in session named by the session cookie,
+// responding with 401 when there is none
+func (h *BuiltinAuthHandler) sessionFromCookie(c *gin.Context) (types.SessionData, bool) {
+	var sessionData types.SessionData
+
+	sessionToken, err := c.Cookie("session")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No session found"})
+		return sessionData, false
+	}
+
+	sessionKey := fmt.Sprintf("session:%s", sessionToken)
+	if err := h.cache.Get(c, sessionKey, &sessionData); err != nil {
+		if err == cache.ErrKeyNotFound {
+			log.Debug().Msg("session not found or expired")
+		} else {
+			log.Error().Err(err).Msg("failed to get session from cache")
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found"})
+		return sessionData, false
+	}
+	return sessionData, true
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/ldap"
+	"github.com/autobrr/dashbrr/internal/services/ldap/ldaptest"
+	"github.com/autobrr/dashbrr/internal/services/lockout"
+	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
+)
+
+func TestBuiltinAuthHandler_LDAPLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	directory := ldaptest.NewServer(t)
+	directory.AddEntry("uid=search,ou=people,dc=example,dc=com", "search-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"search"},
+	})
+	directory.AddEntry("uid=alice,ou=people,dc=example,dc=com", "alice-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"alice"},
+		"mail":        {"alice@example.com"},
+	})
+	directory.AddEntry("cn=media,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass": {"groupOfUniqueNames"},
+		"cn":          {"media"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=com"},
+	})
+	directory.AddEntry("uid=ops,ou=people,dc=example,dc=com", "directory-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"ops"},
+	})
+	directory.AddEntry("uid=bob,ou=people,dc=example,dc=com", "bob-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob"},
+		"mail":        {"admin@example.com"},
+	})
+	directory.AddEntry("uid=carol,ou=people,dc=example,dc=com", "carol-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"carol"},
+	})
+
+	hash, err := utils.HashPassword("Local123!")
+	require.NoError(t, err)
+	require.NoError(t, db.CreateUser(&types.User{Username: "localadmin", Email: "admin@example.com", PasswordHash: hash, Role: types.RoleAdmin}))
+	require.NoError(t, db.CreateUser(&types.User{Username: "ops", Email: "ops@example.com", PasswordHash: hash, Role: types.RoleAdmin}))
+	require.NoError(t, db.CreateUser(&types.User{Username: "carol", Email: "carol", AuthSource: types.AuthSourceExternal}))
+
+	handler := NewBuiltinAuthHandler(db, store, ldap.New(types.LDAPConfig{
+		URL:          directory.URL,
+		BindDN:       "uid=search,ou=people,dc=example,dc=com",
+		BindPassword: "search-secret",
+		BaseDN:       "dc=example,dc=com",
+		GroupRoleMapping: types.GroupRoleMapping{
+			OperatorGroups: []string{"media"},
+		},
+	}), nil)
+	router := gin.New()
+	router.POST("/login", handler.Login)
+
+	// A directory user is created on first login with the mapped role
+	w := performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "alice-secret"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	alice, err := db.GetUserByUsername("alice")
+	require.NoError(t, err)
+	require.NotNil(t, alice)
+	assert.Equal(t, "alice@example.com", alice.Email)
+	assert.Equal(t, types.RoleOperator, alice.Role)
+	assert.Equal(t, types.AuthSourceLDAP, alice.AuthSource)
+	assert.Empty(t, alice.PasswordHash)
+
+	// Logging in again reuses the account
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "alice-secret"})
+	require.Equal(t, http.StatusOK, w.Code)
+	users, err := db.ListUsers()
+	require.NoError(t, err)
+	assert.Len(t, users, 4)
+
+	// Directory users never sign into local accounts, by username or email
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "ops", "password": "directory-secret"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "bob", "password": "bob-secret"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	ops, err := db.GetUserByUsername("ops")
+	require.NoError(t, err)
+	assert.Equal(t, types.RoleAdmin, ops.Role)
+	assert.Equal(t, types.AuthSourceLocal, ops.AuthSource)
+	bob, err := db.GetUserByUsername("bob")
+	require.NoError(t, err)
+	assert.Nil(t, bob)
+
+	// Passwordless accounts from before sources were recorded are claimed
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "carol", "password": "carol-secret"})
+	require.Equal(t, http.StatusOK, w.Code)
+	carol, err := db.GetUserByUsername("carol")
+	require.NoError(t, err)
+	assert.Equal(t, types.AuthSourceLDAP, carol.AuthSource)
+
+	// Wrong directory passwords are rejected
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Local accounts keep working next to the directory
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "localadmin", "password": "Local123!"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Disabled accounts stay disabled even with valid directory credentials
+	require.NoError(t, db.SetUserDisabled(alice.ID, true))
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "alice-secret"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestBuiltinAuthHandler_TwoFactorLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	hash, err := utils.HashPassword("Secret123!")
+	require.NoError(t, err)
+	user := &types.User{Username: "alice", Email: "alice@example.com", PasswordHash: hash, Role: types.RoleAdmin}
+	require.NoError(t, db.CreateUser(user))
+
+	handler := NewBuiltinAuthHandler(db, store, nil, nil)
+	router := gin.New()
+	router.POST("/login", handler.Login)
+	router.POST("/login/2fa", handler.LoginTwoFactor)
+	signedIn := router.Group("", func(c *gin.Context) {
+		c.Set("auth_type", "builtin")
+		c.Set("user_id", user.ID)
+	})
+	signedIn.POST("/2fa/setup", handler.SetupTwoFactor)
+	signedIn.POST("/2fa/enable", handler.EnableTwoFactor)
+
+	// Enroll: the secret is confirmed with a code before it is stored
+	w := performJSON(router, http.MethodPost, "/2fa/setup", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var setup struct {
+		Secret     string `json:"secret"`
+		OTPAuthURL string `json:"otpauth_url"`
+		QRCode     string `json:"qr_code"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &setup))
+	assert.Contains(t, setup.OTPAuthURL, "otpauth://totp/")
+	assert.Contains(t, setup.QRCode, "data:image/png;base64,")
+
+	w = performJSON(router, http.MethodPost, "/2fa/enable", gin.H{"code": "000000"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	code, err := totp.GenerateCode(setup.Secret, time.Now())
+	require.NoError(t, err)
+	w = performJSON(router, http.MethodPost, "/2fa/enable", gin.H{"code": code})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var enabled struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enabled))
+	require.Len(t, enabled.RecoveryCodes, recoveryCodeCount)
+
+	// The password alone only yields a challenge
+	login := func() string {
+		w := performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "Secret123!"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			Challenge         string `json:"challenge"`
+			AccessToken       string `json:"access_token"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.True(t, resp.TwoFactorRequired)
+		require.Empty(t, resp.AccessToken)
+		return resp.Challenge
+	}
+	challenge := login()
+
+	w = performJSON(router, http.MethodPost, "/login/2fa", gin.H{"challenge": challenge, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The code used for enrollment cannot be replayed
+	w = performJSON(router, http.MethodPost, "/login/2fa", gin.H{"challenge": challenge, "code": code})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Recovery codes work once
+	w = performJSON(router, http.MethodPost, "/login/2fa", gin.H{"challenge": challenge, "recovery_code": enabled.RecoveryCodes[0]})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "access_token")
+
+	// Challenges are single use
+	w = performJSON(router, http.MethodPost, "/login/2fa", gin.H{"challenge": challenge, "recovery_code": enabled.RecoveryCodes[1]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	challenge = login()
+	w = performJSON(router, http.MethodPost, "/login/2fa", gin.H{"challenge": challenge, "recovery_code": enabled.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Too many wrong codes invalidate the challenge
+	for i := 1; i < twoFactorMaxAttempts; i++ {
+		performJSON(router, http.MethodPost, "/login/2fa", gin.H{"challenge": challenge, "code": "000000"})
+	}
+	w = performJSON(router, http.MethodPost, "/login/2fa", gin.H{"challenge": challenge, "recovery_code": enabled.RecoveryCodes[1]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestBuiltinAuthHandler_Lockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	hash, err := utils.HashPassword("Secret123!")
+	require.NoError(t, err)
+	require.NoError(t, db.CreateUser(&types.User{Username: "alice", Email: "alice@example.com", PasswordHash: hash, Role: types.RoleAdmin}))
+
+	handler := NewBuiltinAuthHandler(db, store, nil, lockout.New(db, types.LockoutConfig{Threshold: 3, Duration: time.Hour}))
+	router := gin.New()
+	router.POST("/login", handler.Login)
+
+	// Two failures stay below the backoff
+	for i := 0; i < 2; i++ {
+		w := performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "wrong"})
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w := performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "wrong"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Once locked, even the right password is refused
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "Secret123!"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	events, err := db.ListAuditEvents(models.AuditFilter{Action: models.AuditLoginFailed})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.NotEmpty(t, events[0].IP)
+
+	events, err = db.ListAuditEvents(models.AuditFilter{Action: models.AuditLockout})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	// Unlocking lets the user sign in again
+	_, err = db.DeleteLoginLockout("alice")
+	require.NoError(t, err)
+	w = performJSON(router, http.MethodPost, "/login", gin.H{"username": "alice", "password": "Secret123!"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
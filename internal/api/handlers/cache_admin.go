@@ -0,0 +1,108 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/services/cache"
+)
+
+// sessionPrefixes are the key prefixes of signed-in sessions, which are
+// never listed or purged through the cache endpoints
+var sessionPrefixes = []string{"session:", "oidc:session:"}
+
+type CacheAdminHandler struct {
+	db    *database.DB
+	store cache.Store
+}
+
+func NewCacheAdminHandler(db *database.DB, store cache.Store) *CacheAdminHandler {
+	return &CacheAdminHandler{
+		db:    db,
+		store: store,
+	}
+}
+
+// cachePurgeRequest selects the keys to purge
+type cachePurgeRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+// GetStats returns the counters of the cache store and how many keys it
+// holds per prefix
+func (h *CacheAdminHandler) GetStats(c *gin.Context) {
+	stats, err := h.store.Stats(c.Request.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get cache stats")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cache stats"})
+		return
+	}
+
+	keys, err := h.store.Keys(c.Request.Context(), "")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list cache keys")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list cache keys"})
+		return
+	}
+
+	prefixes := map[string]int{}
+	for _, key := range keys {
+		prefix, _, found := strings.Cut(key, ":")
+		if found {
+			prefix += ":"
+		}
+		prefixes[prefix]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stats":    stats,
+		"prefixes": prefixes,
+	})
+}
+
+// Purge removes the cached values whose keys start with a prefix
+func (h *CacheAdminHandler) Purge(c *gin.Context) {
+	var req cachePurgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A key prefix is required"})
+		return
+	}
+	if purgesSessions(req.Prefix) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sessions cannot be purged from the cache"})
+		return
+	}
+
+	deleted, err := h.store.DeletePrefix(c.Request.Context(), req.Prefix)
+	if err != nil {
+		log.Error().Err(err).Str("prefix", req.Prefix).Msg("Failed to purge cache")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge cache"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditCachePurge,
+		Target:  req.Prefix,
+		Details: map[string]interface{}{"deleted": deleted},
+	})
+
+	log.Info().Str("prefix", req.Prefix).Int("deleted", deleted).Msg("Purged cache")
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// purgesSessions reports whether purging prefix would sign users out
+func purgesSessions(prefix string) bool {
+	for _, session := range sessionPrefixes {
+		if strings.HasPrefix(session, prefix) || strings.HasPrefix(prefix, session) {
+			return true
+		}
+	}
+	return false
+}
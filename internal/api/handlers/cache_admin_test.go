@@ -0,0 +1,62 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/services/cache"
+)
+
+func TestCacheAdminHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+	store := cache.NewMemoryStore(t.TempDir())
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "sonarr:queue:1", "queue", time.Minute))
+	require.NoError(t, store.Set(ctx, "sonarr:stats:1", "stats", time.Minute))
+	require.NoError(t, store.Set(ctx, "radarr:queue:1", "queue", time.Minute))
+	require.NoError(t, store.Set(ctx, "session:token", "session", time.Minute))
+
+	handler := NewCacheAdminHandler(db, store)
+	router := gin.New()
+	router.GET("/admin/cache", handler.GetStats)
+	router.POST("/admin/cache/purge", handler.Purge)
+
+	w := performJSON(router, http.MethodGet, "/admin/cache", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Stats    cache.Stats    `json:"stats"`
+		Prefixes map[string]int `json:"prefixes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "memory", resp.Stats.Backend)
+	assert.Equal(t, 2, resp.Prefixes["sonarr:"])
+	assert.Equal(t, 1, resp.Prefixes["radarr:"])
+
+	// A prefix is required and sessions cannot be purged
+	w = performJSON(router, http.MethodPost, "/admin/cache/purge", gin.H{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = performJSON(router, http.MethodPost, "/admin/cache/purge", gin.H{"prefix": "sess"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(router, http.MethodPost, "/admin/cache/purge", gin.H{"prefix": "sonarr:"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted":2}`, w.Body.String())
+
+	var value string
+	assert.Equal(t, cache.ErrKeyNotFound, store.Get(ctx, "sonarr:queue:1", &value))
+	assert.NoError(t, store.Get(ctx, "radarr:queue:1", &value))
+	assert.NoError(t, store.Get(ctx, "session:token", &value))
+}
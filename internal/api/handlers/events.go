@@ -70,6 +70,22 @@ func safeClose(ch chan struct{}) {
 	}
 }
 
+// checkDue reports whether a service with its own check interval is due
+// for a health check. Other services are checked on every run.
+func checkDue(service models.ServiceConfiguration) bool {
+	if service.CheckInterval <= 0 {
+		return true
+	}
+
+	lastChecksMu.RLock()
+	lastCheck, ok := lastChecks[service.InstanceID]
+	lastChecksMu.RUnlock()
+
+	// Allow for runs of the monitor arriving slightly early
+	interval := time.Duration(service.CheckInterval) * time.Second
+	return !ok || time.Since(lastCheck) >= interval-time.Second
+}
+
 // checkAndBroadcastHealth performs health checks for all services and broadcasts results
 func (h *EventsHandler) checkAndBroadcastHealth(ctx context.Context) []models.ServiceHealth {
 	services, err := h.db.GetAllServices()
@@ -101,7 +117,7 @@ func (h *EventsHandler) checkAndBroadcastHealth(ctx context.Context) []models.Se
 
 		batch := services[i:end]
 		for _, service := range batch {
-			if service.URL == "" {
+			if service.URL == "" || !checkDue(service) {
 				continue
 			}
 
@@ -305,7 +321,11 @@ func (h *EventsHandler) StartHealthMonitor() {
 
 		go h.checkAndBroadcastHealth(monitorCtx)
 
-		healthMonitor = time.NewTicker(30 * time.Second)
+		interval := services.DefaultCheckInterval
+		if h.health != nil && h.health.CheckInterval > 0 {
+			interval = h.health.CheckInterval
+		}
+		healthMonitor = time.NewTicker(interval)
 		go func() {
 			for {
 				select {
@@ -20,9 +20,8 @@ import (
 )
 
 const (
-	defaultTimeout = 10 * time.Second
-	cacheDuration  = 30 * time.Second
-	cachePrefix    = "maintainerr:collections:"
+	cacheDuration = 30 * time.Second
+	cachePrefix   = "maintainerr:collections:"
 )
 
 type MaintainerrHandler struct {
@@ -90,26 +89,10 @@ func (h *MaintainerrHandler) GetMaintainerrCollections(c *gin.Context) {
 		return
 	}
 
-	cacheKey := cachePrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var collections []maintainerr.Collection
-	err := h.cache.Get(ctx, cacheKey, &collections)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("count", len(collections)).
-			Msg("Serving Maintainerr collections from cache")
-		c.JSON(http.StatusOK, collections)
-
-		// Refresh cache in background if needed
-		go h.refreshCollectionsCache(instanceId, cacheKey)
-		return
-	}
-
-	// If not in cache, fetch from service
-	collections, err = h.fetchAndCacheCollections(instanceId, cacheKey)
+	// Serve from cache, refreshing in the background once it expires
+	collections, err := cache.Fetch(c.Request.Context(), h.cache, cachePrefix+instanceId, cacheDuration, func(context.Context) ([]maintainerr.Collection, error) {
+		return h.fetchCollections(instanceId)
+	})
 	if err != nil {
 		if err.Error() == "service not configured" {
 			// Return empty response for unconfigured service
@@ -135,15 +118,13 @@ func (h *MaintainerrHandler) GetMaintainerrCollections(c *gin.Context) {
 	log.Debug().
 		Int("count", len(collections)).
 		Str("instanceId", instanceId).
-		Msg("Successfully retrieved and cached Maintainerr collections")
+		Msg("Retrieved Maintainerr collections")
 
 	c.JSON(http.StatusOK, collections)
 }
 
-func (h *MaintainerrHandler) fetchAndCacheCollections(instanceId, cacheKey string) ([]maintainerr.Collection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
-
+// fetchCollections fetches the collections of a Maintainerr instance
+func (h *MaintainerrHandler) fetchCollections(instanceId string) ([]maintainerr.Collection, error) {
 	maintainerrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get service config: %w", err)
@@ -154,42 +135,5 @@ func (h *MaintainerrHandler) fetchAndCacheCollections(instanceId, cacheKey strin
 	}
 
 	service := &maintainerr.MaintainerrService{}
-	collections, err := service.GetCollections(maintainerrConfig.URL, maintainerrConfig.APIKey)
-	if err != nil {
-		return nil, err // Pass through the ErrMaintainerr
-	}
-
-	// Only cache successful responses
-	if err := h.cache.Set(ctx, cacheKey, collections, cacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Maintainerr collections")
-	}
-
-	return collections, nil
-}
-
-func (h *MaintainerrHandler) refreshCollectionsCache(instanceId, cacheKey string) {
-	// Add a small delay to prevent immediate refresh
-	time.Sleep(100 * time.Millisecond)
-
-	collections, err := h.fetchAndCacheCollections(instanceId, cacheKey)
-	if err != nil {
-		if err.Error() != "service not configured" {
-			status, message := determineErrorResponse(err)
-			log.Error().
-				Err(err).
-				Str("instanceId", instanceId).
-				Int("status", status).
-				Str("message", message).
-				Msg("Failed to refresh Maintainerr collections cache")
-		}
-		return
-	}
-
-	log.Debug().
-		Str("instanceId", instanceId).
-		Int("count", len(collections)).
-		Msg("Successfully refreshed Maintainerr collections cache")
+	return service.GetCollections(maintainerrConfig.URL, maintainerrConfig.APIKey) // Errors pass through as ErrMaintainerr
 }
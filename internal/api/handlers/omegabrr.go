@@ -56,25 +56,10 @@ func (h *OmegabrrHandler) GetOmegabrrStatus(c *gin.Context) {
 		return
 	}
 
-	cacheKey := omegabrrStatusPrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var health models.ServiceHealth
-	err := h.cache.Get(ctx, cacheKey, &health)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Msg("Serving Omegabrr status from cache")
-		c.JSON(http.StatusOK, health)
-
-		// Refresh cache in background if needed
-		go h.refreshStatusCache(instanceId, cacheKey)
-		return
-	}
-
-	// If not in cache, fetch from service
-	health, err = h.fetchAndCacheStatus(instanceId, cacheKey)
+	// Serve from cache, refreshing in the background once it expires
+	health, err := cache.Fetch(c.Request.Context(), h.cache, omegabrrStatusPrefix+instanceId, omegabrrCacheDuration, func(context.Context) (models.ServiceHealth, error) {
+		return h.fetchStatus(instanceId)
+	})
 	if err != nil {
 		status := http.StatusInternalServerError
 		if err == context.DeadlineExceeded || err == context.Canceled {
@@ -89,12 +74,13 @@ func (h *OmegabrrHandler) GetOmegabrrStatus(c *gin.Context) {
 
 	log.Info().
 		Str("instanceId", instanceId).
-		Msg("Successfully retrieved and cached Omegabrr status")
+		Msg("Retrieved Omegabrr status")
 
 	c.JSON(http.StatusOK, health)
 }
 
-func (h *OmegabrrHandler) fetchAndCacheStatus(instanceId, cacheKey string) (models.ServiceHealth, error) {
+// fetchStatus fetches the health of an Omegabrr instance
+func (h *OmegabrrHandler) fetchStatus(instanceId string) (models.ServiceHealth, error) {
 	omegabrrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		return models.ServiceHealth{}, err
@@ -113,36 +99,9 @@ func (h *OmegabrrHandler) fetchAndCacheStatus(instanceId, cacheKey string) (mode
 		return models.ServiceHealth{}, fmt.Errorf("failed to get status")
 	}
 
-	// Cache the results
-	ctx := context.Background()
-	if err := h.cache.Set(ctx, cacheKey, health, omegabrrCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Omegabrr status")
-	}
-
 	return health, nil
 }
 
-func (h *OmegabrrHandler) refreshStatusCache(instanceId, cacheKey string) {
-	// Add a small delay to prevent immediate refresh
-	time.Sleep(100 * time.Millisecond)
-
-	_, err := h.fetchAndCacheStatus(instanceId, cacheKey)
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to refresh Omegabrr status cache")
-		return
-	}
-
-	log.Debug().
-		Str("instanceId", instanceId).
-		Msg("Successfully refreshed Omegabrr status cache")
-}
-
 // TriggerWebhookArrs handles webhook trigger for ARRs
 func (h *OmegabrrHandler) TriggerWebhookArrs(c *gin.Context) {
 	var req WebhookRequest
@@ -180,6 +139,12 @@ func (h *OmegabrrHandler) TriggerWebhookArrs(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditWebhookTrigger,
+		Target:  req.TargetURL,
+		Details: map[string]interface{}{"webhook": "arrs"},
+	})
+
 	log.Info().
 		Str("targetUrl", req.TargetURL).
 		Msg("Successfully triggered ARRs webhook")
@@ -227,6 +192,12 @@ func (h *OmegabrrHandler) TriggerWebhookLists(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditWebhookTrigger,
+		Target:  req.TargetURL,
+		Details: map[string]interface{}{"webhook": "lists"},
+	})
+
 	log.Info().
 		Str("targetUrl", req.TargetURL).
 		Msg("Successfully triggered Lists webhook")
@@ -274,6 +245,12 @@ func (h *OmegabrrHandler) TriggerWebhookAll(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditWebhookTrigger,
+		Target:  req.TargetURL,
+		Details: map[string]interface{}{"webhook": "all"},
+	})
+
 	log.Info().
 		Str("targetUrl", req.TargetURL).
 		Msg("Successfully triggered all webhooks")
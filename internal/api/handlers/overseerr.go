@@ -14,6 +14,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/services/cache"
 	"github.com/autobrr/dashbrr/internal/services/overseerr"
 	"github.com/autobrr/dashbrr/internal/types"
@@ -110,6 +111,16 @@ func (h *OverseerrHandler) UpdateRequestStatus(c *gin.Context) {
 		log.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to clear cache after status update")
 	}
 
+	action := models.AuditRequestDecline
+	if approve {
+		action = models.AuditRequestApprove
+	}
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  action,
+		Target:  instanceId,
+		Details: map[string]interface{}{"requestId": reqID},
+	})
+
 	c.Status(http.StatusOK)
 }
 
@@ -121,27 +132,10 @@ func (h *OverseerrHandler) GetRequests(c *gin.Context) {
 		return
 	}
 
-	cacheKey := overseerrCachePrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var response *types.RequestsStats
-	err := h.cache.Get(ctx, cacheKey, &response)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("pendingCount", response.PendingCount).
-			Int("totalRequests", len(response.Requests)).
-			Msg("Serving Overseerr requests from cache")
-		c.JSON(http.StatusOK, response)
-
-		// Refresh cache in background if needed
-		go h.refreshRequestsCache(instanceId, cacheKey)
-		return
-	}
-
-	// If not in cache, fetch from service
-	stats, err := h.fetchAndCacheRequests(instanceId, cacheKey)
+	// Serve from cache, refreshing in the background once it expires
+	stats, err := cache.Fetch(c.Request.Context(), h.cache, overseerrCachePrefix+instanceId, overseerrCacheDuration, func(context.Context) (*types.RequestsStats, error) {
+		return h.fetchRequests(instanceId)
+	})
 	if err != nil {
 		if err.Error() == "service not configured" {
 			// Return empty response for unconfigured service
@@ -167,12 +161,13 @@ func (h *OverseerrHandler) GetRequests(c *gin.Context) {
 		Str("instanceId", instanceId).
 		Int("pendingCount", stats.PendingCount).
 		Int("totalRequests", len(stats.Requests)).
-		Msg("Successfully retrieved and cached Overseerr requests")
+		Msg("Retrieved Overseerr requests")
 
 	c.JSON(http.StatusOK, stats)
 }
 
-func (h *OverseerrHandler) fetchAndCacheRequests(instanceId, cacheKey string) (*types.RequestsStats, error) {
+// fetchRequests fetches the media requests of an Overseerr instance
+func (h *OverseerrHandler) fetchRequests(instanceId string) (*types.RequestsStats, error) {
 	overseerrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		return nil, err
@@ -185,39 +180,5 @@ func (h *OverseerrHandler) fetchAndCacheRequests(instanceId, cacheKey string) (*
 	service := &overseerr.OverseerrService{}
 	service.SetDB(h.db) // Set the database instance for fetching Radarr/Sonarr configs
 
-	stats, err := service.GetRequests(overseerrConfig.URL, overseerrConfig.APIKey)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache the results
-	ctx := context.Background()
-	if err := h.cache.Set(ctx, cacheKey, stats, overseerrCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Overseerr requests")
-	}
-
-	return stats, nil
-}
-
-func (h *OverseerrHandler) refreshRequestsCache(instanceId, cacheKey string) {
-	// Add a small delay to prevent immediate refresh
-	time.Sleep(100 * time.Millisecond)
-
-	stats, err := h.fetchAndCacheRequests(instanceId, cacheKey)
-	if err != nil && err.Error() != "service not configured" {
-		log.Error().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to refresh Overseerr requests cache")
-		return
-	}
-
-	log.Debug().
-		Str("instanceId", instanceId).
-		Int("pendingCount", stats.PendingCount).
-		Int("totalRequests", len(stats.Requests)).
-		Msg("Successfully refreshed Overseerr requests cache")
+	return service.GetRequests(overseerrConfig.URL, overseerrConfig.APIKey)
 }
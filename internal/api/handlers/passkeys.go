@@ -0,0 +1,253 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/services/passkey"
+	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
+)
+
+const (
+	passkeyCeremonyTTL = 5 * time.Minute
+	passkeyNameMaxLen  = 64
+)
+
+// PasskeyHandler registers passkeys for local accounts and signs users in
+// with them
+type PasskeyHandler struct {
+	auth     *BuiltinAuthHandler
+	passkeys *passkey.Service
+}
+
+func NewPasskeyHandler(auth *BuiltinAuthHandler, passkeys *passkey.Service) *PasskeyHandler {
+	return &PasskeyHandler{
+		auth:     auth,
+		passkeys: passkeys,
+	}
+}
+
+// BeginLogin starts a passwordless login. The returned session ID is
+// passed back to FinishLogin.
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	options, session, err := h.passkeys.BeginLogin()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to start passkey login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	id, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate passkey login session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := h.auth.cache.Set(c, "webauthn:login:"+id, session, passkeyCeremonyTTL); err != nil {
+		log.Error().Err(err).Msg("failed to store passkey login session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session": id,
+		"options": options,
+	})
+}
+
+// FinishLogin verifies the authenticator's assertion and starts a session
+// for the owner of the passkey
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	// Each login session can be redeemed once. The session is claimed
+	// atomically before verifying, so concurrent submissions of the same
+	// assertion cannot both sign in.
+	id := c.Query("session")
+	key := "webauthn:login:" + id
+	var session webauthn.SessionData
+	if err := h.auth.cache.Get(c, key, &session); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please try again"})
+		return
+	}
+	claimed, err := h.auth.cache.SetNX(c, "webauthn:used:"+id, true, passkeyCeremonyTTL)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to claim passkey login session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please try again"})
+		return
+	}
+	if err := h.auth.cache.Delete(c, key); err != nil {
+		log.Error().Err(err).Msg("failed to delete passkey login session")
+	}
+
+	user, err := h.passkeys.FinishLogin(session, c.Request)
+	if err != nil {
+		if errors.Is(err, passkey.ErrInvalidCredential) || errors.Is(err, passkey.ErrUnknownCredential) {
+			log.Debug().Err(err).Msg("passkey login failed")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey"})
+			return
+		}
+		log.Error().Err(err).Msg("failed to verify passkey login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if user.Disabled {
+		h.auth.auditLoginFailure(c, user.Username, map[string]interface{}{"method": "passkey", "reason": "account disabled"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	// A passkey verifies the user on the authenticator, so it stands in
+	// for both the password and the second factor
+	h.auth.createSession(c, user, "passkey")
+}
+
+// ListPasskeys returns the passkeys of the caller
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	user, ok := h.passkeyUser(c)
+	if !ok {
+		return
+	}
+
+	passkeys, err := h.auth.db.ListPasskeys(user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list passkeys")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// BeginRegistration starts adding a passkey to the caller's account
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	user, ok := h.passkeyUser(c)
+	if !ok {
+		return
+	}
+
+	options, session, err := h.passkeys.BeginRegistration(user)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to start passkey registration")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := h.auth.cache.Set(c, fmt.Sprintf("webauthn:register:%d", user.ID), session, passkeyCeremonyTTL); err != nil {
+		log.Error().Err(err).Msg("failed to store passkey registration session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"options": options})
+}
+
+// FinishRegistration verifies the authenticator's attestation and stores
+// the passkey. The optional name query parameter labels it; the browser
+// name is used otherwise.
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	user, ok := h.passkeyUser(c)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = utils.DeviceName(c.Request.UserAgent())
+	}
+	if len(name) > passkeyNameMaxLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Passkey name must be at most %d characters", passkeyNameMaxLen)})
+		return
+	}
+
+	key := fmt.Sprintf("webauthn:register:%d", user.ID)
+	var session webauthn.SessionData
+	if err := h.auth.cache.Get(c, key, &session); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey registration expired, please try again"})
+		return
+	}
+	if err := h.auth.cache.Delete(c, key); err != nil {
+		log.Error().Err(err).Msg("failed to delete passkey registration session")
+	}
+
+	created, err := h.passkeys.FinishRegistration(user, session, name, c.Request)
+	if err != nil {
+		if errors.Is(err, passkey.ErrInvalidCredential) {
+			log.Debug().Err(err).Msg("passkey registration failed")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey could not be verified"})
+			return
+		}
+		log.Error().Err(err).Msg("failed to register passkey")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		return
+	}
+
+	recordAudit(c, h.auth.db, models.AuditEvent{
+		Action:  models.AuditPasskeyCreate,
+		Target:  user.Username,
+		Details: map[string]interface{}{"passkey_id": created.ID, "name": created.Name},
+	})
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// DeletePasskey removes one of the caller's passkeys
+func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	user, ok := h.passkeyUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	existing, err := h.auth.db.GetPasskeyByID(id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get passkey")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if existing == nil || existing.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	if err := h.auth.db.DeletePasskey(existing.ID); err != nil {
+		log.Error().Err(err).Msg("failed to delete passkey")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+
+	recordAudit(c, h.auth.db, models.AuditEvent{
+		Action:  models.AuditPasskeyDelete,
+		Target:  user.Username,
+		Details: map[string]interface{}{"passkey_id": existing.ID, "name": existing.Name},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted"})
+}
+
+// passkeyUser returns the local account of the caller. Passkeys sign in
+// to local accounts, so sessions from other providers are refused.
+func (h *PasskeyHandler) passkeyUser(c *gin.Context) (*types.User, bool) {
+	return h.auth.localUser(c, "Passkeys are only available for local accounts")
+}
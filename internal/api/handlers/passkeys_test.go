@@ -0,0 +1,211 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/passkey"
+	"github.com/autobrr/dashbrr/internal/services/passkey/passkeytest"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestPasskeyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+	memory := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { memory.Close() })
+	store := &barrierStore{Store: memory}
+
+	user := &types.User{Username: "alice", Email: "alice@example.com", Role: types.RoleAdmin}
+	require.NoError(t, db.CreateUser(user))
+
+	service, err := passkey.New(db, types.WebAuthnConfig{RPID: "dashbrr.example.com"})
+	require.NoError(t, err)
+	handler := NewPasskeyHandler(NewBuiltinAuthHandler(db, store, nil, nil), service)
+
+	authType := "builtin"
+	router := gin.New()
+	router.POST("/passkey/login/begin", handler.BeginLogin)
+	router.POST("/passkey/login/finish", handler.FinishLogin)
+	signedIn := router.Group("", func(c *gin.Context) {
+		c.Set("auth_type", authType)
+		c.Set("user_id", user.ID)
+	})
+	signedIn.GET("/passkeys", handler.ListPasskeys)
+	signedIn.POST("/passkeys/register/begin", handler.BeginRegistration)
+	signedIn.POST("/passkeys/register/finish", handler.FinishRegistration)
+	signedIn.DELETE("/passkeys/:id", handler.DeletePasskey)
+
+	authenticator := passkeytest.New("https://dashbrr.example.com")
+
+	// Register a passkey
+	w := performJSON(router, http.MethodPost, "/passkeys/register/begin", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var creation struct {
+		Options protocol.CredentialCreation `json:"options"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &creation))
+	attestation, err := authenticator.Register(creation.Options)
+	require.NoError(t, err)
+
+	w = performJSON(router, http.MethodPost, "/passkeys/register/finish?name=YubiKey", json.RawMessage(attestation))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created types.Passkey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "YubiKey", created.Name)
+	assert.NotContains(t, w.Body.String(), "credential\"")
+
+	// The registration session is used up
+	w = performJSON(router, http.MethodPost, "/passkeys/register/finish", json.RawMessage(attestation))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(router, http.MethodGet, "/passkeys", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var passkeys []types.Passkey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &passkeys))
+	require.Len(t, passkeys, 1)
+
+	// Sign in without a password
+	login := func(authenticator *passkeytest.Authenticator) *pendingPasskeyLogin {
+		w := performJSON(router, http.MethodPost, "/passkey/login/begin", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var begin struct {
+			Session string                       `json:"session"`
+			Options protocol.CredentialAssertion `json:"options"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &begin))
+		assertion, err := authenticator.Login(begin.Options)
+		require.NoError(t, err)
+		return &pendingPasskeyLogin{
+			session:   begin.Session,
+			assertion: assertion,
+		}
+	}
+
+	attempt := login(authenticator)
+	w = performJSON(router, http.MethodPost, "/passkey/login/finish?session="+attempt.session, json.RawMessage(attempt.assertion))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "access_token")
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session=")
+
+	// Login sessions cannot be replayed
+	w = performJSON(router, http.MethodPost, "/passkey/login/finish?session="+attempt.session, json.RawMessage(attempt.assertion))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Not even by submitting the same assertion concurrently, with every
+	// submission reading the login session before any redeems it. Synced
+	// passkeys have no signature counter to catch the replay.
+	synced := passkeytest.New("https://dashbrr.example.com")
+	synced.Synced = true
+	w = performJSON(router, http.MethodPost, "/passkeys/register/begin", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &creation))
+	attestation, err = synced.Register(creation.Options)
+	require.NoError(t, err)
+	w = performJSON(router, http.MethodPost, "/passkeys/register/finish?name=Phone", json.RawMessage(attestation))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	attempt = login(synced)
+	const submissions = 10
+	store.hold("webauthn:login:", submissions)
+	var wg sync.WaitGroup
+	var signedInCount atomic.Int32
+	for i := 0; i < submissions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := performJSON(router, http.MethodPost, "/passkey/login/finish?session="+attempt.session, json.RawMessage(attempt.assertion))
+			if w.Code == http.StatusOK {
+				signedInCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), signedInCount.Load())
+
+	// Disabled accounts are refused
+	require.NoError(t, db.SetUserDisabled(user.ID, true))
+	attempt = login(authenticator)
+	w = performJSON(router, http.MethodPost, "/passkey/login/finish?session="+attempt.session, json.RawMessage(attempt.assertion))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	require.NoError(t, db.SetUserDisabled(user.ID, false))
+
+	// Sessions of other providers cannot manage passkeys
+	authType = "oidc"
+	w = performJSON(router, http.MethodGet, "/passkeys", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	authType = "builtin"
+
+	// Delete the passkey
+	w = performJSON(router, http.MethodDelete, fmt.Sprintf("/passkeys/%d", created.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = performJSON(router, http.MethodDelete, fmt.Sprintf("/passkeys/%d", created.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	attempt = login(authenticator)
+	w = performJSON(router, http.MethodPost, "/passkey/login/finish?session="+attempt.session, json.RawMessage(attempt.assertion))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// pendingPasskeyLogin is a login assertion waiting to be submitted
+type pendingPasskeyLogin struct {
+	session   string
+	assertion []byte
+}
+
+// barrierStore holds reads of keys with a prefix until a number of them
+// have read, so concurrent requests all read before any of them writes
+type barrierStore struct {
+	cache.Store
+
+	mu      sync.Mutex
+	prefix  string
+	waiting int
+	release chan struct{}
+}
+
+// hold makes the next n reads of keys starting with prefix wait for each
+// other
+func (s *barrierStore) hold(prefix string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prefix, s.waiting, s.release = prefix, n, make(chan struct{})
+}
+
+func (s *barrierStore) Get(ctx context.Context, key string, value interface{}) error {
+	err := s.Store.Get(ctx, key, value)
+
+	s.mu.Lock()
+	release := s.release
+	if release == nil || !strings.HasPrefix(key, s.prefix) {
+		s.mu.Unlock()
+		return err
+	}
+	s.waiting--
+	if s.waiting == 0 {
+		close(release)
+		s.release = nil
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-release:
+	case <-time.After(5 * time.Second):
+	}
+	return err
+}
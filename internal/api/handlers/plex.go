@@ -50,26 +50,10 @@ func (h *PlexHandler) GetPlexSessions(c *gin.Context) {
 		return
 	}
 
-	cacheKey := plexCachePrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var sessions *types.PlexSessionsResponse
-	err := h.cache.Get(ctx, cacheKey, &sessions)
-	if err == nil && sessions != nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("size", sessions.MediaContainer.Size).
-			Msg("Serving Plex sessions from cache")
-		c.JSON(http.StatusOK, sessions)
-
-		// Refresh cache in background without delay
-		go h.refreshSessionsCache(instanceId, cacheKey)
-		return
-	}
-
-	// If not in cache or invalid cache data, fetch from service
-	sessions, err = h.fetchAndCacheSessions(instanceId, cacheKey)
+	// Serve from cache, refreshing in the background once it expires
+	sessions, err := cache.Fetch(c.Request.Context(), h.cache, plexCachePrefix+instanceId, plexCacheDuration, func(context.Context) (*types.PlexSessionsResponse, error) {
+		return h.fetchSessions(instanceId)
+	})
 	if err != nil {
 		if err.Error() == "service not configured" {
 			// Return empty response for unconfigured service
@@ -95,7 +79,7 @@ func (h *PlexHandler) GetPlexSessions(c *gin.Context) {
 		log.Debug().
 			Str("instanceId", instanceId).
 			Int("size", sessions.MediaContainer.Size).
-			Msg("Successfully retrieved and cached Plex sessions")
+			Msg("Retrieved Plex sessions")
 	} else {
 		log.Debug().
 			Str("instanceId", instanceId).
@@ -105,7 +89,8 @@ func (h *PlexHandler) GetPlexSessions(c *gin.Context) {
 	c.JSON(http.StatusOK, sessions)
 }
 
-func (h *PlexHandler) fetchAndCacheSessions(instanceId, cacheKey string) (*types.PlexSessionsResponse, error) {
+// fetchSessions fetches the active sessions of a Plex instance
+func (h *PlexHandler) fetchSessions(instanceId string) (*types.PlexSessionsResponse, error) {
 	plexConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		return nil, err
@@ -130,36 +115,5 @@ func (h *PlexHandler) fetchAndCacheSessions(instanceId, cacheKey string) (*types
 		sessions.MediaContainer.Metadata = []types.PlexSession{}
 	}
 
-	// Cache the results
-	ctx := context.Background()
-	if err := h.cache.Set(ctx, cacheKey, sessions, plexCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Plex sessions")
-	}
-
 	return sessions, nil
 }
-
-func (h *PlexHandler) refreshSessionsCache(instanceId, cacheKey string) {
-	sessions, err := h.fetchAndCacheSessions(instanceId, cacheKey)
-	if err != nil && err.Error() != "service not configured" {
-		log.Error().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to refresh Plex sessions cache")
-		return
-	}
-
-	if sessions != nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("size", sessions.MediaContainer.Size).
-			Msg("Successfully refreshed Plex sessions cache")
-	} else {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Msg("Refreshed cache with empty Plex sessions")
-	}
-}
@@ -6,6 +6,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -53,22 +54,6 @@ func (h *ProwlarrHandler) GetStats(c *gin.Context) {
 		return
 	}
 
-	cacheKey := prowlarrStatsPrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var statsResp types.ProwlarrStatsResponse
-	err := h.cache.Get(ctx, cacheKey, &statsResp)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("grabCount", statsResp.GrabCount).
-			Msg("Serving Prowlarr stats from cache")
-		c.JSON(http.StatusOK, statsResp)
-		return
-	}
-
-	// If not in cache, fetch from service
 	prowlarrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to get Prowlarr configuration")
@@ -82,53 +67,21 @@ func (h *ProwlarrHandler) GetStats(c *gin.Context) {
 		return
 	}
 
-	// Build Prowlarr API URL
-	apiURL := fmt.Sprintf("%s/api/v1/system/status?apikey=%s", prowlarrConfig.URL, prowlarrConfig.APIKey)
-
-	// Make request to Prowlarr
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(apiURL)
+	// Serve from cache, refreshing in the background once it expires
+	statsResp, err := cache.Fetch(c.Request.Context(), h.cache, prowlarrStatsPrefix+instanceId, prowlarrCacheDuration, func(context.Context) (types.ProwlarrStatsResponse, error) {
+		var stats types.ProwlarrStatsResponse
+		err := getProwlarr(prowlarrConfig.URL+"/api/v1/system/status", prowlarrConfig.APIKey, "stats", &stats)
+		return stats, err
+	})
 	if err != nil {
-		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to fetch Prowlarr stats")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Prowlarr stats"})
+		respondProwlarrError(c, instanceId, err)
 		return
 	}
 
-	if resp == nil {
-		log.Error().Str("instanceId", instanceId).Msg("Received nil response from Prowlarr")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Received nil response from Prowlarr"})
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Error().
-			Str("instanceId", instanceId).
-			Int("statusCode", resp.StatusCode).
-			Msg("Prowlarr API returned non-200 status")
-		c.JSON(resp.StatusCode, gin.H{"error": fmt.Sprintf("Prowlarr API returned status: %d", resp.StatusCode)})
-		return
-	}
-
-	// Parse response
-	if err := json.NewDecoder(resp.Body).Decode(&statsResp); err != nil {
-		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to parse Prowlarr response")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse Prowlarr response"})
-		return
-	}
-
-	// Cache the results
-	if err := h.cache.Set(ctx, cacheKey, statsResp, prowlarrCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Prowlarr stats")
-	}
-
 	log.Debug().
 		Str("instanceId", instanceId).
 		Int("grabCount", statsResp.GrabCount).
-		Msg("Successfully retrieved and cached Prowlarr stats")
+		Msg("Retrieved Prowlarr stats")
 
 	c.JSON(http.StatusOK, statsResp)
 }
@@ -148,22 +101,6 @@ func (h *ProwlarrHandler) GetIndexers(c *gin.Context) {
 		return
 	}
 
-	cacheKey := prowlarrIndexerPrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var indexers []types.ProwlarrIndexer
-	err := h.cache.Get(ctx, cacheKey, &indexers)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("indexerCount", len(indexers)).
-			Msg("Serving Prowlarr indexers from cache")
-		c.JSON(http.StatusOK, indexers)
-		return
-	}
-
-	// If not in cache, fetch from service
 	prowlarrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to get Prowlarr configuration")
@@ -177,73 +114,44 @@ func (h *ProwlarrHandler) GetIndexers(c *gin.Context) {
 		return
 	}
 
-	// Build Prowlarr API URL
-	apiURL := fmt.Sprintf("%s/api/v1/indexer?apikey=%s", prowlarrConfig.URL, prowlarrConfig.APIKey)
-
-	// Make request to Prowlarr
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(apiURL)
-	if err != nil {
-		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to fetch Prowlarr indexers")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Prowlarr indexers"})
-		return
-	}
-
-	if resp == nil {
-		log.Error().Str("instanceId", instanceId).Msg("Received nil response from Prowlarr")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Received nil response from Prowlarr"})
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Error().
-			Str("instanceId", instanceId).
-			Int("statusCode", resp.StatusCode).
-			Msg("Prowlarr API returned non-200 status")
-		c.JSON(resp.StatusCode, gin.H{"error": fmt.Sprintf("Prowlarr API returned status: %d", resp.StatusCode)})
-		return
-	}
-
-	// Parse response
-	if err := json.NewDecoder(resp.Body).Decode(&indexers); err != nil {
-		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to parse Prowlarr response")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse Prowlarr response"})
-		return
-	}
-
-	// Get indexer stats
-	prowlarrService := prowlarr.NewProwlarrService().(*prowlarr.ProwlarrService)
-	statsResp, err := prowlarrService.GetIndexerStats(prowlarrConfig.URL, prowlarrConfig.APIKey)
-	if err == nil && statsResp != nil {
-		// Create a map for quick lookup
-		statsMap := make(map[int]types.ProwlarrIndexerStats)
-		for _, stat := range statsResp.Indexers {
-			statsMap[stat.IndexerID] = stat
+	// Serve from cache, refreshing in the background once it expires
+	indexers, err := cache.Fetch(c.Request.Context(), h.cache, prowlarrIndexerPrefix+instanceId, prowlarrCacheDuration, func(context.Context) ([]types.ProwlarrIndexer, error) {
+		var indexers []types.ProwlarrIndexer
+		if err := getProwlarr(prowlarrConfig.URL+"/api/v1/indexer", prowlarrConfig.APIKey, "indexers", &indexers); err != nil {
+			return nil, err
 		}
 
-		// Enrich indexers with stats
-		for i := range indexers {
-			if stats, ok := statsMap[indexers[i].ID]; ok {
-				indexers[i].AverageResponseTime = stats.AverageResponseTime
-				indexers[i].NumberOfGrabs = stats.NumberOfGrabs
-				indexers[i].NumberOfQueries = stats.NumberOfQueries
+		// Get indexer stats
+		prowlarrService := prowlarr.NewProwlarrService().(*prowlarr.ProwlarrService)
+		statsResp, err := prowlarrService.GetIndexerStats(prowlarrConfig.URL, prowlarrConfig.APIKey)
+		if err == nil && statsResp != nil {
+			// Create a map for quick lookup
+			statsMap := make(map[int]types.ProwlarrIndexerStats)
+			for _, stat := range statsResp.Indexers {
+				statsMap[stat.IndexerID] = stat
+			}
+
+			// Enrich indexers with stats
+			for i := range indexers {
+				if stats, ok := statsMap[indexers[i].ID]; ok {
+					indexers[i].AverageResponseTime = stats.AverageResponseTime
+					indexers[i].NumberOfGrabs = stats.NumberOfGrabs
+					indexers[i].NumberOfQueries = stats.NumberOfQueries
+				}
 			}
 		}
-	}
 
-	// Cache the results
-	if err := h.cache.Set(ctx, cacheKey, indexers, prowlarrCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Prowlarr indexers")
+		return indexers, nil
+	})
+	if err != nil {
+		respondProwlarrError(c, instanceId, err)
+		return
 	}
 
 	log.Debug().
 		Str("instanceId", instanceId).
 		Int("indexerCount", len(indexers)).
-		Msg("Successfully retrieved and cached Prowlarr indexers")
+		Msg("Retrieved Prowlarr indexers")
 
 	c.JSON(http.StatusOK, indexers)
 }
@@ -263,22 +171,6 @@ func (h *ProwlarrHandler) GetIndexerStats(c *gin.Context) {
 		return
 	}
 
-	cacheKey := prowlarrIndexerStatsPrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var statsResp types.ProwlarrIndexerStatsResponse
-	err := h.cache.Get(ctx, cacheKey, &statsResp)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("indexerCount", len(statsResp.Indexers)).
-			Msg("Serving Prowlarr indexer stats from cache")
-		c.JSON(http.StatusOK, statsResp)
-		return
-	}
-
-	// If not in cache, fetch from service
 	prowlarrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to get Prowlarr configuration")
@@ -292,27 +184,73 @@ func (h *ProwlarrHandler) GetIndexerStats(c *gin.Context) {
 		return
 	}
 
-	// Get indexer stats
-	prowlarrService := prowlarr.NewProwlarrService().(*prowlarr.ProwlarrService)
-	stats, err := prowlarrService.GetIndexerStats(prowlarrConfig.URL, prowlarrConfig.APIKey)
+	// Serve from cache, refreshing in the background once it expires
+	stats, err := cache.Fetch(c.Request.Context(), h.cache, prowlarrIndexerStatsPrefix+instanceId, prowlarrCacheDuration, func(context.Context) (*types.ProwlarrIndexerStatsResponse, error) {
+		prowlarrService := prowlarr.NewProwlarrService().(*prowlarr.ProwlarrService)
+		return prowlarrService.GetIndexerStats(prowlarrConfig.URL, prowlarrConfig.APIKey)
+	})
 	if err != nil {
 		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to fetch Prowlarr indexer stats")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Prowlarr indexer stats"})
 		return
 	}
 
-	// Cache the results
-	if err := h.cache.Set(ctx, cacheKey, stats, prowlarrCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Prowlarr indexer stats")
-	}
-
 	log.Debug().
 		Str("instanceId", instanceId).
 		Int("indexerCount", len(stats.Indexers)).
-		Msg("Successfully retrieved and cached Prowlarr indexer stats")
+		Msg("Retrieved Prowlarr indexer stats")
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// prowlarrError is a failed Prowlarr request and the response it maps to
+type prowlarrError struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *prowlarrError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s: %v", e.message, e.err)
+	}
+	return e.message
+}
+
+// getProwlarr fetches a Prowlarr API endpoint and decodes its JSON response
+// into v. what names the fetched resource in errors.
+func getProwlarr(url, apiKey, what string, v interface{}) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%s?apikey=%s", url, apiKey))
+	if err != nil {
+		return &prowlarrError{status: http.StatusInternalServerError, message: "Failed to fetch Prowlarr " + what, err: err}
+	}
+	if resp == nil {
+		return &prowlarrError{status: http.StatusInternalServerError, message: "Received nil response from Prowlarr"}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &prowlarrError{status: resp.StatusCode, message: fmt.Sprintf("Prowlarr API returned status: %d", resp.StatusCode)}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &prowlarrError{status: http.StatusInternalServerError, message: "Failed to parse Prowlarr response", err: err}
+	}
+	return nil
+}
+
+// respondProwlarrError logs a failed Prowlarr request and writes its response
+func respondProwlarrError(c *gin.Context, instanceId string, err error) {
+	var prowlarrErr *prowlarrError
+	if !errors.As(err, &prowlarrErr) {
+		prowlarrErr = &prowlarrError{status: http.StatusInternalServerError, message: err.Error()}
+	}
+
+	log.Error().
+		Err(err).
+		Str("instanceId", instanceId).
+		Int("statusCode", prowlarrErr.status).
+		Msg("Prowlarr request failed")
+	c.JSON(prowlarrErr.status, gin.H{"error": prowlarrErr.message})
+}
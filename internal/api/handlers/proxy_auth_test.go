@@ -0,0 +1,194 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestProxyAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+
+	trusted, err := types.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	require.NoError(t, err)
+
+	auth := middleware.NewAuthMiddleware(nil, db, &types.ProxyAuthConfig{
+		TrustedProxies: trusted,
+		UserHeader:     middleware.DefaultProxyUserHeader,
+		EmailHeader:    middleware.DefaultProxyEmailHeader,
+		GroupsHeader:   middleware.DefaultProxyGroupsHeader,
+		GroupRoleMapping: types.GroupRoleMapping{
+			AdminGroups:    []string{"dashbrr-admins"},
+			OperatorGroups: []string{"media"},
+		},
+	})
+
+	router := gin.New()
+	router.Use(auth.RequireAuth())
+	router.GET("/userinfo", NewBuiltinAuthHandler(db, nil, nil, nil).GetUserInfo)
+
+	request := func(remoteAddr, user, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "10.1.1.1")
+		if user != "" {
+			req.Header.Set("Remote-User", user)
+			req.Header.Set("Remote-Email", user+"@example.com")
+			req.Header.Set("Remote-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Headers from untrusted peers are ignored, even with a spoofed X-Forwarded-For
+	w := request("203.0.113.5:4000", "mallory", "dashbrr-admins")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	user, err := db.GetUserByUsername("mallory")
+	require.NoError(t, err)
+	assert.Nil(t, user)
+
+	// The first request provisions the user with the mapped role
+	w = request("10.2.3.4:4000", "alice", "users|media")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "alice", info.Username)
+	assert.Equal(t, "alice@example.com", info.Email)
+	assert.Equal(t, types.RoleOperator, info.Role)
+
+	// Roles follow the proxy groups on later requests
+	w = request("192.0.2.1:4000", "alice", "dashbrr-admins")
+	require.Equal(t, http.StatusOK, w.Code)
+	user, err = db.GetUserByUsername("alice")
+	require.NoError(t, err)
+	assert.Equal(t, types.RoleAdmin, user.Role)
+
+	// Disabled accounts are rejected
+	require.NoError(t, db.SetUserDisabled(user.ID, true))
+	w = request("10.2.3.4:4000", "alice", "dashbrr-admins")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Without the user header, trusted peers fall back to normal auth
+	w = request("10.2.3.4:4000", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestProxyAuth_WithoutGroupMapping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+
+	trusted, err := types.ParseTrustedProxies([]string{"127.0.0.1"})
+	require.NoError(t, err)
+
+	auth := middleware.NewAuthMiddleware(nil, db, &types.ProxyAuthConfig{
+		TrustedProxies: trusted,
+		UserHeader:     "X-Auth-User",
+	})
+
+	router := gin.New()
+	router.Use(auth.RequireAuth())
+	router.GET("/role", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("role"))
+	})
+
+	request := func(user string) string {
+		req := httptest.NewRequest(http.MethodGet, "/role", nil)
+		req.RemoteAddr = "127.0.0.1:4000"
+		req.Header.Set("X-Auth-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	// Like registration, the first account becomes admin and later ones
+	// viewers; roles are then managed in dashbrr
+	assert.Equal(t, types.RoleAdmin, request("first"))
+	assert.Equal(t, types.RoleViewer, request("second"))
+
+	second, err := db.GetUserByUsername("second")
+	require.NoError(t, err)
+	require.NoError(t, db.UpdateUserRole(second.ID, types.RoleOperator))
+	assert.Equal(t, types.RoleOperator, request("second"))
+}
+
+func TestProxyAuth_LocalAccounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", PasswordHash: "hash", Role: types.RoleAdmin}
+	require.NoError(t, db.CreateUser(admin))
+
+	trusted, err := types.ParseTrustedProxies([]string{"127.0.0.1"})
+	require.NoError(t, err)
+
+	auth := middleware.NewAuthMiddleware(nil, db, &types.ProxyAuthConfig{
+		TrustedProxies: trusted,
+		UserHeader:     middleware.DefaultProxyUserHeader,
+		EmailHeader:    middleware.DefaultProxyEmailHeader,
+		GroupsHeader:   middleware.DefaultProxyGroupsHeader,
+		GroupRoleMapping: types.GroupRoleMapping{
+			AdminGroups: []string{"dashbrr-admins"},
+		},
+	})
+
+	router := gin.New()
+	router.Use(auth.RequireAuth())
+	router.GET("/role", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("role"))
+	})
+
+	request := func(user, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/role", nil)
+		req.RemoteAddr = "127.0.0.1:4000"
+		req.Header.Set("Remote-User", user)
+		req.Header.Set("Remote-Email", email)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A proxy identity with the email of a local account does not sign into it
+	w := request("mallory", "admin@example.com")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Neither does one with its username, and the account keeps its role
+	w = request("admin", "someone@example.com")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	user, err := db.GetUserByUsername("admin")
+	require.NoError(t, err)
+	assert.Equal(t, types.RoleAdmin, user.Role)
+
+	mallory, err := db.GetUserByUsername("mallory")
+	require.NoError(t, err)
+	assert.Nil(t, mallory)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := types.ParseTrustedProxies([]string{"172.16.0.0/12", "::1"})
+	require.NoError(t, err)
+
+	config := types.ProxyAuthConfig{TrustedProxies: networks}
+	assert.True(t, config.IsTrusted([]byte{172, 20, 0, 1}))
+	assert.False(t, config.IsTrusted([]byte{172, 32, 0, 1}))
+
+	_, err = types.ParseTrustedProxies([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
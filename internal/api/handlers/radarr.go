@@ -13,6 +13,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/services/arr"
 	"github.com/autobrr/dashbrr/internal/services/cache"
 	"github.com/autobrr/dashbrr/internal/services/radarr"
@@ -51,22 +52,6 @@ func (h *RadarrHandler) GetQueue(c *gin.Context) {
 		return
 	}
 
-	cacheKey := radarrQueuePrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var queueResp types.RadarrQueueResponse
-	err := h.cache.Get(ctx, cacheKey, &queueResp)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("totalRecords", queueResp.TotalRecords).
-			Msg("Serving Radarr queue from cache")
-		c.JSON(http.StatusOK, queueResp)
-		return
-	}
-
-	// If not in cache, fetch from service
 	radarrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to get Radarr configuration")
@@ -80,11 +65,18 @@ func (h *RadarrHandler) GetQueue(c *gin.Context) {
 		return
 	}
 
-	// Create Radarr service instance
-	service := &radarr.RadarrService{}
-
-	// Get queue records using the service
-	records, err := service.GetQueueForHealth(radarrConfig.URL, radarrConfig.APIKey)
+	// Serve from cache, refreshing in the background once it expires
+	queueResp, err := cache.Fetch(c.Request.Context(), h.cache, radarrQueuePrefix+instanceId, radarrCacheDuration, func(context.Context) (types.RadarrQueueResponse, error) {
+		service := &radarr.RadarrService{}
+		records, err := service.GetQueueForHealth(radarrConfig.URL, radarrConfig.APIKey)
+		if err != nil {
+			return types.RadarrQueueResponse{}, err
+		}
+		return types.RadarrQueueResponse{
+			Records:      records,
+			TotalRecords: len(records),
+		}, nil
+	})
 	if err != nil {
 		if arrErr, ok := err.(*arr.ErrArr); ok {
 			log.Error().
@@ -101,24 +93,10 @@ func (h *RadarrHandler) GetQueue(c *gin.Context) {
 		return
 	}
 
-	// Create response
-	queueResp = types.RadarrQueueResponse{
-		Records:      records,
-		TotalRecords: len(records),
-	}
-
-	// Cache the results
-	if err := h.cache.Set(ctx, cacheKey, queueResp, radarrCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Radarr queue")
-	}
-
 	log.Debug().
 		Str("instanceId", instanceId).
 		Int("totalRecords", queueResp.TotalRecords).
-		Msg("Successfully retrieved and cached Radarr queue")
+		Msg("Retrieved Radarr queue")
 
 	c.JSON(http.StatusOK, queueResp)
 }
@@ -183,5 +161,17 @@ func (h *RadarrHandler) DeleteQueueItem(c *gin.Context) {
 	cacheKey := radarrQueuePrefix + instanceId
 	h.cache.Delete(context.Background(), cacheKey)
 
+	recordAudit(c, h.db, models.AuditEvent{
+		Action: models.AuditQueueDelete,
+		Target: instanceId,
+		Details: map[string]interface{}{
+			"queueId":          queueId,
+			"removeFromClient": options.RemoveFromClient,
+			"blocklist":        options.Blocklist,
+			"skipRedownload":   options.SkipRedownload,
+			"changeCategory":   options.ChangeCategory,
+		},
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Queue item deleted successfully"})
 }
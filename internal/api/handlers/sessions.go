@@ -0,0 +1,189 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// ListSessions returns the caller's signed-in sessions
+func (h *BuiltinAuthHandler) ListSessions(c *gin.Context) {
+	userID, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.db.ListSessions(userID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+	if sessions == nil {
+		sessions = []types.Session{}
+	}
+
+	if current := h.currentSession(c); current != nil {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == current.ID
+		}
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs out one of the caller's sessions. Admins can revoke
+// any session.
+func (h *BuiltinAuthHandler) RevokeSession(c *gin.Context) {
+	userID, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	session, err := h.db.GetSessionByID(id)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if session == nil || (session.UserID != userID && !types.RoleAtLeast(c.GetString("role"), types.RoleAdmin)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := h.db.DeleteSession(session.ID); err != nil {
+		log.Error().Err(err).Msg("failed to revoke session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	if current := h.currentSession(c); current != nil && current.ID == session.ID {
+		h.dropCurrentSession(c)
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditSessionRevoke,
+		Target:  fmt.Sprintf("session:%d", session.ID),
+		Details: map[string]interface{}{"user_id": session.UserID, "device": session.Device},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllSessions signs the caller out everywhere. With keep_current=true
+// the session making the request stays signed in.
+func (h *BuiltinAuthHandler) RevokeAllSessions(c *gin.Context) {
+	userID, ok := sessionOwner(c)
+	if !ok {
+		return
+	}
+
+	current := h.currentSession(c)
+	keepCurrent := c.Query("keep_current") == "true" && current != nil
+
+	sessions, err := h.db.ListSessions(userID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if keepCurrent {
+		for _, session := range sessions {
+			if session.ID == current.ID {
+				continue
+			}
+			if err := h.db.DeleteSession(session.ID); err != nil {
+				log.Error().Err(err).Msg("failed to revoke session")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+				return
+			}
+		}
+	} else {
+		if err := h.db.DeleteSessionsForUser(userID); err != nil {
+			log.Error().Err(err).Msg("failed to revoke sessions")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+		if current != nil {
+			h.dropCurrentSession(c)
+		}
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditSessionRevokeAll,
+		Details: map[string]interface{}{"keep_current": keepCurrent},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked"})
+}
+
+// sessionOwner returns the local user whose sessions are managed. API
+// tokens cannot manage sessions.
+func sessionOwner(c *gin.Context) (int64, bool) {
+	if c.GetString("auth_type") == "token" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API tokens cannot manage sessions"})
+		return 0, false
+	}
+
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sessions require a local account"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// currentSession returns the indexed session making the request, if any
+func (h *BuiltinAuthHandler) currentSession(c *gin.Context) *types.Session {
+	token := sessionToken(c)
+	if token == "" {
+		return nil
+	}
+
+	session, err := h.db.GetSessionByToken(token)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get current session")
+		return nil
+	}
+	return session
+}
+
+// dropCurrentSession removes the requesting session from the cache and
+// clears its cookie once it has been revoked
+func (h *BuiltinAuthHandler) dropCurrentSession(c *gin.Context) {
+	if token := sessionToken(c); token != "" {
+		_ = h.cache.Delete(c, "session:"+token)
+	}
+	clearSessionCookie(c)
+}
+
+// sessionToken returns the session token from the cookie or the
+// Authorization header
+func sessionToken(c *gin.Context) string {
+	if token, err := c.Cookie("session"); err == nil {
+		return token
+	}
+
+	parts := strings.Fields(c.GetHeader("Authorization"))
+	if len(parts) == 2 && strings.EqualFold(parts[0], "bearer") && !strings.HasPrefix(parts[1], types.APITokenPrefix) {
+		return parts[1]
+	}
+	return ""
+}
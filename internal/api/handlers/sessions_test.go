@@ -0,0 +1,140 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
+)
+
+func TestBuiltinAuthHandler_Sessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	hash, err := utils.HashPassword("Secret123!")
+	require.NoError(t, err)
+	require.NoError(t, db.CreateUser(&types.User{Username: "alice", Email: "alice@example.com", PasswordHash: hash, Role: types.RoleAdmin}))
+
+	handler := NewBuiltinAuthHandler(db, store, nil, nil)
+	auth := middleware.NewAuthMiddleware(store, db, nil)
+	router := gin.New()
+	router.POST("/login", handler.Login)
+	protected := router.Group("", auth.RequireAuth())
+	protected.GET("/sessions", handler.ListSessions)
+	protected.DELETE("/sessions", handler.RevokeAllSessions)
+	protected.DELETE("/sessions/:id", handler.RevokeSession)
+
+	login := func(userAgent string) string {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username": "alice", "password": "Secret123!"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			AccessToken string `json:"access_token"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.AccessToken
+	}
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	laptop := login("Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0")
+	phone := login("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+	tablet := login("Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+
+	w := request(http.MethodGet, "/sessions", laptop)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var sessions []types.Session
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	require.Len(t, sessions, 3)
+
+	devices := map[string]types.Session{}
+	for _, session := range sessions {
+		devices[session.Device] = session
+	}
+	assert.True(t, devices["Firefox on Linux"].Current)
+	assert.False(t, devices["Safari on iOS"].Current)
+
+	// Revoking a session signs that device out
+	w = request(http.MethodDelete, "/sessions/"+strconv.FormatInt(devices["Safari on iOS"].ID, 10), laptop)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/sessions", phone).Code)
+
+	// Signing out other sessions keeps the current one
+	w = request(http.MethodDelete, "/sessions?keep_current=true", laptop)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/sessions", tablet).Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/sessions", laptop).Code)
+
+	// Logging out everywhere includes the current session
+	w = request(http.MethodDelete, "/sessions", laptop)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/sessions", laptop).Code)
+}
+
+func TestBuiltinAuthHandler_SessionsExcludeOIDC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	handler := NewBuiltinAuthHandler(db, store, nil, nil)
+	auth := middleware.NewAuthMiddleware(store, db, nil)
+	router := gin.New()
+	protected := router.Group("", auth.RequireAuth())
+	protected.GET("/sessions", handler.ListSessions)
+	protected.DELETE("/sessions", handler.RevokeAllSessions)
+
+	// OIDC sessions belong to no local account and are not indexed; they
+	// end with their cache entry at logout or expiry
+	require.NoError(t, store.Set(context.Background(), "oidc:session:oidc-session", types.SessionData{
+		AuthType:  "oidc",
+		Role:      types.RoleViewer,
+		Subject:   "user@example.com",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, time.Hour))
+
+	request := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/sessions", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: "oidc-session"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodGet)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Sessions require a local account")
+
+	w = request(http.MethodDelete)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "signing out everywhere is not reported as done")
+
+	sessions, err := db.ListSessions(0)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
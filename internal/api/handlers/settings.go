@@ -14,8 +14,13 @@ import (
 	"github.com/autobrr/dashbrr/internal/database"
 	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/services"
+	"github.com/autobrr/dashbrr/internal/types"
 )
 
+// errManagedService is returned when changing a service declared in the
+// config file
+const errManagedService = "Service is managed by the config file"
+
 type SettingsHandler struct {
 	db     *database.DB
 	health *services.HealthService
@@ -36,8 +41,15 @@ func (h *SettingsHandler) GetSettings(c *gin.Context) {
 		return
 	}
 
+	// Viewers cannot act on services, so they never need the API keys.
+	// Operators still do: the frontend sends them along with webhook triggers.
+	maskKeys := !types.RoleAtLeast(c.GetString("role"), types.RoleOperator)
+
 	configMap := make(map[string]models.ServiceConfiguration)
 	for _, config := range configurations {
+		if maskKeys {
+			config.APIKey = ""
+		}
 		log.Debug().
 			Str("instance", config.InstanceID).
 			Str("display_name", config.DisplayName).
@@ -75,6 +87,18 @@ func (h *SettingsHandler) SaveSettings(c *gin.Context) {
 		return
 	}
 
+	if existing != nil && existing.Managed {
+		c.JSON(http.StatusConflict, gin.H{"error": errManagedService})
+		return
+	}
+
+	// Tags and check intervals are only set in the config file
+	config.Managed = false
+	config.Tags, config.CheckInterval = nil, 0
+	if existing != nil {
+		config.Tags, config.CheckInterval = existing.Tags, existing.CheckInterval
+	}
+
 	// If updating, stop health monitoring first
 	if existing != nil && h.health != nil {
 		h.health.StopMonitoring(instanceID)
@@ -97,6 +121,16 @@ func (h *SettingsHandler) SaveSettings(c *gin.Context) {
 		return
 	}
 
+	action := models.AuditServiceCreate
+	if existing != nil {
+		action = models.AuditServiceUpdate
+	}
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  action,
+		Target:  instanceID,
+		Changes: models.ServiceConfigChanges(existing, &config),
+	})
+
 	log.Info().Str("instance", instanceID).Msg("Successfully saved configuration")
 	c.JSON(http.StatusOK, config)
 }
@@ -118,6 +152,11 @@ func (h *SettingsHandler) DeleteSettings(c *gin.Context) {
 		return
 	}
 
+	if existing.Managed {
+		c.JSON(http.StatusConflict, gin.H{"error": errManagedService})
+		return
+	}
+
 	// Stop health monitoring before deleting
 	if h.health != nil {
 		log.Debug().Str("instance", instanceID).Msg("Stopping health monitoring")
@@ -131,6 +170,12 @@ func (h *SettingsHandler) DeleteSettings(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditServiceDelete,
+		Target:  instanceID,
+		Changes: models.ServiceConfigChanges(existing, nil),
+	})
+
 	log.Info().Str("instance", instanceID).Msg("Successfully deleted configuration")
 	c.JSON(http.StatusOK, gin.H{"message": "Configuration deleted successfully"})
 }
@@ -0,0 +1,60 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+func TestSettingsHandler_ManagedServices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+
+	require.NoError(t, db.CreateService(&models.ServiceConfiguration{
+		InstanceID:  "sonarr-config-1",
+		DisplayName: "Sonarr",
+		URL:         "http://sonarr",
+		Managed:     true,
+	}))
+	require.NoError(t, db.CreateService(&models.ServiceConfiguration{
+		InstanceID:    "radarr-1",
+		DisplayName:   "Radarr",
+		URL:           "http://radarr",
+		Tags:          []string{"media"},
+		CheckInterval: 300,
+	}))
+
+	handler := NewSettingsHandler(db, nil)
+	router := gin.New()
+	router.POST("/settings/:instance", handler.SaveSettings)
+	router.DELETE("/settings/:instance", handler.DeleteSettings)
+
+	// Services declared in the config file are read-only
+	w := performJSON(router, http.MethodPost, "/settings/sonarr-config-1", gin.H{"displayName": "Edited", "url": "http://sonarr"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = performJSON(router, http.MethodDelete, "/settings/sonarr-config-1", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	sonarr, err := db.GetServiceByInstanceID("sonarr-config-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Sonarr", sonarr.DisplayName)
+
+	// Other services cannot become managed, and keep their tags
+	w = performJSON(router, http.MethodPost, "/settings/radarr-1", gin.H{"displayName": "Edited", "url": "http://radarr", "managed": true})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	radarr, err := db.GetServiceByInstanceID("radarr-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", radarr.DisplayName)
+	assert.False(t, radarr.Managed)
+	assert.Equal(t, []string{"media"}, radarr.Tags)
+	assert.Equal(t, int64(300), radarr.CheckInterval)
+}
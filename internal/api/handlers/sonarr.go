@@ -13,6 +13,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/services/arr"
 	"github.com/autobrr/dashbrr/internal/services/cache"
 	"github.com/autobrr/dashbrr/internal/services/sonarr"
@@ -111,6 +112,18 @@ func (h *SonarrHandler) DeleteQueueItem(c *gin.Context) {
 			Msg("Failed to clear Sonarr queue cache")
 	}
 
+	recordAudit(c, h.db, models.AuditEvent{
+		Action: models.AuditQueueDelete,
+		Target: instanceId,
+		Details: map[string]interface{}{
+			"queueId":          queueId,
+			"removeFromClient": options.RemoveFromClient,
+			"blocklist":        options.Blocklist,
+			"skipRedownload":   options.SkipRedownload,
+			"changeCategory":   options.ChangeCategory,
+		},
+	})
+
 	log.Info().
 		Str("instanceId", instanceId).
 		Str("queueId", queueId).
@@ -138,22 +151,6 @@ func (h *SonarrHandler) GetQueue(c *gin.Context) {
 		return
 	}
 
-	cacheKey := sonarrQueuePrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var queueResp types.SonarrQueueResponse
-	err := h.cache.Get(ctx, cacheKey, &queueResp)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("totalRecords", queueResp.TotalRecords).
-			Msg("Serving Sonarr queue from cache")
-		c.JSON(http.StatusOK, queueResp)
-		return
-	}
-
-	// If not in cache, fetch from service
 	sonarrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to get Sonarr configuration")
@@ -167,11 +164,18 @@ func (h *SonarrHandler) GetQueue(c *gin.Context) {
 		return
 	}
 
-	// Create Sonarr service instance
-	service := &sonarr.SonarrService{}
-
-	// Get queue records using the service
-	records, err := service.GetQueueForHealth(sonarrConfig.URL, sonarrConfig.APIKey)
+	// Serve from cache, refreshing in the background once it expires
+	queueResp, err := cache.Fetch(c.Request.Context(), h.cache, sonarrQueuePrefix+instanceId, sonarrCacheDuration, func(context.Context) (types.SonarrQueueResponse, error) {
+		service := &sonarr.SonarrService{}
+		records, err := service.GetQueueForHealth(sonarrConfig.URL, sonarrConfig.APIKey)
+		if err != nil {
+			return types.SonarrQueueResponse{}, err
+		}
+		return types.SonarrQueueResponse{
+			Records:      records,
+			TotalRecords: len(records),
+		}, nil
+	})
 	if err != nil {
 		if arrErr, ok := err.(*arr.ErrArr); ok {
 			log.Error().
@@ -188,24 +192,10 @@ func (h *SonarrHandler) GetQueue(c *gin.Context) {
 		return
 	}
 
-	// Create response
-	queueResp = types.SonarrQueueResponse{
-		Records:      records,
-		TotalRecords: len(records),
-	}
-
-	// Cache the results
-	if err := h.cache.Set(ctx, cacheKey, queueResp, sonarrCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Sonarr queue")
-	}
-
 	log.Debug().
 		Str("instanceId", instanceId).
 		Int("totalRecords", queueResp.TotalRecords).
-		Msg("Successfully retrieved and cached Sonarr queue")
+		Msg("Retrieved Sonarr queue")
 
 	c.JSON(http.StatusOK, queueResp)
 }
@@ -225,25 +215,6 @@ func (h *SonarrHandler) GetStats(c *gin.Context) {
 		return
 	}
 
-	cacheKey := sonarrStatsPrefix + instanceId
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var statsResp types.SonarrStatsResponse
-	err := h.cache.Get(ctx, cacheKey, &statsResp)
-	if err == nil {
-		log.Debug().
-			Str("instanceId", instanceId).
-			Int("monitored", statsResp.Monitored).
-			Msg("Serving Sonarr stats from cache")
-		c.JSON(http.StatusOK, gin.H{
-			"stats":   statsResp,
-			"version": "", // Version will be added by the frontend if needed
-		})
-		return
-	}
-
-	// If not in cache, fetch from service
 	sonarrConfig, err := h.db.GetServiceByInstanceID(instanceId)
 	if err != nil {
 		log.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to get Sonarr configuration")
@@ -257,11 +228,11 @@ func (h *SonarrHandler) GetStats(c *gin.Context) {
 		return
 	}
 
-	// Create Sonarr service instance
-	service := &sonarr.SonarrService{}
-
-	// Get system status using the service
-	version, err := service.GetSystemStatus(sonarrConfig.URL, sonarrConfig.APIKey)
+	// Serve from cache, refreshing in the background once it expires
+	version, err := cache.Fetch(c.Request.Context(), h.cache, sonarrStatsPrefix+instanceId, sonarrCacheDuration, func(context.Context) (string, error) {
+		service := &sonarr.SonarrService{}
+		return service.GetSystemStatus(sonarrConfig.URL, sonarrConfig.APIKey)
+	})
 	if err != nil {
 		if arrErr, ok := err.(*arr.ErrArr); ok {
 			log.Error().
@@ -280,7 +251,7 @@ func (h *SonarrHandler) GetStats(c *gin.Context) {
 
 	// Create response with stats and version
 	c.JSON(http.StatusOK, gin.H{
-		"stats":   statsResp,
+		"stats":   types.SonarrStatsResponse{},
 		"version": version,
 	})
 }
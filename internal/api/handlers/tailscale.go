@@ -69,27 +69,10 @@ func (h *TailscaleHandler) GetTailscaleDevices(c *gin.Context) {
 		}
 	}
 
-	ctx := context.Background()
-
-	// Try to get from cache first
-	var response struct {
-		Devices []tailscale.Device `json:"devices"`
-		Status  string             `json:"status"`
-	}
-	err := h.cache.Get(ctx, cacheKey, &response)
-	if err == nil {
-		log.Debug().
-			Int("deviceCount", len(response.Devices)).
-			Msg("Serving Tailscale devices from cache")
-		c.JSON(http.StatusOK, response)
-
-		// Refresh cache in background if needed
-		go h.refreshDevicesCache(instanceId, apiKey, cacheKey)
-		return
-	}
-
-	// If not in cache, fetch from service
-	devices, err := h.fetchAndCacheDevices(instanceId, apiKey, cacheKey)
+	// Serve from cache, refreshing in the background once it expires
+	devices, err := cache.Fetch(c.Request.Context(), h.cache, cacheKey, tailscaleCacheDuration, func(context.Context) ([]tailscale.Device, error) {
+		return h.fetchDevices(instanceId, apiKey)
+	})
 	if err != nil {
 		status := http.StatusInternalServerError
 		if err == context.DeadlineExceeded || err == context.Canceled {
@@ -122,20 +105,17 @@ func (h *TailscaleHandler) GetTailscaleDevices(c *gin.Context) {
 	log.Info().
 		Int("total", len(devices)).
 		Int("online", onlineCount).
-		Msg("Successfully retrieved and cached Tailscale devices")
-
-	response = struct {
-		Devices []tailscale.Device `json:"devices"`
-		Status  string             `json:"status"`
-	}{
-		Devices: devices,
-		Status:  "success",
-	}
+		Msg("Retrieved Tailscale devices")
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, gin.H{
+		"devices": devices,
+		"status":  "success",
+	})
 }
 
-func (h *TailscaleHandler) fetchAndCacheDevices(instanceId, apiKey, cacheKey string) ([]tailscale.Device, error) {
+// fetchDevices fetches the devices of a tailnet, using apiKey when set and
+// the key of the Tailscale instance otherwise
+func (h *TailscaleHandler) fetchDevices(instanceId, apiKey string) ([]tailscale.Device, error) {
 	service := &tailscale.TailscaleService{}
 
 	var devices []tailscale.Device
@@ -160,40 +140,5 @@ func (h *TailscaleHandler) fetchAndCacheDevices(instanceId, apiKey, cacheKey str
 		return nil, err
 	}
 
-	// Cache the results
-	ctx := context.Background()
-	response := struct {
-		Devices []tailscale.Device `json:"devices"`
-		Status  string             `json:"status"`
-	}{
-		Devices: devices,
-		Status:  "success",
-	}
-
-	if err := h.cache.Set(ctx, cacheKey, response, tailscaleCacheDuration); err != nil {
-		log.Warn().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to cache Tailscale devices")
-	}
-
 	return devices, nil
 }
-
-func (h *TailscaleHandler) refreshDevicesCache(instanceId, apiKey, cacheKey string) {
-	// Add a small delay to prevent immediate refresh
-	time.Sleep(100 * time.Millisecond)
-
-	_, err := h.fetchAndCacheDevices(instanceId, apiKey, cacheKey)
-	if err != nil {
-		log.Error().
-			Err(err).
-			Str("instanceId", instanceId).
-			Msg("Failed to refresh Tailscale devices cache")
-		return
-	}
-
-	log.Debug().
-		Str("instanceId", instanceId).
-		Msg("Successfully refreshed Tailscale devices cache")
-}
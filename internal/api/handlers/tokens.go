@@ -0,0 +1,172 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
+)
+
+const defaultTokenExpiry = 90 * 24 * time.Hour
+
+type TokenHandler struct {
+	db *database.DB
+}
+
+func NewTokenHandler(db *database.DB) *TokenHandler {
+	return &TokenHandler{
+		db: db,
+	}
+}
+
+// ListTokens returns the caller's API tokens. Admins can pass all=true to
+// see every user's tokens.
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	userID, ok := h.tokenOwner(c)
+	if !ok {
+		return
+	}
+	if c.Query("all") == "true" && types.RoleAtLeast(c.GetString("role"), types.RoleAdmin) {
+		userID = 0
+	}
+
+	tokens, err := h.db.ListAPITokens(userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list API tokens")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API tokens"})
+		return
+	}
+	if tokens == nil {
+		tokens = []types.APIToken{}
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateToken issues a new API token for the caller. The secret is only
+// returned in this response.
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	userID, ok := h.tokenOwner(c)
+	if !ok {
+		return
+	}
+
+	var req types.CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = types.TokenScopeRead
+	}
+	if !types.IsValidTokenScope(req.Scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
+		return
+	}
+
+	expiresIn := defaultTokenExpiry
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_in duration"})
+			return
+		}
+		expiresIn = d
+	}
+
+	secret, err := utils.GenerateAPIToken()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	token := &types.APIToken{
+		UserID:    userID,
+		Name:      req.Name,
+		Scope:     req.Scope,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	if err := h.db.CreateAPIToken(token, secret); err != nil {
+		log.Error().Err(err).Msg("Failed to create API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditTokenCreate,
+		Target:  token.Name,
+		Details: map[string]interface{}{"tokenId": token.ID, "scope": token.Scope},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":  token,
+		"secret": secret,
+	})
+}
+
+// RevokeToken deletes one of the caller's tokens. Admins can revoke any token.
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	userID, ok := h.tokenOwner(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token id"})
+		return
+	}
+
+	token, err := h.db.GetAPITokenByID(id)
+	if err != nil {
+		log.Error().Err(err).Int64("token_id", id).Msg("Failed to get API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API token"})
+		return
+	}
+	if token == nil || (token.UserID != userID && !types.RoleAtLeast(c.GetString("role"), types.RoleAdmin)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+		return
+	}
+
+	if err := h.db.DeleteAPIToken(token.ID); err != nil {
+		log.Error().Err(err).Int64("token_id", id).Msg("Failed to revoke API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditTokenRevoke,
+		Target:  token.Name,
+		Details: map[string]interface{}{"tokenId": token.ID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked"})
+}
+
+// tokenOwner returns the local user managing tokens. Tokens cannot be used
+// to manage tokens, and belong to local accounts only.
+func (h *TokenHandler) tokenOwner(c *gin.Context) (int64, bool) {
+	if c.GetString("auth_type") == "token" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API tokens cannot manage API tokens"})
+		return 0, false
+	}
+
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API tokens require a local account"})
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestTokenHandler_BearerAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", PasswordHash: "hash", Role: types.RoleAdmin}
+	require.NoError(t, db.CreateUser(admin))
+
+	handler := NewTokenHandler(db)
+	auth := middleware.NewAuthMiddleware(nil, db, nil)
+
+	// Token management runs as the logged-in user
+	manage := gin.New()
+	manage.Use(func(c *gin.Context) {
+		c.Set("user_id", admin.ID)
+		c.Set("auth_type", "builtin")
+		c.Set("role", types.RoleAdmin)
+	})
+	manage.POST("/tokens", handler.CreateToken)
+
+	w := performJSON(manage, http.MethodPost, "/tokens", gin.H{"name": "script", "scope": types.TokenScopeRead})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Secret string `json:"secret"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Contains(t, created.Secret, types.APITokenPrefix)
+
+	// The API accepts the token and caps the admin's role at the token scope
+	api := gin.New()
+	api.Use(auth.RequireAuth())
+	api.GET("/read", auth.RequireRole(types.RoleViewer), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"role": c.GetString("role")})
+	})
+	api.POST("/write", auth.RequireRole(types.RoleOperator), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	api.POST("/tokens", handler.CreateToken)
+
+	request := func(method, path, secret string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/read", created.Secret))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/write", created.Secret))
+	assert.Equal(t, http.StatusForbidden, request(http.MethodPost, "/tokens", created.Secret))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/read", types.APITokenPrefix+"unknown"))
+
+	tokens, err := db.ListAPITokens(admin.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedAt)
+
+	// Disabled users' tokens stop working
+	require.NoError(t, db.SetUserDisabled(admin.ID, true))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/read", created.Secret))
+}
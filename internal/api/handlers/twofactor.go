@@ -0,0 +1,390 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
+)
+
+const (
+	totpIssuer            = "Dashbrr"
+	twoFactorChallengeTTL = 5 * time.Minute
+	twoFactorMaxAttempts  = 5
+	twoFactorSetupTTL     = 10 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+// twoFactorChallenge is a login that passed the password check and waits
+// for the second factor
+type twoFactorChallenge struct {
+	UserID    int64     `json:"user_id"`
+	Method    string    `json:"method"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// startTwoFactorChallenge stores a pending login and asks the client for a code
+func (h *BuiltinAuthHandler) startTwoFactorChallenge(c *gin.Context, user *types.User, method string) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate two-factor challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	challenge := twoFactorChallenge{
+		UserID:    user.ID,
+		Method:    method,
+		ExpiresAt: time.Now().Add(twoFactorChallengeTTL),
+	}
+	if err := h.cache.Set(c, "2fa:challenge:"+token, challenge, twoFactorChallengeTTL); err != nil {
+		log.Error().Err(err).Msg("failed to store two-factor challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge":           token,
+		"expires_in":          int(twoFactorChallengeTTL.Seconds()),
+	})
+}
+
+// LoginTwoFactor completes a login with a TOTP or recovery code
+func (h *BuiltinAuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req types.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	challengeKey := "2fa:challenge:" + req.Challenge
+	var challenge twoFactorChallenge
+	if err := h.cache.Get(c, challengeKey, &challenge); err != nil || time.Now().After(challenge.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	user, err := h.db.GetUserByID(challenge.UserID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if user == nil || user.Disabled || !user.TOTPEnabled {
+		_ = h.cache.Delete(c, challengeKey)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+	if h.throttled(c, user.Username) {
+		return
+	}
+
+	ok, err := h.verifySecondFactor(c, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to verify two-factor code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		h.recordLoginFailure(c, user.Username, "invalid two-factor code")
+
+		// Each challenge allows a few guesses before the password is needed again
+		challenge.Attempts++
+		if challenge.Attempts >= twoFactorMaxAttempts {
+			_ = h.cache.Delete(c, challengeKey)
+		} else if err := h.cache.Set(c, challengeKey, challenge, time.Until(challenge.ExpiresAt)); err != nil {
+			log.Error().Err(err).Msg("failed to update two-factor challenge")
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if err := h.cache.Delete(c, challengeKey); err != nil {
+		log.Error().Err(err).Msg("failed to delete two-factor challenge")
+	}
+	h.createSession(c, user, challenge.Method)
+}
+
+// GetTwoFactorStatus reports whether the caller has two-factor enabled
+func (h *BuiltinAuthHandler) GetTwoFactorStatus(c *gin.Context) {
+	user, ok := h.twoFactorUser(c)
+	if !ok {
+		return
+	}
+
+	remaining := 0
+	if user.TOTPEnabled {
+		var err error
+		if remaining, err = h.db.CountRecoveryCodes(user.ID); err != nil {
+			log.Error().Err(err).Msg("failed to count recovery codes")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor generates a new TOTP secret for the caller. The secret is
+// only stored on the account once it is confirmed with EnableTwoFactor.
+func (h *BuiltinAuthHandler) SetupTwoFactor(c *gin.Context) {
+	user, ok := h.twoFactorUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Username,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate TOTP secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	qrCode, err := totpQRCode(key)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to render TOTP QR code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := h.cache.Set(c, fmt.Sprintf("2fa:setup:%d", user.ID), key.Secret(), twoFactorSetupTTL); err != nil {
+		log.Error().Err(err).Msg("failed to store pending TOTP secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      key.Secret(),
+		"otpauth_url": key.URL(),
+		"qr_code":     qrCode,
+		"expires_in":  int(twoFactorSetupTTL.Seconds()),
+	})
+}
+
+// EnableTwoFactor confirms the pending secret with a code and returns the
+// recovery codes. They are shown only once.
+func (h *BuiltinAuthHandler) EnableTwoFactor(c *gin.Context) {
+	user, ok := h.twoFactorUser(c)
+	if !ok {
+		return
+	}
+
+	var req types.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	setupKey := fmt.Sprintf("2fa:setup:%d", user.ID)
+	var secret string
+	if err := h.cache.Get(c, setupKey, &secret); err != nil || secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending two-factor setup, start again"})
+		return
+	}
+
+	user.TOTPSecret = secret
+	if !h.validateTOTP(c, user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to generate recovery code")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		codes[i] = code
+	}
+
+	if err := h.db.EnableTOTP(user.ID, secret, codes); err != nil {
+		log.Error().Err(err).Msg("failed to enable two-factor authentication")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := h.cache.Delete(c, setupKey); err != nil {
+		log.Error().Err(err).Msg("failed to delete pending TOTP secret")
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action: models.AuditUser2FAEnable,
+		Target: user.Username,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns off two-factor authentication after checking a
+// current TOTP or recovery code
+func (h *BuiltinAuthHandler) DisableTwoFactor(c *gin.Context) {
+	user, ok := h.twoFactorUser(c)
+	if !ok {
+		return
+	}
+
+	var req types.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := h.verifySecondFactor(c, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to verify two-factor code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if err := h.db.DisableTOTP(user.ID); err != nil {
+		log.Error().Err(err).Msg("failed to disable two-factor authentication")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action: models.AuditUser2FADisable,
+		Target: user.Username,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// twoFactorUser returns the local account of a password session. Two-factor
+// authentication only guards password logins, so other sessions are refused.
+func (h *BuiltinAuthHandler) twoFactorUser(c *gin.Context) (*types.User, bool) {
+	return h.localUser(c, "Two-factor authentication is only available for password logins")
+}
+
+// localUser returns the local account of a built-in session, or refuses
+// other sessions with the given message
+func (h *BuiltinAuthHandler) localUser(c *gin.Context, refusal string) (*types.User, bool) {
+	userID := c.GetInt64("user_id")
+	if c.GetString("auth_type") != "builtin" || userID == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": refusal})
+		return nil, false
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, redeems a
+// recovery code
+func (h *BuiltinAuthHandler) verifySecondFactor(c *gin.Context, user *types.User, code, recoveryCode string) (bool, error) {
+	if code != "" && h.validateTOTP(c, user, code) {
+		return true, nil
+	}
+	if recoveryCode == "" {
+		return false, nil
+	}
+
+	used, err := h.db.UseRecoveryCode(user.ID, recoveryCode)
+	if err != nil || !used {
+		return false, err
+	}
+
+	remaining, err := h.db.CountRecoveryCodes(user.ID)
+	if err != nil {
+		return false, err
+	}
+	log.Info().Str("username", user.Username).Int("remaining", remaining).Msg("recovery code used")
+	recordAudit(c, h.db, models.AuditEvent{
+		Actor:   user.Username,
+		ActorID: user.ID,
+		Action:  models.AuditRecoveryCodeUsed,
+		Target:  user.Username,
+		Details: map[string]interface{}{"remaining": remaining},
+	})
+	return true, nil
+}
+
+// validateTOTP checks a code against the user's secret, allowing one step
+// of clock drift. Accepted codes are claimed in the cache until they expire
+// so a code cannot be replayed, not even by a concurrent login.
+func (h *BuiltinAuthHandler) validateTOTP(c *gin.Context, user *types.User, code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	valid, err := totp.ValidateCustom(code, user.TOTPSecret, time.Now(), totp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	if err != nil || !valid {
+		return false
+	}
+
+	usedKey := fmt.Sprintf("2fa:used:%d:%s", user.ID, code)
+	claimed, err := h.cache.SetNX(c, usedKey, true, 90*time.Second)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to remember used TOTP code")
+		return false
+	}
+	return claimed
+}
+
+// totpQRCode renders the otpauth URI as a PNG data URI for authenticator apps
+func totpQRCode(key *otp.Key) (string, error) {
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,368 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
+)
+
+const defaultInviteExpiry = 72 * time.Hour
+
+type UserHandler struct {
+	db *database.DB
+}
+
+func NewUserHandler(db *database.DB) *UserHandler {
+	return &UserHandler{
+		db: db,
+	}
+}
+
+// ListUsers returns all users
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	users, err := h.db.ListUsers()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+	if users == nil {
+		users = []types.User{}
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateUser creates a user directly, without an invite
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req types.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = types.RoleViewer
+	}
+	if !types.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	if err := utils.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status, msg := h.checkUnique(req.Username, req.Email); status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hash password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	user := &types.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: hashedPassword,
+		Role:         req.Role,
+	}
+	if err := h.db.CreateUser(user); err != nil {
+		log.Error().Err(err).Msg("Failed to create user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditUserCreate,
+		Target:  user.Username,
+		Details: map[string]interface{}{"source": "api", "role": user.Role},
+	})
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser changes a user's role or disabled state
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req types.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if req.Role != nil && !types.IsValidRole(*req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	losesAdmin := (req.Role != nil && *req.Role != types.RoleAdmin) || (req.Disabled != nil && *req.Disabled)
+	if losesAdmin {
+		if user.ID == c.GetInt64("user_id") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot demote or disable your own account"})
+			return
+		}
+		if !h.canRemoveAdmin(c, user) {
+			return
+		}
+	}
+
+	changes := make(map[string]models.AuditChange)
+	if req.Role != nil && *req.Role != user.Role {
+		if err := h.db.UpdateUserRole(user.ID, *req.Role); err != nil {
+			log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to update user role")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+		changes["role"] = models.AuditChange{Before: user.Role, After: *req.Role}
+		user.Role = *req.Role
+	}
+	if req.Disabled != nil && *req.Disabled != user.Disabled {
+		if err := h.db.SetUserDisabled(user.ID, *req.Disabled); err != nil {
+			log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to update user")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+		action := models.AuditUserEnable
+		if *req.Disabled {
+			action = models.AuditUserDisable
+		}
+		recordAudit(c, h.db, models.AuditEvent{Action: action, Target: user.Username})
+		user.Disabled = *req.Disabled
+	}
+
+	if role, ok := changes["role"]; ok {
+		recordAudit(c, h.db, models.AuditEvent{
+			Action:  models.AuditUserRoleChange,
+			Target:  user.Username,
+			Changes: map[string]models.AuditChange{"role": role},
+		})
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser removes a user
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	if user.ID == c.GetInt64("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+	if !h.canRemoveAdmin(c, user) {
+		return
+	}
+
+	if err := h.db.DeleteUser(user.ID); err != nil {
+		log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to delete user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action: models.AuditUserDelete,
+		Target: user.Username,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// ListInvites returns all invites
+func (h *UserHandler) ListInvites(c *gin.Context) {
+	invites, err := h.db.ListInvites()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list invites")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invites"})
+		return
+	}
+	if invites == nil {
+		invites = []types.Invite{}
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// CreateInvite creates an invite and returns its token. The token is only
+// shown once; the database keeps a hash.
+func (h *UserHandler) CreateInvite(c *gin.Context) {
+	var req types.CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = types.RoleViewer
+	}
+	if !types.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	expiresIn := defaultInviteExpiry
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_in duration"})
+			return
+		}
+		expiresIn = d
+	}
+
+	if req.Email != "" {
+		existing, err := h.db.GetUserByEmail(req.Email)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to check email")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if existing != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+	}
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate invite token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	actor, _ := auditActor(c, h.db)
+	invite := &types.Invite{
+		Email:     req.Email,
+		Role:      req.Role,
+		CreatedBy: actor,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	if err := h.db.CreateInvite(invite, token); err != nil {
+		log.Error().Err(err).Msg("Failed to create invite")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditInviteCreate,
+		Target:  invite.Email,
+		Details: map[string]interface{}{"inviteId": invite.ID, "role": invite.Role},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invite": invite,
+		"token":  token,
+		"path":   middleware.BasePath(c) + "/register?invite=" + token,
+	})
+}
+
+// DeleteInvite revokes an invite
+func (h *UserHandler) DeleteInvite(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite id"})
+		return
+	}
+
+	if err := h.db.DeleteInvite(id); err != nil {
+		log.Error().Err(err).Int64("invite_id", id).Msg("Failed to delete invite")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invite"})
+		return
+	}
+
+	recordAudit(c, h.db, models.AuditEvent{
+		Action:  models.AuditInviteDelete,
+		Details: map[string]interface{}{"inviteId": id},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite deleted successfully"})
+}
+
+// loadUser fetches the user named by the :id parameter, writing an error
+// response if it cannot be found
+func (h *UserHandler) loadUser(c *gin.Context) (*types.User, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return nil, false
+	}
+
+	user, err := h.db.GetUserByID(id)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", id).Msg("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// canRemoveAdmin checks that removing user's admin access leaves at least
+// one active admin, writing an error response if it would not
+func (h *UserHandler) canRemoveAdmin(c *gin.Context, user *types.User) bool {
+	if user.Role != types.RoleAdmin || user.Disabled {
+		return true
+	}
+
+	admins, err := h.db.CountActiveAdmins()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to count admins")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if admins <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last admin"})
+		return false
+	}
+	return true
+}
+
+// checkUnique returns an error status and message if the username or email
+// is already taken
+func (h *UserHandler) checkUnique(username, email string) (int, string) {
+	existing, err := h.db.GetUserByUsername(username)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check username")
+		return http.StatusInternalServerError, "Internal server error"
+	}
+	if existing != nil {
+		return http.StatusConflict, "Username already exists"
+	}
+
+	existing, err = h.db.GetUserByEmail(email)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check email")
+		return http.StatusInternalServerError, "Internal server error"
+	}
+	if existing != nil {
+		return http.StatusConflict, "Email already exists"
+	}
+	return 0, ""
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func setupUserTestDB(t *testing.T) *database.DB {
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func performJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUserHandler_LastAdminProtection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", PasswordHash: "hash", Role: types.RoleAdmin}
+	other := &types.User{Username: "other", Email: "other@example.com", PasswordHash: "hash", Role: types.RoleAdmin}
+	require.NoError(t, db.CreateUser(admin))
+	require.NoError(t, db.CreateUser(other))
+
+	handler := NewUserHandler(db)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", admin.ID) })
+	router.PATCH("/users/:id", handler.UpdateUser)
+	router.DELETE("/users/:id", handler.DeleteUser)
+
+	// Admins cannot remove their own access
+	w := performJSON(router, http.MethodDelete, fmt.Sprintf("/users/%d", admin.ID), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Demoting the other admin is fine while one admin remains
+	w = performJSON(router, http.MethodPatch, fmt.Sprintf("/users/%d", other.ID), gin.H{"role": types.RoleViewer})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Disabling the only remaining admin is refused, even by someone else
+	require.NoError(t, db.UpdateUserRole(other.ID, types.RoleAdmin))
+	require.NoError(t, db.SetUserDisabled(admin.ID, true))
+	w = performJSON(router, http.MethodPatch, fmt.Sprintf("/users/%d", other.ID), gin.H{"disabled": true})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestBuiltinAuthHandler_RegisterWithInvite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupUserTestDB(t)
+
+	require.NoError(t, db.CreateUser(&types.User{Username: "admin", Email: "admin@example.com", PasswordHash: "hash", Role: types.RoleAdmin}))
+
+	userHandler := NewUserHandler(db)
+	authHandler := NewBuiltinAuthHandler(db, nil, nil, nil)
+	router := gin.New()
+	router.Use(middleware.Cookies("/dashbrr", http.SameSiteLaxMode))
+	router.POST("/invites", userHandler.CreateInvite)
+	router.POST("/register", authHandler.Register)
+
+	register := gin.H{"username": "newuser", "email": "new@example.com", "password": "Password123!"}
+
+	// Without an invite, registration stays closed
+	w := performJSON(router, http.MethodPost, "/register", register)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performJSON(router, http.MethodPost, "/invites", gin.H{"role": types.RoleOperator, "email": "new@example.com"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Token string `json:"token"`
+		Path  string `json:"path"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Token)
+	assert.Equal(t, "/dashbrr/register?invite="+created.Token, created.Path)
+
+	// Invites bound to an email cannot be used for another address
+	register["invite_token"] = created.Token
+	register["email"] = "someone@example.com"
+	w = performJSON(router, http.MethodPost, "/register", register)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	register["email"] = "NEW@example.com"
+	w = performJSON(router, http.MethodPost, "/register", register)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	user, err := db.GetUserByUsername("newuser")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, types.RoleOperator, user.Role)
+
+	// Invites can only be redeemed once
+	register["username"] = "another"
+	register["email"] = "new2@example.com"
+	w = performJSON(router, http.MethodPost, "/register", register)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
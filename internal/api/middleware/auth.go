@@ -7,29 +7,66 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
+	"github.com/autobrr/dashbrr/internal/database"
 	"github.com/autobrr/dashbrr/internal/services/cache"
 	"github.com/autobrr/dashbrr/internal/types"
 )
 
+// apiTokenTouchInterval is how often the last use of an API token is recorded
+const apiTokenTouchInterval = time.Minute
+
+// sessionTouchInterval is how often activity renews a password session
+const sessionTouchInterval = time.Minute
+
 type AuthMiddleware struct {
-	cache cache.Store
+	cache     cache.Store
+	db        *database.DB
+	proxyAuth *types.ProxyAuthConfig
 }
 
-func NewAuthMiddleware(cache cache.Store) *AuthMiddleware {
+// NewAuthMiddleware creates the auth middleware. proxyAuth enables forward
+// auth from trusted proxies and may be nil.
+func NewAuthMiddleware(cache cache.Store, db *database.DB, proxyAuth *types.ProxyAuthConfig) *AuthMiddleware {
 	return &AuthMiddleware{
-		cache: cache,
+		cache:     cache,
+		db:        db,
+		proxyAuth: proxyAuth,
 	}
 }
 
 // RequireAuth middleware checks for valid authentication
 func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API tokens are only accepted from the Authorization header
+		if secret, ok := apiTokenFromHeader(c); ok {
+			if !m.authenticateAPIToken(c, secret) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// A trusted proxy has already authenticated the user
+		if username, ok := m.proxyUser(c); ok {
+			if !m.authenticateProxyUser(c, username) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled or unavailable"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		// Get session cookie
 		sessionToken, err := c.Cookie("session")
+		fromCookie := err == nil
 		if err != nil {
 			// Check for Authorization header as fallback
 			authHeader := c.GetHeader("Authorization")
@@ -66,15 +103,23 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 				c.Abort()
 				return
 			}
+			if !m.renewSession(c, sessionKey, sessionToken, &sessionData, fromCookie) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+				c.Abort()
+				return
+			}
 		}
 
-		// Store session data in context
-		c.Set("session", sessionData)
-		c.Set("auth_type", sessionData.AuthType)
-		if sessionData.UserID != 0 {
-			c.Set("user_id", sessionData.UserID)
+		role, ok := m.resolveRole(sessionData)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+			c.Abort()
+			return
 		}
 
+		// Store session data in context
+		setSessionContext(c, sessionData, role)
+
 		c.Next()
 	}
 }
@@ -82,6 +127,12 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 // OptionalAuth middleware checks for authentication but doesn't require it
 func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if username, ok := m.proxyUser(c); ok {
+			m.authenticateProxyUser(c, username)
+			c.Next()
+			return
+		}
+
 		sessionToken, err := c.Cookie("session")
 		if err != nil {
 			c.Next()
@@ -102,15 +153,165 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 				c.Next()
 				return
 			}
+			if !m.renewSession(c, sessionKey, sessionToken, &sessionData, true) {
+				c.Next()
+				return
+			}
 		}
 
-		// Store session data in context
-		c.Set("session", sessionData)
-		c.Set("auth_type", sessionData.AuthType)
-		if sessionData.UserID != 0 {
-			c.Set("user_id", sessionData.UserID)
+		role, ok := m.resolveRole(sessionData)
+		if !ok {
+			c.Next()
+			return
 		}
 
+		// Store session data in context
+		setSessionContext(c, sessionData, role)
+
+		c.Next()
+	}
+}
+
+// RequireRole middleware rejects requests from users below the given role.
+// It must run after RequireAuth.
+func (m *AuthMiddleware) RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !types.RoleAtLeast(c.GetString("role"), role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
+
+// apiTokenFromHeader returns the bearer secret if it is an API token
+func apiTokenFromHeader(c *gin.Context) (string, bool) {
+	parts := strings.Fields(c.GetHeader("Authorization"))
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return "", false
+	}
+	if !strings.HasPrefix(parts[1], types.APITokenPrefix) {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// authenticateAPIToken validates an API token and stores its owner in the
+// request context. The token acts with the owner's current role, capped by
+// the token scope.
+func (m *AuthMiddleware) authenticateAPIToken(c *gin.Context, secret string) bool {
+	if m.db == nil {
+		return false
+	}
+
+	token, err := m.db.GetAPITokenBySecret(secret)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up API token")
+		return false
+	}
+	if token == nil || token.Expired() {
+		return false
+	}
+
+	user, err := m.db.GetUserByID(token.UserID)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", token.UserID).Msg("failed to load API token user")
+		return false
+	}
+	if user == nil || user.Disabled {
+		return false
+	}
+
+	role := types.TokenRole(user.Role, token.Scope)
+	if role == "" {
+		return false
+	}
+
+	// Avoid a database write on every request from busy scripts
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval {
+		if err := m.db.TouchAPIToken(token.ID, now); err != nil {
+			log.Warn().Err(err).Int64("token_id", token.ID).Msg("failed to update API token last use")
+		}
+	}
+
+	setSessionContext(c, types.SessionData{
+		UserID:    user.ID,
+		AuthType:  "token",
+		ExpiresAt: token.ExpiresAt,
+	}, role)
+	c.Set("api_token_id", token.ID)
+	return true
+}
+
+// renewSession checks a password session against the session index and
+// slides its expiry on activity. Sessions missing from the index were
+// revoked, e.g. by signing out everywhere or changing the password.
+func (m *AuthMiddleware) renewSession(c *gin.Context, sessionKey, sessionToken string, sessionData *types.SessionData, fromCookie bool) bool {
+	if m.db == nil || sessionData.UserID == 0 {
+		return true
+	}
+
+	session, err := m.db.GetSessionByToken(sessionToken)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up session")
+		return false
+	}
+	if session == nil {
+		_ = m.cache.Delete(c, sessionKey)
+		return false
+	}
+
+	// Avoid a database write on every request
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return true
+	}
+
+	expiresAt := now.Add(types.SessionTTL)
+	if err := m.db.TouchSession(session.ID, now, expiresAt, c.ClientIP()); err != nil {
+		log.Warn().Err(err).Int64("session_id", session.ID).Msg("failed to renew session")
+		return true
+	}
+	sessionData.ExpiresAt = expiresAt
+	if err := m.cache.Set(c, sessionKey, *sessionData, types.SessionTTL); err != nil {
+		log.Warn().Err(err).Int64("session_id", session.ID).Msg("failed to renew cached session")
+	}
+	if fromCookie {
+		c.SetCookie("session", sessionToken, int(types.SessionTTL.Seconds()), CookiePath(c), "", true, true)
+	}
+	return true
+}
+
+// resolveRole returns the current role for a session. Built-in users are
+// looked up on every request so role changes apply immediately; a session
+// whose user was deleted or disabled is rejected.
+func (m *AuthMiddleware) resolveRole(sessionData types.SessionData) (string, bool) {
+	if sessionData.UserID == 0 || m.db == nil {
+		if sessionData.Role == "" {
+			return types.RoleViewer, true
+		}
+		return sessionData.Role, true
+	}
+
+	user, err := m.db.GetUserByID(sessionData.UserID)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", sessionData.UserID).Msg("failed to load session user")
+		return "", false
+	}
+	if user == nil || user.Disabled {
+		return "", false
+	}
+	return user.Role, true
+}
+
+// setSessionContext stores the authenticated session in the request context
+func setSessionContext(c *gin.Context, sessionData types.SessionData, role string) {
+	c.Set("session", sessionData)
+	c.Set("auth_type", sessionData.AuthType)
+	c.Set("role", role)
+	if sessionData.UserID != 0 {
+		c.Set("user_id", sessionData.UserID)
+	}
+}
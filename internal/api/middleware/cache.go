@@ -5,23 +5,81 @@ package middleware
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
 	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/types"
 )
 
 const (
 	HealthCheckTTL = 5 * time.Minute  // 5 minutes for health checks
 	DefaultTTL     = 30 * time.Second // 30 seconds default for other endpoints
+
+	responsePrefix   = "response:"
+	generationPrefix = "response:generation:"
+	// generationTTL outlives any cached response, so a generation that
+	// expires cannot bring back responses it invalidated
+	generationTTL = 24 * time.Hour
 )
 
+// CacheConfig holds how long responses are cached
+type CacheConfig struct {
+	// HealthTTL applies to health check endpoints
+	HealthTTL time.Duration
+	// ServiceTTLs maps a path fragment such as "/sonarr" to the TTL of
+	// the endpoints containing it
+	ServiceTTLs map[string]time.Duration
+	// DefaultTTL applies to all other endpoints
+	DefaultTTL time.Duration
+	// PerUser keeps a separate copy of each response for every user, for
+	// upstreams whose responses depend on who is asking
+	PerUser bool
+	// StaleGrace is how long expired responses, and the upstream values
+	// handlers cache, are served while they are refreshed. Zero turns
+	// stale responses off.
+	StaleGrace time.Duration
+}
+
+// DefaultCacheConfig returns the default cache TTLs
+func DefaultCacheConfig() *CacheConfig {
+	return &CacheConfig{
+		HealthTTL: HealthCheckTTL,
+		ServiceTTLs: map[string]time.Duration{
+			"/plex/sessions": 10 * time.Second,
+			"/autobrr":       30 * time.Second,
+			"/overseerr":     1 * time.Minute,
+			"/maintainerr":   1 * time.Minute,
+			"/sonarr":        30 * time.Second,
+			"/radarr":        30 * time.Second,
+			"/prowlarr":      1 * time.Minute,
+		},
+		DefaultTTL: DefaultTTL,
+		StaleGrace: cache.DefaultStaleGrace,
+	}
+}
+
 type CacheMiddleware struct {
 	store cache.Store
+
+	mu     sync.RWMutex
+	config *CacheConfig
+
+	// refresher runs the handlers of stale responses being refreshed, and
+	// refreshing holds their keys
+	refresher  *gin.Engine
+	refreshing sync.Map
 }
 
 type CachedResponse struct {
@@ -29,133 +87,402 @@ type CachedResponse struct {
 	Body        []byte            `json:"body"`
 	ContentType string            `json:"content_type"`
 	Headers     map[string]string `json:"headers"`
+	// ETag is a weak validator of the body, which clients send back in
+	// If-None-Match to be answered with 304 Not Modified
+	ETag string `json:"etag"`
+	// FreshUntil is when the response expires. It is kept for the stale
+	// grace period after that and served while it is refreshed.
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+func NewCacheMiddleware(store cache.Store, config *CacheConfig) *CacheMiddleware {
+	if config == nil {
+		config = DefaultCacheConfig()
+	}
+
+	m := &CacheMiddleware{
+		store:  store,
+		config: config,
+	}
+
+	// Refreshes skip the middleware of the router, such as authentication
+	// and rate limits, and only cache the response of the route handler
+	m.refresher = gin.New()
+	m.refresher.Use(gin.Recovery())
+	m.refresher.GET("/*path", restoreRefresh, m.Cache(), runRefresh)
+	return m
 }
 
-func NewCacheMiddleware(store cache.Store) *CacheMiddleware {
-	return &CacheMiddleware{
-		store: store,
+// SetConfig replaces the cache TTLs, nil restoring the defaults
+func (m *CacheMiddleware) SetConfig(config *CacheConfig) {
+	if config == nil {
+		config = DefaultCacheConfig()
 	}
+
+	m.mu.Lock()
+	m.config = config
+	m.mu.Unlock()
 }
 
 func (m *CacheMiddleware) Cache() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Only cache GET requests
+		// Only cache GET requests. Other requests change the service
+		// instance they are about, dropping its cached responses.
 		if c.Request.Method != http.MethodGet {
-			c.Next()
+			m.invalidateOnSuccess(c)
 			return
 		}
 
-		// Use the full URL path as cache key
-		cacheKey := c.Request.URL.String()
+		m.mu.RLock()
+		perUser := m.config.PerUser
+		grace := m.config.StaleGrace
+		m.mu.RUnlock()
+		cacheKey := m.cacheKey(c, perUser)
 
-		// Try to get from cache
+		// Handlers caching upstream values use the same grace period
+		ctx := cache.WithStaleGrace(c.Request.Context(), grace)
+
+		// Cache-Control: no-cache asks for a fresh response, which still
+		// refreshes the cache for later requests
+		cacheStatus := "MISS"
+		if bypassCache(c.Request) {
+			cacheStatus = "BYPASS"
+			// Handlers caching upstream values skip them as well
+			ctx = cache.WithNoCache(ctx)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		// Try to get from cache. Expired responses are served while a
+		// background request refreshes them.
 		var cachedResponse CachedResponse
-		err := m.store.Get(c.Request.Context(), cacheKey, &cachedResponse)
-		if err == nil {
+		if cacheStatus == "MISS" && m.store.Get(c.Request.Context(), cacheKey, &cachedResponse) == nil {
+			switch {
+			case time.Now().Before(cachedResponse.FreshUntil):
+				cacheStatus = "HIT"
+			case grace > 0:
+				cacheStatus = "STALE"
+				m.revalidate(c, cacheKey)
+			}
+		}
+		if cacheStatus == "HIT" || cacheStatus == "STALE" {
 			// Set cached headers
 			for k, v := range cachedResponse.Headers {
-				c.Header(k, v)
+				if cacheableHeader(k) {
+					c.Header(k, v)
+				}
 			}
 
-			c.Header("X-Cache", "HIT")
-			c.Data(cachedResponse.Status, cachedResponse.ContentType, cachedResponse.Body)
+			c.Header("X-Cache", cacheStatus)
 			c.Abort()
+			if notModified(c, cachedResponse.ETag) {
+				return
+			}
+			c.Data(cachedResponse.Status, cachedResponse.ContentType, cachedResponse.Body)
 			return
 		}
 
-		// Create a buffer to store the response
+		// Hold back the response, so it can be answered with 304 Not
+		// Modified once its ETag is known
 		w := &responseWriter{
 			ResponseWriter: c.Writer,
-			body:           bytes.NewBufferString(""),
-			headers:        make(map[string]string),
+			body:           &bytes.Buffer{},
 		}
 
 		// Replace writer
 		c.Writer = w
+		c.Header("X-Cache", cacheStatus)
 
 		// Process request
 		c.Next()
+		c.Writer = w.ResponseWriter
 
 		// Only cache successful JSON responses
+		status := w.Status()
 		contentType := w.Header().Get("Content-Type")
-		if c.Writer.Status() >= 200 && c.Writer.Status() < 300 && isJSONResponse(contentType) {
-			// Store headers
-			headers := make(map[string]string)
-			for k, v := range w.Header() {
-				if len(v) > 0 {
-					headers[k] = v[0]
-				}
-			}
+		if status < 200 || status >= 300 || !isJSONResponse(contentType) || w.Written() {
+			w.flush()
+			return
+		}
 
-			responseData := CachedResponse{
-				Status:      c.Writer.Status(),
-				Body:        w.body.Bytes(),
-				ContentType: contentType,
-				Headers:     headers,
+		// Store headers
+		headers := make(map[string]string)
+		for k, v := range w.Header() {
+			if len(v) > 0 && cacheableHeader(k) {
+				headers[k] = v[0]
 			}
+		}
 
-			// Determine TTL based on endpoint
-			ttl := m.getTTL(c.Request.URL.Path)
+		// Determine TTL based on endpoint
+		ttl := m.getTTL(c.Request.URL.Path)
 
-			err := m.store.Set(c.Request.Context(), cacheKey, responseData, ttl)
-			if err != nil {
-				log.Error().Err(err).Str("key", cacheKey).Msg("Failed to cache response")
-			}
+		responseData := CachedResponse{
+			Status:      status,
+			Body:        w.body.Bytes(),
+			ContentType: contentType,
+			Headers:     headers,
+			ETag:        etag(w.body.Bytes()),
+			FreshUntil:  time.Now().Add(ttl),
+		}
+
+		// Keep the response for the stale grace period
+		ttl += grace
+
+		err := m.store.Set(c.Request.Context(), cacheKey, responseData, ttl)
+		if err != nil {
+			log.Error().Err(err).Str("key", cacheKey).Msg("Failed to cache response")
 		}
 
-		// Set cache status header
-		c.Header("X-Cache", "MISS")
+		if notModified(c, responseData.ETag) {
+			return
+		}
+		w.flush()
 	}
 }
 
+// refreshKey holds the route of a request whose stale response is being
+// refreshed
+type refreshKey struct{}
+
+// refreshRoute is what a refresh needs of the request it replays: the
+// values middleware set, such as the session it was authenticated with,
+// the path parameters and the route handler
+type refreshRoute struct {
+	keys    map[string]any
+	params  gin.Params
+	handler gin.HandlerFunc
+}
+
+// revalidate refreshes the stale response to a request in the background.
+// Only the route handler runs again, on a copy of the request without its
+// cookies and Authorization header, so a refresh does not authenticate,
+// renew sessions, count towards rate limits or issue CSRF tokens. A
+// response is refreshed by one request at a time.
+func (m *CacheMiddleware) revalidate(c *gin.Context, cacheKey string) {
+	if _, busy := m.refreshing.LoadOrStore(cacheKey, struct{}{}); busy {
+		return
+	}
+
+	copied := c.Copy()
+	route := &refreshRoute{
+		keys:    copied.Keys,
+		params:  copied.Params,
+		handler: c.Handler(),
+	}
+
+	req := c.Request.Clone(context.WithValue(context.Background(), refreshKey{}, route))
+	req.Header.Del("Cookie")
+	req.Header.Del("Authorization")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	go func() {
+		defer m.refreshing.Delete(cacheKey)
+		m.refresher.ServeHTTP(&discardWriter{header: http.Header{}}, req)
+	}()
+}
+
+// restoreRefresh restores the values and path parameters of the request a
+// refresh replays
+func restoreRefresh(c *gin.Context) {
+	route, ok := c.Request.Context().Value(refreshKey{}).(*refreshRoute)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	for key, value := range route.keys {
+		c.Set(key, value)
+	}
+	c.Params = route.params
+}
+
+// runRefresh runs the route handler of the request a refresh replays
+func runRefresh(c *gin.Context) {
+	c.Request.Context().Value(refreshKey{}).(*refreshRoute).handler(c)
+}
+
+// InvalidateOnSuccess drops the cached responses of the service instance a
+// request changes once it succeeds, for mutating routes outside the cached
+// groups
+func (m *CacheMiddleware) InvalidateOnSuccess() gin.HandlerFunc {
+	return m.invalidateOnSuccess
+}
+
+func (m *CacheMiddleware) invalidateOnSuccess(c *gin.Context) {
+	c.Next()
+
+	if status := c.Writer.Status(); status >= 200 && status < 300 {
+		m.Invalidate(c.Request.Context(), cacheTag(c))
+	}
+}
+
+// Invalidate drops the cached responses of service instances. Responses
+// are keyed by a generation of their instance, so starting a new one makes
+// every older response unreachable without looking them up.
+func (m *CacheMiddleware) Invalidate(ctx context.Context, instanceIDs ...string) {
+	generation := time.Now().UnixNano()
+	for _, instanceID := range instanceIDs {
+		if err := m.store.Set(ctx, generationPrefix+instanceID, generation, generationTTL); err != nil {
+			log.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to invalidate cached responses")
+		}
+	}
+}
+
+// cacheKey returns the key of the response to a request: the current
+// generation of its service instance, the user when responses are cached
+// per user, and the URL
+func (m *CacheMiddleware) cacheKey(c *gin.Context, perUser bool) string {
+	tag := cacheTag(c)
+
+	var generation int64
+	if err := m.store.Get(c.Request.Context(), generationPrefix+tag, &generation); err != nil && !errors.Is(err, cache.ErrKeyNotFound) {
+		log.Debug().Err(err).Str("instanceId", tag).Msg("Failed to read cache generation")
+	}
+
+	key := fmt.Sprintf("%s%s:%d:", responsePrefix, tag, generation)
+	if perUser {
+		key += principal(c) + ":"
+	}
+	return key + c.Request.URL.String()
+}
+
+// cacheTag returns the service instance a request is about, from the
+// instanceId query parameter or an instance path parameter
+func cacheTag(c *gin.Context) string {
+	if instanceID := c.Query("instanceId"); instanceID != "" {
+		return instanceID
+	}
+	if instanceID := c.Param("instanceId"); instanceID != "" {
+		return instanceID
+	}
+	return c.Param("instance")
+}
+
+// principal identifies who made a request for per-user cache keys
+func principal(c *gin.Context) string {
+	value, exists := c.Get("session")
+	session, ok := value.(types.SessionData)
+	if !exists || !ok {
+		return "anonymous"
+	}
+
+	switch {
+	case session.UserID != 0:
+		return "user:" + strconv.FormatInt(session.UserID, 10)
+	case session.Subject != "":
+		return "subject:" + session.Subject
+	}
+	return "role:" + session.Role
+}
+
+// cacheableHeader reports whether a response header may be replayed to
+// other requests. Cookies, such as a renewed session or a freshly issued
+// CSRF token, and the CSRF token header belong to the request that
+// produced the response.
+func cacheableHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Set-Cookie", http.CanonicalHeaderKey(csrfTokenHeader), "X-Cache":
+		return false
+	}
+	return true
+}
+
+// bypassCache reports whether a request asks not to be served from cache
+func bypassCache(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "no-store", "max-age=0":
+			return true
+		}
+	}
+	return r.Header.Get("Pragma") == "no-cache"
+}
+
 // getTTL determines cache TTL based on the endpoint
 func (m *CacheMiddleware) getTTL(path string) time.Duration {
+	m.mu.RLock()
+	config := m.config
+	m.mu.RUnlock()
+
 	// Health check endpoints
 	if strings.Contains(path, "/health") {
-		return HealthCheckTTL
+		return config.HealthTTL
 	}
 
 	// Service-specific TTLs
-	switch {
-	case strings.Contains(path, "/plex/sessions"):
-		return 10 * time.Second
-	case strings.Contains(path, "/autobrr"):
-		return 30 * time.Second
-	case strings.Contains(path, "/overseerr"):
-		return 1 * time.Minute
-	case strings.Contains(path, "/maintainerr"):
-		return 1 * time.Minute
-	case strings.Contains(path, "/sonarr"):
-		return 30 * time.Second
-	case strings.Contains(path, "/radarr"):
-		return 30 * time.Second
-	case strings.Contains(path, "/prowlarr"):
-		return 1 * time.Minute
-	default:
-		return DefaultTTL
+	for fragment, ttl := range config.ServiceTTLs {
+		if strings.Contains(path, fragment) {
+			return ttl
+		}
 	}
+	return config.DefaultTTL
+}
+
+// etag returns a weak ETag for a response body. It is weak because the
+// body may be sent compressed.
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified answers a request with 304 Not Modified when its
+// If-None-Match header matches etag. The ETag is set on the response
+// either way.
+func notModified(c *gin.Context, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+
+	ifNoneMatch := c.GetHeader("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			c.Header("Content-Type", "")
+			c.Status(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return true
+		}
+	}
+	return false
 }
 
 func isJSONResponse(contentType string) bool {
 	return contentType == "application/json" || contentType == "application/json; charset=utf-8"
 }
 
+// responseWriter holds back the body of a response until flush
 type responseWriter struct {
 	gin.ResponseWriter
-	body    *bytes.Buffer
-	headers map[string]string
+	body *bytes.Buffer
 }
 
 func (w *responseWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+	return w.body.Write(b)
 }
 
 func (w *responseWriter) WriteString(s string) (int, error) {
-	w.body.WriteString(s)
-	return w.ResponseWriter.WriteString(s)
+	return w.body.WriteString(s)
+}
+
+// flush sends the held back body
+func (w *responseWriter) flush() {
+	if w.body.Len() == 0 {
+		return
+	}
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		log.Debug().Err(err).Msg("Failed to write response")
+	}
 }
 
-func (w *responseWriter) WriteHeader(status int) {
-	w.ResponseWriter.WriteHeader(status)
+// discardWriter is a response writer for background requests whose
+// response is only cached
+type discardWriter struct {
+	header http.Header
 }
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,332 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestCacheMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	config := DefaultCacheConfig()
+	middleware := NewCacheMiddleware(store, config)
+
+	calls := 0
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			id, _ := strconv.ParseInt(user, 10, 64)
+			c.Set("session", types.SessionData{UserID: id})
+		}
+	})
+	router.Use(middleware.Cache())
+	router.GET("/sonarr/queue", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+	router.DELETE("/sonarr/queue/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/services/:instanceId/action", middleware.InvalidateOnSuccess(), func(c *gin.Context) {
+		c.Status(http.StatusBadRequest)
+	})
+
+	perform := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"calls":1}`, w.Body.String())
+
+	// Cache-Control: no-cache fetches a fresh response and caches it
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, "BYPASS", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"calls":2}`, w.Body.String())
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", nil)
+	assert.JSONEq(t, `{"calls":2}`, w.Body.String())
+
+	// A successful mutation drops the responses of its instance only
+	perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-2", nil)
+	perform(http.MethodDelete, "/sonarr/queue/7?instanceId=sonarr-1", nil)
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-2", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+
+	// Failed mutations leave the cache alone
+	perform(http.MethodPost, "/services/sonarr-2/action", nil)
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-2", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+
+	// Responses are shared between users unless cached per user
+	user1 := map[string]string{"X-Test-User": "1"}
+	user2 := map[string]string{"X-Test-User": "2"}
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", user2)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+
+	perUser := DefaultCacheConfig()
+	perUser.PerUser = true
+	middleware.SetConfig(perUser)
+
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", user1)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", user1)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	w = perform(http.MethodGet, "/sonarr/queue?instanceId=sonarr-1", user2)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+}
+
+func TestCacheMiddleware_Stale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	config := DefaultCacheConfig()
+	config.DefaultTTL = 50 * time.Millisecond
+	config.StaleGrace = 0
+	middleware := NewCacheMiddleware(store, config)
+
+	// Requests pass the router middleware, which a refresh must not run
+	var calls, routed, performed atomic.Int32
+	var refreshHeaders atomic.Value
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		routed.Add(1)
+		c.Set("session", types.SessionData{UserID: 1})
+	})
+	router.Use(middleware.Cache())
+	router.GET("/queue/:instanceId", func(c *gin.Context) {
+		n := calls.Add(1)
+		if n > 1 {
+			_, signedIn := c.Get("session")
+			refreshHeaders.Store([]string{c.GetHeader("Cookie"), c.GetHeader("Authorization"), c.Param("instanceId"), strconv.FormatBool(signedIn)})
+		}
+		c.JSON(http.StatusOK, gin.H{"calls": n})
+	})
+
+	perform := func() *httptest.ResponseRecorder {
+		performed.Add(1)
+		req := httptest.NewRequest(http.MethodGet, "/queue/instance-1", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: "secret"})
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without a stale grace, expired responses are missed
+	perform()
+	time.Sleep(100 * time.Millisecond)
+	w := perform()
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"calls":2}`, w.Body.String())
+
+	// Responses cached once there is one are kept past their TTL
+	config = DefaultCacheConfig()
+	config.DefaultTTL = 50 * time.Millisecond
+	middleware.SetConfig(config)
+	time.Sleep(100 * time.Millisecond)
+	perform()
+	time.Sleep(100 * time.Millisecond)
+
+	w = perform()
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"calls":3}`, w.Body.String())
+
+	require.Eventually(t, func() bool {
+		w := perform()
+		return w.Header().Get("X-Cache") == "HIT" && w.Body.String() == `{"calls":4}`
+	}, time.Second, 5*time.Millisecond, "the stale response is refreshed in the background")
+
+	// The refresh ran the route handler only, as the same user and route
+	// but without the credentials of the request
+	assert.Equal(t, performed.Load(), routed.Load(), "the refresh skips the router middleware")
+	assert.Equal(t, []string{"", "", "instance-1", "true"}, refreshHeaders.Load())
+}
+
+func TestCacheMiddleware_HandlerCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	config := DefaultCacheConfig()
+	config.DefaultTTL = 50 * time.Millisecond
+	middleware := NewCacheMiddleware(store, config)
+
+	// The handler caches the upstream value for longer than the response
+	var upstream atomic.Int32
+	router := gin.New()
+	router.Use(middleware.Cache())
+	router.GET("/queue", func(c *gin.Context) {
+		value, err := cache.Fetch(c.Request.Context(), store, "upstream:queue", time.Hour, func(context.Context) (int32, error) {
+			return upstream.Add(1), nil
+		})
+		require.NoError(t, err)
+		c.JSON(http.StatusOK, gin.H{"upstream": value})
+	})
+
+	perform := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/queue", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform(nil)
+	assert.JSONEq(t, `{"upstream":1}`, w.Body.String())
+
+	// Cache-Control: no-cache reaches the upstream through the handler cache
+	w = perform(map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, "BYPASS", w.Header().Get("X-Cache"))
+	assert.JSONEq(t, `{"upstream":2}`, w.Body.String())
+
+	// Refreshing a stale response does too
+	time.Sleep(100 * time.Millisecond)
+	w = perform(nil)
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	require.Eventually(t, func() bool {
+		w := perform(nil)
+		return w.Header().Get("X-Cache") == "HIT" && w.Body.String() == `{"upstream":3}`
+	}, time.Second, 5*time.Millisecond, "the stale response is refreshed from the upstream")
+}
+
+func TestCacheMiddleware_ETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	middleware := NewCacheMiddleware(store, DefaultCacheConfig())
+
+	calls := 0
+	router := gin.New()
+	router.Use(middleware.Cache())
+	router.GET("/plex/sessions", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"size": 2})
+	})
+	router.GET("/plex/error", func(c *gin.Context) {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "down"})
+	})
+
+	perform := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform("/plex/sessions", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, etag)
+	assert.JSONEq(t, `{"size":2}`, w.Body.String())
+
+	// Cached responses are answered with 304 when the client has them
+	w = perform("/plex/sessions", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, 1, calls)
+
+	w = perform("/plex/sessions", `W/"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, w.Code, "any listed ETag matches")
+
+	w = perform("/plex/sessions", `W/"other"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"size":2}`, w.Body.String())
+
+	// Fresh responses are answered with 304 too
+	middleware.Invalidate(context.Background(), "")
+	w = perform("/plex/sessions", etag)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, 2, calls)
+
+	// Errors are passed through without an ETag
+	w = perform("/plex/error", "")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.JSONEq(t, `{"error":"down"}`, w.Body.String())
+}
+
+func TestCacheMiddleware_PrivateHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	middleware := NewCacheMiddleware(store, DefaultCacheConfig())
+
+	router := gin.New()
+	// Renews the session of the signed-in user, as AuthMiddleware does
+	router.Use(func(c *gin.Context) {
+		if session, err := c.Cookie("session"); err == nil {
+			c.SetCookie("session", session, 3600, "/", "", true, true)
+		}
+	})
+	router.Use(middleware.Cache())
+	router.GET("/queue", func(c *gin.Context) {
+		c.Header("X-Upstream", "sonarr")
+		c.JSON(http.StatusOK, gin.H{"queue": []string{}})
+	})
+
+	perform := func(session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/queue", nil)
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: session})
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform("user-a-secret")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session=user-a-secret")
+
+	// The renewed cookie of the first user is not replayed to the next
+	w = perform("")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Empty(t, w.Header().Values("Set-Cookie"))
+	assert.Equal(t, "sonarr", w.Header().Get("X-Upstream"))
+
+	w = perform("user-b-secret")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	require.Len(t, w.Header().Values("Set-Cookie"), 1)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session=user-b-secret")
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCompressMinSize is the smallest response body worth compressing
+const DefaultCompressMinSize = 1024
+
+// compressibleTypes are the content types that are compressed. Event
+// streams are left alone so every event is sent as it happens.
+var compressibleTypes = []string{
+	"application/json",
+	"application/javascript",
+	"text/plain",
+	"text/html",
+	"text/css",
+}
+
+// Compress compresses response bodies of at least minSize bytes with
+// brotli or gzip, whichever the client prefers
+func Compress(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			minSize:        minSize,
+		}
+		c.Writer = w
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		c.Next()
+
+		w.close()
+		c.Writer = w.ResponseWriter
+	}
+}
+
+// negotiateEncoding returns the content coding to use for an
+// Accept-Encoding header, preferring brotli over gzip, or an empty string
+// when the client accepts neither
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = value
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = quality > 0
+	}
+
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// the body is large enough to compress
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	switch {
+	case !w.compressible():
+		w.decide(false)
+	case len(w.buf) >= w.minSize:
+		w.decide(true)
+	}
+	if err := w.flushBuffer(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what was written so far, uncompressed if the body is still
+// too small to tell
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+		_ = w.flushBuffer()
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible reports whether the response is worth compressing
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || w.ResponseWriter.Written() {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, compressible := range compressibleTypes {
+		if strings.HasPrefix(contentType, compressible) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide settles whether the body is compressed
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	if !compress {
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if w.encoding == "br" {
+		w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+	} else {
+		w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+	}
+}
+
+// flushBuffer writes the held back start of the body once it is decided
+func (w *compressWriter) flushBuffer() error {
+	if !w.decided || len(w.buf) == 0 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close finishes the response, sending a body too small to compress as it is
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	_ = w.flushBuffer()
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+	}
+}
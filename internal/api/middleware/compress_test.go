@@ -0,0 +1,79 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	large := strings.Repeat("queue item ", 200)
+	router := gin.New()
+	router.Use(Compress(DefaultCompressMinSize))
+	router.GET("/large", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"records": large})
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"records": "few"})
+	})
+	router.GET("/events", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, "data: %s\n\n", large)
+	})
+
+	perform := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform("/large", "gzip, deflate, br")
+	require.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	body, err := io.ReadAll(brotli.NewReader(w.Body))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"records":"`+large+`"}`, string(body))
+
+	w = perform("/large", "gzip, br;q=0")
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"records":"`+large+`"}`, string(body))
+
+	w = perform("/large", "identity")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.JSONEq(t, `{"records":"`+large+`"}`, w.Body.String())
+
+	w = perform("/small", "br")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "small bodies are sent as they are")
+	assert.JSONEq(t, `{"records":"few"}`, w.Body.String())
+
+	w = perform("/events", "br")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "event streams are not compressed")
+	assert.True(t, strings.HasPrefix(w.Body.String(), "data: "))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "br", negotiateEncoding("gzip, br"))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip;q=0.8, br;q=0"))
+	assert.Equal(t, "gzip", negotiateEncoding("GZIP"))
+	assert.Equal(t, "", negotiateEncoding("deflate"))
+	assert.Equal(t, "", negotiateEncoding(""))
+}
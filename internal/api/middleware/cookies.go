@@ -0,0 +1,60 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseSameSite converts a SameSite setting ("lax", "strict" or "none") to
+// its cookie attribute. An empty value means lax.
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return http.SameSiteDefaultMode, fmt.Errorf("invalid SameSite value %q, expected lax, strict or none", value)
+}
+
+// cookiePathKey is the context key holding the path cookies are scoped to
+const cookiePathKey = "cookie_path"
+
+// Cookies sets the path and SameSite attribute of the cookies handlers set
+// during the request. Handlers read the path with CookiePath and may still
+// pick a different SameSite mode for a cookie that needs it.
+func Cookies(path string, mode http.SameSite) gin.HandlerFunc {
+	if path == "" {
+		path = "/"
+	}
+
+	return func(c *gin.Context) {
+		c.Set(cookiePathKey, path)
+		c.SetSameSite(mode)
+		c.Next()
+	}
+}
+
+// CookiePath returns the path cookies are scoped to, "/" unless dashbrr is
+// served under a base path
+func CookiePath(c *gin.Context) string {
+	if path := c.GetString(cookiePathKey); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// BasePath returns the path dashbrr is served under without a trailing
+// slash, empty when it is served from the root. Handlers prefix it to the
+// frontend paths they redirect to or hand out.
+func BasePath(c *gin.Context) string {
+	return strings.TrimSuffix(CookiePath(c), "/")
+}
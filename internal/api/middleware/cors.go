@@ -4,16 +4,46 @@
 package middleware
 
 import (
+	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-// SetupCORS returns the CORS middleware configuration
-func SetupCORS() gin.HandlerFunc {
-	config := cors.Config{
+// CORSConfig holds configuration for cross-origin requests
+type CORSConfig struct {
+	// Origins allowed to call the API. "*" allows any origin, and entries
+	// may use a wildcard such as https://*.example.com.
+	AllowOrigins []string
+	// AllowCredentials lets browsers send cookies with cross-origin
+	// requests. It cannot be combined with "*".
+	AllowCredentials bool
+}
+
+// DefaultCORSConfig returns the default CORS configuration
+func DefaultCORSConfig() *CORSConfig {
+	return &CORSConfig{
 		AllowOrigins: []string{"*"},
+	}
+}
+
+// Validate checks the configuration before it is used
+func (c *CORSConfig) Validate() error {
+	if len(c.AllowOrigins) == 0 {
+		return errors.New("at least one allowed origin is required")
+	}
+	for _, origin := range c.AllowOrigins {
+		if origin == "*" && c.AllowCredentials {
+			return errors.New("credentials cannot be allowed for all origins")
+		}
+	}
+	return c.corsConfig().Validate()
+}
+
+func (c *CORSConfig) corsConfig() cors.Config {
+	config := cors.Config{
 		AllowMethods: []string{
 			"GET",
 			"POST",
@@ -28,10 +58,54 @@ func SetupCORS() gin.HandlerFunc {
 			"Content-Type",
 			"Accept",
 			"X-Requested-With",
+			csrfTokenHeader,
 		},
-		ExposeHeaders: []string{"Content-Length", "Content-Type"},
-		MaxAge:        12 * time.Hour,
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", csrfTokenHeader},
+		AllowCredentials: c.AllowCredentials,
+		AllowWildcard:    true,
+		MaxAge:           12 * time.Hour,
 	}
 
-	return cors.New(config)
+	for _, origin := range c.AllowOrigins {
+		if origin == "*" {
+			config.AllowAllOrigins = true
+			return config
+		}
+	}
+	config.AllowOrigins = c.AllowOrigins
+	return config
+}
+
+// SetupCORS returns the CORS middleware configuration
+func SetupCORS(config *CORSConfig) gin.HandlerFunc {
+	if config == nil {
+		config = DefaultCORSConfig()
+	}
+
+	return cors.New(config.corsConfig())
+}
+
+// CORS is a CORS middleware whose configuration can be replaced while the
+// server runs
+type CORS struct {
+	handler atomic.Value // gin.HandlerFunc
+}
+
+// NewCORS creates a CORS middleware, nil using the default configuration
+func NewCORS(config *CORSConfig) *CORS {
+	c := &CORS{}
+	c.SetConfig(config)
+	return c
+}
+
+// SetConfig replaces the CORS configuration
+func (c *CORS) SetConfig(config *CORSConfig) {
+	c.handler.Store(SetupCORS(config))
+}
+
+// Handler returns the middleware
+func (c *CORS) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.handler.Load().(gin.HandlerFunc)(ctx)
+	}
 }
@@ -5,6 +5,7 @@ package middleware
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"net/http"
@@ -28,7 +29,8 @@ var (
 
 // CSRFConfig holds configuration for CSRF protection
 type CSRFConfig struct {
-	// Secure indicates if the cookie should be sent only over HTTPS
+	// Secure forces the Secure cookie flag. Otherwise it is set for HTTPS
+	// requests only, so plain HTTP installs on a LAN keep working.
 	Secure bool
 	// Cookie path
 	Path string
@@ -38,6 +40,8 @@ type CSRFConfig struct {
 	MaxAge int
 	// If true, cookie is not accessible via JavaScript
 	HttpOnly bool
+	// SameSite attribute of the cookie
+	SameSite http.SameSite
 	// Methods that don't require CSRF validation
 	ExemptMethods []string
 	// Paths that don't require CSRF validation
@@ -47,9 +51,9 @@ type CSRFConfig struct {
 // DefaultCSRFConfig returns the default CSRF configuration
 func DefaultCSRFConfig() *CSRFConfig {
 	return &CSRFConfig{
-		Secure:        true,
 		Path:          "/",
 		HttpOnly:      true,
+		SameSite:      http.SameSiteLaxMode,
 		MaxAge:        int(csrfTokenDuration.Seconds()),
 		ExemptMethods: []string{"GET", "HEAD", "OPTIONS"},
 		ExemptPaths:   []string{},
@@ -65,7 +69,11 @@ func generateCSRFToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-// CSRF returns a middleware that provides CSRF protection
+// CSRF returns a middleware that provides CSRF protection using the double
+// submit pattern: state-changing requests must echo the csrf_token cookie in
+// the X-CSRF-Token header. Requests carrying a bearer token and no session
+// cookie are exempt, as browsers never attach one to a cross-site request on
+// their own.
 func CSRF(config *CSRFConfig) gin.HandlerFunc {
 	if config == nil {
 		config = DefaultCSRFConfig()
@@ -86,15 +94,12 @@ func CSRF(config *CSRFConfig) gin.HandlerFunc {
 			if method == m {
 				// For GET requests, set a new token if one doesn't exist
 				if method == "GET" {
-					_, err := c.Cookie(csrfTokenCookie)
-					if err == http.ErrNoCookie {
-						token, err := generateCSRFToken()
+					if _, err := c.Cookie(csrfTokenCookie); err == http.ErrNoCookie {
+						token, err := issueCSRFToken(c, config)
 						if err != nil {
 							c.AbortWithStatus(http.StatusInternalServerError)
 							return
 						}
-						c.SetCookie(csrfTokenCookie, token, config.MaxAge, config.Path,
-							config.Domain, config.Secure, config.HttpOnly)
 						c.Header(csrfTokenHeader, token)
 					}
 				}
@@ -103,9 +108,16 @@ func CSRF(config *CSRFConfig) gin.HandlerFunc {
 			}
 		}
 
+		// Bearer tokens cannot be forged cross-site, but a browser sends the
+		// session cookie along with any header a page sets
+		if hasBearerToken(c) && !hasSessionCookie(c) {
+			c.Next()
+			return
+		}
+
 		// Get the token from the cookie
 		cookie, err := c.Cookie(csrfTokenCookie)
-		if err != nil {
+		if err != nil || cookie == "" {
 			c.JSON(http.StatusForbidden, gin.H{"error": ErrTokenMissing.Error()})
 			c.Abort()
 			return
@@ -119,25 +131,83 @@ func CSRF(config *CSRFConfig) gin.HandlerFunc {
 			return
 		}
 
-		// Compare the cookie token with the header token
-		if cookie != header {
+		// Compare the cookie token with the header token. The token is kept
+		// for its lifetime rather than rotated, as the dashboard sends
+		// several requests at once.
+		if subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
 			c.JSON(http.StatusForbidden, gin.H{"error": ErrTokenMismatch.Error()})
 			c.Abort()
 			return
 		}
 
-		// Generate a new token for the next request
-		newToken, err := generateCSRFToken()
-		if err != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
+		c.Next()
+	}
+}
+
+// CSRFToken returns a handler that hands the current CSRF token to the
+// frontend, issuing one when the browser has none. The cookie is HttpOnly,
+// so this is how scripts learn the value to send back.
+func CSRFToken(config *CSRFConfig) gin.HandlerFunc {
+	if config == nil {
+		config = DefaultCSRFConfig()
+	}
+
+	return func(c *gin.Context) {
+		token := c.GetString(csrfTokenCookie)
+		if token == "" {
+			token, _ = c.Cookie(csrfTokenCookie)
+		}
+		if token == "" {
+			var err error
+			if token, err = issueCSRFToken(c, config); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return
+			}
 		}
 
-		// Set the new token in both cookie and header
-		c.SetCookie(csrfTokenCookie, newToken, config.MaxAge, config.Path,
-			config.Domain, config.Secure, config.HttpOnly)
-		c.Header(csrfTokenHeader, newToken)
+		c.Header("Cache-Control", "no-store")
+		c.Header(csrfTokenHeader, token)
+		c.JSON(http.StatusOK, gin.H{"csrf_token": token})
+	}
+}
 
-		c.Next()
+// issueCSRFToken generates a token and stores it in the CSRF cookie. The
+// token is also kept in the context, as the request has no cookie yet.
+func issueCSRFToken(c *gin.Context, config *CSRFConfig) (string, error) {
+	token, err := generateCSRFToken()
+	if err != nil {
+		return "", err
 	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrfTokenCookie,
+		Value:    token,
+		MaxAge:   config.MaxAge,
+		Path:     config.Path,
+		Domain:   config.Domain,
+		Secure:   config.Secure || isHTTPS(c),
+		HttpOnly: config.HttpOnly,
+		SameSite: config.SameSite,
+	})
+	c.Set(csrfTokenCookie, token)
+	return token, nil
+}
+
+// hasBearerToken reports whether the request authenticates with an
+// Authorization bearer token
+func hasBearerToken(c *gin.Context) bool {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	return ok && strings.EqualFold(scheme, "bearer") && strings.TrimSpace(token) != ""
+}
+
+// hasSessionCookie reports whether the request carries a session cookie
+func hasSessionCookie(c *gin.Context) bool {
+	session, err := c.Cookie("session")
+	return err == nil && session != ""
+}
+
+// isHTTPS reports whether the client reached dashbrr over HTTPS, directly
+// or through a TLS-terminating proxy
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
 }
@@ -0,0 +1,147 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/services/cache"
+)
+
+func TestCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := DefaultCSRFConfig()
+	config.SameSite = http.SameSiteStrictMode
+	config.ExemptPaths = []string{"/hooks/"}
+
+	router := gin.New()
+	router.Use(CSRF(config))
+	router.GET("/csrf", CSRFToken(config))
+	router.POST("/action", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.POST("/hooks/notify", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	perform := func(method, path string, headers map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Bootstrap a token
+	w := perform(http.MethodGet, "/csrf", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Token string `json:"csrf_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, body.Token, cookie.Value)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.True(t, cookie.HttpOnly)
+	assert.False(t, cookie.Secure, "plain HTTP requests get a cookie without the Secure flag")
+
+	// An existing token is handed out again
+	w = perform(http.MethodGet, "/csrf", nil, cookie)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, cookie.Value, body.Token)
+	assert.Empty(t, w.Result().Cookies())
+
+	// Cookie-authenticated requests need the token in the header
+	assert.Equal(t, http.StatusForbidden, perform(http.MethodPost, "/action", nil, cookie).Code)
+	assert.Equal(t, http.StatusForbidden, perform(http.MethodPost, "/action",
+		map[string]string{csrfTokenHeader: "forged"}, cookie).Code)
+	assert.Equal(t, http.StatusNoContent, perform(http.MethodPost, "/action",
+		map[string]string{csrfTokenHeader: cookie.Value}, cookie).Code)
+
+	// The token stays valid for further requests
+	assert.Equal(t, http.StatusNoContent, perform(http.MethodPost, "/action",
+		map[string]string{csrfTokenHeader: cookie.Value}, cookie).Code)
+
+	// Bearer tokens and exempt paths skip the check, other schemes do not
+	assert.Equal(t, http.StatusNoContent, perform(http.MethodPost, "/action",
+		map[string]string{"Authorization": "Bearer secret"}).Code)
+	assert.Equal(t, http.StatusForbidden, perform(http.MethodPost, "/action",
+		map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}).Code)
+
+	// A bearer header does not exempt a request signed in with a session
+	// cookie
+	session := &http.Cookie{Name: "session", Value: "session-id"}
+	assert.Equal(t, http.StatusForbidden, perform(http.MethodPost, "/action",
+		map[string]string{"Authorization": "Bearer bogus"}, session).Code)
+	assert.Equal(t, http.StatusNoContent, perform(http.MethodPost, "/action",
+		map[string]string{"Authorization": "Bearer bogus", csrfTokenHeader: cookie.Value}, session, cookie).Code)
+	assert.Equal(t, http.StatusNoContent, perform(http.MethodPost, "/hooks/notify", nil).Code)
+
+	// Behind a TLS-terminating proxy the cookie is Secure
+	w = perform(http.MethodGet, "/csrf", map[string]string{"X-Forwarded-Proto": "https"})
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.True(t, w.Result().Cookies()[0].Secure)
+}
+
+func TestParseSameSite(t *testing.T) {
+	for value, want := range map[string]http.SameSite{
+		"":       http.SameSiteLaxMode,
+		"Lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	} {
+		got, err := ParseSameSite(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	_, err := ParseSameSite("sometimes")
+	assert.Error(t, err)
+}
+
+func TestCSRF_CachedResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := cache.NewMemoryStore(t.TempDir())
+	t.Cleanup(func() { store.Close() })
+
+	router := gin.New()
+	router.Use(CSRF(DefaultCSRFConfig()))
+	router.Use(NewCacheMiddleware(store, DefaultCacheConfig()).Cache())
+	router.GET("/queue", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"queue": []string{}}) })
+
+	token := func(w *httptest.ResponseRecorder) string {
+		var tokens []string
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == csrfTokenCookie {
+				tokens = append(tokens, cookie.Value)
+			}
+		}
+		require.Len(t, tokens, 1)
+		assert.Equal(t, tokens[0], w.Header().Get(csrfTokenHeader))
+		return tokens[0]
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/queue", nil))
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	first := token(w)
+
+	// A cached response carries a token of its own for every client
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/queue", nil))
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.NotEqual(t, first, token(w))
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// Header names used by Authelia, Authentik and oauth2-proxy by default
+const (
+	DefaultProxyUserHeader   = "Remote-User"
+	DefaultProxyEmailHeader  = "Remote-Email"
+	DefaultProxyGroupsHeader = "Remote-Groups"
+)
+
+// proxyUser returns the username passed by a trusted proxy. Headers from
+// any other address are ignored, since clients can set them freely.
+func (m *AuthMiddleware) proxyUser(c *gin.Context) (string, bool) {
+	if m.proxyAuth == nil {
+		return "", false
+	}
+
+	// RemoteAddr is the direct peer; gin's ClientIP would honour
+	// X-Forwarded-For, which the client controls
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	if !m.proxyAuth.IsTrusted(net.ParseIP(host)) {
+		return "", false
+	}
+
+	username := strings.TrimSpace(c.GetHeader(m.proxyAuth.UserHeader))
+	return username, username != ""
+}
+
+// authenticateProxyUser loads the user a trusted proxy logged in, creating
+// it on first sight, and stores it in the request context. When groups are
+// mapped to roles the user's role follows the proxy groups. Users are
+// matched by username only, and local accounts with a password are never
+// signed in through the proxy, since proxy identities and emails are not
+// proof of owning them.
+func (m *AuthMiddleware) authenticateProxyUser(c *gin.Context, username string) bool {
+	if m.db == nil {
+		return false
+	}
+
+	email := strings.TrimSpace(c.GetHeader(m.proxyAuth.EmailHeader))
+	groups := splitProxyGroups(c.GetHeader(m.proxyAuth.GroupsHeader))
+
+	user, err := m.db.GetUserByUsername(username)
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to look up proxy user")
+		return false
+	}
+
+	if user == nil {
+		if user, err = m.provisionProxyUser(c, username, email, groups); err != nil {
+			log.Error().Err(err).Str("username", username).Msg("failed to create proxy user")
+			return false
+		}
+	}
+	if user.Disabled {
+		return false
+	}
+	if user.PasswordHash != "" {
+		log.Warn().Str("username", username).Msg("refusing proxy login for a local password account")
+		return false
+	}
+
+	if m.proxyAuth.MapsGroups() {
+		if role := m.proxyAuth.RoleForGroups(groups); role != user.Role {
+			if err := m.db.UpdateUserRole(user.ID, role); err != nil {
+				log.Error().Err(err).Str("username", username).Msg("failed to update proxy user role")
+				return false
+			}
+			m.recordProxyAudit(c, user, models.AuditEvent{
+				Action:  models.AuditUserRoleChange,
+				Changes: map[string]models.AuditChange{"role": {Before: user.Role, After: role}},
+			})
+			user.Role = role
+		}
+	}
+
+	setSessionContext(c, types.SessionData{
+		UserID:   user.ID,
+		AuthType: "proxy",
+		Subject:  user.Username,
+	}, user.Role)
+	return true
+}
+
+// provisionProxyUser creates the local account for a proxy user. Proxy
+// users have no password and can only sign in through the proxy.
+func (m *AuthMiddleware) provisionProxyUser(c *gin.Context, username, email string, groups []string) (*types.User, error) {
+	hasUsers, err := m.db.HasUsers()
+	if err != nil {
+		return nil, err
+	}
+	role := m.proxyAuth.InitialRole(groups, !hasUsers)
+
+	if email == "" {
+		email = username
+	}
+
+	user := &types.User{
+		Username:   username,
+		Email:      email,
+		Role:       role,
+		AuthSource: types.AuthSourceProxy,
+	}
+	if err := m.db.CreateUser(user); err != nil {
+		// A concurrent request may have created the user already
+		if existing, lookupErr := m.db.GetUserByUsername(username); lookupErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+
+	log.Info().Str("username", username).Str("role", role).Msg("created user from proxy authentication")
+	m.recordProxyAudit(c, user, models.AuditEvent{
+		Action:  models.AuditUserCreate,
+		Details: map[string]interface{}{"method": "proxy", "role": role},
+	})
+	return user, nil
+}
+
+// recordProxyAudit records a change the proxy made to a user's account
+func (m *AuthMiddleware) recordProxyAudit(c *gin.Context, user *types.User, event models.AuditEvent) {
+	event.Actor = "proxy"
+	event.IP = c.ClientIP()
+	event.Target = user.Username
+	if err := m.db.CreateAuditEvent(&event); err != nil {
+		log.Error().Err(err).Str("action", event.Action).Msg("Failed to record audit event")
+	}
+}
+
+// splitProxyGroups splits a groups header. Authelia separates groups with
+// commas, Authentik with pipes.
+func splitProxyGroups(value string) []string {
+	var groups []string
+	for _, group := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '|' }) {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
@@ -6,6 +6,7 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,25 +17,42 @@ import (
 
 type RateLimiter struct {
 	store     cache.Store
-	window    time.Duration
-	limit     int
 	keyPrefix string
+
+	mu     sync.RWMutex
+	window time.Duration
+	limit  int
 }
 
 // NewRateLimiter creates a new rate limiter with the specified configuration
 func NewRateLimiter(store cache.Store, window time.Duration, limit int, keyPrefix string) *RateLimiter {
+	rl := &RateLimiter{
+		store:     store,
+		keyPrefix: keyPrefix,
+	}
+	rl.SetLimit(window, limit)
+	return rl
+}
+
+// SetLimit replaces the number of requests allowed per window
+func (rl *RateLimiter) SetLimit(window time.Duration, limit int) {
 	if window == 0 {
 		window = time.Hour
 	}
 	if limit == 0 {
 		limit = 1000
 	}
-	return &RateLimiter{
-		store:     store,
-		window:    window,
-		limit:     limit,
-		keyPrefix: keyPrefix,
-	}
+
+	rl.mu.Lock()
+	rl.window, rl.limit = window, limit
+	rl.mu.Unlock()
+}
+
+// settings returns the current window and limit
+func (rl *RateLimiter) settings() (time.Duration, int) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.window, rl.limit
 }
 
 // RateLimit returns a Gin middleware function that implements rate limiting
@@ -48,11 +66,13 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 			return
 		}
 
+		window, limit := rl.settings()
+
 		// Create key for this IP and endpoint
 		endpoint := c.Request.URL.Path
 		key := fmt.Sprintf("%s%s:%s", rl.keyPrefix, endpoint, clientIP)
 		now := time.Now().Unix()
-		windowStart := now - int64(rl.window.Seconds())
+		windowStart := now - int64(window.Seconds())
 
 		// Clean up old requests
 		if err := rl.store.CleanAndCount(c, key, windowStart); err != nil {
@@ -70,17 +90,17 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 		}
 
 		// Check if limit exceeded
-		if count >= int64(rl.limit) {
-			retryAfter := windowStart + int64(rl.window.Seconds()) - now
+		if count >= int64(limit) {
+			retryAfter := windowStart + int64(window.Seconds()) - now
 			c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
-			c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", rl.limit))
+			c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 			c.Header("X-RateLimit-Remaining", "0")
-			c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", windowStart+int64(rl.window.Seconds())))
+			c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", windowStart+int64(window.Seconds())))
 
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":       "Rate limit exceeded",
-				"limit":       rl.limit,
-				"window":      rl.window.String(),
+				"limit":       limit,
+				"window":      window.String(),
 				"retry_after": retryAfter,
 			})
 			c.Abort()
@@ -95,18 +115,18 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 		}
 
 		// Set expiration
-		if err := rl.store.Expire(c, key, rl.window); err != nil {
+		if err := rl.store.Expire(c, key, window); err != nil {
 			log.Error().Err(err).Msg("Failed to set expiration")
 		}
 
 		// Set rate limit headers
-		remaining := rl.limit - int(count) - 1
+		remaining := limit - int(count) - 1
 		if remaining < 0 {
 			remaining = 0
 		}
-		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", rl.limit))
+		c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 		c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
-		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", windowStart+int64(rl.window.Seconds())))
+		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", windowStart+int64(window.Seconds())))
 
 		c.Next()
 	}
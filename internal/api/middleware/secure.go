@@ -4,7 +4,10 @@
 package middleware
 
 import (
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +26,8 @@ type SecureConfig struct {
 	CSPFrameSrc           []string
 	CSPWorkerSrc          []string
 	CSPManifestSrc        []string
+	CSPFrameAncestors     []string
+	CSPDirectives         map[string][]string // Further directives, by name
 	HSTSEnabled           bool
 	HSTSMaxAge            int
 	HSTSIncludeSubdomains bool
@@ -50,6 +55,7 @@ func DefaultSecureConfig() *SecureConfig {
 		CSPFrameSrc:           []string{"'none'"},
 		CSPWorkerSrc:          []string{"'self'", "blob:", "http:", "https:"},
 		CSPManifestSrc:        []string{"'self'", "http:", "https:"},
+		CSPFrameAncestors:     []string{"'none'"},
 		HSTSEnabled:           true,
 		HSTSMaxAge:            31536000, // 1 year
 		HSTSIncludeSubdomains: true,
@@ -103,10 +109,63 @@ func (c *SecureConfig) buildCSPHeader() string {
 	if len(c.CSPManifestSrc) > 0 {
 		csp += "manifest-src " + joinSources(c.CSPManifestSrc) + "; "
 	}
+	if len(c.CSPFrameAncestors) > 0 {
+		csp += "frame-ancestors " + joinSources(c.CSPFrameAncestors) + "; "
+	}
+
+	names := make([]string, 0, len(c.CSPDirectives))
+	for name := range c.CSPDirectives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		csp += strings.TrimSpace(name+" "+joinSources(c.CSPDirectives[name])) + "; "
+	}
 
 	return csp
 }
 
+// SetCSPDirective replaces the sources of a CSP directive. Directives
+// without a field of their own, such as base-uri, are kept in
+// CSPDirectives. An empty source list removes the directive, except for
+// directives like upgrade-insecure-requests that take no sources.
+func (c *SecureConfig) SetCSPDirective(name string, sources []string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || strings.ContainsAny(name, " ;") {
+		return fmt.Errorf("invalid CSP directive %q", name)
+	}
+	for _, source := range sources {
+		if strings.ContainsAny(source, ";,") {
+			return fmt.Errorf("invalid source %q for CSP directive %s", source, name)
+		}
+	}
+
+	fields := map[string]*[]string{
+		"default-src":     &c.CSPDefaultSrc,
+		"script-src":      &c.CSPScriptSrc,
+		"style-src":       &c.CSPStyleSrc,
+		"img-src":         &c.CSPImgSrc,
+		"connect-src":     &c.CSPConnectSrc,
+		"font-src":        &c.CSPFontSrc,
+		"object-src":      &c.CSPObjectSrc,
+		"media-src":       &c.CSPMediaSrc,
+		"frame-src":       &c.CSPFrameSrc,
+		"worker-src":      &c.CSPWorkerSrc,
+		"manifest-src":    &c.CSPManifestSrc,
+		"frame-ancestors": &c.CSPFrameAncestors,
+	}
+	if field, ok := fields[name]; ok {
+		*field = sources
+		return nil
+	}
+
+	if c.CSPDirectives == nil {
+		c.CSPDirectives = make(map[string][]string)
+	}
+	c.CSPDirectives[name] = sources
+	return nil
+}
+
 // joinSources joins CSP sources with spaces
 func joinSources(sources []string) string {
 	if len(sources) == 0 {
@@ -0,0 +1,73 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecure_CSPDirectives(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := DefaultSecureConfig()
+	require.NoError(t, config.SetCSPDirective("frame-ancestors", []string{"'self'", "https://ha.example.com"}))
+	require.NoError(t, config.SetCSPDirective("IMG-SRC", []string{"'self'"}))
+	require.NoError(t, config.SetCSPDirective("frame-src", nil))
+	require.NoError(t, config.SetCSPDirective("upgrade-insecure-requests", nil))
+	require.NoError(t, config.SetCSPDirective("base-uri", []string{"'self'"}))
+	assert.Error(t, config.SetCSPDirective("script-src; img-src", nil))
+	assert.Error(t, config.SetCSPDirective("script-src", []string{"'self'; img-src *"}))
+	config.FrameGuardEnabled = false
+
+	router := gin.New()
+	router.Use(Secure(config))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	csp := w.Header().Get("Content-Security-Policy")
+	assert.Contains(t, csp, "frame-ancestors 'self' https://ha.example.com; ")
+	assert.Contains(t, csp, "img-src 'self'; ")
+	assert.NotContains(t, csp, "frame-src")
+	assert.Contains(t, csp, "base-uri 'self'; upgrade-insecure-requests; ")
+	assert.Empty(t, w.Header().Get("X-Frame-Options"))
+}
+
+func TestCORSConfig_Validate(t *testing.T) {
+	assert.NoError(t, DefaultCORSConfig().Validate())
+	assert.NoError(t, (&CORSConfig{AllowOrigins: []string{"https://*.example.com"}, AllowCredentials: true}).Validate())
+	assert.Error(t, (&CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}).Validate())
+	assert.Error(t, (&CORSConfig{AllowOrigins: []string{"example.com"}}).Validate())
+	assert.Error(t, (&CORSConfig{}).Validate())
+}
+
+func TestSetupCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(SetupCORS(&CORSConfig{AllowOrigins: []string{"https://dash.example.com"}, AllowCredentials: true}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	request := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("https://dash.example.com")
+	assert.Equal(t, "https://dash.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = request("https://evil.example.net")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -4,8 +4,6 @@
 package routes
 
 import (
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,59 +11,64 @@ import (
 
 	"github.com/autobrr/dashbrr/internal/api/handlers"
 	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/config"
 	"github.com/autobrr/dashbrr/internal/database"
 	"github.com/autobrr/dashbrr/internal/services"
 	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/core"
+	"github.com/autobrr/dashbrr/internal/services/ldap"
+	"github.com/autobrr/dashbrr/internal/services/lockout"
+	"github.com/autobrr/dashbrr/internal/services/passkey"
 	"github.com/autobrr/dashbrr/internal/types"
 )
 
-// SetupRoutes configures all the routes for the application
-func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService) cache.Store {
+// SetupRoutes configures all the routes for the application. The returned
+// runtime applies reloaded settings to the routes.
+func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService, cfg *config.Config) *Runtime {
 	// Use custom logger instead of default Gin logger
 	r.Use(middleware.Logger())
 	r.Use(gin.Recovery())
-	r.Use(middleware.SetupCORS())
-	r.Use(middleware.Secure(nil)) // Add secure middleware with default config
-
-	// Initialize cache with database directory for session storage
-	cacheConfig := cache.Config{
-		DataDir: filepath.Dir(os.Getenv("DASHBRR__DB_PATH")), // Use same directory as database
+	cors := middleware.NewCORS(corsConfig(cfg.Server.CORS))
+	r.Use(cors.Handler())
+	r.Use(middleware.Secure(secureConfig(cfg.Server.Security)))
+
+	// Cookie attributes and CSRF protection for cookie-authenticated requests
+	csrf := csrfConfig(cfg.Server)
+	r.Use(middleware.Cookies(csrf.Path, csrf.SameSite))
+	if cfg.Server.CSRF.Disabled {
+		log.Warn().Msg("CSRF protection is disabled")
+	} else {
+		r.Use(middleware.CSRF(csrf))
 	}
 
-	// Configure Redis if enabled
-	if os.Getenv("REDIS_HOST") != "" {
-		host := os.Getenv("REDIS_HOST")
-		port := os.Getenv("REDIS_PORT")
-		if port == "" {
-			port = "6379"
-		}
-		cacheConfig.RedisAddr = host + ":" + port
-	}
+	// Initialize cache, persisting sessions next to the database unless
+	// another directory is configured
+	cacheConfig := cache.NewConfigFromSettings(cfg.Cache, gin.Mode() != gin.ReleaseMode)
 
 	store, err := cache.InitCache(cacheConfig)
 	if err != nil {
 		// This should never happen as InitCache always returns a valid store
 		log.Debug().Err(err).Msg("Using memory cache")
-		store = cache.NewMemoryStore(cacheConfig.DataDir)
+		store = cache.NewBoundedMemoryStore(cacheConfig.DataDir, cacheConfig.Limits)
 	}
+	core.SetCache(store)
 
-	// Determine cache type based on environment and Redis configuration
+	// Determine the cache type that was set up, after any fallback
 	cacheType := "memory"
-	if os.Getenv("CACHE_TYPE") == "redis" && os.Getenv("REDIS_HOST") != "" {
+	switch store.(type) {
+	case *cache.RedisStore:
 		cacheType = "redis"
+	case *cache.DiskStore:
+		cacheType = "disk"
 	}
 	log.Debug().Str("type", cacheType).Msg("Cache initialized")
 
-	// Create rate limiters with different configurations
-	apiRateLimiter := middleware.NewRateLimiter(store, time.Minute, 60, "api:")       // 60 requests per minute for API
-	healthRateLimiter := middleware.NewRateLimiter(store, time.Minute, 30, "health:") // 30 health checks per minute
-	authRateLimiter := middleware.NewRateLimiter(store, time.Minute, 30, "auth:")     // 30 auth requests per minute
+	// Create rate limiters for groups of endpoints
+	limiters := newRateLimiters(store)
+	limiters.apply(cfg.RateLimits)
 
-	// Special rate limiter for Tailscale services
-	tailscaleRateLimiter := middleware.NewRateLimiter(store, 2*time.Minute, 20, "tailscale:") // 20 requests per 2 minutes
-
-	// Create cache middleware (now handles TTLs internally)
-	cacheMiddleware := middleware.NewCacheMiddleware(store)
+	// Create cache middleware with the configured TTLs and stale grace
+	cacheMiddleware := middleware.NewCacheMiddleware(store, responseCacheConfig(cfg.Cache))
 
 	// Initialize handlers with cache
 	settingsHandler := handlers.NewSettingsHandler(db, health)
@@ -80,28 +83,45 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 	sonarrHandler := handlers.NewSonarrHandler(db, store)
 	radarrHandler := handlers.NewRadarrHandler(db, store)
 	prowlarrHandler := handlers.NewProwlarrHandler(db, store)
+	auditHandler := handlers.NewAuditHandler(db)
+	cacheAdminHandler := handlers.NewCacheAdminHandler(db, store)
+	userHandler := handlers.NewUserHandler(db)
+	tokenHandler := handlers.NewTokenHandler(db)
 
 	// Initialize auth handlers and middleware
 	var oidcAuthHandler *handlers.AuthHandler
-	builtinAuthHandler := handlers.NewBuiltinAuthHandler(db, store)
-	authMiddleware := middleware.NewAuthMiddleware(store)
+	ldapAuth := ldapAuthenticator(cfg.Auth.LDAP)
+	proxyAuth := proxyAuthConfig(cfg.Auth.Proxy)
+	guard := lockout.New(db, lockoutConfig(cfg.Auth.Lockout))
+	builtinAuthHandler := handlers.NewBuiltinAuthHandler(db, store, ldapAuth, guard)
+	passkeyHandler := newPasskeyHandler(db, builtinAuthHandler, cfg.Auth.WebAuthn)
+	authMiddleware := middleware.NewAuthMiddleware(store, db, proxyAuth)
 
 	// Initialize OIDC if configuration is provided
-	if hasOIDCConfig() {
+	if oidc := cfg.Auth.OIDC; hasOIDCConfig(oidc) {
 		authConfig := &types.AuthConfig{
-			Issuer:       getEnvOrDefault("OIDC_ISSUER", ""),
-			ClientID:     getEnvOrDefault("OIDC_CLIENT_ID", ""),
-			ClientSecret: getEnvOrDefault("OIDC_CLIENT_SECRET", ""),
-			RedirectURL:  getEnvOrDefault("OIDC_REDIRECT_URL", "http://localhost:3000/api/auth/callback"),
+			Issuer:       oidc.Issuer,
+			ClientID:     oidc.ClientID,
+			ClientSecret: oidc.ClientSecret,
+			RedirectURL:  valueOrDefault(oidc.RedirectURL, "http://localhost:3000"+cfg.Server.BasePath+"/api/auth/callback"),
+			Scopes:       oidc.Scopes,
+
+			GroupsClaim:    valueOrDefault(oidc.GroupsClaim, "groups"),
+			AdminGroups:    oidc.AdminGroups,
+			OperatorGroups: oidc.OperatorGroups,
+			DefaultRole:    oidc.DefaultRole,
 		}
-		oidcAuthHandler = handlers.NewAuthHandler(authConfig, store)
+		oidcAuthHandler = handlers.NewAuthHandler(authConfig, db, store)
 	}
 
 	// Start the health monitor
 	eventsHandler.StartHealthMonitor()
 
+	// All routes live under the configured base path
+	base := r.Group(cfg.Server.BasePath)
+
 	// Public routes (no auth required)
-	public := r.Group("")
+	public := base.Group("")
 	{
 		// Health check endpoint
 		public.GET("/health", func(c *gin.Context) {
@@ -109,13 +129,21 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 		})
 
 		// Auth configuration endpoint
-		public.GET("/api/auth/config", handlers.GetAuthConfig)
+		public.GET("/api/auth/config", handlers.GetAuthConfig(handlers.AuthMethods{
+			OIDC:    oidcAuthHandler != nil,
+			LDAP:    ldapAuth != nil,
+			Proxy:   proxyAuth != nil,
+			Passkey: passkeyHandler != nil,
+		}))
+
+		// CSRF token for the frontend to send with state-changing requests
+		public.GET("/api/auth/csrf", middleware.CSRFToken(csrf))
 
 		// OIDC auth endpoints (only if OIDC is configured)
 		if oidcAuthHandler != nil {
 			public.GET("/api/auth/callback", oidcAuthHandler.Callback)
 			oidcAuth := public.Group("/api/auth/oidc")
-			oidcAuth.Use(authRateLimiter.RateLimit())
+			oidcAuth.Use(limiters.auth.RateLimit())
 			{
 				oidcAuth.GET("/login", oidcAuthHandler.Login)
 				oidcAuth.POST("/logout", oidcAuthHandler.Logout)
@@ -124,20 +152,26 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 
 		// Built-in auth endpoints
 		builtinAuth := public.Group("/api/auth")
-		builtinAuth.Use(authRateLimiter.RateLimit())
+		builtinAuth.Use(limiters.auth.RateLimit())
 		{
 			builtinAuth.GET("/registration-status", builtinAuthHandler.CheckRegistrationStatus)
 			builtinAuth.POST("/register", builtinAuthHandler.Register)
+			builtinAuth.GET("/invite/:token", builtinAuthHandler.GetInvite)
 			builtinAuth.POST("/login", builtinAuthHandler.Login)
+			builtinAuth.POST("/login/2fa", builtinAuthHandler.LoginTwoFactor)
+			if passkeyHandler != nil {
+				builtinAuth.POST("/passkey/login/begin", passkeyHandler.BeginLogin)
+				builtinAuth.POST("/passkey/login/finish", passkeyHandler.FinishLogin)
+			}
 			builtinAuth.POST("/logout", builtinAuthHandler.Logout)
 			builtinAuth.GET("/verify", builtinAuthHandler.Verify)
 		}
 	}
 
 	// Protected auth routes
-	protectedAuth := r.Group("/api/auth")
+	protectedAuth := base.Group("/api/auth")
 	protectedAuth.Use(authMiddleware.RequireAuth())
-	protectedAuth.Use(authRateLimiter.RateLimit())
+	protectedAuth.Use(limiters.auth.RateLimit())
 	{
 		if oidcAuthHandler != nil {
 			oidc := protectedAuth.Group("/oidc")
@@ -148,23 +182,89 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 			}
 		}
 		protectedAuth.GET("/userinfo", builtinAuthHandler.GetUserInfo)
+
+		// Signed-in sessions of password logins
+		sessions := protectedAuth.Group("/sessions")
+		{
+			sessions.GET("", builtinAuthHandler.ListSessions)
+			sessions.DELETE("", builtinAuthHandler.RevokeAllSessions)
+			sessions.DELETE("/:id", builtinAuthHandler.RevokeSession)
+		}
+
+		// Two-factor authentication for password logins
+		twoFactor := protectedAuth.Group("/2fa")
+		{
+			twoFactor.GET("", builtinAuthHandler.GetTwoFactorStatus)
+			twoFactor.POST("/setup", builtinAuthHandler.SetupTwoFactor)
+			twoFactor.POST("/enable", builtinAuthHandler.EnableTwoFactor)
+			twoFactor.POST("/disable", builtinAuthHandler.DisableTwoFactor)
+		}
+
+		// Passkeys of local accounts
+		if passkeyHandler != nil {
+			passkeys := protectedAuth.Group("/passkeys")
+			{
+				passkeys.GET("", passkeyHandler.ListPasskeys)
+				passkeys.POST("/register/begin", passkeyHandler.BeginRegistration)
+				passkeys.POST("/register/finish", passkeyHandler.FinishRegistration)
+				passkeys.DELETE("/:id", passkeyHandler.DeletePasskey)
+			}
+		}
 	}
 
+	// Role checks for endpoints that change state
+	requireOperator := authMiddleware.RequireRole(types.RoleOperator)
+	requireAdmin := authMiddleware.RequireRole(types.RoleAdmin)
+
 	// API routes group with auth middleware
-	api := r.Group("/api")
+	api := base.Group("/api")
 	api.Use(authMiddleware.RequireAuth())
+	api.Use(authMiddleware.RequireRole(types.RoleViewer))
+	api.Use(middleware.Compress(middleware.DefaultCompressMinSize))
 	{
 		// Settings endpoints - no caching to ensure fresh data
 		settings := api.Group("/settings")
 		{
 			settings.GET("", settingsHandler.GetSettings)
-			settings.POST("/:instance", settingsHandler.SaveSettings)
-			settings.DELETE("/:instance", settingsHandler.DeleteSettings)
+			settings.POST("/:instance", requireAdmin, cacheMiddleware.InvalidateOnSuccess(), settingsHandler.SaveSettings)
+			settings.DELETE("/:instance", requireAdmin, cacheMiddleware.InvalidateOnSuccess(), settingsHandler.DeleteSettings)
+		}
+
+		// Audit log
+		api.GET("/audit", requireAdmin, auditHandler.GetEvents)
+
+		// Cache administration
+		admin := api.Group("/admin")
+		admin.Use(requireAdmin)
+		{
+			admin.GET("/cache", cacheAdminHandler.GetStats)
+			admin.POST("/cache/purge", cacheAdminHandler.Purge)
+		}
+
+		// Personal API tokens
+		tokens := api.Group("/tokens")
+		{
+			tokens.GET("", tokenHandler.ListTokens)
+			tokens.POST("", tokenHandler.CreateToken)
+			tokens.DELETE("/:id", tokenHandler.RevokeToken)
+		}
+
+		// User management
+		users := api.Group("/users")
+		users.Use(requireAdmin)
+		{
+			users.GET("", userHandler.ListUsers)
+			users.POST("", userHandler.CreateUser)
+			users.PATCH("/:id", userHandler.UpdateUser)
+			users.DELETE("/:id", userHandler.DeleteUser)
+			users.GET("/invites", userHandler.ListInvites)
+			users.POST("/invites", userHandler.CreateInvite)
+			users.DELETE("/invites/:id", userHandler.DeleteInvite)
 		}
 
 		// Health check endpoints (no cache for SSE)
 		health := api.Group("/health")
-		health.Use(healthRateLimiter.RateLimit())
+		health.Use(limiters.health.RateLimit())
 		{
 			health.GET("/:service", healthHandler.CheckHealth)
 			health.GET("/events", eventsHandler.StreamHealth)
@@ -175,7 +275,7 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 		{
 			// Regular services with standard rate limit
 			regularServices := services.Group("")
-			regularServices.Use(apiRateLimiter.RateLimit())
+			regularServices.Use(limiters.api.RateLimit())
 			regularServices.Use(cacheMiddleware.Cache())
 			{
 				regularServices.GET("/autobrr/stats", autobrrHandler.GetAutobrrReleaseStats)
@@ -194,14 +294,14 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 				{
 					sonarr.GET("/queue", sonarrHandler.GetQueue)
 					sonarr.GET("/stats", sonarrHandler.GetStats)
-					sonarr.DELETE("/queue/:id", sonarrHandler.DeleteQueueItem)
+					sonarr.DELETE("/queue/:id", requireOperator, sonarrHandler.DeleteQueueItem)
 				}
 
 				// Radarr endpoints
 				radarr := regularServices.Group("/radarr")
 				{
 					radarr.GET("/queue", radarrHandler.GetQueue)
-					radarr.DELETE("/queue/:id", radarrHandler.DeleteQueueItem)
+					radarr.DELETE("/queue/:id", requireOperator, radarrHandler.DeleteQueueItem)
 				}
 
 				// Prowlarr endpoints
@@ -216,6 +316,7 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 				{
 					omegabrr.GET("/status", omegabrrHandler.GetOmegabrrStatus)
 					webhook := omegabrr.Group("/webhook")
+					webhook.Use(requireOperator)
 					{
 						webhook.POST("/arrs", omegabrrHandler.TriggerWebhookArrs)
 						webhook.POST("/lists", omegabrrHandler.TriggerWebhookLists)
@@ -226,7 +327,7 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 
 			// Tailscale services with special rate limit
 			tailscaleServices := services.Group("")
-			tailscaleServices.Use(tailscaleRateLimiter.RateLimit())
+			tailscaleServices.Use(limiters.tailscale.RateLimit())
 			tailscaleServices.Use(cacheMiddleware.Cache())
 			{
 				tailscaleServices.GET("/tailscale/devices", tailscaleHandler.GetTailscaleDevices)
@@ -234,7 +335,9 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 
 			// Service action endpoints that require instanceId
 			serviceActions := services.Group("/services/:instanceId")
-			serviceActions.Use(apiRateLimiter.RateLimit())
+			serviceActions.Use(limiters.api.RateLimit())
+			serviceActions.Use(requireOperator)
+			serviceActions.Use(cacheMiddleware.InvalidateOnSuccess())
 			{
 				// Overseerr action endpoints
 				overseerrActions := serviceActions.Group("/overseerr")
@@ -245,19 +348,223 @@ func SetupRoutes(r *gin.Engine, db *database.DB, health *services.HealthService)
 		}
 	}
 
-	return store
+	return &Runtime{
+		Store:    store,
+		cors:     cors,
+		cache:    cacheMiddleware,
+		guard:    guard,
+		limiters: limiters,
+	}
+}
+
+// corsConfig returns the cross-origin settings. An invalid configuration
+// falls back to the defaults.
+func corsConfig(cors config.CORSConfig) *middleware.CORSConfig {
+	corsConfig := middleware.DefaultCORSConfig()
+	if len(cors.AllowedOrigins) == 0 {
+		return corsConfig
+	}
+
+	configured := &middleware.CORSConfig{
+		AllowOrigins:     cors.AllowedOrigins,
+		AllowCredentials: cors.AllowCredentials,
+	}
+	if err := configured.Validate(); err != nil {
+		log.Error().Err(err).Msg("Invalid CORS configuration, allowing all origins without credentials")
+		return corsConfig
+	}
+	return configured
+}
+
+// secureConfig returns the security header settings, applying the
+// configured overrides to the defaults
+func secureConfig(security config.SecurityConfig) *middleware.SecureConfig {
+	secure := middleware.DefaultSecureConfig()
+	secure.CSPEnabled = !security.CSPDisabled
+
+	if len(security.FrameAncestors) > 0 {
+		secure.CSPFrameAncestors = security.FrameAncestors
+	}
+	for name, sources := range security.CSP {
+		if err := secure.SetCSPDirective(name, sources); err != nil {
+			log.Error().Err(err).Msg("Ignoring CSP directive")
+		}
+	}
+
+	// Only CSP can allow a list of origins to frame the UI, so
+	// X-Frame-Options is dropped when framing is allowed
+	if secure.CSPEnabled && !(len(secure.CSPFrameAncestors) == 1 && secure.CSPFrameAncestors[0] == "'none'") {
+		secure.FrameGuardEnabled = false
+	}
+
+	if security.ReferrerPolicy != "" {
+		secure.ReferrerPolicy = security.ReferrerPolicy
+	}
+
+	hsts := security.HSTS
+	secure.HSTSEnabled = !hsts.Disabled
+	if hsts.MaxAge > 0 {
+		secure.HSTSMaxAge = hsts.MaxAge
+	}
+	if hsts.IncludeSubdomains != nil {
+		secure.HSTSIncludeSubdomains = *hsts.IncludeSubdomains
+	}
+	if hsts.Preload != nil {
+		secure.HSTSPreload = *hsts.Preload
+	}
+	return secure
+}
+
+// csrfConfig returns the CSRF protection settings. The cookie is scoped to
+// the base path, which also prefixes the exempt paths. An invalid SameSite
+// value falls back to lax.
+func csrfConfig(server config.ServerConfig) *middleware.CSRFConfig {
+	csrf := middleware.DefaultCSRFConfig()
+	if server.BasePath != "" {
+		csrf.Path = server.BasePath
+	}
+	sameSite, err := middleware.ParseSameSite(server.Cookies.SameSite)
+	if err != nil {
+		log.Warn().Err(err).Msg("Invalid cookie SameSite setting, using lax")
+	} else {
+		csrf.SameSite = sameSite
+	}
+	for _, path := range server.CSRF.ExemptPaths {
+		csrf.ExemptPaths = append(csrf.ExemptPaths, server.BasePath+path)
+	}
+	return csrf
+}
+
+// responseCacheConfig returns the response cache settings, applying the
+// configured TTLs to the defaults
+func responseCacheConfig(settings config.CacheConfig) *middleware.CacheConfig {
+	ttl := settings.TTL
+	cacheConfig := middleware.DefaultCacheConfig()
+	cacheConfig.PerUser = settings.PerUser
+	if grace := time.Duration(settings.StaleGrace); grace != 0 {
+		// A negative grace turns stale responses off
+		cacheConfig.StaleGrace = max(grace, 0)
+	}
+	if ttl.Default > 0 {
+		cacheConfig.DefaultTTL = time.Duration(ttl.Default)
+	}
+	if ttl.Health > 0 {
+		cacheConfig.HealthTTL = time.Duration(ttl.Health)
+	}
+
+	services := map[string]config.Duration{
+		"/plex/sessions": ttl.PlexSessions,
+		"/autobrr":       ttl.Autobrr,
+		"/overseerr":     ttl.Overseerr,
+		"/maintainerr":   ttl.Maintainerr,
+		"/sonarr":        ttl.Sonarr,
+		"/radarr":        ttl.Radarr,
+		"/prowlarr":      ttl.Prowlarr,
+	}
+	for fragment, value := range services {
+		if value > 0 {
+			cacheConfig.ServiceTTLs[fragment] = time.Duration(value)
+		}
+	}
+	return cacheConfig
 }
 
 // hasOIDCConfig checks if all required OIDC configuration is provided
-func hasOIDCConfig() bool {
-	return os.Getenv("OIDC_ISSUER") != "" &&
-		os.Getenv("OIDC_CLIENT_ID") != "" &&
-		os.Getenv("OIDC_CLIENT_SECRET") != ""
+func hasOIDCConfig(oidc config.OIDCConfig) bool {
+	return oidc.Issuer != "" && oidc.ClientID != "" && oidc.ClientSecret != ""
+}
+
+// proxyAuthConfig returns the forward auth configuration, or nil when no
+// trusted proxies are configured
+func proxyAuthConfig(proxy config.ProxyAuthConfig) *types.ProxyAuthConfig {
+	if len(proxy.TrustedProxies) == 0 {
+		return nil
+	}
+
+	networks, err := types.ParseTrustedProxies(proxy.TrustedProxies)
+	if err != nil {
+		log.Error().Err(err).Msg("Proxy authentication disabled")
+		return nil
+	}
+
+	log.Info().Strs("trusted_proxies", proxy.TrustedProxies).Msg("Proxy authentication enabled")
+	return &types.ProxyAuthConfig{
+		TrustedProxies: networks,
+		UserHeader:     valueOrDefault(proxy.UserHeader, middleware.DefaultProxyUserHeader),
+		EmailHeader:    valueOrDefault(proxy.EmailHeader, middleware.DefaultProxyEmailHeader),
+		GroupsHeader:   valueOrDefault(proxy.GroupsHeader, middleware.DefaultProxyGroupsHeader),
+
+		GroupRoleMapping: types.GroupRoleMapping{
+			AdminGroups:    proxy.AdminGroups,
+			OperatorGroups: proxy.OperatorGroups,
+			DefaultRole:    proxy.DefaultRole,
+		},
+	}
+}
+
+// ldapAuthenticator returns the LDAP login backend, or nil when no LDAP
+// URL is configured
+func ldapAuthenticator(ldapConfig config.LDAPConfig) *ldap.Authenticator {
+	if ldapConfig.URL == "" {
+		return nil
+	}
+
+	log.Info().Str("url", ldapConfig.URL).Msg("LDAP authentication enabled")
+	return ldap.New(types.LDAPConfig{
+		URL:                ldapConfig.URL,
+		StartTLS:           ldapConfig.StartTLS,
+		InsecureSkipVerify: ldapConfig.InsecureSkipVerify,
+		BindDN:             ldapConfig.BindDN,
+		BindPassword:       ldapConfig.BindPassword,
+		BaseDN:             ldapConfig.BaseDN,
+		UserFilter:         ldapConfig.UserFilter,
+		UsernameAttribute:  ldapConfig.UsernameAttribute,
+		EmailAttribute:     ldapConfig.EmailAttribute,
+		GroupBaseDN:        ldapConfig.GroupBaseDN,
+		GroupFilter:        ldapConfig.GroupFilter,
+		GroupNameAttribute: ldapConfig.GroupNameAttribute,
+		GroupRoleMapping: types.GroupRoleMapping{
+			AdminGroups:    ldapConfig.AdminGroups,
+			OperatorGroups: ldapConfig.OperatorGroups,
+			DefaultRole:    ldapConfig.DefaultRole,
+		},
+	})
+}
+
+// lockoutConfig returns the brute-force protection settings for password
+// logins
+func lockoutConfig(lockoutConfig config.LockoutConfig) types.LockoutConfig {
+	return types.LockoutConfig{
+		Threshold:  lockoutConfig.Threshold,
+		Duration:   time.Duration(lockoutConfig.Duration),
+		WebhookURL: lockoutConfig.WebhookURL,
+	}
+}
+
+// newPasskeyHandler returns the passkey endpoints, or nil when no relying
+// party ID is configured
+func newPasskeyHandler(db *database.DB, auth *handlers.BuiltinAuthHandler, webAuthn config.WebAuthnConfig) *handlers.PasskeyHandler {
+	if webAuthn.RPID == "" {
+		return nil
+	}
+
+	service, err := passkey.New(db, types.WebAuthnConfig{
+		RPID:          webAuthn.RPID,
+		RPDisplayName: webAuthn.RPDisplayName,
+		RPOrigins:     webAuthn.RPOrigins,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Passkey login disabled")
+		return nil
+	}
+
+	log.Info().Str("rp_id", webAuthn.RPID).Msg("Passkey login enabled")
+	return handlers.NewPasskeyHandler(auth, service)
 }
 
-// getEnvOrDefault returns the value of an environment variable or a default value if not set
-func getEnvOrDefault(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
+// valueOrDefault returns value, or defaultValue when it is empty
+func valueOrDefault(value, defaultValue string) string {
+	if value != "" {
 		return value
 	}
 	return defaultValue
@@ -0,0 +1,93 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/config"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/services"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestSettingsRequireCSRFWithSessionCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	cfg, err := config.Load(filepath.Join(dir, "config.toml"), config.Flags{})
+	require.NoError(t, err)
+	cfg.Database.Path = filepath.Join(dir, "dashbrr.db")
+	cfg.Cache.Type = "memory"
+	cfg.Cache.Dir = dir
+
+	db, err := database.InitDB(cfg.Database.Path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	r := gin.New()
+	runtime := SetupRoutes(r, db, services.NewHealthService(), cfg)
+	t.Cleanup(func() { runtime.Store.Close() })
+
+	// Sign in an admin the way the login handler does
+	admin := &types.User{Username: "admin", Email: "admin@example.com", PasswordHash: "hash", Role: types.RoleAdmin}
+	require.NoError(t, db.CreateUser(admin))
+	const token = "session-token"
+	require.NoError(t, db.CreateSession(&types.Session{UserID: admin.ID, ExpiresAt: time.Now().Add(time.Hour)}, token))
+	require.NoError(t, runtime.Store.Set(context.Background(), "session:"+token, types.SessionData{
+		UserID:    admin.ID,
+		AuthType:  "builtin",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, time.Hour))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/csrf", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Token string `json:"csrf_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	csrfCookies := w.Result().Cookies()
+	require.NotEmpty(t, csrfCookies)
+
+	// The UI sends the session cookie alongside its bearer token
+	save := func(csrfToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/settings/sonarr-1",
+			strings.NewReader(`{"displayName":"Sonarr","url":"http://sonarr:8989","apiKey":"key"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.AddCookie(&http.Cookie{Name: "session", Value: token})
+		for _, cookie := range csrfCookies {
+			req.AddCookie(cookie)
+		}
+		if csrfToken != "" {
+			req.Header.Set("X-CSRF-Token", csrfToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w = save("")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "CSRF token missing")
+
+	w = save(body.Token)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	service, err := db.GetServiceByInstanceID("sonarr-1")
+	require.NoError(t, err)
+	require.NotNil(t, service)
+	assert.Equal(t, "Sonarr", service.DisplayName)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package routes
+
+import (
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/api/middleware"
+	"github.com/autobrr/dashbrr/internal/config"
+	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/lockout"
+)
+
+// Runtime holds the parts of the routes whose settings can change while
+// the server runs
+type Runtime struct {
+	Store cache.Store
+
+	cors     *middleware.CORS
+	cache    *middleware.CacheMiddleware
+	guard    *lockout.Guard
+	limiters *rateLimiters
+}
+
+// Apply updates the routes to a reloaded configuration: rate limits, cache
+// settings, CORS origins and login lockout settings
+func (rt *Runtime) Apply(cfg *config.Config) {
+	rt.limiters.apply(cfg.RateLimits)
+	rt.cache.SetConfig(responseCacheConfig(cfg.Cache))
+	rt.cors.SetConfig(corsConfig(cfg.Server.CORS))
+	rt.guard.SetConfig(lockoutConfig(cfg.Auth.Lockout))
+}
+
+// rateLimiters are the rate limiters of groups of endpoints
+type rateLimiters struct {
+	api       *middleware.RateLimiter
+	health    *middleware.RateLimiter
+	auth      *middleware.RateLimiter
+	tailscale *middleware.RateLimiter
+}
+
+func newRateLimiters(store cache.Store) *rateLimiters {
+	return &rateLimiters{
+		api:       middleware.NewRateLimiter(store, 0, 0, "api:"),
+		health:    middleware.NewRateLimiter(store, 0, 0, "health:"),
+		auth:      middleware.NewRateLimiter(store, 0, 0, "auth:"),
+		tailscale: middleware.NewRateLimiter(store, 0, 0, "tailscale:"),
+	}
+}
+
+// apply sets the limits, with configured values replacing the defaults
+func (l *rateLimiters) apply(limits config.RateLimitsConfig) {
+	setLimit(l.api, limits.API, time.Minute, 60)               // 60 requests per minute for API
+	setLimit(l.health, limits.Health, time.Minute, 30)         // 30 health checks per minute
+	setLimit(l.auth, limits.Auth, time.Minute, 30)             // 30 auth requests per minute
+	setLimit(l.tailscale, limits.Tailscale, 2*time.Minute, 20) // 20 requests per 2 minutes for Tailscale services
+}
+
+// setLimit sets the limit of a rate limiter, with the configured limit
+// replacing the default
+func setLimit(rl *middleware.RateLimiter, limit config.RateLimitConfig, window time.Duration, requests int) {
+	if limit.Window > 0 {
+		window = time.Duration(limit.Window)
+	}
+	if limit.Requests > 0 {
+		requests = limit.Requests
+	}
+	rl.SetLimit(window, requests)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/commands/base"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+// AuditCommand shows the audit log
+type AuditCommand struct {
+	*base.BaseCommand
+	db *database.DB
+}
+
+func NewAuditCommand(db *database.DB) *AuditCommand {
+	return &AuditCommand{
+		BaseCommand: base.NewBaseCommand(
+			"audit",
+			"Show the audit log of configuration and administrative actions",
+			"list [--limit=<n>] [--action=<action>] [--actor=<user>] [--target=<target>] [--since=<duration|RFC3339>] [--json]\n\n"+
+				"Examples:\n"+
+				"  dashbrr run audit list\n"+
+				"  dashbrr run audit list --action=service.delete --since=24h\n"+
+				"  dashbrr run audit list --actor=admin --json",
+		),
+		db: db,
+	}
+}
+
+func (c *AuditCommand) Execute(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("insufficient arguments. %s", c.Usage())
+	}
+
+	switch args[0] {
+	case "list":
+		return c.list(args[1:])
+	default:
+		return fmt.Errorf("unknown subcommand: %s\n\n%s", args[0], c.Usage())
+	}
+}
+
+func (c *AuditCommand) list(args []string) error {
+	filter := models.AuditFilter{Limit: 50}
+	jsonOutput := false
+
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			jsonOutput = true
+		case strings.HasPrefix(arg, "--limit="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--limit="))
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid limit: %s", arg)
+			}
+			filter.Limit = n
+		case strings.HasPrefix(arg, "--action="):
+			filter.Action = strings.TrimPrefix(arg, "--action=")
+		case strings.HasPrefix(arg, "--actor="):
+			filter.Actor = strings.TrimPrefix(arg, "--actor=")
+		case strings.HasPrefix(arg, "--target="):
+			filter.Target = strings.TrimPrefix(arg, "--target=")
+		case strings.HasPrefix(arg, "--since="):
+			since, err := parseSince(strings.TrimPrefix(arg, "--since="))
+			if err != nil {
+				return err
+			}
+			filter.Since = since
+		default:
+			return fmt.Errorf("unknown flag: %s\n\n%s", arg, c.Usage())
+		}
+	}
+
+	events, err := c.db.ListAuditEvents(filter)
+	if err != nil {
+		return fmt.Errorf("failed to list audit events: %v", err)
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(events)
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No audit events found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTOR\tIP\tACTION\tTARGET\tSTATUS\tCHANGES")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			event.CreatedAt.Local().Format(time.DateTime),
+			event.Actor,
+			valueOrDash(event.IP),
+			event.Action,
+			valueOrDash(event.Target),
+			event.Status,
+			formatChanges(event.Changes),
+		)
+	}
+	return w.Flush()
+}
+
+// parseSince accepts either a relative duration ("24h") or an RFC3339 timestamp
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since value %q: use a duration like 24h or an RFC3339 timestamp", value)
+	}
+	return t, nil
+}
+
+func formatChanges(changes map[string]models.AuditChange) string {
+	if len(changes) == 0 {
+		return "-"
+	}
+	fields := make([]string, 0, len(changes))
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		change := changes[field]
+		parts = append(parts, fmt.Sprintf("%s: %v -> %v", field, change.Before, change.After))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -26,14 +26,20 @@ func NewConfigCommand(db *database.DB) *ConfigCommand {
 			"Usage:\n"+
 				"  dashbrr run config discover [--docker] [--k8s]\n"+
 				"  dashbrr run config import <file>\n"+
-				"  dashbrr run config export [--format=<yaml|json>] [--mask-secrets] [--output=<file>]\n\n"+
+				"  dashbrr run config export [--format=<yaml|json>] [--mask-secrets] [--output=<file>]\n"+
+				"  dashbrr run config validate [path] [--offline]\n"+
+				"  dashbrr run config schema [--output=<file>]\n\n"+
 				"Examples:\n"+
 				"  # Discover services from Docker labels\n"+
 				"  dashbrr run config discover --docker\n\n"+
 				"  # Import services from external config\n"+
 				"  dashbrr run config import services.yaml\n\n"+
 				"  # Export configurations\n"+
-				"  dashbrr run config export --format=yaml --mask-secrets --output=services.yaml",
+				"  dashbrr run config export --format=yaml --mask-secrets --output=services.yaml\n\n"+
+				"  # Check the config file without connecting to the database\n"+
+				"  dashbrr run config validate config.toml --offline\n\n"+
+				"  # Write a JSON Schema for editor completion\n"+
+				"  dashbrr run config schema --output=dashbrr.schema.json",
 		),
 		db: db,
 	}
@@ -54,6 +60,10 @@ func (c *ConfigCommand) Execute(ctx context.Context, args []string) error {
 		return c.handleImport(ctx, subcommandArgs)
 	case "export":
 		return c.handleExport(ctx, subcommandArgs)
+	case "validate":
+		return c.handleValidate(subcommandArgs)
+	case "schema":
+		return c.handleSchema(subcommandArgs)
 	default:
 		return fmt.Errorf("unknown subcommand: %s\n\n%s", subcommand, c.Usage())
 	}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	appconfig "github.com/autobrr/dashbrr/internal/config"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/services/cache"
+)
+
+// handleValidate checks a config file and whether the database and Redis
+// it configures can be reached
+func (c *ConfigCommand) handleValidate(args []string) error {
+	path := ""
+	connect := true
+	for _, arg := range args {
+		switch {
+		case arg == "--offline":
+			connect = false
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown flag: %s\n\n%s", arg, c.Usage())
+		case path == "":
+			path = arg
+		default:
+			return fmt.Errorf("config validate takes a single file\n\n%s", c.Usage())
+		}
+	}
+	if path == "" {
+		path = appconfig.DefaultPath()
+	}
+
+	problems, err := appconfig.ValidateFile(path)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem.Format(path))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %d problem(s) found", path, len(problems))
+	}
+
+	if connect {
+		if err := checkConnections(path); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
+
+// checkConnections connects to the database and Redis configured in the
+// file at path
+func checkConnections(path string) error {
+	cfg, err := appconfig.Load(path, appconfig.Flags{})
+	if err != nil {
+		return err
+	}
+
+	if err := database.Ping(database.NewConfigFromSettings(cfg.Database)); err != nil {
+		return fmt.Errorf("%s: database: cannot connect to %s: %v", path, cfg.Database.Type, err)
+	}
+	fmt.Printf("Database (%s): reachable\n", cfg.Database.Type)
+
+	// Without a type the cache uses Redis whenever a host is given
+	addr := cfg.Cache.RedisAddr()
+	usesRedis := addr != "" && !strings.EqualFold(cfg.Cache.Type, "memory") && !strings.EqualFold(cfg.Cache.Type, "disk")
+	if usesRedis {
+		if err := cache.Ping(addr); err != nil {
+			return fmt.Errorf("%s: cache.redis: cannot connect to %s: %v", path, addr, err)
+		}
+		fmt.Printf("Redis (%s): reachable\n", addr)
+	}
+	return nil
+}
+
+// handleSchema prints the JSON Schema of the config file
+func (c *ConfigCommand) handleSchema(args []string) error {
+	var outputPath string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--output=") {
+			outputPath = strings.TrimPrefix(arg, "--output=")
+		} else {
+			return fmt.Errorf("unknown flag: %s\n\n%s", arg, c.Usage())
+		}
+	}
+
+	data, err := json.MarshalIndent(appconfig.Schema(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema: %v", err)
+	}
+	data = append(data, '\n')
+
+	if outputPath == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(outputPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write schema: %v", err)
+	}
+	fmt.Printf("Schema written to %s\n", outputPath)
+	return nil
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/commands/audit"
 	"github.com/autobrr/dashbrr/internal/commands/autobrr"
 	"github.com/autobrr/dashbrr/internal/commands/base"
 	"github.com/autobrr/dashbrr/internal/commands/config"
@@ -20,28 +23,41 @@ import (
 	"github.com/autobrr/dashbrr/internal/commands/service"
 	"github.com/autobrr/dashbrr/internal/commands/sonarr"
 	"github.com/autobrr/dashbrr/internal/commands/tailscale"
+	"github.com/autobrr/dashbrr/internal/commands/token"
 	"github.com/autobrr/dashbrr/internal/commands/user"
 	"github.com/autobrr/dashbrr/internal/commands/version"
+	appconfig "github.com/autobrr/dashbrr/internal/config"
 	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/services/cache"
+	"github.com/autobrr/dashbrr/internal/services/core"
 )
 
 // ExecuteCommand handles the execution of CLI commands
-func ExecuteCommand(args []string) error {
+func ExecuteCommand(cfg *appconfig.Config, args []string) error {
 	if len(args) < 1 {
 		return fmt.Errorf("no command specified\n\nRun 'dashbrr run help' for usage")
 	}
 
 	// Initialize database for commands
-	db, err := initializeDatabase()
+	db, err := initializeDatabase(cfg.Database)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
+	// Services keep version lookups in the configured cache, as they do in
+	// the server
+	store, err := cache.InitCache(cache.NewConfigFromSettings(cfg.Cache, false))
+	if err != nil {
+		log.Warn().Err(err).Msg("Configured cache unavailable, using memory cache")
+	}
+	defer store.Close()
+	core.SetCache(store)
+
 	registry := base.NewRegistry()
 
 	// Register commands
-	if err := registerCommands(registry, db); err != nil {
+	if err := registerCommands(registry, db, cfg); err != nil {
 		return err
 	}
 
@@ -52,16 +68,29 @@ func ExecuteCommand(args []string) error {
 	return registry.Execute(context.Background(), cmdName, cmdArgs)
 }
 
-func initializeDatabase() (*database.DB, error) {
-	dbPath := "./data/dashbrr.db"
-	db, err := database.InitDB(dbPath)
+// ExecuteStandalone runs the commands that need neither the configuration
+// nor the database, so a broken config file can still be checked. It
+// reports whether args named such a command.
+func ExecuteStandalone(args []string) (bool, error) {
+	if len(args) < 2 || args[0] != "config" {
+		return false, nil
+	}
+	switch args[1] {
+	case "validate", "schema":
+		return true, config.NewConfigCommand(nil).Execute(context.Background(), args[1:])
+	}
+	return false, nil
+}
+
+func initializeDatabase(dbConfig appconfig.DatabaseConfig) (*database.DB, error) {
+	db, err := database.InitDBWithConfig(database.NewConfigFromSettings(dbConfig))
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %v", err)
 	}
 	return db, nil
 }
 
-func registerCommands(registry *base.Registry, db *database.DB) error {
+func registerCommands(registry *base.Registry, db *database.DB, cfg *appconfig.Config) error {
 	// Create commands that need special handling
 	helpCmd := help.NewHelpCommand(registry)
 	serviceCmd := service.NewServiceCommand()
@@ -70,11 +99,13 @@ func registerCommands(registry *base.Registry, db *database.DB) error {
 	// Register top-level commands
 	topLevelCommands := []base.Command{
 		version.NewVersionCommand(),
-		health.NewHealthCommand(db),
+		health.NewHealthCommand(db, cfg),
 		helpCmd,
 		user.NewUserCommand(db),
 		serviceCmd,
 		configCmd, // Add the config command to top-level commands
+		audit.NewAuditCommand(db),
+		token.NewTokenCommand(db),
 	}
 
 	serviceCommands := []base.Command{
@@ -28,6 +28,7 @@ type HealthCommand struct {
 	checkSystem   bool
 	jsonOutput    bool
 	db            *database.DB
+	cfg           *config.Config
 }
 
 type HealthStatus struct {
@@ -46,14 +47,15 @@ type HealthStatus struct {
 	Services map[string]bool `json:"services,omitempty"`
 }
 
-func NewHealthCommand(db *database.DB) *HealthCommand {
+func NewHealthCommand(db *database.DB, cfg *config.Config) *HealthCommand {
 	return &HealthCommand{
 		BaseCommand: base.NewBaseCommand(
 			"health",
 			"Check system and service health",
 			"[--services] [--system] [--json]",
 		),
-		db: db,
+		db:  db,
+		cfg: cfg,
 	}
 }
 
@@ -160,15 +162,12 @@ func (c *HealthCommand) Execute(ctx context.Context, args []string) error {
 
 func (c *HealthCommand) checkDatabase(status *HealthStatus) error {
 	// Get database configuration
-	dbConfig := database.NewConfig()
+	dbConfig := database.NewConfigFromSettings(c.cfg.Database)
 	status.System.Database.Type = dbConfig.Driver
 
 	// Try to connect to the database
-	var db *database.DB
-	var err error
-
 	// Connect using config regardless of driver type
-	db, err = database.InitDBWithConfig(dbConfig)
+	db, err := database.InitDBWithConfig(dbConfig)
 
 	if err != nil {
 		status.System.Database.Connected = false
@@ -181,15 +180,18 @@ func (c *HealthCommand) checkDatabase(status *HealthStatus) error {
 }
 
 func (c *HealthCommand) checkConfig(status *HealthStatus) error {
-	_, err := config.LoadConfig("config.toml")
-	if err != nil {
+	path := c.cfg.Path
+	if path == "" {
+		path = config.DefaultPath()
+	}
+	status.System.Config.Path = path
+
+	if _, err := config.LoadConfig(path); err != nil {
 		status.System.Config.Valid = false
-		status.System.Config.Path = "config.toml"
 		return err
 	}
 
 	status.System.Config.Valid = true
-	status.System.Config.Path = "config.toml"
 	return nil
 }
 
@@ -0,0 +1,231 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/commands/base"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
+)
+
+const defaultTokenExpiry = 90 * 24 * time.Hour
+
+// TokenCommand manages personal API tokens
+type TokenCommand struct {
+	*base.BaseCommand
+	db *database.DB
+}
+
+func NewTokenCommand(db *database.DB) *TokenCommand {
+	return &TokenCommand{
+		BaseCommand: base.NewBaseCommand(
+			"token",
+			"Manage personal API tokens",
+			"<subcommand> [arguments]\n\n  Subcommands:\n"+
+				"    create <username> <name> [--scope=read|write|admin] [--expires=2160h]\n"+
+				"    list [username] [--json]\n"+
+				"    revoke <id>\n\n"+
+				"Examples:\n"+
+				"  dashbrr run token create admin backup-script --scope=read\n"+
+				"  dashbrr run token list admin\n"+
+				"  dashbrr run token revoke 3",
+		),
+		db: db,
+	}
+}
+
+func (c *TokenCommand) Execute(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("insufficient arguments. %s", c.Usage())
+	}
+
+	switch args[0] {
+	case "create":
+		return c.create(args[1:])
+	case "list":
+		return c.list(args[1:])
+	case "revoke":
+		if len(args) < 2 {
+			return errors.New("usage: token revoke <id>")
+		}
+		return c.revoke(args[1])
+	default:
+		return fmt.Errorf("unknown subcommand: %s\n\n%s", args[0], c.Usage())
+	}
+}
+
+func (c *TokenCommand) create(args []string) error {
+	scope := types.TokenScopeRead
+	expiresIn := defaultTokenExpiry
+	var positional []string
+
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--scope="):
+			scope = strings.TrimPrefix(arg, "--scope=")
+		case strings.HasPrefix(arg, "--expires="):
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, "--expires="))
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid expiry: %s", arg)
+			}
+			expiresIn = d
+		case strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("unknown flag: %s\n\n%s", arg, c.Usage())
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) < 2 {
+		return errors.New("usage: token create <username> <name> [--scope=read|write|admin] [--expires=2160h]")
+	}
+	if !types.IsValidTokenScope(scope) {
+		return fmt.Errorf("invalid scope %q: must be read, write or admin", scope)
+	}
+
+	user, err := c.db.GetUserByUsername(positional[0])
+	if err != nil {
+		return fmt.Errorf("failed to find user: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", positional[0])
+	}
+
+	secret, err := utils.GenerateAPIToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	token := &types.APIToken{
+		UserID:    user.ID,
+		Name:      positional[1],
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	if err := c.db.CreateAPIToken(token, secret); err != nil {
+		return fmt.Errorf("failed to create token: %v", err)
+	}
+
+	c.recordAudit(models.AuditTokenCreate, token)
+
+	fmt.Printf("Token %q created for %s with scope %s, valid until %s\n",
+		token.Name, user.Username, token.Scope, token.ExpiresAt.Local().Format(time.DateTime))
+	fmt.Printf("Secret (shown only once): %s\n", secret)
+	return nil
+}
+
+func (c *TokenCommand) list(args []string) error {
+	var userID int64
+	jsonOutput := false
+
+	for _, arg := range args {
+		if arg == "--json" {
+			jsonOutput = true
+			continue
+		}
+		user, err := c.db.GetUserByUsername(arg)
+		if err != nil {
+			return fmt.Errorf("failed to find user: %v", err)
+		}
+		if user == nil {
+			return fmt.Errorf("user %s not found", arg)
+		}
+		userID = user.ID
+	}
+
+	tokens, err := c.db.ListAPITokens(userID)
+	if err != nil {
+		return fmt.Errorf("failed to list tokens: %v", err)
+	}
+
+	if jsonOutput {
+		if tokens == nil {
+			tokens = []types.APIToken{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tokens)
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("No API tokens found.")
+		return nil
+	}
+
+	usernames := make(map[int64]string)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tNAME\tPREFIX\tSCOPE\tEXPIRES\tLAST USED")
+	for _, token := range tokens {
+		username, ok := usernames[token.UserID]
+		if !ok {
+			username = strconv.FormatInt(token.UserID, 10)
+			if user, err := c.db.GetUserByID(token.UserID); err == nil && user != nil {
+				username = user.Username
+			}
+			usernames[token.UserID] = username
+		}
+
+		expires := token.ExpiresAt.Local().Format(time.DateTime)
+		if token.Expired() {
+			expires += " (expired)"
+		}
+		lastUsed := "never"
+		if token.LastUsedAt != nil {
+			lastUsed = token.LastUsedAt.Local().Format(time.DateTime)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			token.ID, username, token.Name, token.Prefix, token.Scope, expires, lastUsed)
+	}
+	return w.Flush()
+}
+
+func (c *TokenCommand) revoke(idArg string) error {
+	id, err := strconv.ParseInt(idArg, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid token id: %s", idArg)
+	}
+
+	token, err := c.db.GetAPITokenByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to find token: %v", err)
+	}
+	if token == nil {
+		return fmt.Errorf("token %d not found", id)
+	}
+
+	if err := c.db.DeleteAPIToken(id); err != nil {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+
+	c.recordAudit(models.AuditTokenRevoke, token)
+
+	fmt.Printf("Token %q revoked\n", token.Name)
+	return nil
+}
+
+// recordAudit stores a CLI-initiated token change in the audit log
+func (c *TokenCommand) recordAudit(action string, token *types.APIToken) {
+	event := &models.AuditEvent{
+		Actor:   "cli",
+		Action:  action,
+		Target:  token.Name,
+		Details: map[string]interface{}{"source": "cli", "tokenId": token.ID, "userId": token.UserID},
+	}
+	if err := c.db.CreateAuditEvent(event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record audit event: %v\n", err)
+	}
+}
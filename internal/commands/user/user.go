@@ -5,16 +5,25 @@ package user
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/autobrr/dashbrr/internal/commands/base"
 	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/types"
+	"github.com/autobrr/dashbrr/internal/utils"
 )
 
+const defaultInviteExpiry = 72 * time.Hour
+
 type UserCommand struct {
 	*base.BaseCommand
 	db *database.DB
@@ -25,7 +34,7 @@ func NewUserCommand(db *database.DB) *UserCommand {
 		BaseCommand: base.NewBaseCommand(
 			"user",
 			"Manage users in the system",
-			"<subcommand> [arguments]\n\n  Subcommands:\n    create <username> <password>\n    change-password <username> <new_password>",
+			"<subcommand> [arguments]\n\n  Subcommands:\n    create <username> <password> [email] [--role=admin|operator|viewer]\n    change-password <username> <new_password>\n    set-role <username> <admin|operator|viewer>\n    list [--json]\n    disable <username>\n    enable <username>\n    delete <username>\n    2fa reset <username>\n    unlock <username>\n    invite [--email=<email>] [--role=admin|operator|viewer] [--expires=72h]",
 		),
 		db: db,
 	}
@@ -39,25 +48,63 @@ func (c *UserCommand) Execute(ctx context.Context, args []string) error {
 	subcommand := args[0]
 	switch subcommand {
 	case "create":
-		if len(args) < 3 {
-			return errors.New("usage: user create <username> <password>")
+		var role string
+		var positional []string
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg, "--role=") {
+				role = strings.TrimPrefix(arg, "--role=")
+				continue
+			}
+			positional = append(positional, arg)
+		}
+		if len(positional) < 2 {
+			return errors.New("usage: user create <username> <password> [email] [--role=admin|operator|viewer]")
 		}
-		email := fmt.Sprintf("%s@dashbrr.local", args[1])
-		if len(args) > 3 {
-			email = args[3]
+		email := fmt.Sprintf("%s@dashbrr.local", positional[0])
+		if len(positional) > 2 {
+			email = positional[2]
 		}
-		return c.createUser(args[1], args[2], email)
+		return c.createUser(positional[0], positional[1], email, role)
 	case "change-password":
 		if len(args) < 3 {
 			return errors.New("usage: user change-password <username> <new_password>")
 		}
 		return c.changePassword(args[1], args[2])
+	case "set-role":
+		if len(args) < 3 {
+			return errors.New("usage: user set-role <username> <admin|operator|viewer>")
+		}
+		return c.setRole(args[1], args[2])
+	case "list":
+		return c.listUsers(len(args) > 1 && args[1] == "--json")
+	case "disable", "enable":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: user %s <username>", subcommand)
+		}
+		return c.setDisabled(args[1], subcommand == "disable")
+	case "delete":
+		if len(args) < 2 {
+			return errors.New("usage: user delete <username>")
+		}
+		return c.deleteUser(args[1])
+	case "2fa":
+		if len(args) < 3 || args[1] != "reset" {
+			return errors.New("usage: user 2fa reset <username>")
+		}
+		return c.resetTwoFactor(args[2])
+	case "unlock":
+		if len(args) < 2 {
+			return errors.New("usage: user unlock <username>")
+		}
+		return c.unlockUser(args[1])
+	case "invite":
+		return c.createInvite(args[1:])
 	default:
 		return fmt.Errorf("unknown subcommand: %s", subcommand)
 	}
 }
 
-func (c *UserCommand) createUser(username, password, email string) error {
+func (c *UserCommand) createUser(username, password, email, role string) error {
 	// Validate username and password
 	if len(username) < 3 || len(username) > 32 {
 		return errors.New("username must be between 3 and 32 characters")
@@ -83,6 +130,21 @@ func (c *UserCommand) createUser(username, password, email string) error {
 		return fmt.Errorf("email %s already exists", email)
 	}
 
+	// The first user is always an admin, later users default to viewer
+	if role == "" {
+		hasUsers, err := c.db.HasUsers()
+		if err != nil {
+			return fmt.Errorf("error checking users: %v", err)
+		}
+		role = types.RoleViewer
+		if !hasUsers {
+			role = types.RoleAdmin
+		}
+	}
+	if !types.IsValidRole(role) {
+		return fmt.Errorf("invalid role %q: must be admin, operator or viewer", role)
+	}
+
 	// Hash the password
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -94,13 +156,16 @@ func (c *UserCommand) createUser(username, password, email string) error {
 		Username:     username,
 		Email:        email,
 		PasswordHash: string(passwordHash),
+		Role:         role,
 	}
 
 	if err := c.db.CreateUser(user); err != nil {
 		return fmt.Errorf("failed to create user: %v", err)
 	}
 
-	fmt.Printf("User %s created successfully\n", username)
+	c.recordAudit(models.AuditUserCreate, username, nil)
+
+	fmt.Printf("User %s created successfully with role %s\n", username, role)
 	return nil
 }
 
@@ -130,6 +195,287 @@ func (c *UserCommand) changePassword(username, newPassword string) error {
 		return fmt.Errorf("failed to update password: %v", err)
 	}
 
+	c.recordAudit(models.AuditUserPasswordChange, username, nil)
+
 	fmt.Printf("Password changed successfully for user %s\n", username)
 	return nil
 }
+
+func (c *UserCommand) setRole(username, role string) error {
+	if !types.IsValidRole(role) {
+		return fmt.Errorf("invalid role %q: must be admin, operator or viewer", role)
+	}
+
+	user, err := c.db.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+	if user.Role == role {
+		fmt.Printf("User %s already has role %s\n", username, role)
+		return nil
+	}
+
+	if err := c.ensureNotLastAdmin(user); err != nil {
+		return err
+	}
+
+	if err := c.db.UpdateUserRole(user.ID, role); err != nil {
+		return fmt.Errorf("failed to update role: %v", err)
+	}
+
+	c.recordAudit(models.AuditUserRoleChange, username, map[string]models.AuditChange{
+		"role": {Before: user.Role, After: role},
+	})
+
+	fmt.Printf("Role for user %s changed from %s to %s\n", username, user.Role, role)
+	return nil
+}
+
+func (c *UserCommand) listUsers(jsonOutput bool) error {
+	users, err := c.db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %v", err)
+	}
+
+	if jsonOutput {
+		if users == nil {
+			users = []types.User{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(users)
+	}
+
+	if len(users) == 0 {
+		fmt.Println("No users found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tROLE\tSTATUS\t2FA\tCREATED")
+	for _, user := range users {
+		status := "active"
+		if user.Disabled {
+			status = "disabled"
+		}
+		twoFactor := "off"
+		if user.TOTPEnabled {
+			twoFactor = "on"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			user.ID,
+			user.Username,
+			user.Email,
+			user.Role,
+			status,
+			twoFactor,
+			user.CreatedAt.Local().Format(time.DateTime),
+		)
+	}
+	return w.Flush()
+}
+
+func (c *UserCommand) setDisabled(username string, disabled bool) error {
+	user, err := c.db.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+
+	state := "enabled"
+	action := models.AuditUserEnable
+	if disabled {
+		state = "disabled"
+		action = models.AuditUserDisable
+	}
+	if user.Disabled == disabled {
+		fmt.Printf("User %s is already %s\n", username, state)
+		return nil
+	}
+
+	if disabled {
+		if err := c.ensureNotLastAdmin(user); err != nil {
+			return err
+		}
+	}
+
+	if err := c.db.SetUserDisabled(user.ID, disabled); err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+
+	c.recordAudit(action, username, nil)
+
+	fmt.Printf("User %s %s\n", username, state)
+	return nil
+}
+
+func (c *UserCommand) deleteUser(username string) error {
+	user, err := c.db.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+
+	if err := c.ensureNotLastAdmin(user); err != nil {
+		return err
+	}
+
+	if err := c.db.DeleteUser(user.ID); err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+
+	c.recordAudit(models.AuditUserDelete, username, nil)
+
+	fmt.Printf("User %s deleted\n", username)
+	return nil
+}
+
+// resetTwoFactor removes two-factor authentication from an account, for
+// users who lost their authenticator and recovery codes
+func (c *UserCommand) resetTwoFactor(username string) error {
+	user, err := c.db.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", username)
+	}
+	if !user.TOTPEnabled {
+		fmt.Printf("User %s does not have two-factor authentication enabled\n", username)
+		return nil
+	}
+
+	if err := c.db.DisableTOTP(user.ID); err != nil {
+		return fmt.Errorf("failed to reset two-factor authentication: %v", err)
+	}
+
+	c.recordAudit(models.AuditUser2FAReset, username, nil)
+
+	fmt.Printf("Two-factor authentication reset for user %s\n", username)
+	return nil
+}
+
+// unlockUser clears failed logins so a locked out user can sign in again
+// right away. Unknown usernames are tracked too, so no user lookup is needed.
+func (c *UserCommand) unlockUser(username string) error {
+	lockout, err := c.db.GetLoginLockout(username)
+	if err != nil {
+		return fmt.Errorf("failed to get login failures: %v", err)
+	}
+	if lockout == nil {
+		fmt.Printf("User %s has no failed logins\n", username)
+		return nil
+	}
+
+	if _, err := c.db.DeleteLoginLockout(username); err != nil {
+		return fmt.Errorf("failed to unlock user: %v", err)
+	}
+
+	c.recordAudit(models.AuditUserUnlock, username, map[string]models.AuditChange{
+		"failures": {Before: lockout.Failures, After: 0},
+	})
+
+	if lockout.Locked() {
+		fmt.Printf("User %s unlocked (%d failed logins, last from %s)\n", username, lockout.Failures, lockout.LastIP)
+	} else {
+		fmt.Printf("Cleared %d failed logins for user %s\n", lockout.Failures, username)
+	}
+	return nil
+}
+
+func (c *UserCommand) createInvite(args []string) error {
+	invite := &types.Invite{
+		Role:      types.RoleViewer,
+		CreatedBy: "cli",
+		ExpiresAt: time.Now().Add(defaultInviteExpiry),
+	}
+
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--email="):
+			invite.Email = strings.TrimPrefix(arg, "--email=")
+		case strings.HasPrefix(arg, "--role="):
+			invite.Role = strings.TrimPrefix(arg, "--role=")
+		case strings.HasPrefix(arg, "--expires="):
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, "--expires="))
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid expiry: %s", arg)
+			}
+			invite.ExpiresAt = time.Now().Add(d)
+		default:
+			return fmt.Errorf("unknown flag: %s\n\n%s", arg, c.Usage())
+		}
+	}
+
+	if !types.IsValidRole(invite.Role) {
+		return fmt.Errorf("invalid role %q: must be admin, operator or viewer", invite.Role)
+	}
+	if invite.Email != "" {
+		existingUser, err := c.db.GetUserByEmail(invite.Email)
+		if err != nil {
+			return fmt.Errorf("error checking email: %v", err)
+		}
+		if existingUser != nil {
+			return fmt.Errorf("email %s already exists", invite.Email)
+		}
+	}
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate invite token: %v", err)
+	}
+	if err := c.db.CreateInvite(invite, token); err != nil {
+		return fmt.Errorf("failed to create invite: %v", err)
+	}
+
+	event := &models.AuditEvent{
+		Actor:   "cli",
+		Action:  models.AuditInviteCreate,
+		Target:  invite.Email,
+		Details: map[string]interface{}{"source": "cli", "inviteId": invite.ID, "role": invite.Role},
+	}
+	if err := c.db.CreateAuditEvent(event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record audit event: %v\n", err)
+	}
+
+	fmt.Printf("Invite created with role %s, valid until %s\n", invite.Role, invite.ExpiresAt.Local().Format(time.DateTime))
+	fmt.Printf("Token: %s\n", token)
+	fmt.Printf("Registration link: /register?invite=%s\n", token)
+	return nil
+}
+
+// ensureNotLastAdmin refuses changes that would leave no active admin
+func (c *UserCommand) ensureNotLastAdmin(user *types.User) error {
+	if user.Role != types.RoleAdmin || user.Disabled {
+		return nil
+	}
+	admins, err := c.db.CountActiveAdmins()
+	if err != nil {
+		return fmt.Errorf("failed to count admins: %v", err)
+	}
+	if admins <= 1 {
+		return fmt.Errorf("%s is the last admin", user.Username)
+	}
+	return nil
+}
+
+// recordAudit stores a CLI-initiated user change in the audit log
+func (c *UserCommand) recordAudit(action, username string, changes map[string]models.AuditChange) {
+	event := &models.AuditEvent{
+		Actor:   "cli",
+		Action:  action,
+		Target:  username,
+		Changes: changes,
+		Details: map[string]interface{}{"source": "cli"},
+	}
+	if err := c.db.CreateAuditEvent(event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record audit event: %v\n", err)
+	}
+}
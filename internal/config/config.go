@@ -4,11 +4,18 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -17,51 +24,360 @@ const (
 
 // Config represents the main configuration structure
 type Config struct {
-	Server   ServerConfig   `toml:"server"`
-	Cache    CacheConfig    `toml:"cache"`
-	Database DatabaseConfig `toml:"database"`
-	Auth     AuthConfig     `toml:"auth"`
+	Server     ServerConfig     `toml:"server" yaml:"server"`
+	Logging    LoggingConfig    `toml:"logging" yaml:"logging"`
+	Cache      CacheConfig      `toml:"cache" yaml:"cache"`
+	Database   DatabaseConfig   `toml:"database" yaml:"database"`
+	Auth       AuthConfig       `toml:"auth" yaml:"auth"`
+	RateLimits RateLimitsConfig `toml:"rate_limits" yaml:"rate_limits"`
+	Health     HealthConfig     `toml:"health" yaml:"health"`
+
+	// Services declared in the config file, reconciled into the database
+	// on startup according to ServiceSync
+	Services    []ServiceConfig   `toml:"services" yaml:"services"`
+	ServiceSync ServiceSyncConfig `toml:"service_sync" yaml:"service_sync"`
+
+	// Path is the config file the settings were read from. It is empty
+	// when the environment alone configured dashbrr.
+	Path string `toml:"-" yaml:"-"`
+}
+
+// Flags holds the settings given on the command line. Empty values were
+// not set and leave the configuration alone.
+type Flags struct {
+	ListenAddr string
+	DBPath     string
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	ListenAddr string `toml:"listen_addr" env:"DASHBRR__LISTEN_ADDR"`
+	ListenAddr string `toml:"listen_addr" yaml:"listen_addr" env:"DASHBRR__LISTEN_ADDR"`
+
+	// BasePath serves dashbrr under a path prefix, such as /dashbrr when a
+	// reverse proxy forwards https://example.com/dashbrr/ to it
+	BasePath string `toml:"base_path" yaml:"base_path" env:"DASHBRR__BASE_PATH"`
+
+	// TrustedProxies are the addresses or CIDR ranges whose
+	// X-Forwarded-For headers are believed for the client IP
+	TrustedProxies []string `toml:"trusted_proxies" yaml:"trusted_proxies" env:"DASHBRR__TRUSTED_PROXIES"`
+
+	Cookies  CookiesConfig  `toml:"cookies" yaml:"cookies"`
+	CSRF     CSRFConfig     `toml:"csrf" yaml:"csrf"`
+	Security SecurityConfig `toml:"security" yaml:"security"`
+	CORS     CORSConfig     `toml:"cors" yaml:"cors"`
+}
+
+// LoggingConfig holds log output settings
+type LoggingConfig struct {
+	// Level is trace, debug, info, warn or error. Unset, everything is
+	// logged.
+	Level string `toml:"level" yaml:"level" env:"DASHBRR__LOG_LEVEL"`
+}
+
+// CookiesConfig holds attributes of the cookies dashbrr sets
+type CookiesConfig struct {
+	// SameSite is lax (default), strict or none
+	SameSite string `toml:"same_site" yaml:"same_site" env:"DASHBRR__COOKIE_SAMESITE"`
+}
+
+// CSRFConfig holds cross-site request forgery protection settings
+type CSRFConfig struct {
+	Disabled    bool     `toml:"disabled" yaml:"disabled" env:"DASHBRR__CSRF_DISABLED"`
+	ExemptPaths []string `toml:"exempt_paths" yaml:"exempt_paths" env:"DASHBRR__CSRF_EXEMPT_PATHS"`
 }
 
 // CacheConfig holds cache-related configuration
 type CacheConfig struct {
-	Type  string      `toml:"type" env:"CACHE_TYPE"`
-	Redis RedisConfig `toml:"redis"`
+	// Type is memory, disk or redis. Unset, Redis is used when a host is
+	// given.
+	Type string `toml:"type" yaml:"type" env:"CACHE_TYPE"`
+
+	// Dir is where the memory cache persists sessions and the disk cache
+	// keeps its database. It defaults to the directory of the SQLite
+	// database.
+	Dir string `toml:"dir" yaml:"dir" env:"DASHBRR__CACHE_DIR"`
+
+	// MaxEntries and MaxBytes bound the memory cache, which evicts the
+	// least recently used values first. Zero means no limit.
+	MaxEntries int   `toml:"max_entries" yaml:"max_entries" env:"DASHBRR__CACHE_MAX_ENTRIES"`
+	MaxBytes   int64 `toml:"max_bytes" yaml:"max_bytes" env:"DASHBRR__CACHE_MAX_BYTES"`
+
+	Redis RedisConfig    `toml:"redis" yaml:"redis"`
+	TTL   CacheTTLConfig `toml:"ttl" yaml:"ttl"`
+
+	// PerUser caches service responses separately for every user instead
+	// of sharing them
+	PerUser bool `toml:"per_user" yaml:"per_user" env:"DASHBRR__CACHE_PER_USER"`
+
+	// StaleGrace is how long an expired response is still served while it
+	// is refreshed in the background. Unset uses the default of two
+	// minutes and a negative grace turns stale responses off.
+	StaleGrace Duration `toml:"stale_grace" yaml:"stale_grace" env:"DASHBRR__CACHE_STALE_GRACE"`
+}
+
+// RedisAddr returns the host:port of the Redis server, or an empty string
+// when none is configured
+func (c CacheConfig) RedisAddr() string {
+	if c.Redis.Host == "" {
+		return ""
+	}
+	return net.JoinHostPort(c.Redis.Host, strconv.Itoa(c.Redis.Port))
+}
+
+// CacheTTLConfig holds how long API responses are cached. Unset values
+// keep the defaults.
+type CacheTTLConfig struct {
+	Default      Duration `toml:"default" yaml:"default" env:"DASHBRR__CACHE_TTL_DEFAULT"`
+	Health       Duration `toml:"health" yaml:"health" env:"DASHBRR__CACHE_TTL_HEALTH"`
+	PlexSessions Duration `toml:"plex_sessions" yaml:"plex_sessions" env:"DASHBRR__CACHE_TTL_PLEX_SESSIONS"`
+	Autobrr      Duration `toml:"autobrr" yaml:"autobrr" env:"DASHBRR__CACHE_TTL_AUTOBRR"`
+	Overseerr    Duration `toml:"overseerr" yaml:"overseerr" env:"DASHBRR__CACHE_TTL_OVERSEERR"`
+	Maintainerr  Duration `toml:"maintainerr" yaml:"maintainerr" env:"DASHBRR__CACHE_TTL_MAINTAINERR"`
+	Sonarr       Duration `toml:"sonarr" yaml:"sonarr" env:"DASHBRR__CACHE_TTL_SONARR"`
+	Radarr       Duration `toml:"radarr" yaml:"radarr" env:"DASHBRR__CACHE_TTL_RADARR"`
+	Prowlarr     Duration `toml:"prowlarr" yaml:"prowlarr" env:"DASHBRR__CACHE_TTL_PROWLARR"`
+}
+
+// RateLimitsConfig holds the per-client request limits of groups of API
+// endpoints. Unset values keep the defaults.
+type RateLimitsConfig struct {
+	API       RateLimitConfig `toml:"api" yaml:"api"`
+	Health    RateLimitConfig `toml:"health" yaml:"health"`
+	Auth      RateLimitConfig `toml:"auth" yaml:"auth"`
+	Tailscale RateLimitConfig `toml:"tailscale" yaml:"tailscale"`
+}
+
+// RateLimitConfig allows a number of requests per window
+type RateLimitConfig struct {
+	Requests int      `toml:"requests" yaml:"requests"`
+	Window   Duration `toml:"window" yaml:"window"`
+}
+
+// HealthConfig holds background health check settings
+type HealthConfig struct {
+	// CheckInterval is how often configured services are checked
+	CheckInterval Duration `toml:"check_interval" yaml:"check_interval" env:"DASHBRR__HEALTH_CHECK_INTERVAL"`
+}
+
+// Service sync policies
+const (
+	// ServiceSyncCreate adds declared services that do not exist yet and
+	// leaves existing ones alone, so they stay editable in the UI
+	ServiceSyncCreate = "create"
+	// ServiceSyncSync also updates existing services to match the config
+	// file and marks them as managed
+	ServiceSyncSync = "sync"
+	// ServiceSyncPrune also deletes managed services that are no longer
+	// declared
+	ServiceSyncPrune = "prune"
+)
+
+// ServiceConfig declares a service in the config file
+type ServiceConfig struct {
+	// Type is the service type, such as sonarr or plex
+	Type string `toml:"type" yaml:"type"`
+	// ID tells apart services of the same type. The instance ID becomes
+	// <type>-<id>, or <type>-config-<n> for the n-th service of the type
+	// without an ID.
+	ID   string `toml:"id" yaml:"id"`
+	Name string `toml:"name" yaml:"name"`
+	URL  string `toml:"url" yaml:"url"`
+
+	// The API key is given inline, or read from an environment variable
+	// or a file such as a Docker secret
+	APIKey     string `toml:"api_key" yaml:"api_key"`
+	APIKeyEnv  string `toml:"api_key_env" yaml:"api_key_env"`
+	APIKeyFile string `toml:"api_key_file" yaml:"api_key_file"`
+
+	Tags []string `toml:"tags" yaml:"tags"`
+	// CheckInterval checks the service less often than the health monitor
+	// runs
+	CheckInterval Duration `toml:"check_interval" yaml:"check_interval"`
+}
+
+// InstanceID returns the instance ID of the n-th (1-based) declared
+// service of its type
+func (s ServiceConfig) InstanceID(n int) string {
+	serviceType := strings.ToLower(s.Type)
+	if s.ID != "" {
+		return serviceType + "-" + s.ID
+	}
+	return fmt.Sprintf("%s-config-%d", serviceType, n)
+}
+
+// ResolveAPIKey returns the API key of the service, reading it from the
+// referenced environment variable or file when it is not given inline
+func (s ServiceConfig) ResolveAPIKey() (string, error) {
+	switch {
+	case s.APIKey != "":
+		return s.APIKey, nil
+	case s.APIKeyEnv != "":
+		apiKey := os.Getenv(s.APIKeyEnv)
+		if apiKey == "" {
+			return "", fmt.Errorf("environment variable %s is not set", s.APIKeyEnv)
+		}
+		return apiKey, nil
+	case s.APIKeyFile != "":
+		data, err := os.ReadFile(s.APIKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading API key file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return "", nil
+}
+
+// ServiceSyncConfig controls how declared services are reconciled
+type ServiceSyncConfig struct {
+	// Policy is create (default), sync or prune
+	Policy string `toml:"policy" yaml:"policy" env:"DASHBRR__SERVICE_SYNC_POLICY"`
 }
 
 // RedisConfig holds Redis-specific configuration
 type RedisConfig struct {
-	Host string `toml:"host" env:"REDIS_HOST"`
-	Port int    `toml:"port" env:"REDIS_PORT"`
+	Host string `toml:"host" yaml:"host" env:"REDIS_HOST"`
+	Port int    `toml:"port" yaml:"port" env:"REDIS_PORT"`
 }
 
 // DatabaseConfig holds database-related configuration
 type DatabaseConfig struct {
-	Type     string `toml:"type" env:"DASHBRR__DB_TYPE"`
-	Path     string `toml:"path" env:"DASHBRR__DB_PATH"`
-	Host     string `toml:"host" env:"DASHBRR__DB_HOST"`
-	Port     int    `toml:"port" env:"DASHBRR__DB_PORT"`
-	User     string `toml:"user" env:"DASHBRR__DB_USER"`
-	Password string `toml:"password" env:"DASHBRR__DB_PASSWORD"`
-	Name     string `toml:"name" env:"DASHBRR__DB_NAME"`
+	Type     string `toml:"type" yaml:"type" env:"DASHBRR__DB_TYPE"`
+	Path     string `toml:"path" yaml:"path" env:"DASHBRR__DB_PATH"`
+	Host     string `toml:"host" yaml:"host" env:"DASHBRR__DB_HOST"`
+	Port     int    `toml:"port" yaml:"port" env:"DASHBRR__DB_PORT"`
+	User     string `toml:"user" yaml:"user" env:"DASHBRR__DB_USER"`
+	Password string `toml:"password" yaml:"password" env:"DASHBRR__DB_PASSWORD"`
+	Name     string `toml:"name" yaml:"name" env:"DASHBRR__DB_NAME"`
+
+	// DSN is a complete PostgreSQL connection string. When set it takes
+	// precedence over the individual host/port/user/password/name settings.
+	DSN string `toml:"dsn" yaml:"dsn" env:"DASHBRR__DB_DSN"`
+
+	// PostgreSQL TLS settings
+	SSLMode     string `toml:"sslmode" yaml:"sslmode" env:"DASHBRR__DB_SSLMODE"`
+	SSLRootCert string `toml:"sslrootcert" yaml:"sslrootcert" env:"DASHBRR__DB_SSLROOTCERT"`
+	SSLCert     string `toml:"sslcert" yaml:"sslcert" env:"DASHBRR__DB_SSLCERT"`
+	SSLKey      string `toml:"sslkey" yaml:"sslkey" env:"DASHBRR__DB_SSLKEY"`
+
+	// Schema sets the PostgreSQL search_path for the connection
+	Schema string `toml:"schema" yaml:"schema" env:"DASHBRR__DB_SCHEMA"`
+
+	// Connection pool settings (durations use Go syntax, e.g. "5m")
+	MaxOpenConns    int      `toml:"max_open_conns" yaml:"max_open_conns" env:"DASHBRR__DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int      `toml:"max_idle_conns" yaml:"max_idle_conns" env:"DASHBRR__DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime Duration `toml:"conn_max_lifetime" yaml:"conn_max_lifetime" env:"DASHBRR__DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime Duration `toml:"conn_max_idle_time" yaml:"conn_max_idle_time" env:"DASHBRR__DB_CONN_MAX_IDLE_TIME"`
+
+	// Startup connection retry settings
+	ConnectRetries    int      `toml:"connect_retries" yaml:"connect_retries" env:"DASHBRR__DB_CONNECT_RETRIES"`
+	ConnectRetryDelay Duration `toml:"connect_retry_delay" yaml:"connect_retry_delay" env:"DASHBRR__DB_CONNECT_RETRY_DELAY"`
 }
 
 // AuthConfig holds authentication-related configuration
 type AuthConfig struct {
-	OIDC OIDCConfig `toml:"oidc"`
+	OIDC     OIDCConfig      `toml:"oidc" yaml:"oidc"`
+	Proxy    ProxyAuthConfig `toml:"proxy" yaml:"proxy"`
+	LDAP     LDAPConfig      `toml:"ldap" yaml:"ldap"`
+	Lockout  LockoutConfig   `toml:"lockout" yaml:"lockout"`
+	WebAuthn WebAuthnConfig  `toml:"webauthn" yaml:"webauthn"`
 }
 
 // OIDCConfig holds OIDC-specific configuration
 type OIDCConfig struct {
-	Issuer       string `toml:"issuer" env:"OIDC_ISSUER"`
-	ClientID     string `toml:"client_id" env:"OIDC_CLIENT_ID"`
-	ClientSecret string `toml:"client_secret" env:"OIDC_CLIENT_SECRET"`
-	RedirectURL  string `toml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Issuer       string   `toml:"issuer" yaml:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string   `toml:"client_id" yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string   `toml:"client_secret" yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string   `toml:"redirect_url" yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes       []string `toml:"scopes" yaml:"scopes" env:"OIDC_SCOPES"`
+
+	// Group claim to role mapping
+	GroupsClaim    string   `toml:"groups_claim" yaml:"groups_claim" env:"OIDC_GROUPS_CLAIM"`
+	AdminGroups    []string `toml:"admin_groups" yaml:"admin_groups" env:"OIDC_ADMIN_GROUPS"`
+	OperatorGroups []string `toml:"operator_groups" yaml:"operator_groups" env:"OIDC_OPERATOR_GROUPS"`
+	DefaultRole    string   `toml:"default_role" yaml:"default_role" env:"OIDC_DEFAULT_ROLE"`
+}
+
+// ProxyAuthConfig holds forward auth configuration. It is enabled by
+// setting trusted proxies.
+type ProxyAuthConfig struct {
+	TrustedProxies []string `toml:"trusted_proxies" yaml:"trusted_proxies" env:"PROXY_AUTH_TRUSTED_PROXIES"`
+	UserHeader     string   `toml:"user_header" yaml:"user_header" env:"PROXY_AUTH_USER_HEADER"`
+	EmailHeader    string   `toml:"email_header" yaml:"email_header" env:"PROXY_AUTH_EMAIL_HEADER"`
+	GroupsHeader   string   `toml:"groups_header" yaml:"groups_header" env:"PROXY_AUTH_GROUPS_HEADER"`
+
+	// Group header to role mapping
+	AdminGroups    []string `toml:"admin_groups" yaml:"admin_groups" env:"PROXY_AUTH_ADMIN_GROUPS"`
+	OperatorGroups []string `toml:"operator_groups" yaml:"operator_groups" env:"PROXY_AUTH_OPERATOR_GROUPS"`
+	DefaultRole    string   `toml:"default_role" yaml:"default_role" env:"PROXY_AUTH_DEFAULT_ROLE"`
+}
+
+// LDAPConfig holds LDAP login configuration. It is enabled by setting a URL.
+type LDAPConfig struct {
+	URL                string `toml:"url" yaml:"url" env:"LDAP_URL"`
+	StartTLS           bool   `toml:"start_tls" yaml:"start_tls" env:"LDAP_START_TLS"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify" yaml:"insecure_skip_verify" env:"LDAP_INSECURE_SKIP_VERIFY"`
+	BindDN             string `toml:"bind_dn" yaml:"bind_dn" env:"LDAP_BIND_DN"`
+	BindPassword       string `toml:"bind_password" yaml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	BaseDN             string `toml:"base_dn" yaml:"base_dn" env:"LDAP_BASE_DN"`
+	UserFilter         string `toml:"user_filter" yaml:"user_filter" env:"LDAP_USER_FILTER"`
+	UsernameAttribute  string `toml:"username_attribute" yaml:"username_attribute" env:"LDAP_USERNAME_ATTRIBUTE"`
+	EmailAttribute     string `toml:"email_attribute" yaml:"email_attribute" env:"LDAP_EMAIL_ATTRIBUTE"`
+	GroupBaseDN        string `toml:"group_base_dn" yaml:"group_base_dn" env:"LDAP_GROUP_BASE_DN"`
+	GroupFilter        string `toml:"group_filter" yaml:"group_filter" env:"LDAP_GROUP_FILTER"`
+	GroupNameAttribute string `toml:"group_name_attribute" yaml:"group_name_attribute" env:"LDAP_GROUP_NAME_ATTRIBUTE"`
+
+	// Group membership to role mapping
+	AdminGroups    []string `toml:"admin_groups" yaml:"admin_groups" env:"LDAP_ADMIN_GROUPS"`
+	OperatorGroups []string `toml:"operator_groups" yaml:"operator_groups" env:"LDAP_OPERATOR_GROUPS"`
+	DefaultRole    string   `toml:"default_role" yaml:"default_role" env:"LDAP_DEFAULT_ROLE"`
+}
+
+// LockoutConfig holds brute-force protection settings for password logins
+type LockoutConfig struct {
+	Threshold  int      `toml:"threshold" yaml:"threshold" env:"AUTH_LOCKOUT_THRESHOLD"`
+	Duration   Duration `toml:"duration" yaml:"duration" env:"AUTH_LOCKOUT_DURATION"`
+	WebhookURL string   `toml:"webhook_url" yaml:"webhook_url" env:"AUTH_LOCKOUT_WEBHOOK_URL"`
+}
+
+// WebAuthnConfig holds passkey login configuration. It is enabled by
+// setting the relying party ID, the domain dashbrr is served from.
+type WebAuthnConfig struct {
+	RPID          string   `toml:"rp_id" yaml:"rp_id" env:"WEBAUTHN_RP_ID"`
+	RPDisplayName string   `toml:"rp_display_name" yaml:"rp_display_name" env:"WEBAUTHN_RP_DISPLAY_NAME"`
+	RPOrigins     []string `toml:"rp_origins" yaml:"rp_origins" env:"WEBAUTHN_RP_ORIGINS"`
+}
+
+// SecurityConfig holds the security headers sent with every response
+type SecurityConfig struct {
+	CSPDisabled bool `toml:"csp_disabled" yaml:"csp_disabled" env:"DASHBRR__CSP_DISABLED"`
+
+	// CSP replaces Content-Security-Policy directives by name, for example
+	// img-src = ["'self'", "https:"]. An empty list removes a directive.
+	CSP map[string][]string `toml:"csp" yaml:"csp"`
+
+	// FrameAncestors lists the origins allowed to embed dashbrr in a frame,
+	// such as a Home Assistant or Organizr instance. By default framing is
+	// forbidden.
+	FrameAncestors []string `toml:"frame_ancestors" yaml:"frame_ancestors" env:"DASHBRR__FRAME_ANCESTORS"`
+
+	ReferrerPolicy string     `toml:"referrer_policy" yaml:"referrer_policy" env:"DASHBRR__REFERRER_POLICY"`
+	HSTS           HSTSConfig `toml:"hsts" yaml:"hsts"`
+}
+
+// HSTSConfig controls the Strict-Transport-Security header. Unset values
+// keep the defaults: one year, including subdomains, with preload.
+type HSTSConfig struct {
+	Disabled          bool  `toml:"disabled" yaml:"disabled" env:"DASHBRR__HSTS_DISABLED"`
+	MaxAge            int   `toml:"max_age" yaml:"max_age" env:"DASHBRR__HSTS_MAX_AGE"`
+	IncludeSubdomains *bool `toml:"include_subdomains" yaml:"include_subdomains" env:"DASHBRR__HSTS_INCLUDE_SUBDOMAINS"`
+	Preload           *bool `toml:"preload" yaml:"preload" env:"DASHBRR__HSTS_PRELOAD"`
+}
+
+// CORSConfig holds cross-origin request settings
+type CORSConfig struct {
+	// AllowedOrigins defaults to any origin ("*")
+	AllowedOrigins   []string `toml:"allowed_origins" yaml:"allowed_origins" env:"DASHBRR__CORS_ALLOWED_ORIGINS"`
+	AllowCredentials bool     `toml:"allow_credentials" yaml:"allow_credentials" env:"DASHBRR__CORS_ALLOW_CREDENTIALS"`
 }
 
 // HasRequiredEnvVars checks if all required environment variables are set
@@ -83,11 +399,14 @@ func HasRequiredEnvVars() bool {
 			return false
 		}
 	case "postgres":
+		// A full DSN replaces the individual connection settings
+		if envSet("DASHBRR__DB_DSN") {
+			return true
+		}
 		requiredVars := []string{
 			"DASHBRR__DB_HOST",
 			"DASHBRR__DB_PORT",
 			"DASHBRR__DB_USER",
-			"DASHBRR__DB_PASSWORD",
 			"DASHBRR__DB_NAME",
 		}
 		for _, v := range requiredVars {
@@ -95,6 +414,9 @@ func HasRequiredEnvVars() bool {
 				return false
 			}
 		}
+		if !envSet("DASHBRR__DB_PASSWORD") {
+			return false
+		}
 	default:
 		return false
 	}
@@ -102,26 +424,97 @@ func HasRequiredEnvVars() bool {
 	return true
 }
 
-// LoadConfig loads the configuration from environment variables or TOML file
-func LoadConfig(path string) (*Config, error) {
-	config := &Config{}
+// DefaultPath returns the config file to use when none is given on the
+// command line: DASHBRR__CONFIG_PATH, else the first config.toml,
+// config.yaml or config.yml found in the user config directory, /config or
+// the working directory, else config.toml in the working directory.
+func DefaultPath() string {
+	if envPath := os.Getenv(EnvConfigPath); envPath != "" {
+		return envPath
+	}
+
+	var dirs []string
+	if userConfigDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(userConfigDir, "dashbrr"))
+	}
+	dirs = append(dirs, "/config", ".")
 
-	// If all required environment variables are set, use them directly
-	if HasRequiredEnvVars() {
+	for _, dir := range dirs {
+		for _, name := range []string{"config.toml", "config.yaml", "config.yml"} {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return "config.toml"
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the built-in defaults, the config file at path, environment variables
+// and command-line flags. A missing config file is not an error; a file
+// that cannot be parsed is.
+func Load(path string, flags Flags) (*Config, error) {
+	config, err := LoadConfig(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		config = &Config{}
 		if err := LoadEnvOverrides(config); err != nil {
 			return nil, fmt.Errorf("error loading environment variables: %w", err)
 		}
-		return config, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	// Otherwise try to load from config file
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+	if flags.ListenAddr != "" {
+		config.Server.ListenAddr = flags.ListenAddr
 	}
+	if flags.DBPath != "" {
+		config.Database.Path = flags.DBPath
+	}
+
+	config.applyDefaults(path)
+	return config, nil
+}
 
-	if err := toml.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("error decoding config file: %w", err)
+// applyDefaults fills in settings that are derived from others. The
+// database lives in a data directory next to the config file unless set,
+// and the memory cache is kept next to the database.
+func (c *Config) applyDefaults(path string) {
+	if c.Server.ListenAddr == "" {
+		c.Server.ListenAddr = ":8080"
+	}
+	if c.Database.Type == "" {
+		c.Database.Type = "sqlite"
+	}
+	if c.Database.Path == "" {
+		c.Database.Path = filepath.Join(filepath.Dir(path), "data", "dashbrr.db")
+	}
+	if c.Cache.Dir == "" {
+		c.Cache.Dir = filepath.Dir(c.Database.Path)
+	}
+	if c.Cache.Redis.Port == 0 {
+		c.Cache.Redis.Port = 6379
+	}
+}
+
+// LoadConfig loads the configuration from a TOML or YAML file, with any
+// environment variables that are set overriding it. A missing file is only
+// an error when the environment does not configure the server and
+// database on its own.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := decodeConfig(path, data, config); err != nil {
+			return nil, fmt.Errorf("error decoding config file: %w", err)
+		}
+		config.Path = path
+	case errors.Is(err, fs.ErrNotExist) && HasRequiredEnvVars():
+		// The environment is complete without a file
+	default:
+		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
 	// Override with any environment variables that are set
@@ -132,17 +525,113 @@ func LoadConfig(path string) (*Config, error) {
 	return config, nil
 }
 
+// decodeConfig parses a config file as YAML when it has a .yaml or .yml
+// extension, and as TOML otherwise
+func decodeConfig(path string, data []byte, config *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, config)
+	default:
+		return toml.Unmarshal(data, config)
+	}
+}
+
 // LoadEnvOverrides loads configuration from environment variables
 func LoadEnvOverrides(config *Config) error {
 	// Server
 	if env := os.Getenv("DASHBRR__LISTEN_ADDR"); env != "" {
 		config.Server.ListenAddr = env
 	}
+	if env := os.Getenv("DASHBRR__BASE_PATH"); env != "" {
+		config.Server.BasePath = env
+	}
+	config.Server.BasePath = NormalizeBasePath(config.Server.BasePath)
+	if env := os.Getenv("DASHBRR__TRUSTED_PROXIES"); env != "" {
+		config.Server.TrustedProxies = SplitList(env)
+	}
+	if env := os.Getenv("DASHBRR__COOKIE_SAMESITE"); env != "" {
+		config.Server.Cookies.SameSite = env
+	}
+	if env := os.Getenv("DASHBRR__CSRF_DISABLED"); env != "" {
+		config.Server.CSRF.Disabled = env == "true"
+	}
+	if env := os.Getenv("DASHBRR__CSRF_EXEMPT_PATHS"); env != "" {
+		config.Server.CSRF.ExemptPaths = SplitList(env)
+	}
+	if env := os.Getenv("DASHBRR__CSP_DISABLED"); env != "" {
+		config.Server.Security.CSPDisabled = env == "true"
+	}
+	if env := os.Getenv("DASHBRR__FRAME_ANCESTORS"); env != "" {
+		config.Server.Security.FrameAncestors = SplitList(env)
+	}
+	if env := os.Getenv("DASHBRR__REFERRER_POLICY"); env != "" {
+		config.Server.Security.ReferrerPolicy = env
+	}
+	if env := os.Getenv("DASHBRR__HSTS_DISABLED"); env != "" {
+		config.Server.Security.HSTS.Disabled = env == "true"
+	}
+	if env := os.Getenv("DASHBRR__HSTS_MAX_AGE"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil {
+			config.Server.Security.HSTS.MaxAge = n
+		}
+	}
+	if env := os.Getenv("DASHBRR__HSTS_INCLUDE_SUBDOMAINS"); env != "" {
+		include := env == "true"
+		config.Server.Security.HSTS.IncludeSubdomains = &include
+	}
+	if env := os.Getenv("DASHBRR__HSTS_PRELOAD"); env != "" {
+		preload := env == "true"
+		config.Server.Security.HSTS.Preload = &preload
+	}
+	if env := os.Getenv("DASHBRR__CORS_ALLOWED_ORIGINS"); env != "" {
+		config.Server.CORS.AllowedOrigins = SplitList(env)
+	}
+	if env := os.Getenv("DASHBRR__CORS_ALLOW_CREDENTIALS"); env != "" {
+		config.Server.CORS.AllowCredentials = env == "true"
+	}
+
+	// Logging
+	if env := os.Getenv("DASHBRR__LOG_LEVEL"); env != "" {
+		config.Logging.Level = env
+	}
 
 	// Cache
 	if env := os.Getenv("CACHE_TYPE"); env != "" {
 		config.Cache.Type = env
 	}
+	if env := os.Getenv("DASHBRR__CACHE_DIR"); env != "" {
+		config.Cache.Dir = env
+	}
+	if env := os.Getenv("DASHBRR__CACHE_MAX_ENTRIES"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil {
+			config.Cache.MaxEntries = n
+		}
+	}
+	if env := os.Getenv("DASHBRR__CACHE_MAX_BYTES"); env != "" {
+		if n, err := strconv.ParseInt(env, 10, 64); err == nil {
+			config.Cache.MaxBytes = n
+		}
+	}
+	if env := os.Getenv("DASHBRR__CACHE_PER_USER"); env != "" {
+		config.Cache.PerUser = env == "true"
+	}
+	ttls := map[string]*Duration{
+		"DASHBRR__CACHE_STALE_GRACE":       &config.Cache.StaleGrace,
+		"DASHBRR__CACHE_TTL_DEFAULT":       &config.Cache.TTL.Default,
+		"DASHBRR__CACHE_TTL_HEALTH":        &config.Cache.TTL.Health,
+		"DASHBRR__CACHE_TTL_PLEX_SESSIONS": &config.Cache.TTL.PlexSessions,
+		"DASHBRR__CACHE_TTL_AUTOBRR":       &config.Cache.TTL.Autobrr,
+		"DASHBRR__CACHE_TTL_OVERSEERR":     &config.Cache.TTL.Overseerr,
+		"DASHBRR__CACHE_TTL_MAINTAINERR":   &config.Cache.TTL.Maintainerr,
+		"DASHBRR__CACHE_TTL_SONARR":        &config.Cache.TTL.Sonarr,
+		"DASHBRR__CACHE_TTL_RADARR":        &config.Cache.TTL.Radarr,
+		"DASHBRR__CACHE_TTL_PROWLARR":      &config.Cache.TTL.Prowlarr,
+	}
+	for key, ttl := range ttls {
+		if err := durationEnv(key, ttl); err != nil {
+			return err
+		}
+	}
 	if env := os.Getenv("REDIS_HOST"); env != "" {
 		config.Cache.Redis.Host = env
 	}
@@ -170,12 +659,58 @@ func LoadEnvOverrides(config *Config) error {
 	if env := os.Getenv("DASHBRR__DB_USER"); env != "" {
 		config.Database.User = env
 	}
-	if env := os.Getenv("DASHBRR__DB_PASSWORD"); env != "" {
+	if env, err := secretEnv("DASHBRR__DB_PASSWORD"); err != nil {
+		return err
+	} else if env != "" {
 		config.Database.Password = env
 	}
 	if env := os.Getenv("DASHBRR__DB_NAME"); env != "" {
 		config.Database.Name = env
 	}
+	if env, err := secretEnv("DASHBRR__DB_DSN"); err != nil {
+		return err
+	} else if env != "" {
+		config.Database.DSN = env
+	}
+	if env := os.Getenv("DASHBRR__DB_SSLMODE"); env != "" {
+		config.Database.SSLMode = env
+	}
+	if env := os.Getenv("DASHBRR__DB_SSLROOTCERT"); env != "" {
+		config.Database.SSLRootCert = env
+	}
+	if env := os.Getenv("DASHBRR__DB_SSLCERT"); env != "" {
+		config.Database.SSLCert = env
+	}
+	if env := os.Getenv("DASHBRR__DB_SSLKEY"); env != "" {
+		config.Database.SSLKey = env
+	}
+	if env := os.Getenv("DASHBRR__DB_SCHEMA"); env != "" {
+		config.Database.Schema = env
+	}
+	if env := os.Getenv("DASHBRR__DB_MAX_OPEN_CONNS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil {
+			config.Database.MaxOpenConns = n
+		}
+	}
+	if env := os.Getenv("DASHBRR__DB_MAX_IDLE_CONNS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil {
+			config.Database.MaxIdleConns = n
+		}
+	}
+	if err := durationEnv("DASHBRR__DB_CONN_MAX_LIFETIME", &config.Database.ConnMaxLifetime); err != nil {
+		return err
+	}
+	if err := durationEnv("DASHBRR__DB_CONN_MAX_IDLE_TIME", &config.Database.ConnMaxIdleTime); err != nil {
+		return err
+	}
+	if env := os.Getenv("DASHBRR__DB_CONNECT_RETRIES"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil {
+			config.Database.ConnectRetries = n
+		}
+	}
+	if err := durationEnv("DASHBRR__DB_CONNECT_RETRY_DELAY", &config.Database.ConnectRetryDelay); err != nil {
+		return err
+	}
 
 	// Auth OIDC
 	if env := os.Getenv("OIDC_ISSUER"); env != "" {
@@ -184,12 +719,214 @@ func LoadEnvOverrides(config *Config) error {
 	if env := os.Getenv("OIDC_CLIENT_ID"); env != "" {
 		config.Auth.OIDC.ClientID = env
 	}
-	if env := os.Getenv("OIDC_CLIENT_SECRET"); env != "" {
+	if env, err := secretEnv("OIDC_CLIENT_SECRET"); err != nil {
+		return err
+	} else if env != "" {
 		config.Auth.OIDC.ClientSecret = env
 	}
 	if env := os.Getenv("OIDC_REDIRECT_URL"); env != "" {
 		config.Auth.OIDC.RedirectURL = env
 	}
+	if env := os.Getenv("OIDC_SCOPES"); env != "" {
+		config.Auth.OIDC.Scopes = SplitList(env)
+	}
+	if env := os.Getenv("OIDC_GROUPS_CLAIM"); env != "" {
+		config.Auth.OIDC.GroupsClaim = env
+	}
+	if env := os.Getenv("OIDC_ADMIN_GROUPS"); env != "" {
+		config.Auth.OIDC.AdminGroups = SplitList(env)
+	}
+	if env := os.Getenv("OIDC_OPERATOR_GROUPS"); env != "" {
+		config.Auth.OIDC.OperatorGroups = SplitList(env)
+	}
+	if env := os.Getenv("OIDC_DEFAULT_ROLE"); env != "" {
+		config.Auth.OIDC.DefaultRole = env
+	}
+
+	// Auth forward auth
+	if env := os.Getenv("PROXY_AUTH_TRUSTED_PROXIES"); env != "" {
+		config.Auth.Proxy.TrustedProxies = SplitList(env)
+	}
+	if env := os.Getenv("PROXY_AUTH_USER_HEADER"); env != "" {
+		config.Auth.Proxy.UserHeader = env
+	}
+	if env := os.Getenv("PROXY_AUTH_EMAIL_HEADER"); env != "" {
+		config.Auth.Proxy.EmailHeader = env
+	}
+	if env := os.Getenv("PROXY_AUTH_GROUPS_HEADER"); env != "" {
+		config.Auth.Proxy.GroupsHeader = env
+	}
+	if env := os.Getenv("PROXY_AUTH_ADMIN_GROUPS"); env != "" {
+		config.Auth.Proxy.AdminGroups = SplitList(env)
+	}
+	if env := os.Getenv("PROXY_AUTH_OPERATOR_GROUPS"); env != "" {
+		config.Auth.Proxy.OperatorGroups = SplitList(env)
+	}
+	if env := os.Getenv("PROXY_AUTH_DEFAULT_ROLE"); env != "" {
+		config.Auth.Proxy.DefaultRole = env
+	}
+
+	// Auth LDAP
+	if env := os.Getenv("LDAP_URL"); env != "" {
+		config.Auth.LDAP.URL = env
+	}
+	if env := os.Getenv("LDAP_START_TLS"); env != "" {
+		config.Auth.LDAP.StartTLS = env == "true"
+	}
+	if env := os.Getenv("LDAP_INSECURE_SKIP_VERIFY"); env != "" {
+		config.Auth.LDAP.InsecureSkipVerify = env == "true"
+	}
+	if env := os.Getenv("LDAP_BIND_DN"); env != "" {
+		config.Auth.LDAP.BindDN = env
+	}
+	if env, err := secretEnv("LDAP_BIND_PASSWORD"); err != nil {
+		return err
+	} else if env != "" {
+		config.Auth.LDAP.BindPassword = env
+	}
+	if env := os.Getenv("LDAP_BASE_DN"); env != "" {
+		config.Auth.LDAP.BaseDN = env
+	}
+	if env := os.Getenv("LDAP_USER_FILTER"); env != "" {
+		config.Auth.LDAP.UserFilter = env
+	}
+	if env := os.Getenv("LDAP_USERNAME_ATTRIBUTE"); env != "" {
+		config.Auth.LDAP.UsernameAttribute = env
+	}
+	if env := os.Getenv("LDAP_EMAIL_ATTRIBUTE"); env != "" {
+		config.Auth.LDAP.EmailAttribute = env
+	}
+	if env := os.Getenv("LDAP_GROUP_BASE_DN"); env != "" {
+		config.Auth.LDAP.GroupBaseDN = env
+	}
+	if env := os.Getenv("LDAP_GROUP_FILTER"); env != "" {
+		config.Auth.LDAP.GroupFilter = env
+	}
+	if env := os.Getenv("LDAP_GROUP_NAME_ATTRIBUTE"); env != "" {
+		config.Auth.LDAP.GroupNameAttribute = env
+	}
+	if env := os.Getenv("LDAP_ADMIN_GROUPS"); env != "" {
+		config.Auth.LDAP.AdminGroups = SplitList(env)
+	}
+	if env := os.Getenv("LDAP_OPERATOR_GROUPS"); env != "" {
+		config.Auth.LDAP.OperatorGroups = SplitList(env)
+	}
+	if env := os.Getenv("LDAP_DEFAULT_ROLE"); env != "" {
+		config.Auth.LDAP.DefaultRole = env
+	}
+
+	// Auth lockout
+	if env := os.Getenv("AUTH_LOCKOUT_THRESHOLD"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil {
+			config.Auth.Lockout.Threshold = n
+		}
+	}
+	if err := durationEnv("AUTH_LOCKOUT_DURATION", &config.Auth.Lockout.Duration); err != nil {
+		return err
+	}
+	if env := os.Getenv("AUTH_LOCKOUT_WEBHOOK_URL"); env != "" {
+		config.Auth.Lockout.WebhookURL = env
+	}
+
+	// Rate limits
+	limits := map[string]*RateLimitConfig{
+		"API":       &config.RateLimits.API,
+		"HEALTH":    &config.RateLimits.Health,
+		"AUTH":      &config.RateLimits.Auth,
+		"TAILSCALE": &config.RateLimits.Tailscale,
+	}
+	for name, limit := range limits {
+		if env := os.Getenv("DASHBRR__RATE_LIMIT_" + name + "_REQUESTS"); env != "" {
+			if n, err := strconv.Atoi(env); err == nil {
+				limit.Requests = n
+			}
+		}
+		if err := durationEnv("DASHBRR__RATE_LIMIT_"+name+"_WINDOW", &limit.Window); err != nil {
+			return err
+		}
+	}
+
+	// Declared services
+	if env := os.Getenv("DASHBRR__SERVICE_SYNC_POLICY"); env != "" {
+		config.ServiceSync.Policy = env
+	}
+
+	// Health checks
+	if err := durationEnv("DASHBRR__HEALTH_CHECK_INTERVAL", &config.Health.CheckInterval); err != nil {
+		return err
+	}
+
+	// Auth WebAuthn
+	if env := os.Getenv("WEBAUTHN_RP_ID"); env != "" {
+		config.Auth.WebAuthn.RPID = env
+	}
+	if env := os.Getenv("WEBAUTHN_RP_DISPLAY_NAME"); env != "" {
+		config.Auth.WebAuthn.RPDisplayName = env
+	}
+	if env := os.Getenv("WEBAUTHN_RP_ORIGINS"); env != "" {
+		config.Auth.WebAuthn.RPOrigins = SplitList(env)
+	}
 
 	return nil
 }
+
+// secretEnv returns the value of an environment variable holding a secret.
+// When only KEY_FILE is set, the value is read from that file instead, as
+// mounted by Docker and Kubernetes secrets. A trailing newline is dropped.
+func secretEnv(key string) (string, error) {
+	if env := os.Getenv(key); env != "" {
+		return env, nil
+	}
+
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s_FILE: %w", key, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// envSet reports whether an environment variable, or its _FILE variant,
+// is set
+func envSet(key string) bool {
+	return os.Getenv(key) != "" || os.Getenv(key+"_FILE") != ""
+}
+
+// durationEnv reads a duration from an environment variable, leaving dest
+// alone when it is not set
+func durationEnv(key string, dest *Duration) error {
+	env := os.Getenv(key)
+	if env == "" {
+		return nil
+	}
+	if err := dest.UnmarshalText([]byte(env)); err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+// NormalizeBasePath returns a base path with a leading slash and without a
+// trailing one, so "dashbrr/" becomes "/dashbrr". Serving from the root
+// yields an empty string.
+func NormalizeBasePath(basePath string) string {
+	basePath = path.Clean("/" + strings.TrimSpace(basePath))
+	if basePath == "/" {
+		return ""
+	}
+	return basePath
+}
+
+// SplitList splits a comma-separated value, trimming whitespace and
+// dropping empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	return writeFile(t, "config.toml", content)
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, `
+[server]
+listen_addr = ":9000"
+
+[database]
+type = "sqlite"
+path = "/srv/dashbrr/file.db"
+
+[cache.ttl]
+health = "45s"
+
+[rate_limits.api]
+requests = 120
+window = "2m"
+
+[health]
+check_interval = "1m"
+`)
+
+	// The file is read when no flags or environment are given
+	cfg, err := Load(path, Flags{})
+	require.NoError(t, err)
+	assert.Equal(t, path, cfg.Path)
+	assert.Equal(t, ":9000", cfg.Server.ListenAddr)
+	assert.Equal(t, "/srv/dashbrr/file.db", cfg.Database.Path)
+	assert.Equal(t, "/srv/dashbrr", cfg.Cache.Dir, "the cache lives next to the database")
+	assert.Equal(t, Duration(45*time.Second), cfg.Cache.TTL.Health)
+	assert.Equal(t, 120, cfg.RateLimits.API.Requests)
+	assert.Equal(t, Duration(2*time.Minute), cfg.RateLimits.API.Window)
+	assert.Equal(t, Duration(time.Minute), cfg.Health.CheckInterval)
+
+	// Environment variables override the file
+	t.Setenv("DASHBRR__DB_PATH", "/srv/dashbrr/env.db")
+	t.Setenv("DASHBRR__RATE_LIMIT_API_REQUESTS", "90")
+	cfg, err = Load(path, Flags{})
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/dashbrr/env.db", cfg.Database.Path)
+	assert.Equal(t, 90, cfg.RateLimits.API.Requests)
+	assert.Equal(t, ":9000", cfg.Server.ListenAddr)
+
+	// Flags override both
+	cfg, err = Load(path, Flags{ListenAddr: ":7000", DBPath: "/srv/dashbrr/flag.db"})
+	require.NoError(t, err)
+	assert.Equal(t, ":7000", cfg.Server.ListenAddr)
+	assert.Equal(t, "/srv/dashbrr/flag.db", cfg.Database.Path)
+}
+
+func TestLoad_CompleteEnvironment(t *testing.T) {
+	path := writeConfig(t, `
+[server]
+listen_addr = ":9000"
+base_path = "/dashbrr"
+
+[database]
+type = "sqlite"
+path = "/srv/dashbrr/file.db"
+
+[cache]
+max_entries = 500
+
+[[services]]
+type = "sonarr"
+name = "Sonarr"
+url = "http://sonarr:8989"
+`)
+
+	// An environment that configures the server and database on its own
+	// still overrides the file rather than replacing it
+	t.Setenv("DASHBRR__LISTEN_ADDR", ":8081")
+	t.Setenv("DASHBRR__DB_TYPE", "sqlite")
+	t.Setenv("DASHBRR__DB_PATH", "/srv/dashbrr/env.db")
+	require.True(t, HasRequiredEnvVars())
+
+	cfg, err := Load(path, Flags{})
+	require.NoError(t, err)
+	assert.Equal(t, path, cfg.Path)
+	assert.Equal(t, ":8081", cfg.Server.ListenAddr)
+	assert.Equal(t, "/srv/dashbrr/env.db", cfg.Database.Path)
+	assert.Equal(t, "/dashbrr", cfg.Server.BasePath)
+	assert.Equal(t, 500, cfg.Cache.MaxEntries)
+	require.Len(t, cfg.Services, 1)
+	assert.Equal(t, "sonarr", cfg.Services[0].Type)
+
+	// Without a file the environment is enough
+	cfg, err = LoadConfig(filepath.Join(t.TempDir(), "config.toml"))
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Path)
+	assert.Equal(t, ":8081", cfg.Server.ListenAddr)
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DASHBRR__CACHE_TTL_DEFAULT", "10s")
+	t.Setenv("DASHBRR__CACHE_STALE_GRACE", "-1s")
+	t.Setenv("DASHBRR__CACHE_MAX_ENTRIES", "5000")
+
+	cfg, err := Load(filepath.Join(dir, "config.toml"), Flags{})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Path)
+	assert.Equal(t, ":8080", cfg.Server.ListenAddr)
+	assert.Equal(t, "sqlite", cfg.Database.Type)
+	assert.Equal(t, filepath.Join(dir, "data", "dashbrr.db"), cfg.Database.Path)
+	assert.Equal(t, filepath.Join(dir, "data"), cfg.Cache.Dir)
+	assert.Equal(t, 6379, cfg.Cache.Redis.Port)
+	assert.Equal(t, Duration(10*time.Second), cfg.Cache.TTL.Default)
+	assert.Equal(t, Duration(-time.Second), cfg.Cache.StaleGrace)
+	assert.Equal(t, 5000, cfg.Cache.MaxEntries)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	_, err := Load(writeConfig(t, "[server\n"), Flags{})
+	assert.Error(t, err, "a config file that cannot be parsed is an error")
+
+	_, err = Load(writeConfig(t, "[health]\ncheck_interval = \"often\"\n"), Flags{})
+	assert.Error(t, err)
+
+	_, err = Load(writeConfig(t, "[auth.lockout]\nduration = \"15 minutes\"\n"), Flags{})
+	assert.Error(t, err, "a lockout duration that cannot be parsed is an error")
+
+	cfg, err := Load(writeConfig(t, "[database]\nconn_max_lifetime = \"30m\"\n\n[auth.lockout]\nduration = \"15m\"\n"), Flags{})
+	require.NoError(t, err)
+	assert.Equal(t, Duration(30*time.Minute), cfg.Database.ConnMaxLifetime)
+	assert.Equal(t, Duration(15*time.Minute), cfg.Auth.Lockout.Duration)
+
+	t.Setenv("DASHBRR__HEALTH_CHECK_INTERVAL", "often")
+	_, err = Load(filepath.Join(t.TempDir(), "config.toml"), Flags{})
+	assert.Error(t, err)
+}
+
+func TestLoad_YAML(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  listen_addr: ":9000"
+  security:
+    csp:
+      img-src: ["'self'", "https:"]
+database:
+  type: postgres
+  host: postgres
+  port: 5432
+cache:
+  ttl:
+    health: 45s
+auth:
+  oidc:
+    scopes: [openid, profile]
+`)
+
+	cfg, err := Load(path, Flags{})
+	require.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.Server.ListenAddr)
+	assert.Equal(t, []string{"'self'", "https:"}, cfg.Server.Security.CSP["img-src"])
+	assert.Equal(t, "postgres", cfg.Database.Type)
+	assert.Equal(t, 5432, cfg.Database.Port)
+	assert.Equal(t, Duration(45*time.Second), cfg.Cache.TTL.Health)
+	assert.Equal(t, []string{"openid", "profile"}, cfg.Auth.OIDC.Scopes)
+
+	_, err = Load(writeFile(t, "config.yml", "server: [\n"), Flags{})
+	assert.Error(t, err)
+}
+
+func TestLoadEnvOverrides_SecretFiles(t *testing.T) {
+	t.Setenv("DASHBRR__DB_PASSWORD_FILE", writeFile(t, "db_password", "s3cret\n"))
+	t.Setenv("OIDC_CLIENT_SECRET_FILE", writeFile(t, "oidc_secret", "from-file"))
+	t.Setenv("OIDC_CLIENT_SECRET", "from-env")
+
+	cfg := &Config{}
+	require.NoError(t, LoadEnvOverrides(cfg))
+	assert.Equal(t, "s3cret", cfg.Database.Password)
+	assert.Equal(t, "from-env", cfg.Auth.OIDC.ClientSecret, "the variable itself wins over its _FILE variant")
+
+	t.Setenv("LDAP_BIND_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, LoadEnvOverrides(&Config{}))
+}
+
+func TestHasRequiredEnvVars_SecretFile(t *testing.T) {
+	t.Setenv("DASHBRR__LISTEN_ADDR", ":8080")
+	t.Setenv("DASHBRR__DB_TYPE", "postgres")
+	t.Setenv("DASHBRR__DB_HOST", "postgres")
+	t.Setenv("DASHBRR__DB_PORT", "5432")
+	t.Setenv("DASHBRR__DB_USER", "dashbrr")
+	t.Setenv("DASHBRR__DB_NAME", "dashbrr")
+	assert.False(t, HasRequiredEnvVars())
+
+	t.Setenv("DASHBRR__DB_PASSWORD_FILE", "/run/secrets/db_password")
+	assert.True(t, HasRequiredEnvVars())
+}
+
+func TestCacheConfig_RedisAddr(t *testing.T) {
+	assert.Empty(t, CacheConfig{}.RedisAddr())
+	assert.Equal(t, "redis:6380", CacheConfig{Redis: RedisConfig{Host: "redis", Port: 6380}}.RedisAddr())
+}
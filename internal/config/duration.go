@@ -0,0 +1,25 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package config
+
+import "time"
+
+// Duration is a time.Duration written in Go syntax, such as "30s" or "5m",
+// in the config file and environment
+type Duration time.Duration
+
+// UnmarshalText parses a duration such as "1m30s"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration in Go syntax
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
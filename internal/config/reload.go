@@ -0,0 +1,151 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultWatchInterval is how often the config file is checked for changes
+const DefaultWatchInterval = 5 * time.Second
+
+// Reloader reads the configuration again when the config file changes and
+// hands the result to an apply function
+type Reloader struct {
+	path  string
+	flags Flags
+	apply func(old, updated *Config)
+
+	mu      sync.Mutex
+	current *Config
+	stamp   fileStamp
+}
+
+// fileStamp identifies a version of the config file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader creates a reloader for the configuration loaded from path
+// with flags. apply is called with the previous and the new configuration
+// whenever a reload changes it.
+func NewReloader(current *Config, path string, flags Flags, apply func(old, updated *Config)) *Reloader {
+	return &Reloader{
+		path:    path,
+		flags:   flags,
+		apply:   apply,
+		current: current,
+		stamp:   stat(path),
+	}
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload reads the configuration again and applies it when it changed. On
+// error the configuration in effect is kept.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stamp = stat(r.path)
+	updated, err := Load(r.path, r.flags)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(r.current, updated) {
+		return nil
+	}
+
+	old := r.current
+	r.current = updated
+	r.apply(old, updated)
+	return nil
+}
+
+// Watch reloads the configuration when the config file changes, checking
+// every interval, or when a signal such as SIGHUP arrives. It returns when
+// ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, signals <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			log.Info().Str("path", r.path).Msg("Reloading configuration")
+		case <-ticker.C:
+			r.mu.Lock()
+			changed := stat(r.path) != r.stamp
+			r.mu.Unlock()
+			if !changed {
+				continue
+			}
+			log.Info().Str("path", r.path).Msg("Config file changed, reloading configuration")
+		}
+
+		if err := r.Reload(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload configuration, keeping the current one")
+		}
+	}
+}
+
+// stat returns the version of a file, or the zero stamp when it is missing
+func stat(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// RestartRequired lists the settings that differ between two
+// configurations and only take effect after a restart. Logging, rate
+// limits, cache TTLs, CORS, login lockout and declared services are
+// applied at runtime.
+func RestartRequired(old, updated *Config) []string {
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"server.listen_addr", old.Server.ListenAddr, updated.Server.ListenAddr},
+		{"server.base_path", old.Server.BasePath, updated.Server.BasePath},
+		{"server.trusted_proxies", old.Server.TrustedProxies, updated.Server.TrustedProxies},
+		{"server.cookies", old.Server.Cookies, updated.Server.Cookies},
+		{"server.csrf", old.Server.CSRF, updated.Server.CSRF},
+		{"server.security", old.Server.Security, updated.Server.Security},
+		{"database", old.Database, updated.Database},
+		{"cache.type", old.Cache.Type, updated.Cache.Type},
+		{"cache.dir", old.Cache.Dir, updated.Cache.Dir},
+		{"cache.max_entries", old.Cache.MaxEntries, updated.Cache.MaxEntries},
+		{"cache.max_bytes", old.Cache.MaxBytes, updated.Cache.MaxBytes},
+		{"cache.redis", old.Cache.Redis, updated.Cache.Redis},
+		{"auth.oidc", old.Auth.OIDC, updated.Auth.OIDC},
+		{"auth.proxy", old.Auth.Proxy, updated.Auth.Proxy},
+		{"auth.ldap", old.Auth.LDAP, updated.Auth.LDAP},
+		{"auth.webauthn", old.Auth.WebAuthn, updated.Auth.WebAuthn},
+		{"health.check_interval", old.Health.CheckInterval, updated.Health.CheckInterval},
+	}
+
+	var changed []string
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.old, field.new) {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed
+}
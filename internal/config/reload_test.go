@@ -0,0 +1,54 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader_Reload(t *testing.T) {
+	path := writeConfig(t, "[rate_limits.api]\nrequests = 60\n")
+	cfg, err := Load(path, Flags{})
+	require.NoError(t, err)
+
+	var applied []*Config
+	reloader := NewReloader(cfg, path, Flags{}, func(old, updated *Config) {
+		assert.Same(t, cfg, old)
+		applied = append(applied, updated)
+	})
+
+	// An unchanged file applies nothing
+	require.NoError(t, reloader.Reload())
+	assert.Empty(t, applied)
+
+	require.NoError(t, os.WriteFile(path, []byte("[rate_limits.api]\nrequests = 120\n"), 0o600))
+	require.NoError(t, reloader.Reload())
+	require.Len(t, applied, 1)
+	assert.Equal(t, 120, reloader.Current().RateLimits.API.Requests)
+
+	// A broken file keeps the configuration in effect
+	require.NoError(t, os.WriteFile(path, []byte("[rate_limits\n"), 0o600))
+	assert.Error(t, reloader.Reload())
+	assert.Len(t, applied, 1)
+	assert.Equal(t, 120, reloader.Current().RateLimits.API.Requests)
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := &Config{}
+	updated := &Config{}
+	updated.Logging.Level = "debug"
+	updated.RateLimits.API.Requests = 10
+	updated.Cache.TTL.Default = Duration(time.Minute)
+	assert.Empty(t, RestartRequired(old, updated), "runtime settings need no restart")
+
+	updated.Server.ListenAddr = ":9000"
+	updated.Database.Type = "postgres"
+	updated.Cache.Type = "redis"
+	assert.Equal(t, []string{"server.listen_addr", "database", "cache.type"}, RestartRequired(old, updated))
+}
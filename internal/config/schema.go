@@ -0,0 +1,86 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package config
+
+import (
+	"reflect"
+
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+// durationPattern matches durations in Go syntax, such as "30s", "1h30m" or
+// "-1s"
+const durationPattern = `^-?(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`
+
+// schemaEnums lists the accepted values of settings with a fixed set.
+// Elements of lists are written as services[].
+var schemaEnums = map[string][]string{
+	"logging.level":            {"trace", "debug", "info", "warn", "error", "fatal", "panic", "disabled"},
+	"server.cookies.same_site": {"lax", "strict", "none"},
+	"database.type":            {"sqlite", "postgres"},
+	"database.sslmode":         {"disable", "allow", "prefer", "require", "verify-ca", "verify-full"},
+	"cache.type":               {"memory", "disk", "redis"},
+	"service_sync.policy":      {ServiceSyncCreate, ServiceSyncSync, ServiceSyncPrune},
+	"services[].type":          models.ServiceTypes,
+}
+
+// Schema returns a JSON Schema describing the config file, for editor
+// completion and validation of TOML and YAML files
+func Schema() map[string]interface{} {
+	schema := schemaFor("", reflect.TypeOf(Config{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "dashbrr configuration"
+	return schema
+}
+
+// schemaFor describes the values of type t at key
+func schemaFor(key string, t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(Duration(0)) {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(key, t.Elem())
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := tagName(field)
+			if name == "" || name == "-" {
+				continue
+			}
+			property := schemaFor(joinKey(key, name), field.Type)
+			if env := field.Tag.Get("env"); env != "" {
+				property["description"] = "Environment variable: " + env
+			}
+			properties[name] = property
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaFor(key+".*", t.Elem()),
+		}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaFor(key+"[]", t.Elem()),
+		}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	}
+
+	schema := map[string]interface{}{"type": "string"}
+	if values, ok := schemaEnums[key]; ok {
+		schema["enum"] = values
+	}
+	return schema
+}
@@ -0,0 +1,472 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+// Problem is an error found in a configuration
+type Problem struct {
+	// Line in the config file, 0 when unknown
+	Line int
+	// Key is the setting, such as cache.ttl.health or services[0].url
+	Key     string
+	Message string
+}
+
+// Format describes the problem in the style of compiler errors, such as
+// "config.toml:12: cache.ttl.health: invalid duration"
+func (p Problem) Format(path string) string {
+	var b strings.Builder
+	b.WriteString(path)
+	if p.Line > 0 {
+		fmt.Fprintf(&b, ":%d", p.Line)
+	}
+	b.WriteString(": ")
+	if p.Key != "" {
+		b.WriteString(p.Key + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ValidateFile checks the config file at path: its syntax, unknown keys,
+// the types of values and, once those are sound, the settings loaded from
+// it and the environment. Problems point at the line of the key when it is
+// in the file.
+func ValidateFile(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	raw, lines, problem := parseRaw(path, data)
+	if problem != nil {
+		return []Problem{*problem}, nil
+	}
+
+	problems := checkKeys("", raw, reflect.TypeOf(Config{}))
+	if len(problems) == 0 {
+		config := &Config{}
+		if err := decodeConfig(path, data, config); err != nil {
+			problems = append(problems, Problem{Message: err.Error()})
+		} else if err := LoadEnvOverrides(config); err != nil {
+			problems = append(problems, Problem{Message: err.Error()})
+		} else {
+			config.applyDefaults(path)
+			problems = append(problems, config.Validate()...)
+		}
+	}
+
+	for i := range problems {
+		if problems[i].Line == 0 {
+			problems[i].Line = lineOf(lines, problems[i].Key)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Key < problems[j].Key
+	})
+	return problems, nil
+}
+
+// Validate checks settings that conflict or are out of range
+func (c *Config) Validate() []Problem {
+	var problems []Problem
+	add := func(key, format string, args ...interface{}) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Logging.Level != "" {
+		if _, err := zerolog.ParseLevel(strings.ToLower(c.Logging.Level)); err != nil {
+			add("logging.level", "unknown log level %q", c.Logging.Level)
+		}
+	}
+	switch strings.ToLower(c.Server.Cookies.SameSite) {
+	case "", "lax", "strict", "none":
+	default:
+		add("server.cookies.same_site", "expected lax, strict or none, got %q", c.Server.Cookies.SameSite)
+	}
+
+	switch c.Database.Type {
+	case "sqlite":
+		if c.Database.Path == "" {
+			add("database.path", "sqlite requires a path")
+		}
+	case "postgres":
+		if c.Database.DSN == "" && (c.Database.Host == "" || c.Database.User == "" || c.Database.Name == "") {
+			add("database", "postgres requires host, user and name, or dsn")
+		}
+	default:
+		add("database.type", "expected sqlite or postgres, got %q", c.Database.Type)
+	}
+	durations := map[string]Duration{
+		"database.conn_max_lifetime":   c.Database.ConnMaxLifetime,
+		"database.conn_max_idle_time":  c.Database.ConnMaxIdleTime,
+		"database.connect_retry_delay": c.Database.ConnectRetryDelay,
+		"auth.lockout.duration":        c.Auth.Lockout.Duration,
+	}
+	for key, value := range durations {
+		if value < 0 {
+			add(key, "must not be negative")
+		}
+	}
+
+	switch strings.ToLower(c.Cache.Type) {
+	case "", "memory", "disk":
+	case "redis":
+		if c.Cache.Redis.Host == "" {
+			add("cache.redis.host", "the redis cache requires a host")
+		}
+	default:
+		add("cache.type", "expected memory, disk or redis, got %q", c.Cache.Type)
+	}
+	if c.Cache.MaxEntries < 0 {
+		add("cache.max_entries", "must not be negative")
+	}
+	if c.Cache.MaxBytes < 0 {
+		add("cache.max_bytes", "must not be negative")
+	}
+
+	ttls := reflect.ValueOf(c.Cache.TTL)
+	for i := 0; i < ttls.NumField(); i++ {
+		if ttls.Field(i).Interface().(Duration) < 0 {
+			add("cache.ttl."+tagName(ttls.Type().Field(i)), "must not be negative")
+		}
+	}
+	limits := map[string]RateLimitConfig{
+		"api":       c.RateLimits.API,
+		"health":    c.RateLimits.Health,
+		"auth":      c.RateLimits.Auth,
+		"tailscale": c.RateLimits.Tailscale,
+	}
+	for name, limit := range limits {
+		if limit.Requests < 0 {
+			add("rate_limits."+name+".requests", "must not be negative")
+		}
+		if limit.Window < 0 {
+			add("rate_limits."+name+".window", "must not be negative")
+		}
+	}
+	if c.Health.CheckInterval < 0 {
+		add("health.check_interval", "must not be negative")
+	}
+
+	oidc := c.Auth.OIDC
+	if (oidc.Issuer != "" || oidc.ClientID != "" || oidc.ClientSecret != "") &&
+		(oidc.Issuer == "" || oidc.ClientID == "" || oidc.ClientSecret == "") {
+		add("auth.oidc", "issuer, client_id and client_secret must be set together")
+	}
+	if c.Auth.LDAP.URL != "" && c.Auth.LDAP.BaseDN == "" {
+		add("auth.ldap.base_dn", "ldap requires a base_dn")
+	}
+
+	switch strings.ToLower(c.ServiceSync.Policy) {
+	case "", ServiceSyncCreate, ServiceSyncSync, ServiceSyncPrune:
+	default:
+		add("service_sync.policy", "expected create, sync or prune, got %q", c.ServiceSync.Policy)
+	}
+	problems = append(problems, validateServices(c.Services)...)
+
+	return problems
+}
+
+// validateServices checks the declared services as they are reconciled
+func validateServices(services []ServiceConfig) []Problem {
+	var problems []Problem
+	seen := make(map[string]int, len(services))
+	counts := make(map[string]int)
+
+	for i, service := range services {
+		key := fmt.Sprintf("services[%d]", i)
+		add := func(field, format string, args ...interface{}) {
+			problems = append(problems, Problem{Key: key + field, Message: fmt.Sprintf(format, args...)})
+		}
+
+		serviceType := strings.ToLower(service.Type)
+		if !models.IsServiceType(serviceType) {
+			add(".type", "unknown service type %q", service.Type)
+		}
+		if service.URL == "" {
+			add(".url", "url is required")
+		}
+
+		keys := 0
+		for _, value := range []string{service.APIKey, service.APIKeyEnv, service.APIKeyFile} {
+			if value != "" {
+				keys++
+			}
+		}
+		if keys > 1 {
+			add("", "only one of api_key, api_key_env and api_key_file may be set")
+		} else if _, err := service.ResolveAPIKey(); err != nil {
+			add("", "%v", err)
+		}
+		if service.CheckInterval < 0 {
+			add(".check_interval", "must not be negative")
+		}
+
+		counts[serviceType]++
+		instanceID := service.InstanceID(counts[serviceType])
+		if first, ok := seen[instanceID]; ok {
+			add(".id", "instance ID %s is already used by services[%d]", instanceID, first)
+		} else {
+			seen[instanceID] = i
+		}
+	}
+	return problems
+}
+
+// parseRaw parses a config file into plain maps and lists, along with the
+// line each key is on. A syntax error is returned as a problem.
+func parseRaw(path string, data []byte) (map[string]interface{}, map[string]int, *Problem) {
+	raw := map[string]interface{}{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, nil, &Problem{Message: err.Error()}
+		}
+		if err := node.Decode(&raw); err != nil && len(node.Content) > 0 {
+			return nil, nil, &Problem{Line: node.Line, Message: "the config file must be a mapping"}
+		}
+		lines := map[string]int{}
+		yamlLines(&node, "", lines)
+		return raw, lines, nil
+	default:
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			problem := &Problem{Message: err.Error()}
+			var decodeErr *toml.DecodeError
+			if errors.As(err, &decodeErr) {
+				problem.Line, _ = decodeErr.Position()
+			}
+			return nil, nil, problem
+		}
+		return raw, tomlLines(data), nil
+	}
+}
+
+// checkKeys compares parsed values against the fields of t, reporting
+// unknown keys and values of the wrong type
+func checkKeys(key string, value interface{}, t reflect.Type) []Problem {
+	// Keys without a value, such as an empty YAML section, are left unset
+	if value == nil {
+		return nil
+	}
+	mismatch := func(expected string) []Problem {
+		return []Problem{{Key: key, Message: fmt.Sprintf("expected %s, got %s", expected, kindOf(value))}}
+	}
+
+	if t == reflect.TypeOf(Duration(0)) {
+		text, ok := value.(string)
+		if !ok {
+			return mismatch("a duration such as \"30s\"")
+		}
+		var d Duration
+		if err := d.UnmarshalText([]byte(text)); err != nil {
+			return []Problem{{Key: key, Message: fmt.Sprintf("invalid duration %q", text)}}
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return checkKeys(key, value, t.Elem())
+	case reflect.Struct:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch("a table")
+		}
+		fields := make(map[string]reflect.Type, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if name := tagName(t.Field(i)); name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		var problems []Problem
+		for name, child := range table {
+			childKey := joinKey(key, name)
+			fieldType, ok := fields[name]
+			if !ok {
+				problems = append(problems, Problem{Key: childKey, Message: "unknown key"})
+				continue
+			}
+			problems = append(problems, checkKeys(childKey, child, fieldType)...)
+		}
+		return problems
+	case reflect.Map:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch("a table")
+		}
+		var problems []Problem
+		for name, child := range table {
+			problems = append(problems, checkKeys(joinKey(key, name), child, t.Elem())...)
+		}
+		return problems
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			return mismatch("a list")
+		}
+		var problems []Problem
+		for i, child := range list {
+			problems = append(problems, checkKeys(fmt.Sprintf("%s[%d]", key, i), child, t.Elem())...)
+		}
+		return problems
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return mismatch("a string")
+		}
+	case reflect.Int, reflect.Int64:
+		switch value.(type) {
+		case int, int64, uint64:
+		default:
+			return mismatch("an integer")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return mismatch("true or false")
+		}
+	}
+	return nil
+}
+
+// kindOf describes a parsed value for error messages
+func kindOf(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int, int64, uint64, float64:
+		return fmt.Sprintf("%v", v)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a table"
+	case nil:
+		return "nothing"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// tagName returns the config file key of a struct field
+func tagName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	return name
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// lineOf returns the line of key, or of the closest enclosing key that is
+// in the file
+func lineOf(lines map[string]int, key string) int {
+	for key != "" {
+		if line, ok := lines[key]; ok {
+			return line
+		}
+		cut := strings.LastIndexAny(key, ".[")
+		if cut < 0 {
+			break
+		}
+		key = key[:cut]
+	}
+	return 0
+}
+
+// yamlLines records the line of every key below node
+func yamlLines(node *yaml.Node, key string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			yamlLines(child, key, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childKey := joinKey(key, node.Content[i].Value)
+			lines[childKey] = node.Content[i].Line
+			yamlLines(node.Content[i+1], childKey, lines)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			childKey := fmt.Sprintf("%s[%d]", key, i)
+			lines[childKey] = child.Line
+			yamlLines(child, childKey, lines)
+		}
+	}
+}
+
+// tomlLines records the line of every table header and key in a TOML
+// file. It reads the file line by line, which is enough for the keys
+// dashbrr uses.
+func tomlLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	arrays := map[string]int{}
+	table := ""
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[["):
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "[["), "]]")
+			name = tomlKey(name)
+			table = fmt.Sprintf("%s[%d]", name, arrays[name])
+			arrays[name]++
+			lines[table] = i + 1
+		case strings.HasPrefix(line, "["):
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "["), "]")
+			table = tomlKey(name)
+			// Subtables of the last array element, such as [services.x]
+			for array, n := range arrays {
+				if strings.HasPrefix(table, array+".") {
+					table = fmt.Sprintf("%s[%d]%s", array, n-1, strings.TrimPrefix(table, array))
+				}
+			}
+			lines[table] = i + 1
+		default:
+			name, _, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			key := joinKey(table, tomlKey(name))
+			if _, seen := lines[key]; !seen {
+				lines[key] = i + 1
+			}
+		}
+	}
+	return lines
+}
+
+// tomlKey normalizes a possibly dotted and quoted TOML key
+func tomlKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFile_TOML(t *testing.T) {
+	path := writeConfig(t, `[server]
+listen_adr = ":9000"
+
+[database]
+type = "postgres"
+port = "5432"
+
+[cache.ttl]
+health = "often"
+
+[[services]]
+type = "sonarr"
+url = "http://sonarr"
+
+[[services]]
+type = "sonar"
+url = "http://sonarr-4k"
+`)
+
+	problems, err := ValidateFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{
+		{Line: 2, Key: "server.listen_adr", Message: "unknown key"},
+		{Line: 6, Key: "database.port", Message: `expected an integer, got "5432"`},
+		{Line: 9, Key: "cache.ttl.health", Message: `invalid duration "often"`},
+	}, problems, "structural problems are reported before settings are checked")
+
+	path = writeConfig(t, `[database]
+type = "postgres"
+port = 5432
+
+[cache]
+type = "redis"
+
+[[services]]
+type = "sonarr"
+url = "http://sonarr"
+
+[[services]]
+type = "sonar"
+url = "http://sonarr-4k"
+api_key = "key"
+api_key_env = "SONARR_KEY"
+`)
+
+	problems, err = ValidateFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{
+		{Line: 1, Key: "database", Message: "postgres requires host, user and name, or dsn"},
+		{Line: 5, Key: "cache.redis.host", Message: "the redis cache requires a host"},
+		{Line: 12, Key: "services[1]", Message: "only one of api_key, api_key_env and api_key_file may be set"},
+		{Line: 13, Key: "services[1].type", Message: `unknown service type "sonar"`},
+	}, problems, "settings are checked once the file is sound, missing keys point at their table")
+
+	problems, err = ValidateFile(writeConfig(t, "[server]\nlisten_addr = \":9000\"\n"))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestValidateFile_YAML(t *testing.T) {
+	path := writeFile(t, "config.yaml", `server:
+  listen_addr: ":9000"
+logging:
+  level: loud
+rate_limits:
+  api:
+    requests: many
+auth:
+`)
+
+	problems, err := ValidateFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{
+		{Line: 7, Key: "rate_limits.api.requests", Message: `expected an integer, got "many"`},
+	}, problems)
+
+	problems, err = ValidateFile(writeFile(t, "config.yml", "logging:\n  level: loud\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{{Line: 2, Key: "logging.level", Message: `unknown log level "loud"`}}, problems)
+}
+
+func TestValidateFile_Syntax(t *testing.T) {
+	problems, err := ValidateFile(writeConfig(t, "[server]\nlisten_addr = \n"))
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 2, problems[0].Line)
+
+	_, err = ValidateFile(filepath.Join(t.TempDir(), "missing.toml"))
+	assert.Error(t, err)
+}
+
+func TestProblem_Format(t *testing.T) {
+	assert.Equal(t, "config.toml:3: cache.type: unknown", Problem{Line: 3, Key: "cache.type", Message: "unknown"}.Format("config.toml"))
+	assert.Equal(t, "config.toml: broken", Problem{Message: "broken"}.Format("config.toml"))
+}
+
+func TestSchema(t *testing.T) {
+	data, err := json.Marshal(Schema())
+	require.NoError(t, err)
+
+	var schema struct {
+		Properties map[string]struct {
+			Properties map[string]struct {
+				Type        string   `json:"type"`
+				Enum        []string `json:"enum"`
+				Pattern     string   `json:"pattern"`
+				Description string   `json:"description"`
+			} `json:"properties"`
+			Items struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(data, &schema))
+
+	database := schema.Properties["database"].Properties
+	assert.Equal(t, []string{"sqlite", "postgres"}, database["type"].Enum)
+	assert.Equal(t, "integer", database["port"].Type)
+	assert.Equal(t, "Environment variable: DASHBRR__DB_PORT", database["port"].Description)
+	assert.NotEmpty(t, schema.Properties["health"].Properties["check_interval"].Pattern)
+	assert.Contains(t, schema.Properties["services"].Items.Properties["type"].Enum, "sonarr")
+}
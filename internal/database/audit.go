@@ -0,0 +1,168 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+const defaultAuditLimit = 100
+
+// placeholder returns the bind parameter for the n-th (1-based) argument
+func (db *DB) placeholder(n int) string {
+	if db.driver == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// CreateAuditEvent stores a new audit event
+func (db *DB) CreateAuditEvent(event *models.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Status == "" {
+		event.Status = models.AuditStatusSuccess
+	}
+
+	changes, err := marshalNullableJSON(event.Changes, len(event.Changes) > 0)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit changes: %w", err)
+	}
+	details, err := marshalNullableJSON(event.Details, len(event.Details) > 0)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+
+	args := []interface{}{
+		event.CreatedAt,
+		event.Actor,
+		event.ActorID,
+		event.IP,
+		event.Action,
+		event.Target,
+		event.Status,
+		changes,
+		details,
+	}
+
+	if db.driver == "postgres" {
+		return db.QueryRow(`
+			INSERT INTO audit_events (created_at, actor, actor_id, ip, action, target, status, changes, details)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id`, args...).Scan(&event.ID)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO audit_events (created_at, actor, actor_id, ip, action, target, status, changes, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+	if err != nil {
+		return err
+	}
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+// ListAuditEvents returns audit events matching the filter, newest first
+func (db *DB) ListAuditEvents(filter models.AuditFilter) ([]models.AuditEvent, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	addCondition := func(column string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, column+db.placeholder(len(args)))
+	}
+
+	if filter.Action != "" {
+		addCondition("action = ", filter.Action)
+	}
+	if filter.Actor != "" {
+		addCondition("actor = ", filter.Actor)
+	}
+	if filter.Target != "" {
+		addCondition("target = ", filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		addCondition("created_at >= ", filter.Since)
+	}
+
+	query := `
+		SELECT id, created_at, actor, actor_id, ip, action, target, status, changes, details
+		FROM audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	args = append(args, limit)
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + db.placeholder(len(args))
+	args = append(args, filter.Offset)
+	query += " OFFSET " + db.placeholder(len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var (
+			event            models.AuditEvent
+			ip, target       sql.NullString
+			changes, details sql.NullString
+		)
+		if err := rows.Scan(
+			&event.ID,
+			&event.CreatedAt,
+			&event.Actor,
+			&event.ActorID,
+			&ip,
+			&event.Action,
+			&target,
+			&event.Status,
+			&changes,
+			&details,
+		); err != nil {
+			return nil, err
+		}
+		event.IP = ip.String
+		event.Target = target.String
+		if changes.Valid && changes.String != "" {
+			if err := json.Unmarshal([]byte(changes.String), &event.Changes); err != nil {
+				return nil, fmt.Errorf("failed to decode audit changes: %w", err)
+			}
+		}
+		if details.Valid && details.String != "" {
+			if err := json.Unmarshal([]byte(details.String), &event.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode audit details: %w", err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// marshalNullableJSON encodes v as JSON, or NULL when present is false
+func marshalNullableJSON(v interface{}, present bool) (sql.NullString, error) {
+	if !present {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+func TestAuditEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	before := &models.ServiceConfiguration{InstanceID: "sonarr-1", URL: "http://old", APIKey: "old-key"}
+	after := &models.ServiceConfiguration{InstanceID: "sonarr-1", URL: "http://new", APIKey: "new-key"}
+
+	events := []models.AuditEvent{
+		{
+			CreatedAt: time.Now().Add(-time.Hour),
+			Actor:     "admin",
+			ActorID:   1,
+			IP:        "10.0.0.1",
+			Action:    models.AuditServiceUpdate,
+			Target:    "sonarr-1",
+			Changes:   models.ServiceConfigChanges(before, after),
+		},
+		{
+			Actor:   "admin",
+			Action:  models.AuditQueueDelete,
+			Target:  "sonarr-1",
+			Details: map[string]interface{}{"queueId": "42"},
+		},
+		{
+			Actor:  "guest",
+			Action: models.AuditLoginFailed,
+			Status: models.AuditStatusFailure,
+		},
+	}
+	for i := range events {
+		if err := db.CreateAuditEvent(&events[i]); err != nil {
+			t.Fatalf("Failed to create audit event: %v", err)
+		}
+		if events[i].ID == 0 {
+			t.Error("Expected audit event ID to be set")
+		}
+	}
+
+	all, err := db.ListAuditEvents(models.AuditFilter{})
+	if err != nil {
+		t.Fatalf("Failed to list audit events: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 audit events, got %d", len(all))
+	}
+	if all[2].Action != models.AuditServiceUpdate {
+		t.Errorf("Expected oldest event last, got %s", all[2].Action)
+	}
+
+	change, ok := all[2].Changes["apiKey"]
+	if !ok {
+		t.Fatal("Expected apiKey change to be recorded")
+	}
+	if change.Before != "[REDACTED]" || change.After != "[REDACTED]" {
+		t.Errorf("Expected API keys to be redacted, got %v -> %v", change.Before, change.After)
+	}
+	if all[2].Changes["url"].After != "http://new" {
+		t.Errorf("Expected url change to be recorded, got %v", all[2].Changes["url"])
+	}
+
+	filtered, err := db.ListAuditEvents(models.AuditFilter{Actor: "admin", Target: "sonarr-1", Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to list filtered audit events: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].Action != models.AuditQueueDelete {
+		t.Errorf("Unexpected filtered result: %+v", filtered)
+	}
+	if filtered[0].Details["queueId"] != "42" {
+		t.Errorf("Expected details to round-trip, got %v", filtered[0].Details)
+	}
+
+	failures, err := db.ListAuditEvents(models.AuditFilter{Action: models.AuditLoginFailed})
+	if err != nil {
+		t.Fatalf("Failed to list login failures: %v", err)
+	}
+	if len(failures) != 1 || failures[0].Status != models.AuditStatusFailure {
+		t.Errorf("Unexpected login failure result: %+v", failures)
+	}
+}
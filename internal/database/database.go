@@ -4,16 +4,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 	_ "modernc.org/sqlite"
 
+	"github.com/autobrr/dashbrr/internal/config"
 	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/types"
 )
@@ -34,39 +38,92 @@ type Config struct {
 	Password string
 	DBName   string
 	Path     string // For SQLite
+
+	// PostgreSQL connection options
+	DSN         string // Full connection string, overrides the fields above
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	SearchPath  string
+
+	// Connection pool tuning
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// Startup connection retries (PostgreSQL only)
+	MaxRetries int
+	RetryDelay time.Duration
 }
 
-// NewConfig creates a new database configuration from environment variables
-func NewConfig() *Config {
-	dbType := os.Getenv("DASHBRR__DB_TYPE")
-	if dbType == "" {
-		dbType = "sqlite" // Default to SQLite
+const (
+	defaultSSLMode         = "disable"
+	defaultMaxOpenConns    = 25
+	defaultMaxIdleConns    = 25
+	defaultConnMaxLifetime = 5 * time.Minute
+	defaultMaxRetries      = 5
+	defaultRetryDelay      = time.Second
+)
+
+// NewConfigFromSettings creates a database configuration from the application
+// configuration. PostgreSQL connections default to localhost:5432, with
+// dashbrr as the user, password and database name.
+func NewConfigFromSettings(settings config.DatabaseConfig) *Config {
+	cfg := &Config{
+		Driver:       settings.Type,
+		Host:         settings.Host,
+		User:         settings.User,
+		Password:     settings.Password,
+		DBName:       settings.Name,
+		Path:         settings.Path,
+		DSN:          settings.DSN,
+		SSLMode:      settings.SSLMode,
+		SSLRootCert:  settings.SSLRootCert,
+		SSLCert:      settings.SSLCert,
+		SSLKey:       settings.SSLKey,
+		SearchPath:   settings.Schema,
+		MaxOpenConns: settings.MaxOpenConns,
+		MaxIdleConns: settings.MaxIdleConns,
+		MaxRetries:   settings.ConnectRetries,
+
+		ConnMaxLifetime: time.Duration(settings.ConnMaxLifetime),
+		ConnMaxIdleTime: time.Duration(settings.ConnMaxIdleTime),
+		RetryDelay:      time.Duration(settings.ConnectRetryDelay),
 	}
 
-	config := &Config{
-		Driver: dbType,
+	if cfg.Driver == "" {
+		cfg.Driver = "sqlite"
+	}
+	if settings.Port != 0 {
+		cfg.Port = strconv.Itoa(settings.Port)
 	}
 
-	if dbType == "postgres" {
-		config.Host = getEnv("DASHBRR__DB_HOST", "localhost")
-		config.Port = getEnv("DASHBRR__DB_PORT", "5432")
-		config.User = getEnv("DASHBRR__DB_USER", "dashbrr")
-		config.Password = getEnv("DASHBRR__DB_PASSWORD", "dashbrr")
-		config.DBName = getEnv("DASHBRR__DB_NAME", "dashbrr")
-	} else {
-		config.Path = getEnv("DASHBRR__DB_PATH", "./data/dashbrr.db")
+	if cfg.Driver == "postgres" && cfg.DSN == "" {
+		if cfg.Host == "" {
+			cfg.Host = "localhost"
+		}
+		if cfg.Port == "" {
+			cfg.Port = "5432"
+		}
+		if cfg.User == "" {
+			cfg.User = "dashbrr"
+		}
+		if cfg.Password == "" {
+			cfg.Password = "dashbrr"
+		}
+		if cfg.DBName == "" {
+			cfg.DBName = "dashbrr"
+		}
 	}
 
-	return config
+	return cfg
 }
 
-// InitDB initializes the database connection and performs migrations
+// InitDB opens the SQLite database at dbPath and performs migrations
 func InitDB(dbPath string) (*DB, error) {
-	config := NewConfig()
-	if config.Driver == "sqlite" {
-		config.Path = dbPath
-	}
-	return InitDBWithConfig(config)
+	return InitDBWithConfig(&Config{Driver: "sqlite", Path: dbPath})
 }
 
 // InitDBWithConfig initializes the database with the provided configuration
@@ -76,17 +133,28 @@ func InitDBWithConfig(config *Config) (*DB, error) {
 		err      error
 	)
 
-	maxRetries := 5
-	baseDelay := time.Second
+	maxRetries := config.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	baseDelay := config.RetryDelay
+	if baseDelay <= 0 {
+		baseDelay = defaultRetryDelay
+	}
 
 	if config.Driver == "postgres" {
 		// PostgreSQL connection
-		dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-			config.Host, config.Port, config.User, config.Password, config.DBName)
+		var dsn string
+		dsn, err = config.postgresDSN()
+		if err != nil {
+			return nil, err
+		}
 		log.Debug().
 			Str("host", config.Host).
 			Str("port", config.Port).
 			Str("database", config.DBName).
+			Bool("dsn", config.DSN != "").
+			Str("sslmode", config.sslMode()).
 			Msg("Initializing PostgreSQL database")
 
 		// Retry loop with exponential backoff
@@ -98,6 +166,7 @@ func InitDBWithConfig(config *Config) (*DB, error) {
 				if err == nil {
 					break // Successfully connected
 				}
+				database.Close()
 			}
 
 			if attempt == maxRetries {
@@ -119,8 +188,9 @@ func InitDBWithConfig(config *Config) (*DB, error) {
 			return nil, err
 		}
 
-		// Create or open database
-		database, err = sql.Open("sqlite", config.Path)
+		// Create or open database. Writers wait for each other instead of
+		// failing with SQLITE_BUSY, so concurrent requests all get written.
+		database, err = sql.Open("sqlite", config.Path+"?_pragma=busy_timeout(5000)")
 		if err != nil {
 			return nil, fmt.Errorf("error opening database: %w", err)
 		}
@@ -140,9 +210,7 @@ func InitDBWithConfig(config *Config) (*DB, error) {
 	}
 
 	// Configure connection pool
-	database.SetMaxOpenConns(25)
-	database.SetMaxIdleConns(25)
-	database.SetConnMaxLifetime(5 * time.Minute)
+	config.applyPoolSettings(database)
 
 	log.Info().
 		Str("driver", config.Driver).
@@ -162,6 +230,87 @@ func InitDBWithConfig(config *Config) (*DB, error) {
 	return db, nil
 }
 
+// Ping checks that the database can be reached, without retrying or
+// migrating it. A SQLite database that does not exist yet is fine as long as
+// its directory can be created.
+func Ping(config *Config) error {
+	if config.Driver != "postgres" {
+		if _, err := os.Stat(config.Path); err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			return checkDirCreatable(filepath.Dir(config.Path))
+		}
+	}
+
+	driver, dsn := "sqlite", config.Path
+	if config.Driver == "postgres" {
+		var err error
+		if dsn, err = config.postgresDSN(); err != nil {
+			return err
+		}
+		driver = "postgres"
+	}
+
+	database, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return database.PingContext(ctx)
+}
+
+// checkDirCreatable reports an error when dir cannot be created because its
+// closest existing ancestor is not a directory
+func checkDirCreatable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// applyPoolSettings configures the connection pool, using defaults for unset values
+func (c *Config) applyPoolSettings(database *sql.DB) {
+	maxOpen := c.MaxOpenConns
+	if maxOpen <= 0 {
+		maxOpen = defaultMaxOpenConns
+	}
+	maxIdle := c.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdleConns
+	}
+	if maxIdle > maxOpen {
+		maxIdle = maxOpen
+	}
+	lifetime := c.ConnMaxLifetime
+	if lifetime <= 0 {
+		lifetime = defaultConnMaxLifetime
+	}
+
+	database.SetMaxOpenConns(maxOpen)
+	database.SetMaxIdleConns(maxIdle)
+	database.SetConnMaxLifetime(lifetime)
+	if c.ConnMaxIdleTime > 0 {
+		database.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
+
 // Path returns the database file path (for SQLite)
 func (db *DB) Path() string {
 	return db.path
@@ -203,16 +352,213 @@ func (db *DB) initSchema() error {
 		return err
 	}
 
+	// Services declared in the config file carry tags and a check interval,
+	// and are marked as managed so they cannot be edited elsewhere
+	if err := db.addColumnIfMissing("service_configurations", "tags", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("service_configurations", "check_interval", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("service_configurations", "managed", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+
+	// Users created before roles existed had full access, so they become
+	// admins once. Every user inserted later defaults to viewer.
+	hasRoles, err := db.hasColumn("users", "role")
+	if err != nil {
+		return err
+	}
+	if !hasRoles {
+		if err := db.addRoleColumn(); err != nil {
+			return err
+		}
+	}
+	if err := db.addColumnIfMissing("users", "disabled", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "totp_secret", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+
+	// Local accounts always have a password, so accounts without one were
+	// created by a proxy or directory login before the source was recorded
+	if err := db.addColumnIfMissing("users", "auth_source", "TEXT NOT NULL DEFAULT 'local'"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE users SET auth_source = 'external' WHERE auth_source = 'local' AND password_hash = ''`); err != nil {
+		return err
+	}
+
+	// Create the session index for password logins. The session data
+	// itself lives in the cache; a session without a row here is revoked.
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS user_sessions (
+			id %s PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash TEXT UNIQUE NOT NULL,
+			device TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			last_seen_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		)`, autoIncrement))
+	if err != nil {
+		return err
+	}
+
+	// Create the failed login tracking table, keyed by lowercased username
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS login_lockouts (
+			username TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL,
+			last_failure_at TIMESTAMP NOT NULL,
+			last_ip TEXT NOT NULL DEFAULT '',
+			locked_until TIMESTAMP
+		)`)
+	if err != nil {
+		return err
+	}
+
+	// Create the passkey table. The credential column holds the JSON
+	// encoded public key and authenticator state.
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS webauthn_credentials (
+			id %s PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			credential_id TEXT UNIQUE NOT NULL,
+			credential TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			last_used_at TIMESTAMP
+		)`, autoIncrement))
+	if err != nil {
+		return err
+	}
+
+	// Create the two-factor recovery codes table
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id %s PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMP
+		)`, autoIncrement))
+	if err != nil {
+		return err
+	}
+
+	// Create the invites table
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS user_invites (
+			id %s PRIMARY KEY,
+			token_hash TEXT UNIQUE NOT NULL,
+			email TEXT,
+			role TEXT NOT NULL,
+			created_by TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		)`, autoIncrement))
+	if err != nil {
+		return err
+	}
+
+	// Create the API tokens table
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id %s PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			prefix TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			last_used_at TIMESTAMP
+		)`, autoIncrement))
+	if err != nil {
+		return err
+	}
+
+	// Create the audit events table
+	_, err = db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS audit_events (
+			id %s PRIMARY KEY,
+			created_at TIMESTAMP NOT NULL,
+			actor TEXT NOT NULL,
+			actor_id INTEGER NOT NULL DEFAULT 0,
+			ip TEXT,
+			action TEXT NOT NULL,
+			target TEXT,
+			status TEXT NOT NULL,
+			changes TEXT,
+			details TEXT
+		)`, autoIncrement))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at)`)
+	if err != nil {
+		return err
+	}
+
 	//log.Debug().Msg("Database schema initialized")
 	return nil
 }
 
-// getEnv retrieves an environment variable with a fallback value
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// addColumnIfMissing adds a column to an existing table during schema upgrades
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	exists, err := db.hasColumn(table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
 	}
-	return fallback
+	return nil
+}
+
+// addRoleColumn adds the role column and makes the existing users admins
+// in one transaction, so an interrupted upgrade cannot leave them viewers
+func (db *DB) addRoleColumn() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer'"); err != nil {
+		return fmt.Errorf("failed to add column users.role: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE users SET role = 'admin'"); err != nil {
+		return fmt.Errorf("failed to make existing users admins: %w", err)
+	}
+	return tx.Commit()
+}
+
+// hasColumn reports whether a table has a column
+func (db *DB) hasColumn(table, column string) (bool, error) {
+	var query string
+	if db.driver == "postgres" {
+		query = `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`
+	} else {
+		query = `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+	}
+
+	var count int
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to inspect column %s.%s: %w", table, column, err)
+	}
+	return count > 0, nil
 }
 
 // HasUsers checks if any users exist in the database
@@ -227,30 +573,82 @@ func (db *DB) HasUsers() (bool, error) {
 
 // User Management Functions
 
-// CreateUser creates a new user in the database
+// userColumns lists the columns read by scanUser, in order
+const userColumns = "id, username, email, password_hash, role, auth_source, disabled, totp_secret, totp_enabled, created_at, updated_at"
+
+// scanUser scans a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*types.User, error) {
+	var user types.User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.AuthSource,
+		&user.Disabled,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// execer runs statements on the database or within a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// CreateUser creates a new user in the database.
+// Users without a role are created as viewers, and users without a source
+// as local accounts.
 func (db *DB) CreateUser(user *types.User) error {
+	return db.insertUser(db.DB, user)
+}
+
+// insertUser creates a user with q
+func (db *DB) insertUser(q execer, user *types.User) error {
 	now := time.Now()
 	var result sql.Result
 	var err error
 
+	if user.Role == "" {
+		user.Role = types.RoleViewer
+	}
+	if user.AuthSource == "" {
+		user.AuthSource = types.AuthSourceLocal
+	}
+
 	if db.driver == "postgres" {
-		err = db.QueryRow(`
-			INSERT INTO users (username, email, password_hash, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5)
+		err = q.QueryRow(`
+			INSERT INTO users (username, email, password_hash, role, auth_source, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 			RETURNING id`,
 			user.Username,
 			user.Email,
 			user.PasswordHash,
+			user.Role,
+			user.AuthSource,
 			now,
 			now,
 		).Scan(&user.ID)
 	} else {
-		result, err = db.Exec(`
-			INSERT INTO users (username, email, password_hash, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?)`,
+		result, err = q.Exec(`
+			INSERT INTO users (username, email, password_hash, role, auth_source, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
 			user.Username,
 			user.Email,
 			user.PasswordHash,
+			user.Role,
+			user.AuthSource,
 			now,
 			now,
 		)
@@ -270,220 +668,261 @@ func (db *DB) CreateUser(user *types.User) error {
 
 // GetUserByUsername retrieves a user by their username
 func (db *DB) GetUserByUsername(username string) (*types.User, error) {
-	var user types.User
-	var placeholder string
-	if db.driver == "postgres" {
-		placeholder = "$1"
-	} else {
-		placeholder = "?"
-	}
-
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, created_at, updated_at
+	return scanUser(db.QueryRow(`
+		SELECT `+userColumns+`
 		FROM users
-		WHERE username = `+placeholder,
+		WHERE username = `+db.placeholder(1),
 		username,
-	).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+	))
 }
 
-// GetUserByEmail retrieves a user by their email
+// GetUserByEmail retrieves a user by their email, ignoring case
 func (db *DB) GetUserByEmail(email string) (*types.User, error) {
-	var user types.User
-	var placeholder string
-	if db.driver == "postgres" {
-		placeholder = "$1"
-	} else {
-		placeholder = "?"
-	}
-
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, created_at, updated_at
+	return scanUser(db.QueryRow(`
+		SELECT `+userColumns+`
 		FROM users
-		WHERE email = `+placeholder,
+		WHERE LOWER(email) = LOWER(`+db.placeholder(1)+`)`,
 		email,
-	).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+	))
 }
 
 // GetUserByID retrieves a user by their ID
 func (db *DB) GetUserByID(id int64) (*types.User, error) {
-	var user types.User
-	var placeholder string
-	if db.driver == "postgres" {
-		placeholder = "$1"
-	} else {
-		placeholder = "?"
-	}
-
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, created_at, updated_at
+	return scanUser(db.QueryRow(`
+		SELECT `+userColumns+`
 		FROM users
-		WHERE id = `+placeholder,
+		WHERE id = `+db.placeholder(1),
 		id,
-	).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
+	))
+}
+
+// UpdateUserPassword updates a user's password hash and updated_at timestamp
+// and signs the user out of all sessions
+func (db *DB) UpdateUserPassword(userID int64, newPasswordHash string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE users
+		SET password_hash = `+db.placeholder(1)+`,
+		    updated_at = `+db.placeholder(2)+`
+		WHERE id = `+db.placeholder(3),
+		newPasswordHash,
+		time.Now(),
+		userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_sessions WHERE user_id = `+db.placeholder(1), userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateUserRole changes a user's role
+func (db *DB) UpdateUserRole(userID int64, role string) error {
+	if !types.IsValidRole(role) {
+		return fmt.Errorf("invalid role: %s", role)
 	}
+
+	_, err := db.Exec(`
+		UPDATE users
+		SET role = `+db.placeholder(1)+`,
+		    updated_at = `+db.placeholder(2)+`
+		WHERE id = `+db.placeholder(3),
+		role,
+		time.Now(),
+		userID,
+	)
+	return err
+}
+
+// UpdateUserAuthSource records where an account comes from
+func (db *DB) UpdateUserAuthSource(userID int64, source string) error {
+	_, err := db.Exec(`
+		UPDATE users
+		SET auth_source = `+db.placeholder(1)+`,
+		    updated_at = `+db.placeholder(2)+`
+		WHERE id = `+db.placeholder(3),
+		source,
+		time.Now(),
+		userID,
+	)
+	return err
+}
+
+// ListUsers returns all users ordered by username
+func (db *DB) ListUsers() ([]types.User, error) {
+	rows, err := db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
-}
+	defer rows.Close()
 
-// UpdateUserPassword updates a user's password hash and updated_at timestamp
-func (db *DB) UpdateUserPassword(userID int64, newPasswordHash string) error {
-	now := time.Now()
-	var placeholder string
-	if db.driver == "postgres" {
-		placeholder = "$1, $2, $3"
-	} else {
-		placeholder = "?, ?, ?"
+	var users []types.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
 	}
+	return users, rows.Err()
+}
 
+// SetUserDisabled disables or re-enables a user's account
+func (db *DB) SetUserDisabled(userID int64, disabled bool) error {
 	_, err := db.Exec(`
-		UPDATE users 
-		SET password_hash = `+placeholder[0:2]+`, 
-		    updated_at = `+placeholder[4:5]+`
-		WHERE id = `+placeholder[7:8],
-		newPasswordHash,
-		now,
+		UPDATE users
+		SET disabled = `+db.placeholder(1)+`,
+		    updated_at = `+db.placeholder(2)+`
+		WHERE id = `+db.placeholder(3),
+		disabled,
+		time.Now(),
 		userID,
 	)
 	return err
 }
 
-// Service Management Functions
+// DeleteUser removes a user together with their API tokens, recovery codes,
+// sessions, passkeys and failed logins in one transaction
+func (db *DB) DeleteUser(userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-// GetServiceByInstanceID retrieves a service configuration by its instance ID
-func (db *DB) GetServiceByInstanceID(instanceID string) (*models.ServiceConfiguration, error) {
-	var service models.ServiceConfiguration
-	var placeholder string
-	if db.driver == "postgres" {
-		placeholder = "$1"
-	} else {
-		placeholder = "?"
+	// SQLite only enforces ON DELETE CASCADE with foreign keys enabled
+	p := db.placeholder(1)
+	queries := []string{
+		`DELETE FROM api_tokens WHERE user_id = ` + p,
+		`DELETE FROM user_recovery_codes WHERE user_id = ` + p,
+		`DELETE FROM user_sessions WHERE user_id = ` + p,
+		`DELETE FROM webauthn_credentials WHERE user_id = ` + p,
+		`DELETE FROM login_lockouts WHERE username = (SELECT LOWER(username) FROM users WHERE id = ` + p + `)`,
+		`DELETE FROM users WHERE id = ` + p,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
 	}
 
-	err := db.QueryRow(`
-		SELECT id, instance_id, display_name, url, api_key 
-		FROM service_configurations 
-		WHERE instance_id = `+placeholder, instanceID).Scan(
+	return tx.Commit()
+}
+
+// CountUsersWithRole returns the number of users that have the given role
+func (db *DB) CountUsersWithRole(role string) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = `+db.placeholder(1), role).Scan(&count)
+	return count, err
+}
+
+// CountActiveAdmins returns the number of admins whose account is not disabled
+func (db *DB) CountActiveAdmins() (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = `+db.placeholder(1)+` AND disabled = `+db.placeholder(2),
+		types.RoleAdmin, false).Scan(&count)
+	return count, err
+}
+
+// Service Management Functions
+
+// serviceColumns lists the service_configurations columns read by scanService
+const serviceColumns = "id, instance_id, display_name, url, api_key, tags, check_interval, managed"
+
+// scanService reads a service configuration selected with serviceColumns
+func scanService(row interface{ Scan(...interface{}) error }) (*models.ServiceConfiguration, error) {
+	var service models.ServiceConfiguration
+	var tags string
+	err := row.Scan(
 		&service.ID,
 		&service.InstanceID,
 		&service.DisplayName,
 		&service.URL,
 		&service.APIKey,
+		&tags,
+		&service.CheckInterval,
+		&service.Managed,
 	)
+	if err != nil {
+		return nil, err
+	}
+	service.Tags = splitTags(tags)
+	return &service, nil
+}
+
+// joinTags stores tags as a comma-separated list
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// splitTags parses a comma-separated list of tags
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// GetServiceByInstanceID retrieves a service configuration by its instance ID
+func (db *DB) GetServiceByInstanceID(instanceID string) (*models.ServiceConfiguration, error) {
+	service, err := scanService(db.QueryRow(`
+		SELECT `+serviceColumns+`
+		FROM service_configurations 
+		WHERE instance_id = `+db.placeholder(1), instanceID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &service, nil
+	return service, nil
 }
 
 // GetServiceByURL retrieves a service configuration by its URL
 func (db *DB) GetServiceByURL(url string) (*models.ServiceConfiguration, error) {
-	var service models.ServiceConfiguration
-	var placeholder string
-	if db.driver == "postgres" {
-		placeholder = "$1"
-	} else {
-		placeholder = "?"
-	}
-
-	err := db.QueryRow(`
-		SELECT id, instance_id, display_name, url, api_key 
+	service, err := scanService(db.QueryRow(`
+		SELECT `+serviceColumns+`
 		FROM service_configurations 
-		WHERE url = `+placeholder, url).Scan(
-		&service.ID,
-		&service.InstanceID,
-		&service.DisplayName,
-		&service.URL,
-		&service.APIKey,
-	)
+		WHERE url = `+db.placeholder(1), url))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &service, nil
+	return service, nil
 }
 
 // GetServiceByInstancePrefix retrieves a service configuration by its instance ID prefix
 func (db *DB) GetServiceByInstancePrefix(prefix string) (*models.ServiceConfiguration, error) {
-	var service models.ServiceConfiguration
-	var query string
-	if db.driver == "postgres" {
-		query = `
-			SELECT id, instance_id, display_name, url, api_key 
-			FROM service_configurations 
-			WHERE instance_id LIKE $1 || '%'
-			LIMIT 1`
-	} else {
-		query = `
-			SELECT id, instance_id, display_name, url, api_key 
-			FROM service_configurations 
-			WHERE instance_id LIKE ? || '%'
-			LIMIT 1`
-	}
-
-	err := db.QueryRow(query, prefix).Scan(
-		&service.ID,
-		&service.InstanceID,
-		&service.DisplayName,
-		&service.URL,
-		&service.APIKey,
-	)
+	service, err := scanService(db.QueryRow(`
+		SELECT `+serviceColumns+`
+		FROM service_configurations 
+		WHERE instance_id LIKE `+db.placeholder(1)+` || '%'
+		LIMIT 1`, prefix))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &service, nil
+	return service, nil
 }
 
 // GetAllServices retrieves all service configurations
 func (db *DB) GetAllServices() ([]models.ServiceConfiguration, error) {
 	rows, err := db.Query(`
-		SELECT id, instance_id, display_name, url, api_key 
+		SELECT ` + serviceColumns + `
 		FROM service_configurations
 	`)
 	if err != nil {
@@ -493,44 +932,41 @@ func (db *DB) GetAllServices() ([]models.ServiceConfiguration, error) {
 
 	var services []models.ServiceConfiguration
 	for rows.Next() {
-		var service models.ServiceConfiguration
-		err := rows.Scan(
-			&service.ID,
-			&service.InstanceID,
-			&service.DisplayName,
-			&service.URL,
-			&service.APIKey,
-		)
+		service, err := scanService(rows)
 		if err != nil {
 			return nil, err
 		}
-		services = append(services, service)
+		services = append(services, *service)
 	}
-	return services, nil
+	return services, rows.Err()
 }
 
 // CreateService creates a new service configuration
 func (db *DB) CreateService(service *models.ServiceConfiguration) error {
+	args := []interface{}{
+		service.InstanceID,
+		service.DisplayName,
+		service.URL,
+		service.APIKey,
+		joinTags(service.Tags),
+		service.CheckInterval,
+		service.Managed,
+	}
+
 	if db.driver == "postgres" {
 		err := db.QueryRow(`
-			INSERT INTO service_configurations (instance_id, display_name, url, api_key)
-			VALUES ($1, $2, $3, $4)
+			INSERT INTO service_configurations (instance_id, display_name, url, api_key, tags, check_interval, managed)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 			RETURNING id`,
-			service.InstanceID,
-			service.DisplayName,
-			service.URL,
-			service.APIKey,
+			args...,
 		).Scan(&service.ID)
 		return err
 	}
 
 	result, err := db.Exec(`
-		INSERT INTO service_configurations (instance_id, display_name, url, api_key)
-		VALUES (?, ?, ?, ?)`,
-		service.InstanceID,
-		service.DisplayName,
-		service.URL,
-		service.APIKey,
+		INSERT INTO service_configurations (instance_id, display_name, url, api_key, tags, check_interval, managed)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		args...,
 	)
 	if err != nil {
 		return err
@@ -551,12 +987,12 @@ func (db *DB) UpdateService(service *models.ServiceConfiguration) error {
 	if db.driver == "postgres" {
 		query = `
 			UPDATE service_configurations 
-			SET display_name = $1, url = $2, api_key = $3
-			WHERE instance_id = $4`
+			SET display_name = $1, url = $2, api_key = $3, tags = $4, check_interval = $5, managed = $6
+			WHERE instance_id = $7`
 	} else {
 		query = `
 			UPDATE service_configurations 
-			SET display_name = ?, url = ?, api_key = ?
+			SET display_name = ?, url = ?, api_key = ?, tags = ?, check_interval = ?, managed = ?
 			WHERE instance_id = ?`
 	}
 
@@ -564,6 +1000,9 @@ func (db *DB) UpdateService(service *models.ServiceConfiguration) error {
 		service.DisplayName,
 		service.URL,
 		service.APIKey,
+		joinTags(service.Tags),
+		service.CheckInterval,
+		service.Managed,
 		service.InstanceID,
 	)
 	return err
@@ -11,6 +11,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/autobrr/dashbrr/internal/config"
 	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/types"
 )
@@ -35,8 +36,6 @@ func setupPostgresDB(t *testing.T) (*DB, func()) {
 		}
 	}
 
-	os.Setenv("DASHBRR__DB_TYPE", "postgres")
-
 	cleanup := func() {
 		if db != nil {
 			// Clean up test data
@@ -44,11 +43,14 @@ func setupPostgresDB(t *testing.T) (*DB, func()) {
 			db.Exec("DELETE FROM users")
 			db.Close()
 		}
-		os.Unsetenv("DASHBRR__DB_TYPE")
 	}
 
-	config := NewConfig()
-	db, err = InitDBWithConfig(config)
+	settings := &config.Config{}
+	if err := config.LoadEnvOverrides(settings); err != nil {
+		t.Fatalf("Failed to load PostgreSQL settings: %v", err)
+	}
+	settings.Database.Type = "postgres"
+	db, err = InitDBWithConfig(NewConfigFromSettings(settings.Database))
 	if err != nil {
 		cleanup()
 		t.Fatalf("Failed to initialize PostgreSQL test database: %v", err)
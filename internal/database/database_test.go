@@ -4,9 +4,12 @@
 package database
 
 import (
+	"database/sql"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/autobrr/dashbrr/internal/config"
 	"github.com/autobrr/dashbrr/internal/models"
 	"github.com/autobrr/dashbrr/internal/types"
 )
@@ -16,23 +19,17 @@ func setupTestDB(t *testing.T) (*DB, func()) {
 	var db *DB
 	var err error
 
-	// Set SQLite test environment
 	tempDir := t.TempDir()
 	dbPath := tempDir + "/test.db"
-	os.Setenv("DASHBRR__DB_TYPE", "sqlite")
-	os.Setenv("DASHBRR__DB_PATH", dbPath)
 
 	cleanup := func() {
 		if db != nil {
 			db.Close()
 		}
 		os.Remove(dbPath)
-		os.Unsetenv("DASHBRR__DB_TYPE")
-		os.Unsetenv("DASHBRR__DB_PATH")
 	}
 
-	config := NewConfig()
-	db, err = InitDBWithConfig(config)
+	db, err = InitDBWithConfig(NewConfigFromSettings(config.DatabaseConfig{Type: "sqlite", Path: dbPath}))
 	if err != nil {
 		cleanup()
 		t.Fatalf("Failed to initialize test database: %v", err)
@@ -125,6 +122,331 @@ func TestUserOperations(t *testing.T) {
 	}
 }
 
+func TestUserRoleAndPasswordUpdates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &types.User{
+		Username:     "operator",
+		Email:        "operator@example.com",
+		PasswordHash: "hash",
+	}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user.Role != types.RoleViewer {
+		t.Errorf("Expected default role %s, got %s", types.RoleViewer, user.Role)
+	}
+
+	if err := db.UpdateUserRole(user.ID, types.RoleOperator); err != nil {
+		t.Fatalf("Failed to update role: %v", err)
+	}
+	if err := db.UpdateUserRole(user.ID, "superuser"); err == nil {
+		t.Error("Expected error for invalid role")
+	}
+
+	if err := db.UpdateUserPassword(user.ID, "new-hash"); err != nil {
+		t.Fatalf("Failed to update password: %v", err)
+	}
+
+	retrieved, err := db.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if retrieved.Role != types.RoleOperator {
+		t.Errorf("Expected role %s, got %s", types.RoleOperator, retrieved.Role)
+	}
+	if retrieved.PasswordHash != "new-hash" {
+		t.Errorf("Expected password hash to be updated, got %s", retrieved.PasswordHash)
+	}
+
+	count, err := db.CountUsersWithRole(types.RoleOperator)
+	if err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 operator, got %d", count)
+	}
+}
+
+func TestUserRoleMigration(t *testing.T) {
+	dbPath := t.TempDir() + "/legacy.db"
+
+	// A database from before roles existed
+	legacy, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	_, err = legacy.Exec(`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE NOT NULL,
+		email TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	if err == nil {
+		_, err = legacy.Exec(`INSERT INTO users (username, email, password_hash, created_at, updated_at)
+			VALUES ('owner', 'owner@example.com', 'hash', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	}
+	legacy.Close()
+	if err != nil {
+		t.Fatalf("Failed to seed legacy database: %v", err)
+	}
+
+	db, err := InitDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	owner, err := db.GetUserByUsername("owner")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if owner.Role != types.RoleAdmin {
+		t.Errorf("Expected existing user to become %s, got %s", types.RoleAdmin, owner.Role)
+	}
+
+	// Users inserted outside CreateUser do not become admins
+	_, err = db.Exec(`INSERT INTO users (username, email, password_hash, created_at, updated_at)
+		VALUES ('restored', 'restored@example.com', 'hash', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	restored, err := db.GetUserByUsername("restored")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if restored.Role != types.RoleViewer {
+		t.Errorf("Expected default role %s, got %s", types.RoleViewer, restored.Role)
+	}
+
+	// Running the migration again leaves roles alone
+	if err := db.UpdateUserRole(owner.ID, types.RoleOperator); err != nil {
+		t.Fatalf("Failed to update role: %v", err)
+	}
+	db.Close()
+	db, err = InitDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if owner, _ = db.GetUserByUsername("owner"); owner == nil || owner.Role != types.RoleOperator {
+		t.Errorf("Expected role to survive a restart, got %+v", owner)
+	}
+}
+
+func TestUserAuthSource(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	local := &types.User{Username: "local", Email: "local@example.com", PasswordHash: "hash"}
+	if err := db.CreateUser(local); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if local.AuthSource != types.AuthSourceLocal {
+		t.Errorf("Expected source %s, got %s", types.AuthSourceLocal, local.AuthSource)
+	}
+
+	// Simulate a passwordless account from before sources were recorded
+	if _, err := db.Exec(`INSERT INTO users (username, email, password_hash, created_at, updated_at) VALUES ('legacy', 'legacy', '', ?, ?)`, time.Now(), time.Now()); err != nil {
+		t.Fatalf("Failed to insert legacy user: %v", err)
+	}
+	if err := db.initSchema(); err != nil {
+		t.Fatalf("Failed to upgrade schema: %v", err)
+	}
+
+	legacy, err := db.GetUserByUsername("legacy")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if legacy.AuthSource != types.AuthSourceExternal {
+		t.Errorf("Expected source %s, got %s", types.AuthSourceExternal, legacy.AuthSource)
+	}
+	if local, _ = db.GetUserByID(local.ID); local.AuthSource != types.AuthSourceLocal {
+		t.Errorf("Expected local accounts to stay local, got %s", local.AuthSource)
+	}
+
+	if err := db.UpdateUserAuthSource(legacy.ID, types.AuthSourceLDAP); err != nil {
+		t.Fatalf("Failed to update source: %v", err)
+	}
+	if legacy, _ = db.GetUserByID(legacy.ID); legacy.AuthSource != types.AuthSourceLDAP {
+		t.Errorf("Expected source %s, got %s", types.AuthSourceLDAP, legacy.AuthSource)
+	}
+}
+
+func TestUserManagement(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	admin := &types.User{Username: "admin", Email: "Admin@Example.com", PasswordHash: "hash", Role: types.RoleAdmin}
+	viewer := &types.User{Username: "viewer", Email: "viewer@example.com", PasswordHash: "hash"}
+	for _, user := range []*types.User{admin, viewer} {
+		if err := db.CreateUser(user); err != nil {
+			t.Fatalf("Failed to create user %s: %v", user.Username, err)
+		}
+	}
+
+	// Email lookups ignore case
+	retrieved, err := db.GetUserByEmail("admin@example.com")
+	if err != nil {
+		t.Fatalf("Failed to get user by email: %v", err)
+	}
+	if retrieved == nil || retrieved.ID != admin.ID {
+		t.Fatal("Expected case-insensitive email lookup to find admin")
+	}
+
+	if err := db.SetUserDisabled(admin.ID, true); err != nil {
+		t.Fatalf("Failed to disable user: %v", err)
+	}
+	retrieved, err = db.GetUserByID(admin.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if !retrieved.Disabled {
+		t.Error("Expected user to be disabled")
+	}
+
+	admins, err := db.CountActiveAdmins()
+	if err != nil {
+		t.Fatalf("Failed to count admins: %v", err)
+	}
+	if admins != 0 {
+		t.Errorf("Expected 0 active admins, got %d", admins)
+	}
+
+	session := &types.Session{UserID: viewer.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.CreateSession(session, "viewer-token"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if _, err := db.RecordLoginFailure("Viewer", "127.0.0.1", time.Now(), 5, time.Minute); err != nil {
+		t.Fatalf("Failed to record login failure: %v", err)
+	}
+
+	if err := db.DeleteUser(viewer.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if sessions, err := db.ListSessions(viewer.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("Expected the sessions to be deleted, got %+v, %v", sessions, err)
+	}
+	if lockout, err := db.GetLoginLockout("viewer"); err != nil || lockout != nil {
+		t.Errorf("Expected the failed logins to be deleted, got %+v, %v", lockout, err)
+	}
+	users, err := db.ListUsers()
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "admin" {
+		t.Errorf("Expected only admin to remain, got %+v", users)
+	}
+}
+
+func TestInvites(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	invite := &types.Invite{
+		Role:      types.RoleOperator,
+		CreatedBy: "admin",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := db.CreateInvite(invite, "secret-token"); err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+
+	retrieved, err := db.GetInviteByToken("secret-token")
+	if err != nil {
+		t.Fatalf("Failed to get invite: %v", err)
+	}
+	if retrieved == nil || !retrieved.Usable() || retrieved.Role != types.RoleOperator {
+		t.Fatalf("Expected usable operator invite, got %+v", retrieved)
+	}
+
+	if missing, err := db.GetInviteByToken("other-token"); err != nil || missing != nil {
+		t.Errorf("Expected no invite for unknown token, got %+v, %v", missing, err)
+	}
+
+	expired := &types.Invite{
+		Role:      types.RoleViewer,
+		CreatedBy: "admin",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := db.CreateInvite(expired, "expired-token"); err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+	if retrieved, err := db.GetInviteByToken("expired-token"); err != nil || retrieved == nil || retrieved.Usable() {
+		t.Errorf("Expected expired invite not to be usable, got %+v, %v", retrieved, err)
+	}
+
+	invites, err := db.ListInvites()
+	if err != nil {
+		t.Fatalf("Failed to list invites: %v", err)
+	}
+	if len(invites) != 2 {
+		t.Errorf("Expected 2 invites, got %d", len(invites))
+	}
+}
+
+func TestCreateInvitedUser(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := db.CreateUser(&types.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	invite := &types.Invite{
+		Role:      types.RoleOperator,
+		CreatedBy: "admin",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := db.CreateInvite(invite, "invite-token"); err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+
+	// A user that cannot be created leaves the invite unused
+	taken := &types.User{Username: "alice", Email: "other@example.com", PasswordHash: "hash", Role: invite.Role}
+	if err := db.CreateInvitedUser(taken, invite.ID); err == nil {
+		t.Fatal("Expected a duplicate username to fail")
+	}
+	if retrieved, err := db.GetInviteByToken("invite-token"); err != nil || retrieved == nil || !retrieved.Usable() {
+		t.Fatalf("Expected the invite to stay usable, got %+v, %v", retrieved, err)
+	}
+
+	user := &types.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash", Role: invite.Role}
+	if err := db.CreateInvitedUser(user, invite.ID); err != nil {
+		t.Fatalf("Failed to create invited user: %v", err)
+	}
+	if user.ID == 0 {
+		t.Error("Expected the user ID to be set")
+	}
+
+	// The invite is used up
+	other := &types.User{Username: "carol", Email: "carol@example.com", PasswordHash: "hash"}
+	if err := db.CreateInvitedUser(other, invite.ID); err != ErrInviteUnavailable {
+		t.Errorf("Expected ErrInviteUnavailable on reuse, got %v", err)
+	}
+	if existing, _ := db.GetUserByUsername("carol"); existing != nil {
+		t.Error("Expected no user for a used invite")
+	}
+
+	expired := &types.Invite{
+		Role:      types.RoleViewer,
+		CreatedBy: "admin",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := db.CreateInvite(expired, "expired-token"); err != nil {
+		t.Fatalf("Failed to create invite: %v", err)
+	}
+	if err := db.CreateInvitedUser(other, expired.ID); err != ErrInviteUnavailable {
+		t.Errorf("Expected ErrInviteUnavailable for expired invite, got %v", err)
+	}
+	if existing, _ := db.GetUserByUsername("carol"); existing != nil {
+		t.Error("Expected no user for an expired invite")
+	}
+}
+
 func TestServiceOperations(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
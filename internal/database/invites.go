@@ -0,0 +1,174 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// ErrInviteUnavailable is returned when an invite was already used or has expired
+var ErrInviteUnavailable = errors.New("invite is no longer valid")
+
+// inviteColumns lists the columns read by scanInvite, in order
+const inviteColumns = "id, email, role, created_by, created_at, expires_at, used_at"
+
+// hashToken hashes an invite or API token; only the hash is stored so a
+// leaked database does not expose usable credentials
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// scanInvite scans a row selected with inviteColumns
+func scanInvite(row interface{ Scan(...interface{}) error }) (*types.Invite, error) {
+	var invite types.Invite
+	var email sql.NullString
+	var usedAt sql.NullTime
+	err := row.Scan(
+		&invite.ID,
+		&email,
+		&invite.Role,
+		&invite.CreatedBy,
+		&invite.CreatedAt,
+		&invite.ExpiresAt,
+		&usedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	invite.Email = email.String
+	if usedAt.Valid {
+		invite.UsedAt = &usedAt.Time
+	}
+	return &invite, nil
+}
+
+// CreateInvite stores a new invite for the given token
+func (db *DB) CreateInvite(invite *types.Invite, token string) error {
+	if invite.CreatedAt.IsZero() {
+		invite.CreatedAt = time.Now()
+	}
+
+	var email interface{}
+	if invite.Email != "" {
+		email = invite.Email
+	}
+
+	args := []interface{}{
+		hashToken(token),
+		email,
+		invite.Role,
+		invite.CreatedBy,
+		invite.CreatedAt,
+		invite.ExpiresAt,
+	}
+
+	if db.driver == "postgres" {
+		return db.QueryRow(`
+			INSERT INTO user_invites (token_hash, email, role, created_by, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id`, args...).Scan(&invite.ID)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO user_invites (token_hash, email, role, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, args...)
+	if err != nil {
+		return err
+	}
+	invite.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetInviteByToken retrieves an invite by its token
+func (db *DB) GetInviteByToken(token string) (*types.Invite, error) {
+	return scanInvite(db.QueryRow(`
+		SELECT `+inviteColumns+`
+		FROM user_invites
+		WHERE token_hash = `+db.placeholder(1),
+		hashToken(token),
+	))
+}
+
+// ListInvites returns all invites, newest first
+func (db *DB) ListInvites() ([]types.Invite, error) {
+	rows, err := db.Query(`SELECT ` + inviteColumns + ` FROM user_invites ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []types.Invite
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, rows.Err()
+}
+
+// CreateInvitedUser redeems an invite and creates the user it was for in
+// one transaction, so an invite is only used up by a registration that
+// succeeds. It fails with ErrInviteUnavailable if the invite was already
+// used or has expired, so an invite is only ever redeemed once even with
+// concurrent registrations.
+func (db *DB) CreateInvitedUser(user *types.User, inviteID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := db.useInvite(tx, inviteID); err != nil {
+		return err
+	}
+	if err := db.insertUser(tx, user); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// useInvite marks an invite as used with q
+func (db *DB) useInvite(q execer, id int64) error {
+	now := time.Now()
+	result, err := q.Exec(`
+		UPDATE user_invites
+		SET used_at = `+db.placeholder(1)+`
+		WHERE id = `+db.placeholder(2)+`
+		  AND used_at IS NULL
+		  AND expires_at > `+db.placeholder(3),
+		now,
+		id,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInviteUnavailable
+	}
+	return nil
+}
+
+// DeleteInvite revokes an invite
+func (db *DB) DeleteInvite(id int64) error {
+	_, err := db.Exec(`DELETE FROM user_invites WHERE id = `+db.placeholder(1), id)
+	return err
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// GetLoginLockout retrieves the failed login state of a username, or nil
+// when there were no recent failures
+func (db *DB) GetLoginLockout(username string) (*types.LoginLockout, error) {
+	var lockout types.LoginLockout
+	var lockedUntil sql.NullTime
+	err := db.QueryRow(`
+		SELECT username, failures, last_failure_at, last_ip, locked_until
+		FROM login_lockouts
+		WHERE username = `+db.placeholder(1),
+		strings.ToLower(username),
+	).Scan(
+		&lockout.Username,
+		&lockout.Failures,
+		&lockout.LastFailureAt,
+		&lockout.LastIP,
+		&lockedUntil,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		lockout.LockedUntil = lockedUntil.Time
+	}
+	return &lockout, nil
+}
+
+// RecordLoginFailure counts a failed login for a username in a single
+// statement, so concurrent failures are all counted. Failures older than
+// duration and expired lockouts are forgotten first. Once failures reach
+// threshold the username is locked for duration, and an existing lockout is
+// kept as it is.
+func (db *DB) RecordLoginFailure(username, ip string, now time.Time, threshold int, duration time.Duration) (*types.LoginLockout, error) {
+	p := func(n int) string {
+		if db.driver == "postgres" {
+			return fmt.Sprintf("$%d", n)
+		}
+		return fmt.Sprintf("?%d", n)
+	}
+
+	lockUntil := now.Add(duration)
+	var firstLock sql.NullTime
+	if threshold <= 1 {
+		firstLock = sql.NullTime{Time: lockUntil, Valid: true}
+	}
+
+	// Every reference to login_lockouts in SET reads the row as it was
+	// before this failure
+	reset := `login_lockouts.last_failure_at < ` + p(5) + ` OR login_lockouts.locked_until <= ` + p(2)
+	failures := `CASE WHEN ` + reset + ` THEN 1 ELSE login_lockouts.failures + 1 END`
+
+	var lockout types.LoginLockout
+	var lockedUntil sql.NullTime
+	err := db.QueryRow(`
+		INSERT INTO login_lockouts (username, failures, last_failure_at, last_ip, locked_until)
+		VALUES (`+p(1)+`, 1, `+p(2)+`, `+p(3)+`, `+p(4)+`)
+		ON CONFLICT (username) DO UPDATE SET
+			failures = `+failures+`,
+			locked_until = CASE
+				WHEN login_lockouts.locked_until > `+p(2)+` THEN login_lockouts.locked_until
+				WHEN `+failures+` >= `+p(6)+` THEN `+p(7)+`
+				ELSE NULL
+			END,
+			last_failure_at = excluded.last_failure_at,
+			last_ip = excluded.last_ip
+		RETURNING username, failures, last_failure_at, last_ip, locked_until`,
+		strings.ToLower(username), now, ip, firstLock, now.Add(-duration), threshold, lockUntil,
+	).Scan(
+		&lockout.Username,
+		&lockout.Failures,
+		&lockout.LastFailureAt,
+		&lockout.LastIP,
+		&lockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		lockout.LockedUntil = lockedUntil.Time
+	}
+	return &lockout, nil
+}
+
+// DeleteStaleLoginLockouts removes the failed logins of usernames whose last
+// failure was before the given time and that are not locked at now. These
+// would be forgotten by the next failure anyway, and removing them keeps
+// failures for unknown usernames from piling up. It returns the number of
+// usernames removed.
+func (db *DB) DeleteStaleLoginLockouts(before, now time.Time) (int64, error) {
+	result, err := db.Exec(`
+		DELETE FROM login_lockouts
+		WHERE last_failure_at < `+db.placeholder(1)+`
+		  AND (locked_until IS NULL OR locked_until <= `+db.placeholder(2)+`)`,
+		before, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteLoginLockout clears the failed logins of a username, unlocking it.
+// It reports whether there was anything to clear.
+func (db *DB) DeleteLoginLockout(username string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM login_lockouts WHERE username = `+db.placeholder(1), strings.ToLower(username))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
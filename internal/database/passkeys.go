@@ -0,0 +1,121 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// passkeyColumns lists the columns read by scanPasskey, in order
+const passkeyColumns = "id, user_id, name, credential_id, credential, created_at, last_used_at"
+
+// scanPasskey scans a row selected with passkeyColumns
+func scanPasskey(row interface{ Scan(...interface{}) error }) (*types.Passkey, error) {
+	var passkey types.Passkey
+	var lastUsedAt sql.NullTime
+	err := row.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.Name,
+		&passkey.CredentialID,
+		&passkey.Credential,
+		&passkey.CreatedAt,
+		&lastUsedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		passkey.LastUsedAt = &lastUsedAt.Time
+	}
+	return &passkey, nil
+}
+
+// CreatePasskey stores a newly registered passkey
+func (db *DB) CreatePasskey(passkey *types.Passkey) error {
+	if passkey.CreatedAt.IsZero() {
+		passkey.CreatedAt = time.Now()
+	}
+
+	args := []interface{}{
+		passkey.UserID,
+		passkey.Name,
+		passkey.CredentialID,
+		passkey.Credential,
+		passkey.CreatedAt,
+	}
+
+	if db.driver == "postgres" {
+		return db.QueryRow(`
+			INSERT INTO webauthn_credentials (user_id, name, credential_id, credential, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`, args...).Scan(&passkey.ID)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO webauthn_credentials (user_id, name, credential_id, credential, created_at)
+		VALUES (?, ?, ?, ?, ?)`, args...)
+	if err != nil {
+		return err
+	}
+	passkey.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetPasskeyByID retrieves a passkey by its ID
+func (db *DB) GetPasskeyByID(id int64) (*types.Passkey, error) {
+	return scanPasskey(db.QueryRow(`
+		SELECT `+passkeyColumns+`
+		FROM webauthn_credentials
+		WHERE id = `+db.placeholder(1),
+		id,
+	))
+}
+
+// ListPasskeys returns the passkeys of a user
+func (db *DB) ListPasskeys(userID int64) ([]types.Passkey, error) {
+	rows, err := db.Query(`
+		SELECT `+passkeyColumns+`
+		FROM webauthn_credentials
+		WHERE user_id = `+db.placeholder(1)+`
+		ORDER BY created_at`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []types.Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, *passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+// UpdatePasskeyUse stores the authenticator state after a login
+func (db *DB) UpdatePasskeyUse(id int64, credential string, usedAt time.Time) error {
+	_, err := db.Exec(`
+		UPDATE webauthn_credentials
+		SET credential = `+db.placeholder(1)+`,
+		    last_used_at = `+db.placeholder(2)+`
+		WHERE id = `+db.placeholder(3),
+		credential, usedAt, id)
+	return err
+}
+
+// DeletePasskey removes a passkey
+func (db *DB) DeletePasskey(id int64) error {
+	_, err := db.Exec(`DELETE FROM webauthn_credentials WHERE id = `+db.placeholder(1), id)
+	return err
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestPasskeys(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &types.User{Username: "keyholder", Email: "keyholder@example.com", PasswordHash: "hash"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	passkey := &types.Passkey{UserID: user.ID, Name: "YubiKey", CredentialID: "cred-1", Credential: `{"id":"cred-1"}`}
+	if err := db.CreatePasskey(passkey); err != nil {
+		t.Fatalf("Failed to create passkey: %v", err)
+	}
+	duplicate := &types.Passkey{UserID: user.ID, Name: "Copy", CredentialID: "cred-1", Credential: `{}`}
+	if err := db.CreatePasskey(duplicate); err == nil {
+		t.Error("Expected duplicate credential ID to be rejected")
+	}
+
+	retrieved, err := db.GetPasskeyByID(passkey.ID)
+	if err != nil {
+		t.Fatalf("Failed to get passkey: %v", err)
+	}
+	if retrieved == nil || retrieved.Name != "YubiKey" || retrieved.LastUsedAt != nil {
+		t.Fatalf("Unexpected passkey: %+v", retrieved)
+	}
+
+	if err := db.UpdatePasskeyUse(passkey.ID, `{"id":"cred-1","counter":1}`, time.Now()); err != nil {
+		t.Fatalf("Failed to update passkey: %v", err)
+	}
+	passkeys, err := db.ListPasskeys(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list passkeys: %v", err)
+	}
+	if len(passkeys) != 1 || passkeys[0].LastUsedAt == nil || passkeys[0].Credential != `{"id":"cred-1","counter":1}` {
+		t.Fatalf("Unexpected passkeys: %+v", passkeys)
+	}
+
+	// Deleting the user removes its passkeys
+	if err := db.DeleteUser(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if missing, err := db.GetPasskeyByID(passkey.ID); err != nil || missing != nil {
+		t.Errorf("Expected passkey to be deleted, got %+v, %v", missing, err)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// sslMode returns the configured sslmode or the default
+func (c *Config) sslMode() string {
+	if c.SSLMode != "" {
+		return c.SSLMode
+	}
+	return defaultSSLMode
+}
+
+// postgresDSN builds the connection string passed to lib/pq.
+// An explicit DSN is used as-is, with only the search_path appended when a
+// schema is configured and the DSN does not already set one.
+func (c *Config) postgresDSN() (string, error) {
+	if c.DSN != "" {
+		return c.withSearchPath(c.DSN)
+	}
+
+	params := []struct {
+		key   string
+		value string
+	}{
+		{"host", c.Host},
+		{"port", c.Port},
+		{"user", c.User},
+		{"password", c.Password},
+		{"dbname", c.DBName},
+		{"sslmode", c.sslMode()},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+		{"search_path", c.SearchPath},
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		parts = append(parts, p.key+"="+quoteDSNValue(p.value))
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// withSearchPath adds the configured schema to a user supplied DSN.
+// Both URL ("postgres://...") and key/value DSNs are supported.
+func (c *Config) withSearchPath(dsn string) (string, error) {
+	if c.SearchPath == "" {
+		return dsn, nil
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid database DSN: %w", err)
+		}
+		q := u.Query()
+		if q.Get("search_path") == "" {
+			q.Set("search_path", c.SearchPath)
+			u.RawQuery = q.Encode()
+		}
+		return u.String(), nil
+	}
+
+	params, err := parseDSNParams(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid database DSN: %w", err)
+	}
+	if _, ok := params["search_path"]; ok {
+		return dsn, nil
+	}
+	return dsn + " search_path=" + quoteDSNValue(c.SearchPath), nil
+}
+
+// parseDSNParams splits a key/value DSN into its parameters the way lib/pq
+// reads it: values are either single quoted or end at whitespace, and a
+// backslash escapes the next character in both.
+func parseDSNParams(dsn string) (map[string]string, error) {
+	params := make(map[string]string)
+	r := []rune(dsn)
+	i := 0
+	skipSpace := func() {
+		for i < len(r) && unicode.IsSpace(r[i]) {
+			i++
+		}
+	}
+
+	for {
+		skipSpace()
+		if i == len(r) {
+			return params, nil
+		}
+
+		start := i
+		for i < len(r) && r[i] != '=' && !unicode.IsSpace(r[i]) {
+			i++
+		}
+		key := string(r[start:i])
+		skipSpace()
+		if i == len(r) || r[i] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q", key)
+		}
+		i++
+		skipSpace()
+
+		var value strings.Builder
+		quoted := i < len(r) && r[i] == '\''
+		if quoted {
+			i++
+		}
+		for {
+			if i == len(r) {
+				if quoted {
+					return nil, fmt.Errorf("unterminated quoted value for %q", key)
+				}
+				break
+			}
+			if (quoted && r[i] == '\'') || (!quoted && unicode.IsSpace(r[i])) {
+				i++
+				break
+			}
+			if r[i] == '\\' && i+1 < len(r) {
+				i++
+			}
+			value.WriteRune(r[i])
+			i++
+		}
+		params[key] = value.String()
+	}
+}
+
+// quoteDSNValue quotes a key/value DSN value when it contains characters
+// that lib/pq would otherwise interpret.
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + replacer.Replace(value) + "'"
+}
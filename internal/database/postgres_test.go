@@ -0,0 +1,114 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/config"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{
+			name: "defaults to sslmode disable",
+			config: Config{
+				Host:     "localhost",
+				Port:     "5432",
+				User:     "dashbrr",
+				Password: "secret",
+				DBName:   "dashbrr",
+			},
+			expected: "host=localhost port=5432 user=dashbrr password=secret dbname=dashbrr sslmode=disable",
+		},
+		{
+			name: "tls and schema",
+			config: Config{
+				Host:        "db.example.com",
+				Port:        "5432",
+				User:        "dashbrr",
+				Password:    "it's secret",
+				DBName:      "dashbrr",
+				SSLMode:     "verify-full",
+				SSLRootCert: "/certs/ca.pem",
+				SearchPath:  "dashbrr",
+			},
+			expected: `host=db.example.com port=5432 user=dashbrr password='it\'s secret' dbname=dashbrr sslmode=verify-full sslrootcert=/certs/ca.pem search_path=dashbrr`,
+		},
+		{
+			name:     "url dsn with schema",
+			config:   Config{DSN: "postgres://user:pass@db:5432/dashbrr?sslmode=require", SearchPath: "app"},
+			expected: "postgres://user:pass@db:5432/dashbrr?search_path=app&sslmode=require",
+		},
+		{
+			name:     "key value dsn keeps existing search_path",
+			config:   Config{DSN: "host=db search_path=other", SearchPath: "app"},
+			expected: "host=db search_path=other",
+		},
+		{
+			name:     "key value dsn keeps spaced search_path",
+			config:   Config{DSN: "host=db search_path = 'other'", SearchPath: "app"},
+			expected: "host=db search_path = 'other'",
+		},
+		{
+			name:     "key value dsn with schema",
+			config:   Config{DSN: "host=db sslmode=require", SearchPath: "app"},
+			expected: "host=db sslmode=require search_path=app",
+		},
+		{
+			name:     "key value dsn with search_path inside a value",
+			config:   Config{DSN: `host=db password='x search_path=y\' z'`, SearchPath: "app"},
+			expected: `host=db password='x search_path=y\' z' search_path=app`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := tt.config.postgresDSN()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dsn != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, dsn)
+			}
+		})
+	}
+
+	invalid := Config{DSN: "host=db password='unterminated", SearchPath: "app"}
+	if _, err := invalid.postgresDSN(); err == nil {
+		t.Error("expected error for an unterminated quoted value")
+	}
+}
+
+func TestNewConfigFromSettings(t *testing.T) {
+	cfg := NewConfigFromSettings(config.DatabaseConfig{
+		Type:              "postgres",
+		Name:              "dashboard",
+		MaxOpenConns:      10,
+		ConnMaxLifetime:   config.Duration(30 * time.Minute),
+		ConnectRetries:    3,
+		ConnectRetryDelay: config.Duration(2 * time.Second),
+	})
+
+	if cfg.Host != "localhost" || cfg.Port != "5432" {
+		t.Errorf("expected default host and port, got %s:%s", cfg.Host, cfg.Port)
+	}
+	if cfg.User != "dashbrr" || cfg.Password != "dashbrr" || cfg.DBName != "dashboard" {
+		t.Errorf("expected default credentials and the configured name, got %s/%s/%s", cfg.User, cfg.Password, cfg.DBName)
+	}
+	if cfg.MaxOpenConns != 10 {
+		t.Errorf("expected 10 max open connections, got %d", cfg.MaxOpenConns)
+	}
+	if cfg.ConnMaxLifetime != 30*time.Minute {
+		t.Errorf("expected 30m lifetime, got %s", cfg.ConnMaxLifetime)
+	}
+	if cfg.MaxRetries != 3 || cfg.RetryDelay != 2*time.Second {
+		t.Errorf("unexpected retry settings: %d, %s", cfg.MaxRetries, cfg.RetryDelay)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// sessionColumns lists the columns read by scanSession, in order
+const sessionColumns = "id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at"
+
+// scanSession scans a row selected with sessionColumns
+func scanSession(row interface{ Scan(...interface{}) error }) (*types.Session, error) {
+	var session types.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IP,
+		&session.UserAgent,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CreateSession adds a session to the index. Only a hash of the session
+// token is stored. Expired sessions of the same user are cleaned up.
+func (db *DB) CreateSession(session *types.Session, token string) error {
+	now := time.Now()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = now
+	}
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = session.CreatedAt
+	}
+
+	if _, err := db.Exec(`
+		DELETE FROM user_sessions
+		WHERE user_id = `+db.placeholder(1)+` AND expires_at <= `+db.placeholder(2),
+		session.UserID, now); err != nil {
+		return err
+	}
+
+	args := []interface{}{
+		session.UserID,
+		hashToken(token),
+		session.Device,
+		session.IP,
+		session.UserAgent,
+		session.CreatedAt,
+		session.LastSeenAt,
+		session.ExpiresAt,
+	}
+
+	if db.driver == "postgres" {
+		return db.QueryRow(`
+			INSERT INTO user_sessions (user_id, token_hash, device, ip, user_agent, created_at, last_seen_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id`, args...).Scan(&session.ID)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO user_sessions (user_id, token_hash, device, ip, user_agent, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+	if err != nil {
+		return err
+	}
+	session.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetSessionByToken retrieves the unexpired session for a session token
+func (db *DB) GetSessionByToken(token string) (*types.Session, error) {
+	return scanSession(db.QueryRow(`
+		SELECT `+sessionColumns+`
+		FROM user_sessions
+		WHERE token_hash = `+db.placeholder(1)+` AND expires_at > `+db.placeholder(2),
+		hashToken(token), time.Now(),
+	))
+}
+
+// GetSessionByID retrieves a session by its ID
+func (db *DB) GetSessionByID(id int64) (*types.Session, error) {
+	return scanSession(db.QueryRow(`
+		SELECT `+sessionColumns+`
+		FROM user_sessions
+		WHERE id = `+db.placeholder(1),
+		id,
+	))
+}
+
+// ListSessions returns the unexpired sessions of a user, most recently
+// active first
+func (db *DB) ListSessions(userID int64) ([]types.Session, error) {
+	rows, err := db.Query(`
+		SELECT `+sessionColumns+`
+		FROM user_sessions
+		WHERE user_id = `+db.placeholder(1)+` AND expires_at > `+db.placeholder(2)+`
+		ORDER BY last_seen_at DESC`,
+		userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []types.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity on a session and moves its expiry
+func (db *DB) TouchSession(id int64, seenAt, expiresAt time.Time, ip string) error {
+	_, err := db.Exec(`
+		UPDATE user_sessions
+		SET last_seen_at = `+db.placeholder(1)+`,
+		    expires_at = `+db.placeholder(2)+`,
+		    ip = `+db.placeholder(3)+`
+		WHERE id = `+db.placeholder(4),
+		seenAt, expiresAt, ip, id)
+	return err
+}
+
+// DeleteSession revokes a session
+func (db *DB) DeleteSession(id int64) error {
+	_, err := db.Exec(`DELETE FROM user_sessions WHERE id = `+db.placeholder(1), id)
+	return err
+}
+
+// DeleteSessionByToken revokes the session for a session token
+func (db *DB) DeleteSessionByToken(token string) error {
+	_, err := db.Exec(`DELETE FROM user_sessions WHERE token_hash = `+db.placeholder(1), hashToken(token))
+	return err
+}
+
+// DeleteSessionsForUser revokes all sessions of a user
+func (db *DB) DeleteSessionsForUser(userID int64) error {
+	_, err := db.Exec(`DELETE FROM user_sessions WHERE user_id = `+db.placeholder(1), userID)
+	return err
+}
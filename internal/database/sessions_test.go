@@ -0,0 +1,78 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestSessions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &types.User{Username: "roamer", Email: "roamer@example.com", PasswordHash: "hash"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	laptop := &types.Session{UserID: user.ID, Device: "Firefox on Linux", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.CreateSession(laptop, "laptop-token"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	phone := &types.Session{UserID: user.ID, Device: "Safari on iOS", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.CreateSession(phone, "phone-token"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	expired := &types.Session{UserID: user.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := db.CreateSession(expired, "expired-token"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	retrieved, err := db.GetSessionByToken("laptop-token")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if retrieved == nil || retrieved.ID != laptop.ID || retrieved.Device != "Firefox on Linux" {
+		t.Fatalf("Unexpected session: %+v", retrieved)
+	}
+	if missing, err := db.GetSessionByToken("expired-token"); err != nil || missing != nil {
+		t.Errorf("Expected no session for expired token, got %+v, %v", missing, err)
+	}
+
+	sessions, err := db.ListSessions(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("Expected 2 active sessions, got %d", len(sessions))
+	}
+
+	// Activity moves the expiry
+	later := time.Now().Add(2 * time.Hour)
+	if err := db.TouchSession(laptop.ID, time.Now(), later, "192.0.2.10"); err != nil {
+		t.Fatalf("Failed to touch session: %v", err)
+	}
+	retrieved, err = db.GetSessionByID(laptop.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if retrieved.IP != "192.0.2.10" || retrieved.ExpiresAt.Before(later.Add(-time.Second)) {
+		t.Errorf("Expected session to be renewed, got %+v", retrieved)
+	}
+
+	// Changing the password signs the user out everywhere
+	if err := db.UpdateUserPassword(user.ID, "new-hash"); err != nil {
+		t.Fatalf("Failed to update password: %v", err)
+	}
+	sessions, err = db.ListSessions(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("Expected sessions to be revoked after password change, got %d", len(sessions))
+	}
+}
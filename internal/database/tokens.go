@@ -0,0 +1,141 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// apiTokenPrefixLength is how much of a secret is kept to identify a token
+const apiTokenPrefixLength = 12
+
+// apiTokenColumns lists the columns read by scanAPIToken, in order
+const apiTokenColumns = "id, user_id, name, prefix, scope, created_at, expires_at, last_used_at"
+
+// scanAPIToken scans a row selected with apiTokenColumns
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*types.APIToken, error) {
+	var token types.APIToken
+	var lastUsedAt sql.NullTime
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&token.Scope,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&lastUsedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return &token, nil
+}
+
+// CreateAPIToken stores a new API token. Only a hash of secret is kept,
+// along with its first characters so users can recognise the token.
+func (db *DB) CreateAPIToken(token *types.APIToken, secret string) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	token.Prefix = secret
+	if len(secret) > apiTokenPrefixLength {
+		token.Prefix = secret[:apiTokenPrefixLength]
+	}
+
+	args := []interface{}{
+		token.UserID,
+		token.Name,
+		hashToken(secret),
+		token.Prefix,
+		token.Scope,
+		token.CreatedAt,
+		token.ExpiresAt,
+	}
+
+	if db.driver == "postgres" {
+		return db.QueryRow(`
+			INSERT INTO api_tokens (user_id, name, token_hash, prefix, scope, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id`, args...).Scan(&token.ID)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_hash, prefix, scope, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, args...)
+	if err != nil {
+		return err
+	}
+	token.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetAPITokenBySecret retrieves the token matching a bearer secret
+func (db *DB) GetAPITokenBySecret(secret string) (*types.APIToken, error) {
+	return scanAPIToken(db.QueryRow(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE token_hash = `+db.placeholder(1),
+		hashToken(secret),
+	))
+}
+
+// GetAPITokenByID retrieves a token by its ID
+func (db *DB) GetAPITokenByID(id int64) (*types.APIToken, error) {
+	return scanAPIToken(db.QueryRow(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE id = `+db.placeholder(1),
+		id,
+	))
+}
+
+// ListAPITokens returns the tokens of a user, or of all users when userID is 0
+func (db *DB) ListAPITokens(userID int64) ([]types.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens`
+	var args []interface{}
+	if userID != 0 {
+		query += ` WHERE user_id = ` + db.placeholder(1)
+		args = append(args, userID)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []types.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// TouchAPIToken records when a token was last used
+func (db *DB) TouchAPIToken(id int64, usedAt time.Time) error {
+	_, err := db.Exec(`UPDATE api_tokens SET last_used_at = `+db.placeholder(1)+` WHERE id = `+db.placeholder(2),
+		usedAt, id)
+	return err
+}
+
+// DeleteAPIToken revokes a token
+func (db *DB) DeleteAPIToken(id int64) error {
+	_, err := db.Exec(`DELETE FROM api_tokens WHERE id = `+db.placeholder(1), id)
+	return err
+}
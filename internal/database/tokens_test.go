@@ -0,0 +1,78 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestAPITokens(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &types.User{Username: "scripter", Email: "scripter@example.com", PasswordHash: "hash"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	token := &types.APIToken{
+		UserID:    user.ID,
+		Name:      "backup",
+		Scope:     types.TokenScopeRead,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	secret := types.APITokenPrefix + "abcdefghijklmnopqrstuvwxyz"
+	if err := db.CreateAPIToken(token, secret); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if token.Prefix != secret[:apiTokenPrefixLength] {
+		t.Errorf("Expected prefix %s, got %s", secret[:apiTokenPrefixLength], token.Prefix)
+	}
+
+	retrieved, err := db.GetAPITokenBySecret(secret)
+	if err != nil {
+		t.Fatalf("Failed to get token: %v", err)
+	}
+	if retrieved == nil || retrieved.ID != token.ID || retrieved.LastUsedAt != nil {
+		t.Fatalf("Unexpected token: %+v", retrieved)
+	}
+
+	if missing, err := db.GetAPITokenBySecret(secret + "x"); err != nil || missing != nil {
+		t.Errorf("Expected no token for wrong secret, got %+v, %v", missing, err)
+	}
+
+	if err := db.TouchAPIToken(token.ID, time.Now()); err != nil {
+		t.Fatalf("Failed to touch token: %v", err)
+	}
+	retrieved, err = db.GetAPITokenByID(token.ID)
+	if err != nil {
+		t.Fatalf("Failed to get token: %v", err)
+	}
+	if retrieved.LastUsedAt == nil {
+		t.Error("Expected last used time to be set")
+	}
+
+	tokens, err := db.ListAPITokens(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list tokens: %v", err)
+	}
+	if len(tokens) != 1 {
+		t.Errorf("Expected 1 token, got %d", len(tokens))
+	}
+
+	// Deleting the user removes their tokens
+	if err := db.DeleteUser(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	tokens, err = db.ListAPITokens(0)
+	if err != nil {
+		t.Fatalf("Failed to list tokens: %v", err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("Expected tokens to be deleted with user, got %d", len(tokens))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// EnableTOTP stores a confirmed TOTP secret for a user and replaces their
+// recovery codes. Only hashes of the recovery codes are stored.
+func (db *DB) EnableTOTP(userID int64, secret string, recoveryCodes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = `+db.placeholder(1), userID); err != nil {
+		return err
+	}
+	for _, code := range recoveryCodes {
+		if _, err := tx.Exec(`
+			INSERT INTO user_recovery_codes (user_id, code_hash)
+			VALUES (`+db.placeholder(1)+`, `+db.placeholder(2)+`)`,
+			userID, hashRecoveryCode(code)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE users
+		SET totp_secret = `+db.placeholder(1)+`,
+		    totp_enabled = `+db.placeholder(2)+`,
+		    updated_at = `+db.placeholder(3)+`
+		WHERE id = `+db.placeholder(4),
+		secret, true, time.Now(), userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP removes two-factor authentication and the recovery codes
+// from a user's account
+func (db *DB) DisableTOTP(userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = `+db.placeholder(1), userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE users
+		SET totp_secret = '',
+		    totp_enabled = `+db.placeholder(1)+`,
+		    updated_at = `+db.placeholder(2)+`
+		WHERE id = `+db.placeholder(3),
+		false, time.Now(), userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used. It
+// reports false when the code does not exist or was used before.
+func (db *DB) UseRecoveryCode(userID int64, code string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE user_recovery_codes
+		SET used_at = `+db.placeholder(1)+`
+		WHERE user_id = `+db.placeholder(2)+`
+		  AND code_hash = `+db.placeholder(3)+`
+		  AND used_at IS NULL`,
+		time.Now(), userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user
+func (db *DB) CountRecoveryCodes(userID int64) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM user_recovery_codes
+		WHERE user_id = `+db.placeholder(1)+` AND used_at IS NULL`,
+		userID).Scan(&count)
+	return count, err
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes
+// so codes can be typed the way they read
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+	return hashToken(normalized)
+}
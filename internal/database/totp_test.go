@@ -0,0 +1,65 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package database
+
+import (
+	"testing"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func TestTOTP(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &types.User{Username: "careful", Email: "careful@example.com", PasswordHash: "hash"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if err := db.EnableTOTP(user.ID, "JBSWY3DPEHPK3PXP", []string{"abcde-fghij", "klmno-pqrst"}); err != nil {
+		t.Fatalf("Failed to enable TOTP: %v", err)
+	}
+
+	retrieved, err := db.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if !retrieved.TOTPEnabled || retrieved.TOTPSecret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("Expected TOTP to be enabled, got %+v", retrieved)
+	}
+
+	// Recovery codes are matched regardless of case and dashes, and only once
+	if used, err := db.UseRecoveryCode(user.ID, "ABCDE FGHIJ"); err != nil || !used {
+		t.Fatalf("Expected recovery code to be accepted, got %v, %v", used, err)
+	}
+	if used, err := db.UseRecoveryCode(user.ID, "abcde-fghij"); err != nil || used {
+		t.Errorf("Expected used recovery code to be rejected, got %v, %v", used, err)
+	}
+	if used, err := db.UseRecoveryCode(user.ID, "zzzzz-zzzzz"); err != nil || used {
+		t.Errorf("Expected unknown recovery code to be rejected, got %v, %v", used, err)
+	}
+
+	count, err := db.CountRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to count recovery codes: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 remaining recovery code, got %d", count)
+	}
+
+	if err := db.DisableTOTP(user.ID); err != nil {
+		t.Fatalf("Failed to disable TOTP: %v", err)
+	}
+	retrieved, err = db.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if retrieved.TOTPEnabled || retrieved.TOTPSecret != "" {
+		t.Errorf("Expected TOTP to be disabled, got %+v", retrieved)
+	}
+	if count, _ := db.CountRecoveryCodes(user.ID); count != 0 {
+		t.Errorf("Expected recovery codes to be removed, got %d", count)
+	}
+}
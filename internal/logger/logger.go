@@ -40,3 +40,19 @@ func Init() {
 	}
 	log.Logger = zerolog.New(output).With().Timestamp().Logger()
 }
+
+// SetLevel sets the minimum level of logged messages. An empty level logs
+// everything.
+func SetLevel(level string) error {
+	if level == "" {
+		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+		return nil
+	}
+
+	parsed, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(parsed)
+	return nil
+}
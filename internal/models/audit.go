@@ -0,0 +1,116 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditServiceCreate       = "service.create"
+	AuditServiceUpdate       = "service.update"
+	AuditServiceDelete       = "service.delete"
+	AuditQueueDelete         = "queue.delete"
+	AuditRequestApprove      = "overseerr.request.approve"
+	AuditRequestDecline      = "overseerr.request.decline"
+	AuditWebhookTrigger      = "omegabrr.webhook.trigger"
+	AuditLogin               = "auth.login"
+	AuditLoginFailed         = "auth.login_failed"
+	AuditLogout              = "auth.logout"
+	AuditLockout             = "auth.lockout"
+	AuditUserCreate          = "user.create"
+	AuditUserPasswordChange  = "user.password_change"
+	AuditUserRoleChange      = "user.role_change"
+	AuditUserDisable         = "user.disable"
+	AuditUserEnable          = "user.enable"
+	AuditUserDelete          = "user.delete"
+	AuditUserUnlock          = "user.unlock"
+	AuditUser2FAEnable       = "user.2fa_enable"
+	AuditUser2FADisable      = "user.2fa_disable"
+	AuditUser2FAReset        = "user.2fa_reset"
+	AuditRecoveryCodeUsed    = "auth.recovery_code_used"
+	AuditInviteCreate        = "invite.create"
+	AuditInviteDelete        = "invite.delete"
+	AuditTokenCreate         = "token.create"
+	AuditTokenRevoke         = "token.revoke"
+	AuditSessionRevoke       = "session.revoke"
+	AuditSessionRevokeAll    = "session.revoke_all"
+	AuditPasskeyCreate       = "passkey.create"
+	AuditPasskeyDelete       = "passkey.delete"
+	AuditCachePurge          = "cache.purge"
+	AuditStatusSuccess       = "success"
+	AuditStatusFailure       = "failure"
+	auditRedactedPlaceholder = "[REDACTED]"
+)
+
+// AuditEvent records an administrative or security relevant action
+type AuditEvent struct {
+	ID        int64                  `json:"id"`
+	CreatedAt time.Time              `json:"createdAt"`
+	Actor     string                 `json:"actor"`
+	ActorID   int64                  `json:"actorId,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+	Action    string                 `json:"action"`
+	Target    string                 `json:"target,omitempty"`
+	Status    string                 `json:"status"`
+	Changes   map[string]AuditChange `json:"changes,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditChange holds the before and after value of a changed field
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter narrows down audit event queries
+type AuditFilter struct {
+	Action string
+	Actor  string
+	Target string
+	Since  time.Time
+	Limit  int
+	Offset int
+}
+
+// ServiceConfigChanges returns the changed fields between two service
+// configurations. Either side may be nil for creations and deletions.
+// API keys are never included in clear text.
+func ServiceConfigChanges(before, after *ServiceConfiguration) map[string]AuditChange {
+	var b, a ServiceConfiguration
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+
+	changes := make(map[string]AuditChange)
+	if b.DisplayName != a.DisplayName {
+		changes["displayName"] = AuditChange{Before: b.DisplayName, After: a.DisplayName}
+	}
+	if b.URL != a.URL {
+		changes["url"] = AuditChange{Before: b.URL, After: a.URL}
+	}
+	if b.APIKey != a.APIKey {
+		changes["apiKey"] = AuditChange{Before: redactSecret(b.APIKey), After: redactSecret(a.APIKey)}
+	}
+	if strings.Join(b.Tags, ",") != strings.Join(a.Tags, ",") {
+		changes["tags"] = AuditChange{Before: b.Tags, After: a.Tags}
+	}
+	if b.CheckInterval != a.CheckInterval {
+		changes["checkInterval"] = AuditChange{Before: b.CheckInterval, After: a.CheckInterval}
+	}
+	return changes
+}
+
+// redactSecret hides a secret value while still showing whether it was set
+func redactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return auditRedactedPlaceholder
+}
@@ -7,6 +7,31 @@ import (
 	"strings"
 )
 
+// ServiceTypes lists the supported service types
+var ServiceTypes = []string{
+	"autobrr",
+	"radarr",
+	"sonarr",
+	"prowlarr",
+	"overseerr",
+	"plex",
+	"omegabrr",
+	"tailscale",
+	"maintainerr",
+	"general",
+}
+
+// IsServiceType reports whether serviceType is a supported service type
+func IsServiceType(serviceType string) bool {
+	serviceType = strings.ToLower(serviceType)
+	for _, t := range ServiceTypes {
+		if t == serviceType {
+			return true
+		}
+	}
+	return false
+}
+
 // ServiceCreator is responsible for creating service instances
 type ServiceCreator interface {
 	CreateService(serviceType string) ServiceHealthChecker
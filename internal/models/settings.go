@@ -10,4 +10,13 @@ type ServiceConfiguration struct {
 	DisplayName string `json:"displayName"`
 	URL         string `json:"url"`
 	APIKey      string `json:"apiKey,omitempty"`
+
+	// Tags group related services
+	Tags []string `json:"tags,omitempty"`
+	// CheckInterval is the minimum number of seconds between health checks,
+	// or 0 to check on every run of the health monitor
+	CheckInterval int64 `json:"checkInterval,omitempty"`
+	// Managed services are declared in the config file and cannot be
+	// changed through the API
+	Managed bool `json:"managed"`
 }
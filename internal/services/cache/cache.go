@@ -4,6 +4,7 @@
 package cache
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
 	"errors"
@@ -48,6 +49,8 @@ type RedisStore struct {
 	wg     sync.WaitGroup // Added WaitGroup for graceful shutdown
 	closed bool
 	mu     sync.RWMutex
+
+	counters counters
 }
 
 // LocalCache provides in-memory caching to reduce Redis hits
@@ -59,6 +62,7 @@ type LocalCache struct {
 type localCacheItem struct {
 	value      []byte
 	expiration time.Time
+	element    *list.Element // position in the LRU list of a bounded store
 }
 
 // NewCache creates a new Redis cache instance with optimized configuration
@@ -139,6 +143,7 @@ func (s *RedisStore) Get(ctx context.Context, key string, value interface{}) err
 		if err := json.Unmarshal(data, value); err != nil {
 			log.Error().Err(err).Str("key", key).Msg("Failed to unmarshal local cached value")
 		} else {
+			s.counters.record(true)
 			return nil
 		}
 	}
@@ -168,6 +173,7 @@ func (s *RedisStore) Get(ctx context.Context, key string, value interface{}) err
 					}
 				}
 				s.setInLocalCache(key, data, ttl)
+				s.counters.record(true)
 				return json.Unmarshal(data, value)
 			}
 
@@ -183,6 +189,7 @@ func (s *RedisStore) Get(ctx context.Context, key string, value interface{}) err
 	}
 
 	if lastErr == redis.Nil {
+		s.counters.record(false)
 		return ErrKeyNotFound
 	}
 	return lastErr
@@ -460,6 +467,234 @@ func (s *RedisStore) Expire(ctx context.Context, key string, expiration time.Dur
 	return lastErr
 }
 
+// scanBatch is how many keys are scanned or deleted per Redis command
+const scanBatch = 100
+
+// DeletePrefix removes every key starting with prefix from Redis and the
+// local cache
+func (s *RedisStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return 0, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	s.local.Lock()
+	for key := range s.local.items {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.local.items, key)
+		}
+	}
+	s.local.Unlock()
+
+	keys, err := s.Keys(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for start := 0; start < len(keys); start += scanBatch {
+		batch := keys[start:min(start+scanBatch, len(keys))]
+		timeoutCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+		n, err := s.client.Del(timeoutCtx, batch...).Result()
+		cancel()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+
+	return deleted, nil
+}
+
+// Keys returns the keys starting with prefix, scanning Redis in batches
+func (s *RedisStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	var keys []string
+	iter := s.client.Scan(ctx, 0, escapePattern(prefix)+"*", scanBatch).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetMulti returns the values of the keys that exist, reading the keys
+// missing from the local cache in a single Redis command
+func (s *RedisStore) GetMulti(ctx context.Context, keys []string) (map[string]json.RawMessage, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	values := make(map[string]json.RawMessage, len(keys))
+	var remote []string
+	for _, key := range keys {
+		if data, ok := s.getFromLocalCache(key); ok {
+			values[key] = data
+			s.counters.record(true)
+		} else {
+			remote = append(remote, key)
+		}
+	}
+	if len(remote) == 0 {
+		return values, nil
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	results, err := s.client.MGet(timeoutCtx, remote...).Result()
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, result := range results {
+		data, ok := result.(string)
+		if ok {
+			values[remote[i]] = json.RawMessage(data)
+		}
+		s.counters.record(ok)
+	}
+
+	return values, nil
+}
+
+// SetNX stores a value with SET NX unless the key exists
+func (s *RedisStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return false, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	if expiration == 0 {
+		expiration = DefaultTTL
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to marshal value for cache")
+		return false, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	stored, err := s.client.SetNX(timeoutCtx, key, data, expiration).Result()
+	if err != nil {
+		return false, err
+	}
+	if stored {
+		s.setInLocalCache(key, data, expiration)
+	}
+	return stored, nil
+}
+
+// SetMulti stores several values with the same expiration in a single
+// round trip to Redis
+func (s *RedisStore) SetMulti(ctx context.Context, values map[string]interface{}, expiration time.Duration) error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrClosed
+	}
+	s.mu.RUnlock()
+
+	if expiration == 0 {
+		expiration = DefaultTTL
+	}
+
+	encoded := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Failed to marshal value for cache")
+			return err
+		}
+		encoded[key] = data
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	_, err := s.client.Pipelined(timeoutCtx, func(pipe redis.Pipeliner) error {
+		for key, data := range encoded {
+			pipe.Set(timeoutCtx, key, data, expiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, data := range encoded {
+		s.setInLocalCache(key, data, expiration)
+	}
+	return nil
+}
+
+// Stats returns the hits and misses of this store together with the keys
+// held and the evictions counted by the Redis server
+func (s *RedisStore) Stats(ctx context.Context) (Stats, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return Stats{}, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	size, err := s.client.DBSize(timeoutCtx).Result()
+	if err != nil {
+		return Stats{}, err
+	}
+	info, err := s.client.Info(timeoutCtx, "stats").Result()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := s.counters.stats("redis", size)
+	stats.Evictions = infoValue(info, "expired_keys") + infoValue(info, "evicted_keys")
+	return stats, nil
+}
+
+// escapePattern escapes the glob characters of a Redis SCAN pattern
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// infoValue returns a numeric field of the output of the Redis INFO
+// command, or 0 when it is missing
+func infoValue(info, field string) int64 {
+	for _, line := range strings.Split(info, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), field+":"); ok {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
 // Close closes the Redis connection and stops the cleanup goroutine
 func (s *RedisStore) Close() error {
 	s.mu.Lock()
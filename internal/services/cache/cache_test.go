@@ -368,3 +368,50 @@ func TestClosedCache(t *testing.T) {
 	err = cache.Delete(ctx, key)
 	assert.Equal(t, redis.ErrClosed, err)
 }
+
+func TestPrefixOperations(t *testing.T) {
+	cache := setupTestCache(t)
+	defer cleanupTestCache(t, cache)
+
+	ctx := context.Background()
+
+	err := cache.SetMulti(ctx, map[string]interface{}{
+		"test:prefix:a":  testStruct{Name: "a", Value: 1},
+		"test:prefix:b":  testStruct{Name: "b", Value: 2},
+		"test:prefix*:c": testStruct{Name: "c", Value: 3},
+	}, time.Minute)
+	require.NoError(t, err)
+
+	values, err := cache.GetMulti(ctx, []string{"test:prefix:a", "test:prefix:missing"})
+	require.NoError(t, err)
+	assert.Len(t, values, 1)
+	assert.Contains(t, values, "test:prefix:a")
+
+	// Glob characters in the prefix are matched literally
+	keys, err := cache.Keys(ctx, "test:prefix*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test:prefix*:c"}, keys)
+
+	deleted, err := cache.DeletePrefix(ctx, "test:prefix:")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	var retrieved testStruct
+	assert.Equal(t, ErrKeyNotFound, cache.Get(ctx, "test:prefix:a", &retrieved))
+	require.NoError(t, cache.Get(ctx, "test:prefix*:c", &retrieved))
+	require.NoError(t, cache.Delete(ctx, "test:prefix*:c"))
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "redis", stats.Backend)
+	assert.NotZero(t, stats.Hits)
+	assert.NotZero(t, stats.Misses)
+}
+
+func TestInfoValue(t *testing.T) {
+	info := "# Stats\r\ntotal_connections_received:12\r\nexpired_keys:7\r\nevicted_keys:0\r\n"
+	assert.Equal(t, int64(7), infoValue(info, "expired_keys"))
+	assert.Equal(t, int64(0), infoValue(info, "evicted_keys"))
+	assert.Equal(t, int64(0), infoValue(info, "missing"))
+	assert.Equal(t, `a\*b\?`, escapePattern("a*b?"))
+}
@@ -0,0 +1,432 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+)
+
+// diskSchema creates the tables of the disk store. Values are stored as
+// JSON with their expiry in Unix nanoseconds; rate limit windows hold one
+// row per timestamp.
+const diskSchema = `
+CREATE TABLE IF NOT EXISTS cache_items (
+	key        TEXT PRIMARY KEY,
+	value      BLOB NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_cache_items_expires_at ON cache_items (expires_at);
+CREATE TABLE IF NOT EXISTS cache_rate_limits (
+	key       TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	PRIMARY KEY (key, timestamp)
+);`
+
+// hasPrefix is the SQL condition matching keys that start with the first
+// query argument
+const hasPrefix = `substr(key, 1, length(?1)) = ?1`
+
+// DiskStore implements Store on an embedded SQLite database, so cached
+// values, sessions and rate limit windows survive restarts without Redis
+type DiskStore struct {
+	db     *sql.DB
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	closed bool
+	mu     sync.RWMutex
+
+	counters counters
+}
+
+// NewDiskStore opens or creates the cache database cache.db in dataDir
+func NewDiskStore(dataDir string) (Store, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	path := filepath.Join(dataDir, "cache.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening cache database: %w", err)
+	}
+
+	// A single connection serializes writes, which SQLite requires anyway
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{"PRAGMA journal_mode=WAL", diskSchema} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error initializing cache database: %w", err)
+		}
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		log.Error().Err(err).Msg("Failed to set permissions on cache database")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store := &DiskStore{
+		db:     db,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	// Start cleanup goroutine
+	store.wg.Add(1)
+	go func() {
+		defer store.wg.Done()
+		store.cleanup()
+	}()
+
+	return store, nil
+}
+
+// open returns ErrClosed once the store is closed
+func (s *DiskStore) open() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Get retrieves a value from the database
+func (s *DiskStore) Get(ctx context.Context, key string, value interface{}) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	var data []byte
+	var expiresAt int64
+	err := s.db.QueryRowContext(ctx, `SELECT value, expires_at FROM cache_items WHERE key = ?`, key).Scan(&data, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.counters.record(false)
+		return ErrKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if time.Now().UnixNano() >= expiresAt {
+		res, err := s.db.ExecContext(ctx, `DELETE FROM cache_items WHERE key = ? AND expires_at = ?`, key, expiresAt)
+		if err == nil {
+			if n, _ := res.RowsAffected(); n > 0 {
+				s.counters.evictions.Add(n)
+			}
+		}
+		s.counters.record(false)
+		return ErrKeyNotFound
+	}
+
+	s.counters.record(true)
+	return json.Unmarshal(data, value)
+}
+
+// Set stores a value in the database
+func (s *DiskStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return s.SetMulti(ctx, map[string]interface{}{key: value}, expiration)
+}
+
+// Delete removes a value from the database
+func (s *DiskStore) Delete(ctx context.Context, key string) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM cache_items WHERE key = ?`, key)
+	return err
+}
+
+// Increment adds a timestamp to the rate limit window
+func (s *DiskStore) Increment(ctx context.Context, key string, timestamp int64) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO cache_rate_limits (key, timestamp) VALUES (?, ?)`, key, timestamp)
+	return err
+}
+
+// CleanAndCount removes timestamps older than windowStart from the window
+func (s *DiskStore) CleanAndCount(ctx context.Context, key string, windowStart int64) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM cache_rate_limits WHERE key = ? AND timestamp < ?`, key, windowStart)
+	return err
+}
+
+// GetCount returns the number of timestamps in the current window
+func (s *DiskStore) GetCount(ctx context.Context, key string) (int64, error) {
+	if err := s.open(); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cache_rate_limits WHERE key = ?`, key).Scan(&count)
+	return count, err
+}
+
+// Expire updates the expiration time for a key
+func (s *DiskStore) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `UPDATE cache_items SET expires_at = ? WHERE key = ?`,
+		time.Now().Add(expiration).UnixNano(), key)
+	return err
+}
+
+// DeletePrefix removes every value and rate limit window whose key starts
+// with prefix
+func (s *DiskStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if err := s.open(); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var windows int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(DISTINCT key) FROM cache_rate_limits WHERE `+hasPrefix, prefix).Scan(&windows); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cache_rate_limits WHERE `+hasPrefix, prefix); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM cache_items WHERE `+hasPrefix, prefix)
+	if err != nil {
+		return 0, err
+	}
+	items, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(items) + windows, nil
+}
+
+// Keys returns the keys of unexpired values and rate limit windows starting
+// with prefix
+func (s *DiskStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT key FROM cache_items WHERE `+hasPrefix+` AND expires_at > ?2
+		UNION
+		SELECT DISTINCT key FROM cache_rate_limits WHERE `+hasPrefix,
+		prefix, time.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetMulti returns the values of the keys that exist
+func (s *DiskStore) GetMulti(ctx context.Context, keys []string) (map[string]json.RawMessage, error) {
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]json.RawMessage, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, time.Now().UnixNano())
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT key, value FROM cache_items WHERE expires_at > ? AND key IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, err
+		}
+		values[key] = data
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hits := int64(len(values))
+	s.counters.hits.Add(hits)
+	s.counters.misses.Add(int64(len(keys)) - hits)
+	return values, nil
+}
+
+// SetMulti stores several values with the same expiration in a single
+// transaction
+func (s *DiskStore) SetMulti(ctx context.Context, values map[string]interface{}, expiration time.Duration) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if expiration == 0 {
+		expiration = DefaultTTL
+	}
+	expiresAt := time.Now().Add(expiration).UnixNano()
+
+	encoded := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Failed to marshal value for cache")
+			return err
+		}
+		encoded[key] = data
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, data := range encoded {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO cache_items (key, value, expires_at) VALUES (?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`,
+			key, data, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetNX stores a value unless the key holds one that has not expired
+func (s *DiskStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	if err := s.open(); err != nil {
+		return false, err
+	}
+
+	if expiration == 0 {
+		expiration = DefaultTTL
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to marshal value for cache")
+		return false, err
+	}
+
+	// An expired value is replaced, an unexpired one leaves the row as is
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO cache_items (key, value, expires_at) VALUES (?1, ?2, ?3)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at
+		WHERE cache_items.expires_at <= ?4`,
+		key, data, now.Add(expiration).UnixNano(), now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+	stored, err := res.RowsAffected()
+	return stored > 0, err
+}
+
+// Stats returns the counters of the store and the number of keys held
+func (s *DiskStore) Stats(ctx context.Context) (Stats, error) {
+	if err := s.open(); err != nil {
+		return Stats{}, err
+	}
+
+	var size int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM cache_items WHERE expires_at > ?)
+		     + (SELECT COUNT(DISTINCT key) FROM cache_rate_limits)`,
+		time.Now().UnixNano()).Scan(&size)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return s.counters.stats("disk", size), nil
+}
+
+// Close stops the cleanup goroutine and closes the database
+func (s *DiskStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+
+	return s.db.Close()
+}
+
+// cleanup removes expired values and rate limit timestamps older than 24
+// hours
+func (s *DiskStore) cleanup() {
+	ticker := time.NewTicker(CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			res, err := s.db.ExecContext(s.ctx, `DELETE FROM cache_items WHERE expires_at <= ?`, time.Now().UnixNano())
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to remove expired cache values")
+			} else if n, _ := res.RowsAffected(); n > 0 {
+				s.counters.evictions.Add(n)
+			}
+
+			windowStart := time.Now().Add(-24 * time.Hour).Unix()
+			if _, err := s.db.ExecContext(s.ctx, `DELETE FROM cache_rate_limits WHERE timestamp < ?`, windowStart); err != nil {
+				log.Error().Err(err).Msg("Failed to remove old rate limit timestamps")
+			}
+
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package cache
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDiskStore(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open disk store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	t.Run("Basic Operations", func(t *testing.T) {
+		if err := store.Set(ctx, "test_key", "test_value", time.Minute); err != nil {
+			t.Fatalf("Failed to set value: %v", err)
+		}
+
+		var result string
+		if err := store.Get(ctx, "test_key", &result); err != nil {
+			t.Fatalf("Failed to get value: %v", err)
+		}
+		if result != "test_value" {
+			t.Errorf("Expected test_value, got %v", result)
+		}
+
+		if err := store.Delete(ctx, "test_key"); err != nil {
+			t.Fatalf("Failed to delete value: %v", err)
+		}
+		if err := store.Get(ctx, "test_key", &result); err != ErrKeyNotFound {
+			t.Errorf("Expected ErrKeyNotFound after delete, got %v", err)
+		}
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		store.Set(ctx, "expire_key", "value", time.Minute)
+		if err := store.Expire(ctx, "expire_key", 20*time.Millisecond); err != nil {
+			t.Fatalf("Failed to update expiration: %v", err)
+		}
+		time.Sleep(40 * time.Millisecond)
+
+		var result string
+		if err := store.Get(ctx, "expire_key", &result); err != ErrKeyNotFound {
+			t.Errorf("Expected ErrKeyNotFound for expired key, got %v", err)
+		}
+	})
+
+	t.Run("Rate Limiting", func(t *testing.T) {
+		now := time.Now().Unix()
+		for _, ts := range []int64{now - 20, now - 10, now, now} {
+			if err := store.Increment(ctx, "rate:test", ts); err != nil {
+				t.Fatalf("Failed to increment: %v", err)
+			}
+		}
+
+		count, err := store.GetCount(ctx, "rate:test")
+		if err != nil {
+			t.Fatalf("Failed to get count: %v", err)
+		}
+		if count != 3 {
+			t.Errorf("Expected count 3, got %d", count)
+		}
+
+		store.CleanAndCount(ctx, "rate:test", now-15)
+		count, _ = store.GetCount(ctx, "rate:test")
+		if count != 2 {
+			t.Errorf("Expected count 2 after cleaning, got %d", count)
+		}
+	})
+
+	t.Run("Prefix and Bulk Operations", func(t *testing.T) {
+		err := store.SetMulti(ctx, map[string]interface{}{
+			"bulk:a":   1,
+			"bulk:b":   2,
+			"bulk_a":   3,
+			"other:id": 4,
+		}, time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to set values: %v", err)
+		}
+		store.Increment(ctx, "bulk:rate", time.Now().Unix())
+
+		values, err := store.GetMulti(ctx, []string{"bulk:a", "bulk:missing"})
+		if err != nil {
+			t.Fatalf("Failed to get values: %v", err)
+		}
+		if len(values) != 1 || string(values["bulk:a"]) != "1" {
+			t.Errorf("Expected only bulk:a, got %v", values)
+		}
+
+		keys, err := store.Keys(ctx, "bulk:")
+		if err != nil {
+			t.Fatalf("Failed to list keys: %v", err)
+		}
+		sort.Strings(keys)
+		if len(keys) != 3 || keys[0] != "bulk:a" || keys[2] != "bulk:rate" {
+			t.Errorf("Expected the bulk: keys, got %v", keys)
+		}
+
+		deleted, err := store.DeletePrefix(ctx, "bulk:")
+		if err != nil {
+			t.Fatalf("Failed to delete prefix: %v", err)
+		}
+		if deleted != 3 {
+			t.Errorf("Expected 3 deleted keys, got %d", deleted)
+		}
+
+		var result int
+		if err := store.Get(ctx, "bulk_a", &result); err != nil {
+			t.Errorf("Expected keys outside the prefix to be kept, got %v", err)
+		}
+	})
+
+	t.Run("SetNX", func(t *testing.T) {
+		stored, err := store.SetNX(ctx, "claim:a", true, time.Minute)
+		if err != nil || !stored {
+			t.Fatalf("Expected first SetNX to store, got %v, %v", stored, err)
+		}
+		stored, err = store.SetNX(ctx, "claim:a", true, time.Minute)
+		if err != nil || stored {
+			t.Errorf("Expected second SetNX to be refused, got %v, %v", stored, err)
+		}
+
+		store.Set(ctx, "claim:expired", true, time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		stored, err = store.SetNX(ctx, "claim:expired", true, time.Minute)
+		if err != nil || !stored {
+			t.Errorf("Expected SetNX to replace an expired value, got %v, %v", stored, err)
+		}
+	})
+}
+
+func TestDiskStorePersistence(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open disk store: %v", err)
+	}
+	store.Set(ctx, "oidc:state:abc", "state", time.Hour)
+	store.Set(ctx, "sonarr:queue:1", "queue", time.Hour)
+	store.Increment(ctx, "rate:client", time.Now().Unix())
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	var result string
+	if err := store.Get(ctx, "sonarr:queue:1", &result); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after close, got %v", err)
+	}
+
+	store, err = NewDiskStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen disk store: %v", err)
+	}
+	defer store.Close()
+
+	for _, key := range []string{"oidc:state:abc", "sonarr:queue:1"} {
+		if err := store.Get(ctx, key, &result); err != nil {
+			t.Errorf("Expected %s to survive a restart, got %v", key, err)
+		}
+	}
+	if count, _ := store.GetCount(ctx, "rate:client"); count != 1 {
+		t.Errorf("Expected the rate limit window to survive a restart, got %d", count)
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Backend != "disk" || stats.Size != 3 || stats.Hits != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestInitCache_Disk(t *testing.T) {
+	store, err := InitCache(Config{Type: "disk", DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to init cache: %v", err)
+	}
+	defer store.Close()
+
+	if _, ok := store.(*DiskStore); !ok {
+		t.Errorf("Expected a disk store, got %T", store)
+	}
+}
@@ -5,21 +5,45 @@ package cache
 
 import (
 	"context"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/config"
 )
 
 // Config holds cache configuration options
 type Config struct {
+	// Type is "redis", "memory" or "disk". Empty picks Redis when an
+	// address is set.
+	Type string
+
 	// Redis configuration
 	RedisAddr string
 
 	// Memory cache configuration
 	DataDir string // Directory for persistent storage (derived from DB path)
+	Limits  Limits // Bounds on the memory cache, unbounded when zero
+
+	// Development uses smaller Redis pools and shorter timeouts
+	Development bool
+}
+
+// NewConfigFromSettings creates a cache configuration from the application
+// configuration
+func NewConfigFromSettings(settings config.CacheConfig, development bool) Config {
+	return Config{
+		Type:      settings.Type,
+		RedisAddr: settings.RedisAddr(),
+		DataDir:   settings.Dir,
+		Limits: Limits{
+			MaxEntries: settings.MaxEntries,
+			MaxBytes:   settings.MaxBytes,
+		},
+		Development: development,
+	}
 }
 
 // CacheType represents the type of cache to use
@@ -28,11 +52,11 @@ type CacheType string
 const (
 	CacheTypeRedis  CacheType = "redis"
 	CacheTypeMemory CacheType = "memory"
+	CacheTypeDisk   CacheType = "disk"
 )
 
 // getRedisOptions returns Redis configuration optimized for the current environment
-func getRedisOptions(addr string) *redis.Options {
-	isDev := os.Getenv("GIN_MODE") != "release"
+func getRedisOptions(addr string, isDev bool) *redis.Options {
 
 	// Base configuration
 	opts := &redis.Options{
@@ -64,12 +88,12 @@ func getRedisOptions(addr string) *redis.Options {
 	return opts
 }
 
-// getCacheType determines which cache implementation to use based on environment
-func getCacheType() CacheType {
-	cacheType := os.Getenv("CACHE_TYPE")
+// getCacheType determines which cache implementation to use
+func getCacheType(cfg Config) CacheType {
+	cacheType := cfg.Type
 	if cacheType == "" {
 		// Default to memory cache unless Redis is explicitly configured
-		if os.Getenv("REDIS_HOST") != "" {
+		if cfg.RedisAddr != "" {
 			return CacheTypeRedis
 		}
 		return CacheTypeMemory
@@ -80,31 +104,44 @@ func getCacheType() CacheType {
 		return CacheTypeRedis
 	case "memory":
 		return CacheTypeMemory
+	case "disk":
+		return CacheTypeDisk
 	default:
 		log.Warn().Str("type", cacheType).Msg("Unknown cache type specified, using memory cache")
 		return CacheTypeMemory
 	}
 }
 
+// Ping checks that the Redis server at addr answers, without setting up a
+// cache store
+func Ping(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	client := redis.NewClient(getRedisOptions(addr, false))
+	defer client.Close()
+	return client.Ping(ctx).Err()
+}
+
 // InitCache initializes a cache instance based on configuration.
 // It always returns a valid cache store, falling back to memory cache if Redis fails.
 func InitCache(cfg Config) (Store, error) {
-	cacheType := getCacheType()
+	cacheType := getCacheType(cfg)
+	explicitRedis := strings.EqualFold(cfg.Type, string(CacheTypeRedis))
 
 	switch cacheType {
 	case CacheTypeRedis:
 		// Only attempt Redis connection if Redis address is configured
 		if cfg.RedisAddr == "" {
 			// Silently fall back to memory cache when Redis isn't configured
-			return NewMemoryStore(cfg.DataDir), nil
+			return NewBoundedMemoryStore(cfg.DataDir, cfg.Limits), nil
 		}
 
-		isDev := os.Getenv("GIN_MODE") != "release"
-		opts := getRedisOptions(cfg.RedisAddr)
+		opts := getRedisOptions(cfg.RedisAddr, cfg.Development)
 
 		// Create context with shorter timeout for development
 		timeout := DefaultTimeout
-		if isDev {
+		if cfg.Development {
 			timeout = 2 * time.Second
 		}
 
@@ -118,29 +155,37 @@ func InitCache(cfg Config) (Store, error) {
 			if client != nil {
 				client.Close()
 			}
-			if os.Getenv("CACHE_TYPE") == "redis" {
+			if explicitRedis {
 				// Only log error if Redis was explicitly requested
 				log.Error().Err(err).Str("addr", opts.Addr).Msg("Failed to connect to explicitly configured Redis, falling back to memory cache")
 			}
-			return NewMemoryStore(cfg.DataDir), err
+			return NewBoundedMemoryStore(cfg.DataDir, cfg.Limits), err
 		}
 
 		// Initialize Redis cache store
 		store, err := NewCache(opts.Addr)
 		if err != nil {
-			if os.Getenv("CACHE_TYPE") == "redis" {
+			if explicitRedis {
 				// Only log error if Redis was explicitly requested
 				log.Error().Err(err).Msg("Failed to initialize explicitly configured Redis cache, falling back to memory cache")
 			}
-			return NewMemoryStore(cfg.DataDir), err
+			return NewBoundedMemoryStore(cfg.DataDir, cfg.Limits), err
 		}
 		return store, nil
 
 	case CacheTypeMemory:
-		return NewMemoryStore(cfg.DataDir), nil
+		return NewBoundedMemoryStore(cfg.DataDir, cfg.Limits), nil
+
+	case CacheTypeDisk:
+		store, err := NewDiskStore(cfg.DataDir)
+		if err != nil {
+			log.Error().Err(err).Str("dir", cfg.DataDir).Msg("Failed to open disk cache, falling back to memory cache")
+			return NewBoundedMemoryStore(cfg.DataDir, cfg.Limits), err
+		}
+		return store, nil
 
 	default:
 		// This shouldn't happen due to getCacheType's default
-		return NewMemoryStore(cfg.DataDir), nil
+		return NewBoundedMemoryStore(cfg.DataDir, cfg.Limits), nil
 	}
 }
@@ -5,6 +5,7 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 )
 
@@ -18,5 +19,34 @@ type Store interface {
 	CleanAndCount(ctx context.Context, key string, windowStart int64) error
 	GetCount(ctx context.Context, key string) (int64, error)
 	Expire(ctx context.Context, key string, expiration time.Duration) error
+
+	// DeletePrefix removes every key starting with prefix and returns how
+	// many were removed
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+	// Keys returns the keys starting with prefix, in no particular order
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	// GetMulti returns the JSON values of the keys that exist
+	GetMulti(ctx context.Context, keys []string) (map[string]json.RawMessage, error)
+	// SetMulti stores values by key with the same expiration
+	SetMulti(ctx context.Context, values map[string]interface{}, expiration time.Duration) error
+	// SetNX stores a value only when key holds none and reports whether it
+	// did, atomically, so concurrent callers claim a key at most once
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	// Stats returns the counters of the store since it was opened
+	Stats(ctx context.Context) (Stats, error)
+
 	Close() error
 }
+
+// Stats describe the use of a store
+type Stats struct {
+	// Backend is memory or redis
+	Backend string `json:"backend"`
+	Hits    int64  `json:"hits"`
+	Misses  int64  `json:"misses"`
+	// Evictions counts values removed before being read again because
+	// they expired or the store was full
+	Evictions int64 `json:"evictions"`
+	// Size is the number of keys held
+	Size int64 `json:"size"`
+}
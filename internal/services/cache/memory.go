@@ -4,6 +4,7 @@
 package cache
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
 	"os"
@@ -30,6 +31,27 @@ type MemoryStore struct {
 
 	// Session persistence
 	persistPath string
+
+	// Limits on the cached values, guarded by the local cache lock. The
+	// least recently used values are evicted first; pinned keys are neither
+	// counted nor evicted.
+	limits Limits
+	lru    *list.List // keys, most recently used first
+	bytes  int64
+
+	counters counters
+}
+
+// Limits bound the values held by a memory store. Zero means no limit.
+type Limits struct {
+	MaxEntries int
+	MaxBytes   int64
+}
+
+// exceeded reports whether entries values of the given total size are over
+// the limits
+func (l Limits) exceeded(entries int, bytes int64) bool {
+	return (l.MaxEntries > 0 && entries > l.MaxEntries) || (l.MaxBytes > 0 && bytes > l.MaxBytes)
 }
 
 type rateWindow struct {
@@ -44,6 +66,12 @@ type persistedItem struct {
 
 // NewMemoryStore creates a new in-memory cache instance
 func NewMemoryStore(dataDir string) Store {
+	return NewBoundedMemoryStore(dataDir, Limits{})
+}
+
+// NewBoundedMemoryStore creates an in-memory cache instance that evicts the
+// least recently used values once it holds more than the limits allow
+func NewBoundedMemoryStore(dataDir string, limits Limits) Store {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	store := &MemoryStore{
@@ -53,6 +81,8 @@ func NewMemoryStore(dataDir string) Store {
 		ctx:         ctx,
 		cancel:      cancel,
 		persistPath: filepath.Join(dataDir, "sessions.json"),
+		limits:      limits,
+		lru:         list.New(),
 	}
 
 	// Ensure directory exists with proper permissions
@@ -101,10 +131,10 @@ func (s *MemoryStore) loadSessions() {
 	for key, item := range items {
 		// Only load non-expired sessions
 		if now.Before(item.Expiration) {
-			s.local.items[key] = &localCacheItem{
+			s.put(key, &localCacheItem{
 				value:      item.Value,
 				expiration: item.Expiration,
-			}
+			})
 		}
 	}
 	s.local.Unlock()
@@ -118,7 +148,7 @@ func (s *MemoryStore) persistSessions() {
 
 	for key, item := range s.local.items {
 		// Only persist session data (not rate limiting or other cache items)
-		if strings.HasPrefix(key, "session:") || strings.HasPrefix(key, "oidc:session:") {
+		if isSessionKey(key) {
 			// Only persist non-expired sessions
 			if now.Before(item.expiration) {
 				items[key] = persistedItem{
@@ -160,18 +190,22 @@ func (s *MemoryStore) Get(ctx context.Context, key string, value interface{}) er
 	}
 	s.mu.RUnlock()
 
-	s.local.RLock()
+	s.local.Lock()
 	item, exists := s.local.items[key]
-	if exists && time.Now().Before(item.expiration) {
-		s.local.RUnlock()
-		return json.Unmarshal(item.value, value)
-	}
-	if exists {
-		delete(s.local.items, key)
+	fresh := exists && time.Now().Before(item.expiration)
+	if fresh {
+		s.touch(item)
+	} else if exists {
+		s.remove(key, item)
+		s.counters.evictions.Add(1)
 	}
-	s.local.RUnlock()
+	s.local.Unlock()
 
-	return ErrKeyNotFound
+	s.counters.record(fresh)
+	if !fresh {
+		return ErrKeyNotFound
+	}
+	return json.Unmarshal(item.value, value)
 }
 
 // Set stores a value in cache
@@ -194,14 +228,14 @@ func (s *MemoryStore) Set(ctx context.Context, key string, value interface{}, ex
 	}
 
 	s.local.Lock()
-	s.local.items[key] = &localCacheItem{
+	s.put(key, &localCacheItem{
 		value:      data,
 		expiration: time.Now().Add(expiration),
-	}
+	})
 	s.local.Unlock()
 
 	// Persist sessions when they're updated
-	if strings.HasPrefix(key, "session:") || strings.HasPrefix(key, "oidc:session:") {
+	if isSessionKey(key) {
 		s.persistSessions()
 	}
 
@@ -218,11 +252,13 @@ func (s *MemoryStore) Delete(ctx context.Context, key string) error {
 	s.mu.RUnlock()
 
 	s.local.Lock()
-	delete(s.local.items, key)
+	if item, exists := s.local.items[key]; exists {
+		s.remove(key, item)
+	}
 	s.local.Unlock()
 
 	// Persist sessions when they're deleted
-	if strings.HasPrefix(key, "session:") || strings.HasPrefix(key, "oidc:session:") {
+	if isSessionKey(key) {
 		s.persistSessions()
 	}
 
@@ -306,7 +342,7 @@ func (s *MemoryStore) Expire(ctx context.Context, key string, expiration time.Du
 	if item, exists := s.local.items[key]; exists {
 		item.expiration = time.Now().Add(expiration)
 		// Persist sessions when their expiration is updated
-		if strings.HasPrefix(key, "session:") || strings.HasPrefix(key, "oidc:session:") {
+		if isSessionKey(key) {
 			s.persistSessions()
 		}
 	}
@@ -315,6 +351,196 @@ func (s *MemoryStore) Expire(ctx context.Context, key string, expiration time.Du
 	return nil
 }
 
+// DeletePrefix removes every value and rate limit window whose key starts
+// with prefix
+func (s *MemoryStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return 0, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	deleted := 0
+	sessions := false
+	s.local.Lock()
+	for key, item := range s.local.items {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(key, item)
+			deleted++
+			sessions = sessions || isSessionKey(key)
+		}
+	}
+	s.local.Unlock()
+
+	s.rateLimits.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			s.rateLimits.Delete(key)
+			deleted++
+		}
+		return true
+	})
+
+	if sessions {
+		s.persistSessions()
+	}
+
+	return deleted, nil
+}
+
+// Keys returns the keys of unexpired values and rate limit windows starting
+// with prefix
+func (s *MemoryStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	var keys []string
+	now := time.Now()
+	s.local.RLock()
+	for key, item := range s.local.items {
+		if strings.HasPrefix(key, prefix) && now.Before(item.expiration) {
+			keys = append(keys, key)
+		}
+	}
+	s.local.RUnlock()
+
+	s.rateLimits.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			keys = append(keys, key.(string))
+		}
+		return true
+	})
+
+	return keys, nil
+}
+
+// GetMulti returns the values of the keys that exist
+func (s *MemoryStore) GetMulti(ctx context.Context, keys []string) (map[string]json.RawMessage, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	values := make(map[string]json.RawMessage, len(keys))
+	now := time.Now()
+	s.local.Lock()
+	for _, key := range keys {
+		item, exists := s.local.items[key]
+		hit := exists && now.Before(item.expiration)
+		if hit {
+			values[key] = item.value
+			s.touch(item)
+		}
+		s.counters.record(hit)
+	}
+	s.local.Unlock()
+
+	return values, nil
+}
+
+// SetMulti stores several values with the same expiration
+func (s *MemoryStore) SetMulti(ctx context.Context, values map[string]interface{}, expiration time.Duration) error {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return ErrClosed
+	}
+	s.mu.RUnlock()
+
+	if expiration == 0 {
+		expiration = DefaultTTL
+	}
+
+	items := make(map[string]*localCacheItem, len(values))
+	expiresAt := time.Now().Add(expiration)
+	sessions := false
+	for key, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Failed to marshal value for cache")
+			return err
+		}
+		items[key] = &localCacheItem{value: data, expiration: expiresAt}
+		sessions = sessions || isSessionKey(key)
+	}
+
+	s.local.Lock()
+	for key, item := range items {
+		s.put(key, item)
+	}
+	s.local.Unlock()
+
+	if sessions {
+		s.persistSessions()
+	}
+
+	return nil
+}
+
+// SetNX stores a value unless the key holds one that has not expired
+func (s *MemoryStore) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return false, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	if expiration == 0 {
+		expiration = DefaultTTL
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Failed to marshal value for cache")
+		return false, err
+	}
+
+	s.local.Lock()
+	if item, exists := s.local.items[key]; exists && time.Now().Before(item.expiration) {
+		s.local.Unlock()
+		return false, nil
+	}
+	s.put(key, &localCacheItem{
+		value:      data,
+		expiration: time.Now().Add(expiration),
+	})
+	s.local.Unlock()
+
+	if isSessionKey(key) {
+		s.persistSessions()
+	}
+
+	return true, nil
+}
+
+// Stats returns the counters of the store and the number of keys held
+func (s *MemoryStore) Stats(ctx context.Context) (Stats, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return Stats{}, ErrClosed
+	}
+	s.mu.RUnlock()
+
+	s.local.RLock()
+	size := int64(len(s.local.items))
+	s.local.RUnlock()
+
+	s.rateLimits.Range(func(_, _ interface{}) bool {
+		size++
+		return true
+	})
+
+	return s.counters.stats("memory", size), nil
+}
+
 // Close cleans up resources
 func (s *MemoryStore) Close() error {
 	s.mu.Lock()
@@ -333,6 +559,8 @@ func (s *MemoryStore) Close() error {
 
 	s.local.Lock()
 	s.local.items = make(map[string]*localCacheItem)
+	s.lru.Init()
+	s.bytes = 0
 	s.local.Unlock()
 
 	return nil
@@ -352,8 +580,9 @@ func (s *MemoryStore) localCacheCleanup() {
 			s.local.Lock()
 			for key, item := range s.local.items {
 				if now.After(item.expiration) {
-					delete(s.local.items, key)
-					if strings.HasPrefix(key, "session:") || strings.HasPrefix(key, "oidc:session:") {
+					s.remove(key, item)
+					s.counters.evictions.Add(1)
+					if isSessionKey(key) {
 						needsPersist = true
 					}
 				}
@@ -384,3 +613,75 @@ func (s *MemoryStore) localCacheCleanup() {
 		}
 	}
 }
+
+// put stores an item and evicts the least recently used values while the
+// store is over its limits. The caller holds the local cache lock.
+func (s *MemoryStore) put(key string, item *localCacheItem) {
+	if old, exists := s.local.items[key]; exists {
+		s.remove(key, old)
+	}
+	s.local.items[key] = item
+	if isPinnedKey(key) {
+		return
+	}
+
+	item.element = s.lru.PushFront(key)
+	s.bytes += itemSize(key, item)
+	for s.limits.exceeded(s.lru.Len(), s.bytes) {
+		oldest := s.lru.Back().Value.(string)
+		s.remove(oldest, s.local.items[oldest])
+		s.counters.evictions.Add(1)
+	}
+}
+
+// remove drops an item. The caller holds the local cache lock.
+func (s *MemoryStore) remove(key string, item *localCacheItem) {
+	delete(s.local.items, key)
+	if item.element != nil {
+		s.lru.Remove(item.element)
+		s.bytes -= itemSize(key, item)
+		item.element = nil
+	}
+}
+
+// touch marks an item as the most recently used. The caller holds the
+// local cache lock.
+func (s *MemoryStore) touch(item *localCacheItem) {
+	if item.element != nil {
+		s.lru.MoveToFront(item.element)
+	}
+}
+
+// itemSize is the number of bytes an item counts against the limits
+func itemSize(key string, item *localCacheItem) int64 {
+	return int64(len(key) + len(item.value))
+}
+
+// isSessionKey reports whether a key holds a session, which is persisted
+// to disk
+func isSessionKey(key string) bool {
+	return strings.HasPrefix(key, "session:") || strings.HasPrefix(key, "oidc:session:")
+}
+
+// pinnedPrefixes are the keys of security and control state. Evicting them
+// would log users out, let a used TOTP code be replayed, fail logins that are
+// in progress or bring back invalidated responses, so the limits leave them
+// alone. Rate limit windows are kept apart from values and never evicted.
+var pinnedPrefixes = []string{
+	"session:",
+	"oidc:session:",
+	"oidc:state:",
+	"2fa:",
+	"webauthn:",
+	"response:generation:",
+}
+
+// isPinnedKey reports whether a key is exempt from the limits
+func isPinnedKey(key string) bool {
+	for _, prefix := range pinnedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
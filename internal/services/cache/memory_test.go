@@ -5,6 +5,7 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -214,3 +215,195 @@ func TestMemoryStorePersistence(t *testing.T) {
 		t.Errorf("Expected 'test_value', got '%v'", result)
 	}
 }
+
+func TestMemoryStoreBulkOperations(t *testing.T) {
+	store := NewMemoryStore(t.TempDir())
+	defer store.Close()
+
+	ctx := context.Background()
+
+	t.Run("GetMulti and SetMulti", func(t *testing.T) {
+		err := store.SetMulti(ctx, map[string]interface{}{
+			"bulk:a": 1,
+			"bulk:b": 2,
+		}, time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to set values: %v", err)
+		}
+
+		values, err := store.GetMulti(ctx, []string{"bulk:a", "bulk:b", "bulk:missing"})
+		if err != nil {
+			t.Fatalf("Failed to get values: %v", err)
+		}
+		if len(values) != 2 {
+			t.Fatalf("Expected 2 values, got %d", len(values))
+		}
+		if string(values["bulk:b"]) != "2" {
+			t.Errorf("Expected 2, got %s", values["bulk:b"])
+		}
+	})
+
+	t.Run("SetNX", func(t *testing.T) {
+		stored, err := store.SetNX(ctx, "claim:a", true, time.Minute)
+		if err != nil || !stored {
+			t.Fatalf("Expected first SetNX to store, got %v, %v", stored, err)
+		}
+		stored, err = store.SetNX(ctx, "claim:a", true, time.Minute)
+		if err != nil || stored {
+			t.Errorf("Expected second SetNX to be refused, got %v, %v", stored, err)
+		}
+
+		store.Set(ctx, "claim:expired", true, time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		stored, err = store.SetNX(ctx, "claim:expired", true, time.Minute)
+		if err != nil || !stored {
+			t.Errorf("Expected SetNX to replace an expired value, got %v, %v", stored, err)
+		}
+	})
+
+	t.Run("Keys and DeletePrefix", func(t *testing.T) {
+		store.Set(ctx, "purge:one", "value", time.Minute)
+		store.Set(ctx, "purge:two", "value", time.Minute)
+		store.Set(ctx, "keep:one", "value", time.Minute)
+		store.Increment(ctx, "purge:rate", time.Now().Unix())
+
+		keys, err := store.Keys(ctx, "purge:")
+		if err != nil {
+			t.Fatalf("Failed to list keys: %v", err)
+		}
+		if len(keys) != 3 {
+			t.Errorf("Expected 3 keys, got %v", keys)
+		}
+
+		deleted, err := store.DeletePrefix(ctx, "purge:")
+		if err != nil {
+			t.Fatalf("Failed to delete prefix: %v", err)
+		}
+		if deleted != 3 {
+			t.Errorf("Expected 3 deleted keys, got %d", deleted)
+		}
+
+		var result string
+		if err := store.Get(ctx, "purge:one", &result); err != ErrKeyNotFound {
+			t.Errorf("Expected ErrKeyNotFound after purge, got %v", err)
+		}
+		if err := store.Get(ctx, "keep:one", &result); err != nil {
+			t.Errorf("Expected other keys to be kept, got %v", err)
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		store := NewMemoryStore(t.TempDir())
+		defer store.Close()
+
+		store.Set(ctx, "stats:short", "value", 10*time.Millisecond)
+		store.Set(ctx, "stats:long", "value", time.Minute)
+
+		var result string
+		store.Get(ctx, "stats:long", &result)
+		store.Get(ctx, "stats:missing", &result)
+		time.Sleep(20 * time.Millisecond)
+		store.Get(ctx, "stats:short", &result)
+
+		stats, err := store.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		want := Stats{Backend: "memory", Hits: 1, Misses: 2, Evictions: 1, Size: 1}
+		if stats != want {
+			t.Errorf("Expected %+v, got %+v", want, stats)
+		}
+	})
+}
+
+func TestMemoryStoreLimits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Max Entries", func(t *testing.T) {
+		store := NewBoundedMemoryStore(t.TempDir(), Limits{MaxEntries: 2})
+		defer store.Close()
+
+		store.Set(ctx, "a", 1, time.Minute)
+		store.Set(ctx, "b", 2, time.Minute)
+
+		// Reading a makes b the least recently used
+		var result int
+		if err := store.Get(ctx, "a", &result); err != nil {
+			t.Fatalf("Failed to get value: %v", err)
+		}
+		store.Set(ctx, "c", 3, time.Minute)
+
+		if err := store.Get(ctx, "b", &result); err != ErrKeyNotFound {
+			t.Errorf("Expected the least recently used value to be evicted, got %v", err)
+		}
+		for _, key := range []string{"a", "c"} {
+			if err := store.Get(ctx, key, &result); err != nil {
+				t.Errorf("Expected %s to be kept, got %v", key, err)
+			}
+		}
+
+		// Sessions are not counted or evicted
+		store.Set(ctx, "session:one", "value", time.Minute)
+		store.Set(ctx, "session:two", "value", time.Minute)
+		var session string
+		if err := store.Get(ctx, "session:one", &session); err != nil {
+			t.Errorf("Expected sessions to be kept, got %v", err)
+		}
+		if err := store.Get(ctx, "a", &result); err != nil {
+			t.Errorf("Expected sessions not to evict values, got %v", err)
+		}
+
+		stats, _ := store.Stats(ctx)
+		if stats.Evictions != 1 {
+			t.Errorf("Expected 1 eviction, got %d", stats.Evictions)
+		}
+	})
+
+	t.Run("Pinned Keys", func(t *testing.T) {
+		store := NewBoundedMemoryStore(t.TempDir(), Limits{MaxEntries: 2, MaxBytes: 256})
+		defer store.Close()
+
+		if stored, err := store.SetNX(ctx, "2fa:used:1:123456", true, time.Minute); err != nil || !stored {
+			t.Fatalf("Failed to claim TOTP code: %v, %v", stored, err)
+		}
+		store.Set(ctx, "response:generation:/api/sonarr", 3, time.Minute)
+
+		// A flood of responses with varying queries only evicts responses
+		for i := 0; i < 100; i++ {
+			store.Set(ctx, fmt.Sprintf("response:/api/sonarr?page=%d", i), "0123456789", time.Minute)
+		}
+
+		if stored, err := store.SetNX(ctx, "2fa:used:1:123456", true, time.Minute); err != nil || stored {
+			t.Errorf("Expected the TOTP claim to be kept, got %v, %v", stored, err)
+		}
+		var generation int
+		if err := store.Get(ctx, "response:generation:/api/sonarr", &generation); err != nil || generation != 3 {
+			t.Errorf("Expected the generation counter to be kept, got %d, %v", generation, err)
+		}
+		stats, _ := store.Stats(ctx)
+		if stats.Evictions != 98 {
+			t.Errorf("Expected 98 evictions, got %d", stats.Evictions)
+		}
+	})
+
+	t.Run("Max Bytes", func(t *testing.T) {
+		store := NewBoundedMemoryStore(t.TempDir(), Limits{MaxBytes: 32})
+		defer store.Close()
+
+		// Each value takes 1 byte of key and 12 bytes of JSON
+		store.Set(ctx, "a", "0123456789", time.Minute)
+		store.Set(ctx, "b", "0123456789", time.Minute)
+		store.Set(ctx, "c", "0123456789", time.Minute)
+
+		var result string
+		if err := store.Get(ctx, "a", &result); err != ErrKeyNotFound {
+			t.Errorf("Expected the oldest value to be evicted, got %v", err)
+		}
+
+		// Replacing a value does not count it twice
+		store.Set(ctx, "c", "0123456789", time.Minute)
+		if err := store.Get(ctx, "b", &result); err != nil {
+			t.Errorf("Expected b to be kept, got %v", err)
+		}
+	})
+}
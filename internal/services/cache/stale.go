@@ -0,0 +1,118 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultStaleGrace is how long an expired value is still served while it
+// is refreshed in the background
+const DefaultStaleGrace = 2 * time.Minute
+
+// refreshing holds the keys being refreshed in the background, so a burst
+// of requests for an expired value refreshes it once
+var refreshing sync.Map
+
+// staleGraceKey holds the stale grace period of a request
+type staleGraceKey struct{}
+
+// WithStaleGrace returns a context under which Fetch serves expired values
+// for grace while they are refreshed. Zero or less turns stale values off.
+func WithStaleGrace(ctx context.Context, grace time.Duration) context.Context {
+	return context.WithValue(ctx, staleGraceKey{}, max(grace, 0))
+}
+
+// StaleGrace returns the stale grace period of ctx, DefaultStaleGrace
+// unless one was set with WithStaleGrace
+func StaleGrace(ctx context.Context) time.Duration {
+	if grace, ok := ctx.Value(staleGraceKey{}).(time.Duration); ok {
+		return grace
+	}
+	return DefaultStaleGrace
+}
+
+// noCacheKey marks a context whose request asked for a fresh response
+type noCacheKey struct{}
+
+// WithNoCache returns a context under which Fetch skips the cached value
+// and calls the upstream, caching its result for later requests
+func WithNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// NoCache reports whether ctx asks for a fresh value
+func NoCache(ctx context.Context) bool {
+	noCache, _ := ctx.Value(noCacheKey{}).(bool)
+	return noCache
+}
+
+// staleEntry is a cached value with the time it stops being fresh
+type staleEntry[T any] struct {
+	Value      T         `json:"value"`
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+// Fetch returns the value cached under key, calling fetch and caching its
+// result for ttl when there is none. Once the value is older than ttl it is
+// still returned for the stale grace period of ctx while a single
+// background fetch refreshes it, so only a cold cache waits for the
+// upstream. A context from WithNoCache always waits for the upstream.
+// Errors are not cached, and the value is still cached when ctx is
+// cancelled mid-fetch.
+func Fetch[T any](ctx context.Context, store Store, key string, ttl time.Duration, fetch func(context.Context) (T, error)) (T, error) {
+	ctx = context.WithoutCancel(ctx)
+	grace := StaleGrace(ctx)
+
+	var cached staleEntry[T]
+	if !NoCache(ctx) && store.Get(ctx, key, &cached) == nil {
+		if time.Now().Before(cached.FreshUntil) {
+			return cached.Value, nil
+		}
+		if grace > 0 {
+			revalidate(store, key, ttl, grace, fetch)
+			return cached.Value, nil
+		}
+	}
+
+	value, err := fetch(ctx)
+	if err != nil {
+		return value, err
+	}
+	storeFresh(ctx, store, key, ttl, grace, value)
+	return value, nil
+}
+
+// revalidate refreshes an expired value in the background unless a refresh
+// is already running
+func revalidate[T any](store Store, key string, ttl, grace time.Duration, fetch func(context.Context) (T, error)) {
+	if _, busy := refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+
+	go func() {
+		defer refreshing.Delete(key)
+
+		ctx := context.Background()
+		value, err := fetch(ctx)
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("Failed to refresh stale cache entry")
+			return
+		}
+		storeFresh(ctx, store, key, ttl, grace, value)
+	}()
+}
+
+// storeFresh caches a value that is fresh for ttl and kept for the stale
+// grace period after that
+func storeFresh[T any](ctx context.Context, store Store, key string, ttl, grace time.Duration, value T) {
+	entry := staleEntry[T]{Value: value, FreshUntil: time.Now().Add(ttl)}
+	if err := store.Set(ctx, key, entry, ttl+grace); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Failed to cache value")
+	}
+}
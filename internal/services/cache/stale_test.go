@@ -0,0 +1,137 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	store := NewMemoryStore(t.TempDir())
+	defer store.Close()
+
+	ctx := context.Background()
+	ttl := 50 * time.Millisecond
+
+	var calls atomic.Int32
+	fetch := func(context.Context) (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	t.Run("Fresh", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			value, err := Fetch(ctx, store, "fresh", time.Minute, fetch)
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if value != 1 {
+				t.Errorf("Expected the cached value 1, got %d", value)
+			}
+		}
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		calls.Store(0)
+		if _, err := Fetch(ctx, store, "stale", ttl, fetch); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		time.Sleep(2 * ttl)
+
+		// The expired value is served while it is refreshed once
+		for i := 0; i < 3; i++ {
+			value, err := Fetch(ctx, store, "stale", ttl, fetch)
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if value != 1 {
+				t.Errorf("Expected the stale value 1, got %d", value)
+			}
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			value, _ := Fetch(ctx, store, "stale", time.Minute, fetch)
+			if value == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the refreshed value 2, got %d", value)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if n := calls.Load(); n != 2 {
+			t.Errorf("Expected 2 fetches, got %d", n)
+		}
+	})
+
+	t.Run("NoStaleGrace", func(t *testing.T) {
+		calls.Store(0)
+		noGrace := WithStaleGrace(ctx, 0)
+		if _, err := Fetch(noGrace, store, "nograce", ttl, fetch); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		time.Sleep(2 * ttl)
+
+		// Without a grace period expired values are fetched again
+		value, err := Fetch(noGrace, store, "nograce", ttl, fetch)
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		if value != 2 {
+			t.Errorf("Expected the fresh value 2, got %d", value)
+		}
+	})
+
+	t.Run("NoCache", func(t *testing.T) {
+		calls.Store(0)
+		if _, err := Fetch(ctx, store, "nocache", time.Minute, fetch); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+
+		// A request asking for a fresh value skips the cached one and
+		// caches the fresh value for later requests
+		value, err := Fetch(WithNoCache(ctx), store, "nocache", time.Minute, fetch)
+		if err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+		if value != 2 {
+			t.Errorf("Expected the fresh value 2, got %d", value)
+		}
+		if value, _ := Fetch(ctx, store, "nocache", time.Minute, fetch); value != 2 {
+			t.Errorf("Expected the cached value 2, got %d", value)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		failure := errors.New("upstream down")
+		_, err := Fetch(ctx, store, "errors", ttl, func(context.Context) (int, error) {
+			return 0, failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Expected the fetch error, got %v", err)
+		}
+
+		var entry staleEntry[int]
+		if err := store.Get(ctx, "errors", &entry); err != ErrKeyNotFound {
+			t.Errorf("Expected errors not to be cached, got %v", err)
+		}
+	})
+}
+
+func TestStaleGrace(t *testing.T) {
+	ctx := context.Background()
+	if grace := StaleGrace(ctx); grace != DefaultStaleGrace {
+		t.Errorf("Expected the default grace, got %v", grace)
+	}
+	if grace := StaleGrace(WithStaleGrace(ctx, time.Minute)); grace != time.Minute {
+		t.Errorf("Expected a grace of 1m, got %v", grace)
+	}
+	if grace := StaleGrace(WithStaleGrace(ctx, -time.Second)); grace != 0 {
+		t.Errorf("Expected stale values to be off, got %v", grace)
+	}
+}
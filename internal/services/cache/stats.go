@@ -0,0 +1,33 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package cache
+
+import "sync/atomic"
+
+// counters track the hits, misses and evictions of a store
+type counters struct {
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// record counts a lookup as a hit or a miss
+func (c *counters) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// stats returns the counted values for a backend holding size keys
+func (c *counters) stats(backend string, size int64) Stats {
+	return Stats{
+		Backend:   backend,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+}
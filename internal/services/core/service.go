@@ -9,8 +9,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
@@ -25,10 +23,15 @@ var (
 	// Global HTTP client pool
 	httpClients sync.Map
 
+	// Cache shared by all services
+	sharedCache   cache.Store
+	sharedCacheMu sync.RWMutex
+
 	// Common errors
 	ErrServiceNotConfigured = errors.New("service is not configured")
 	ErrNilResponse          = errors.New("received nil response from server")
 	ErrContextCanceled      = errors.New("context canceled")
+	ErrCacheNotSet          = errors.New("no cache store was set with SetCache")
 )
 
 type ServiceCore struct {
@@ -64,40 +67,25 @@ func getHTTPClient(timeout time.Duration) *http.Client {
 	return client
 }
 
+// SetCache sets the store services keep version lookups in. It is called
+// once at startup with the application cache, by the server and by the
+// command executor alike.
+func SetCache(store cache.Store) {
+	sharedCacheMu.Lock()
+	defer sharedCacheMu.Unlock()
+	sharedCache = store
+}
+
 func (s *ServiceCore) initCache() error {
 	if s.cache != nil {
 		return nil
 	}
 
-	// Get database directory from environment
-	dataDir := filepath.Dir(os.Getenv("DASHBRR__DB_PATH"))
-	if dataDir == "." {
-		dataDir = "./data" // Default to ./data if not set
-	}
-
-	// Initialize cache config
-	cfg := cache.Config{
-		DataDir: dataDir,
-	}
-
-	// Add Redis configuration if available
-	if host := os.Getenv("REDIS_HOST"); host != "" {
-		port := os.Getenv("REDIS_PORT")
-		if port == "" {
-			port = "6379"
-		}
-		cfg.RedisAddr = host + ":" + port
-	}
-
-	// Initialize cache using the cache package's initialization logic
-	store, err := cache.InitCache(cfg)
-	if err != nil {
-		// If initialization fails, we'll still get a memory cache from InitCache
-		// We can continue with the memory cache but should return the error
-		// for logging purposes
-		s.cache = store
-		log.Warn().Err(err).Msg("Failed to initialize preferred cache, using memory cache")
-		return err
+	sharedCacheMu.RLock()
+	store := sharedCache
+	sharedCacheMu.RUnlock()
+	if store == nil {
+		return ErrCacheNotSet
 	}
 
 	s.cache = store
@@ -16,7 +16,13 @@ import (
 
 var serviceRegistry = models.NewServiceRegistry()
 
+// DefaultCheckInterval is how often services are checked unless configured
+const DefaultCheckInterval = 30 * time.Second
+
 type HealthService struct {
+	// CheckInterval is how often monitored services are checked
+	CheckInterval time.Duration
+
 	mu                sync.RWMutex
 	monitoredServices map[string]context.CancelFunc
 	healthChecks      map[string]*HealthCheck
@@ -33,6 +39,7 @@ type HealthCheck struct {
 
 func NewHealthService() *HealthService {
 	return &HealthService{
+		CheckInterval:     DefaultCheckInterval,
 		monitoredServices: make(map[string]context.CancelFunc),
 		healthChecks:      make(map[string]*HealthCheck),
 	}
@@ -94,7 +101,7 @@ func (h *HealthService) StartMonitoring(instanceID string, checkFn func(context.
 
 	// Start monitoring in a goroutine
 	go func() {
-		ticker := time.NewTicker(30 * time.Second)
+		ticker := time.NewTicker(h.CheckInterval)
 		defer ticker.Stop()
 
 		for {
@@ -0,0 +1,246 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package ldap authenticates users against an LDAP directory such as
+// LLDAP, OpenLDAP or Active Directory
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// Defaults match LLDAP and most OpenLDAP setups
+const (
+	DefaultUserFilter         = "(&(objectClass=person)(uid={username}))"
+	DefaultUsernameAttribute  = "uid"
+	DefaultEmailAttribute     = "mail"
+	DefaultGroupFilter        = "(|(member={dn})(uniqueMember={dn}))"
+	DefaultGroupNameAttribute = "cn"
+
+	timeout = 10 * time.Second
+)
+
+var (
+	// ErrUserNotFound is returned when no directory entry matches the login
+	ErrUserNotFound = errors.New("ldap: user not found")
+	// ErrInvalidCredentials is returned when the user's bind fails
+	ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+)
+
+// User is a directory user that passed authentication
+type User struct {
+	DN       string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// Authenticator verifies passwords by binding as the user
+type Authenticator struct {
+	config types.LDAPConfig
+}
+
+// New creates an authenticator, filling in defaults for unset attributes
+// and filters
+func New(config types.LDAPConfig) *Authenticator {
+	if config.UserFilter == "" {
+		config.UserFilter = DefaultUserFilter
+	}
+	if config.UsernameAttribute == "" {
+		config.UsernameAttribute = DefaultUsernameAttribute
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = DefaultEmailAttribute
+	}
+	if config.GroupBaseDN == "" {
+		config.GroupBaseDN = config.BaseDN
+	}
+	if config.GroupFilter == "" {
+		config.GroupFilter = DefaultGroupFilter
+	}
+	if config.GroupNameAttribute == "" {
+		config.GroupNameAttribute = DefaultGroupNameAttribute
+	}
+	return &Authenticator{config: config}
+}
+
+// RoleMapping returns how directory groups map to roles
+func (a *Authenticator) RoleMapping() types.GroupRoleMapping {
+	return a.config.GroupRoleMapping
+}
+
+// Authenticate looks the user up with the service account, verifies the
+// password by binding as the user and collects the user's groups
+func (a *Authenticator) Authenticate(username, password string) (*User, error) {
+	// An empty password would be an unauthenticated bind, which many
+	// servers accept for any DN (RFC 4513 5.1.2)
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := a.bindServiceAccount(conn); err != nil {
+		return nil, err
+	}
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap: user bind failed: %w", err)
+	}
+
+	user := &User{
+		DN:       entry.DN,
+		Username: entry.GetAttributeValue(a.config.UsernameAttribute),
+		Email:    entry.GetAttributeValue(a.config.EmailAttribute),
+	}
+	if user.Username == "" {
+		user.Username = username
+	}
+
+	// Groups are searched with the service account, which usually has
+	// wider read access than the user
+	if err := a.bindServiceAccount(conn); err != nil {
+		return nil, err
+	}
+	user.Groups, err = a.findGroups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// connect dials the directory, upgrading to TLS when configured
+func (a *Authenticator) connect() (*goldap.Conn, error) {
+	u, err := url.Parse(a.config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: a.config.InsecureSkipVerify, // opt-in for self-signed directories
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	conn, err := goldap.DialURL(a.config.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		goldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to connect: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if a.config.StartTLS && u.Scheme != "ldaps" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (a *Authenticator) bindServiceAccount(conn *goldap.Conn) error {
+	if a.config.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return fmt.Errorf("ldap: service account bind failed: %w", err)
+	}
+	return nil
+}
+
+func (a *Authenticator) findUser(conn *goldap.Conn, username string) (*goldap.Entry, error) {
+	filter := strings.ReplaceAll(a.config.UserFilter, "{username}", goldap.EscapeFilter(username))
+
+	result, err := conn.Search(goldap.NewSearchRequest(
+		a.config.BaseDN,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, int(timeout.Seconds()), false,
+		filter,
+		[]string{"dn", a.config.UsernameAttribute, a.config.EmailAttribute, "memberOf"},
+		nil,
+	))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap: user search failed: %w", err)
+	}
+
+	switch {
+	case result == nil || len(result.Entries) == 0:
+		return nil, ErrUserNotFound
+	case len(result.Entries) > 1:
+		return nil, fmt.Errorf("ldap: user filter matched more than one entry for %q", username)
+	}
+	return result.Entries[0], nil
+}
+
+// findGroups returns the names of the user's groups, from memberOf when
+// the directory provides it and from a group search
+func (a *Authenticator) findGroups(conn *goldap.Conn, entry *goldap.Entry) ([]string, error) {
+	var groups []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			groups = append(groups, name)
+		}
+	}
+
+	for _, dn := range entry.GetAttributeValues("memberOf") {
+		add(firstRDNValue(dn))
+	}
+
+	filter := strings.NewReplacer(
+		"{dn}", goldap.EscapeFilter(entry.DN),
+		"{username}", goldap.EscapeFilter(entry.GetAttributeValue(a.config.UsernameAttribute)),
+	).Replace(a.config.GroupFilter)
+
+	result, err := conn.Search(goldap.NewSearchRequest(
+		a.config.GroupBaseDN,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		0, int(timeout.Seconds()), false,
+		filter,
+		[]string{a.config.GroupNameAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: group search failed: %w", err)
+	}
+	for _, group := range result.Entries {
+		add(group.GetAttributeValue(a.config.GroupNameAttribute))
+	}
+
+	return groups, nil
+}
+
+// firstRDNValue returns "admins" for "cn=admins,ou=groups,dc=example,dc=com"
+func firstRDNValue(dn string) string {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return ""
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
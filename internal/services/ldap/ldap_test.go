@@ -0,0 +1,107 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package ldap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/autobrr/dashbrr/internal/services/ldap"
+	"github.com/autobrr/dashbrr/internal/services/ldap/ldaptest"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// newDirectory returns an LLDAP-like directory with a service account,
+// two users and two groups
+func newDirectory(t *testing.T) *ldaptest.Server {
+	server := ldaptest.NewServer(t)
+	server.AddEntry("uid=admin,ou=people,dc=example,dc=com", "service-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"admin"},
+	})
+	server.AddEntry("uid=alice,ou=people,dc=example,dc=com", "alice-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"alice"},
+		"mail":        {"alice@example.com"},
+		"memberOf":    {"cn=media,ou=groups,dc=example,dc=com"},
+	})
+	server.AddEntry("uid=bob*,ou=people,dc=example,dc=com", "bob-secret", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob*"},
+	})
+	server.AddEntry("cn=dashbrr-admins,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"objectClass": {"groupOfUniqueNames"},
+		"cn":          {"dashbrr-admins"},
+		"member":      {"uid=alice,ou=people,dc=example,dc=com"},
+	})
+	return server
+}
+
+func newAuthenticator(server *ldaptest.Server, startTLS bool) *ldap.Authenticator {
+	return ldap.New(types.LDAPConfig{
+		URL:                server.URL,
+		StartTLS:           startTLS,
+		InsecureSkipVerify: true,
+		BindDN:             "uid=admin,ou=people,dc=example,dc=com",
+		BindPassword:       "service-secret",
+		BaseDN:             "dc=example,dc=com",
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := newDirectory(t)
+
+	for _, startTLS := range []bool{false, true} {
+		auth := newAuthenticator(server, startTLS)
+
+		user, err := auth.Authenticate("alice", "alice-secret")
+		if err != nil {
+			t.Fatalf("startTLS=%v: Authenticate failed: %v", startTLS, err)
+		}
+		if user.Username != "alice" || user.Email != "alice@example.com" {
+			t.Errorf("Unexpected user %+v", user)
+		}
+		if len(user.Groups) != 2 || user.Groups[0] != "media" || user.Groups[1] != "dashbrr-admins" {
+			t.Errorf("Unexpected groups %v", user.Groups)
+		}
+	}
+}
+
+func TestAuthenticate_Failures(t *testing.T) {
+	server := newDirectory(t)
+	auth := newAuthenticator(server, false)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     error
+	}{
+		{"wrong password", "alice", "wrong", ldap.ErrInvalidCredentials},
+		{"empty password", "alice", "", ldap.ErrInvalidCredentials},
+		{"unknown user", "carol", "secret", ldap.ErrUserNotFound},
+		// The wildcard must be escaped, not expanded
+		{"filter injection", "*", "alice-secret", ldap.ErrUserNotFound},
+		{"group entry", "dashbrr-admins", "x", ldap.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.Authenticate(tt.username, tt.password)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Special characters in a real username still work when escaped
+	if _, err := auth.Authenticate("bob*", "bob-secret"); err != nil {
+		t.Errorf("Expected escaped username to authenticate, got %v", err)
+	}
+
+	// A bad service account is a configuration error, not a failed login
+	broken := ldap.New(types.LDAPConfig{URL: server.URL, BindDN: "uid=admin,ou=people,dc=example,dc=com", BindPassword: "wrong", BaseDN: "dc=example,dc=com"})
+	if _, err := broken.Authenticate("alice", "alice-secret"); err == nil || errors.Is(err, ldap.ErrInvalidCredentials) {
+		t.Errorf("Expected service account error, got %v", err)
+	}
+}
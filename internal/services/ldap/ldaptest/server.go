@@ -0,0 +1,327 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package ldaptest provides a minimal in-process LDAP directory for tests
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP protocol operations and result codes used by the server (RFC 4511)
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+
+	resultSuccess                 = 0
+	resultProtocolError           = 2
+	resultInvalidCredentials      = 49
+	resultInsufficientAccessRight = 50
+
+	startTLSOID = "1.3.6.1.4.1.1466.20037"
+)
+
+// Entry is a directory entry
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Server is a stand-in directory supporting simple binds, subtree searches
+// with and/or/not/equality/presence filters, and StartTLS
+type Server struct {
+	// URL is the ldap:// address of the server
+	URL string
+
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	mu        sync.Mutex
+	entries   []Entry
+	passwords map[string]string
+	conns     map[net.Conn]struct{}
+}
+
+// NewServer starts a directory that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &Server{
+		URL:       "ldap://" + listener.Addr().String(),
+		listener:  listener,
+		tlsConfig: selfSignedTLSConfig(t),
+		passwords: make(map[string]string),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	go s.accept()
+	t.Cleanup(s.close)
+
+	return s
+}
+
+// AddEntry adds an entry. Entries with a password can bind.
+func (s *Server) AddEntry(dn, password string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, Entry{DN: dn, Attributes: attributes})
+	if password != "" {
+		s.passwords[strings.ToLower(dn)] = password
+	}
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) close() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	var boundDN string
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			if len(op.Children) < 3 {
+				writeResult(conn, id, opBindResponse, resultProtocolError)
+				continue
+			}
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			if s.checkPassword(dn, password) {
+				boundDN = dn
+				writeResult(conn, id, opBindResponse, resultSuccess)
+			} else {
+				boundDN = ""
+				writeResult(conn, id, opBindResponse, resultInvalidCredentials)
+			}
+
+		case opSearchRequest:
+			if boundDN == "" {
+				writeResult(conn, id, opSearchResultDone, resultInsufficientAccessRight)
+				continue
+			}
+			s.search(conn, id, op)
+
+		case opExtendedRequest:
+			if len(op.Children) > 0 && op.Children[0].Data.String() == startTLSOID {
+				writeResult(conn, id, opExtendedResponse, resultSuccess)
+				tlsConn := tls.Server(conn, s.tlsConfig)
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				conn = tlsConn
+				continue
+			}
+			writeResult(conn, id, opExtendedResponse, resultProtocolError)
+
+		case opUnbindRequest:
+			return
+
+		default:
+			return
+		}
+	}
+}
+
+func (s *Server) checkPassword(dn, password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expected, ok := s.passwords[strings.ToLower(dn)]
+	return ok && password != "" && password == expected
+}
+
+func (s *Server) search(conn net.Conn, id interface{}, op *ber.Packet) {
+	if len(op.Children) < 8 {
+		writeResult(conn, id, opSearchResultDone, resultProtocolError)
+		return
+	}
+	baseDN := strings.ToLower(op.Children[0].Data.String())
+	filter := op.Children[6]
+
+	var requested []string
+	for _, attr := range op.Children[7].Children {
+		requested = append(requested, attr.Data.String())
+	}
+
+	s.mu.Lock()
+	entries := append([]Entry(nil), s.entries...)
+	s.mu.Unlock()
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(strings.ToLower(entry.DN), baseDN) || !matches(filter, entry) {
+			continue
+		}
+		writeMessage(conn, id, encodeEntry(entry, requested))
+	}
+	writeResult(conn, id, opSearchResultDone, resultSuccess)
+}
+
+// matches evaluates an LDAP filter against an entry
+func matches(filter *ber.Packet, entry Entry) bool {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if !matches(child, entry) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range filter.Children {
+			if matches(child, entry) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return len(filter.Children) == 1 && !matches(filter.Children[0], entry)
+	case 3: // equalityMatch
+		if len(filter.Children) != 2 {
+			return false
+		}
+		want := filter.Children[1].Data.String()
+		for _, value := range attributeValues(entry, filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, want) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		return len(attributeValues(entry, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func attributeValues(entry Entry, name string) []string {
+	for attr, values := range entry.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func encodeEntry(entry Entry, requested []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "SearchResultEntry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+
+	attributes := ber.NewSequence("attributes")
+	for name, values := range entry.Attributes {
+		if len(requested) > 0 && !containsFold(requested, name) {
+			continue
+		}
+		attr := ber.NewSequence("attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attr.AppendChild(set)
+		attributes.AppendChild(attr)
+	}
+	op.AppendChild(attributes)
+	return op
+}
+
+func writeResult(conn net.Conn, id interface{}, tag ber.Tag, code int64) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "LDAPResult")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	writeMessage(conn, id, op)
+}
+
+func writeMessage(conn net.Conn, id interface{}, op *ber.Packet) {
+	message := ber.NewSequence("LDAPMessage")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "messageID"))
+	message.AppendChild(op)
+	_, _ = conn.Write(message.Bytes())
+}
+
+func containsFold(values []string, want string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfSignedTLSConfig returns a server certificate for 127.0.0.1
+func selfSignedTLSConfig(t testing.TB) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ldaptest"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package lockout slows down and stops password guessing against a
+// username, independent of the client IP
+package lockout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+const (
+	DefaultThreshold = 10
+	DefaultDuration  = 15 * time.Minute
+
+	// backoffStart is the number of failures allowed before delays begin.
+	// From there the delay doubles with every failure, up to maxBackoff.
+	backoffStart = 3
+	maxBackoff   = time.Minute
+
+	webhookTimeout = 10 * time.Second
+
+	// purgeInterval is how often failures that no longer count are removed
+	purgeInterval = time.Minute
+)
+
+// Guard tracks failed logins per username
+type Guard struct {
+	db     *database.DB
+	client *http.Client
+
+	mu     sync.RWMutex
+	config types.LockoutConfig
+
+	purgeMu   sync.Mutex
+	lastPurge time.Time
+}
+
+// New creates a guard, filling in defaults for unset values
+func New(db *database.DB, config types.LockoutConfig) *Guard {
+	g := &Guard{
+		db:     db,
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+	g.SetConfig(config)
+	return g
+}
+
+// SetConfig replaces the settings of the guard, filling in defaults for
+// unset values
+func (g *Guard) SetConfig(config types.LockoutConfig) {
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultThreshold
+	}
+	if config.Duration <= 0 {
+		config.Duration = DefaultDuration
+	}
+
+	g.mu.Lock()
+	g.config = config
+	g.mu.Unlock()
+}
+
+// settings returns the current settings of the guard
+func (g *Guard) settings() types.LockoutConfig {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.config
+}
+
+// RetryAfter returns how long the username has to wait before the next
+// login attempt, or zero when it may try now
+func (g *Guard) RetryAfter(username string) (time.Duration, error) {
+	lockout, err := g.db.GetLoginLockout(username)
+	if err != nil || lockout == nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	if lockout.Locked() {
+		return lockout.LockedUntil.Sub(now), nil
+	}
+	if !lockout.LockedUntil.IsZero() || g.stale(lockout, now) {
+		return 0, nil
+	}
+	if wait := lockout.LastFailureAt.Add(backoff(lockout.Failures)).Sub(now); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed login from ip. It reports whether this failure
+// locked the username.
+func (g *Guard) Fail(username, ip string) (*types.LoginLockout, bool, error) {
+	config := g.settings()
+	now := time.Now()
+	lockout, err := g.db.RecordLoginFailure(username, ip, now, config.Threshold, config.Duration)
+	if err != nil {
+		return nil, false, err
+	}
+	g.purge(now, config.Duration)
+
+	// The count is updated atomically, so exactly one of several concurrent
+	// failures reaches the threshold and locks the username
+	locked := lockout.Locked() && lockout.Failures == config.Threshold
+	if locked {
+		g.notify(lockout)
+	}
+	return lockout, locked, nil
+}
+
+// Reset clears the failures of a username after a successful login
+func (g *Guard) Reset(username string) error {
+	_, err := g.db.DeleteLoginLockout(username)
+	return err
+}
+
+// purge removes the failures that are too old to count, at most once per
+// purgeInterval. Failed logins for usernames that do not exist would
+// otherwise stay in the database forever.
+func (g *Guard) purge(now time.Time, duration time.Duration) {
+	g.purgeMu.Lock()
+	if now.Sub(g.lastPurge) < purgeInterval {
+		g.purgeMu.Unlock()
+		return
+	}
+	g.lastPurge = now
+	g.purgeMu.Unlock()
+
+	removed, err := g.db.DeleteStaleLoginLockouts(now.Add(-duration), now)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to remove old failed logins")
+		return
+	}
+	if removed > 0 {
+		log.Debug().Int64("removed", removed).Msg("removed old failed logins")
+	}
+}
+
+// stale reports whether the last failure is too long ago to count
+func (g *Guard) stale(lockout *types.LoginLockout, now time.Time) bool {
+	return now.Sub(lockout.LastFailureAt) > g.settings().Duration
+}
+
+// backoff returns the delay enforced after a number of failures
+func backoff(failures int) time.Duration {
+	if failures < backoffStart {
+		return 0
+	}
+	delay := time.Second << min(failures-backoffStart, 6)
+	return min(delay, maxBackoff)
+}
+
+// notify reports a lockout in the log and, when configured, to a webhook
+func (g *Guard) notify(lockout *types.LoginLockout) {
+	log.Warn().
+		Str("username", lockout.Username).
+		Str("ip", lockout.LastIP).
+		Int("failures", lockout.Failures).
+		Time("locked_until", lockout.LockedUntil).
+		Msg("account locked after repeated failed logins")
+
+	webhookURL := g.settings().WebhookURL
+	if webhookURL == "" {
+		return
+	}
+
+	// The content field lets chat webhooks such as Discord show the message
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":        "auth.lockout",
+		"username":     lockout.Username,
+		"ip":           lockout.LastIP,
+		"failures":     lockout.Failures,
+		"locked_until": lockout.LockedUntil,
+		"content": fmt.Sprintf("Dashbrr: login for %q locked until %s after %d failed attempts (last from %s)",
+			lockout.Username, lockout.LockedUntil.Format(time.RFC3339), lockout.Failures, lockout.LastIP),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to encode lockout notification")
+		return
+	}
+
+	go func() {
+		resp, err := g.client.Post(webhookURL, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			log.Error().Err(err).Msg("failed to send lockout notification")
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			log.Error().Int("status", resp.StatusCode).Msg("lockout notification was rejected")
+		}
+	}()
+}
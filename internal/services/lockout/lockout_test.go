@@ -0,0 +1,179 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package lockout
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Zero(t, backoff(1))
+	assert.Zero(t, backoff(2))
+	assert.Equal(t, time.Second, backoff(3))
+	assert.Equal(t, 2*time.Second, backoff(4))
+	assert.Equal(t, 32*time.Second, backoff(8))
+	assert.Equal(t, maxBackoff, backoff(9))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
+
+func TestGuard(t *testing.T) {
+	db := setupTestDB(t)
+
+	notified := make(chan map[string]interface{}, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		notified <- payload
+	}))
+	t.Cleanup(webhook.Close)
+
+	guard := New(db, types.LockoutConfig{Threshold: 4, Duration: time.Hour, WebhookURL: webhook.URL})
+
+	// The first failures are free, then delays grow
+	for i := 1; i <= 2; i++ {
+		_, locked, err := guard.Fail("Alice", "192.0.2.1")
+		require.NoError(t, err)
+		assert.False(t, locked)
+	}
+	wait, err := guard.RetryAfter("alice")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	state, locked, err := guard.Fail("alice", "192.0.2.2")
+	require.NoError(t, err)
+	assert.False(t, locked)
+	assert.Equal(t, 3, state.Failures)
+	wait, err = guard.RetryAfter("ALICE")
+	require.NoError(t, err)
+	assert.Greater(t, wait, time.Duration(0))
+	assert.LessOrEqual(t, wait, time.Second)
+
+	// Reaching the threshold locks the username and sends a notification
+	state, locked, err = guard.Fail("alice", "192.0.2.3")
+	require.NoError(t, err)
+	assert.True(t, locked)
+	assert.True(t, state.Locked())
+	wait, err = guard.RetryAfter("alice")
+	require.NoError(t, err)
+	assert.Greater(t, wait, 59*time.Minute)
+
+	select {
+	case payload := <-notified:
+		assert.Equal(t, "auth.lockout", payload["event"])
+		assert.Equal(t, "alice", payload["username"])
+		assert.Equal(t, "192.0.2.3", payload["ip"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a lockout notification")
+	}
+
+	// Other usernames are unaffected and a reset clears the lockout
+	wait, err = guard.RetryAfter("bob")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	require.NoError(t, guard.Reset("alice"))
+	wait, err = guard.RetryAfter("alice")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestGuard_ForgetsOldFailures(t *testing.T) {
+	db := setupTestDB(t)
+	guard := New(db, types.LockoutConfig{Threshold: 3, Duration: time.Minute})
+
+	// Two failures from before the lockout window
+	for i := 0; i < 2; i++ {
+		_, err := db.RecordLoginFailure("alice", "192.0.2.1", time.Now().Add(-2*time.Minute), 3, time.Minute)
+		require.NoError(t, err)
+	}
+
+	state, locked, err := guard.Fail("alice", "192.0.2.1")
+	require.NoError(t, err)
+	assert.False(t, locked)
+	assert.Equal(t, 1, state.Failures)
+}
+
+func TestGuard_PurgesOldFailures(t *testing.T) {
+	db := setupTestDB(t)
+	guard := New(db, types.LockoutConfig{Threshold: 1, Duration: time.Minute})
+
+	// Sprayed usernames that failed before the window, one of them still
+	// locked from a longer lockout
+	for _, username := range []string{"ghost1", "ghost2"} {
+		_, err := db.RecordLoginFailure(username, "192.0.2.1", time.Now().Add(-2*time.Minute), 3, time.Minute)
+		require.NoError(t, err)
+	}
+	_, err := db.RecordLoginFailure("locked", "192.0.2.1", time.Now().Add(-2*time.Minute), 1, time.Hour)
+	require.NoError(t, err)
+
+	_, _, err = guard.Fail("alice", "192.0.2.1")
+	require.NoError(t, err)
+
+	for _, username := range []string{"ghost1", "ghost2"} {
+		state, err := db.GetLoginLockout(username)
+		require.NoError(t, err)
+		assert.Nil(t, state, username)
+	}
+	for _, username := range []string{"locked", "alice"} {
+		state, err := db.GetLoginLockout(username)
+		require.NoError(t, err)
+		assert.NotNil(t, state, username)
+	}
+}
+
+func TestGuard_ConcurrentFailures(t *testing.T) {
+	db := setupTestDB(t)
+	guard := New(db, types.LockoutConfig{Threshold: 5, Duration: time.Hour})
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	var locks atomic.Int32
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, locked, err := guard.Fail("alice", "192.0.2.1")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if locked {
+				locks.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Every failure is counted and exactly one of them locks the username
+	state, err := db.GetLoginLockout("alice")
+	require.NoError(t, err)
+	assert.Equal(t, attempts, state.Failures)
+	assert.True(t, state.Locked())
+	assert.Equal(t, int32(1), locks.Load())
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is the tolerance applied to exp, nbf and iat
+const clockSkew = 2 * time.Minute
+
+// ErrInvalidToken is wrapped by every ID token validation failure
+var ErrInvalidToken = errors.New("invalid id_token")
+
+// IDToken holds a validated ID token
+type IDToken struct {
+	Subject string
+	Expiry  time.Time
+	Claims  map[string]interface{}
+}
+
+// VerifyOptions controls ID token validation
+type VerifyOptions struct {
+	ClientID string
+	Nonce    string           // expected nonce; required
+	Now      func() time.Time // defaults to time.Now
+}
+
+// Verify checks the signature of an ID token against the provider's JWKS
+// and validates issuer, audience, expiry and nonce (OIDC Core 3.1.3.7)
+func (p *Provider) Verify(ctx context.Context, rawIDToken string, opts VerifyOptions) (*IDToken, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad payload: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	if opts.Now != nil {
+		now = opts.Now()
+	}
+	if err := p.validateClaims(claims, opts, now); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	exp, _ := numericDate(claims, "exp")
+	sub, _ := claims["sub"].(string)
+	return &IDToken{
+		Subject: sub,
+		Expiry:  exp,
+		Claims:  claims,
+	}, nil
+}
+
+func (p *Provider) validateClaims(claims map[string]interface{}, opts VerifyOptions, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return fmt.Errorf("issuer %q does not match %q", iss, p.Issuer)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return errors.New("missing subject")
+	}
+
+	audiences := stringList(claims["aud"])
+	if !contains(audiences, opts.ClientID) {
+		return fmt.Errorf("audience %v does not include client %q", audiences, opts.ClientID)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != opts.ClientID {
+		return fmt.Errorf("authorized party %q is not client %q", azp, opts.ClientID)
+	}
+
+	exp, ok := numericDate(claims, "exp")
+	if !ok {
+		return errors.New("missing expiry")
+	}
+	if now.After(exp.Add(clockSkew)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericDate(claims, "nbf"); ok && now.Add(clockSkew).Before(nbf) {
+		return errors.New("token not yet valid")
+	}
+	if iat, ok := numericDate(claims, "iat"); ok && now.Add(clockSkew).Before(iat) {
+		return errors.New("token issued in the future")
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	if opts.Nonce == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(opts.Nonce)) != 1 {
+		return errors.New("nonce mismatch")
+	}
+	return nil
+}
+
+// verifySignature checks a JWS signature. The algorithm must match the key
+// type, which rules out "none" and RSA/HMAC confusion.
+func verifySignature(alg string, key interface{}, signingInput string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[0] {
+		case 'R':
+			return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+		case 'P':
+			return rsa.VerifyPSS(k, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid ECDSA signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("algorithm %q does not match key type", alg)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// numericDate reads a JWT NumericDate claim
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// stringList reads a claim that may be a single string or an array of strings
+func stringList(v interface{}) []string {
+	switch value := v.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package oidc implements the parts of OpenID Connect dashbrr relies on:
+// provider discovery, JWKS handling and ID token validation. PKCE comes
+// from golang.org/x/oauth2.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// jwksRefreshInterval limits how often an unknown key ID triggers a JWKS
+	// refetch, so forged tokens cannot be used to hammer the provider
+	jwksRefreshInterval = time.Minute
+)
+
+// Provider holds the endpoints and signing keys of an OpenID provider
+type Provider struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserInfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	EndSessionEndpoint    string   `json:"end_session_endpoint"`
+	SigningAlgorithms     []string `json:"id_token_signing_alg_values_supported"`
+
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// Discover loads the provider configuration from the issuer's
+// .well-known/openid-configuration document
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	issuer = strings.TrimRight(issuer, "/")
+
+	var provider Provider
+	if err := getJSON(ctx, client, issuer+discoveryPath, &provider); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+
+	// The issuer in the document must match the configured one exactly,
+	// otherwise tokens from another tenant could be accepted (OIDC Discovery 4.3)
+	if strings.TrimRight(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match configured issuer %q", provider.Issuer, issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: provider metadata is missing required endpoints")
+	}
+
+	provider.client = client
+	return &provider, nil
+}
+
+// key returns the verification key for a key ID, refreshing the JWKS when
+// the key is unknown (providers rotate keys)
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.RLock()
+	key, ok := p.lookupKey(kid)
+	stale := time.Since(p.keysFetched) > jwksRefreshInterval
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Another request may have refreshed the keys while we waited
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) > jwksRefreshInterval {
+		keys, err := fetchJWKS(ctx, p.client, p.JWKSURI)
+		p.keysFetched = time.Now()
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+	}
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by ID. Tokens without a key ID are accepted only
+// when the provider publishes a single key. Callers must hold p.mu.
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" {
+		if len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key, true
+			}
+		}
+		return nil, false
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// getJSON fetches url and decodes its JSON body into v
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
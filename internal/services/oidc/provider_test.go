@@ -0,0 +1,109 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autobrr/dashbrr/internal/services/oidc"
+	"github.com/autobrr/dashbrr/internal/services/oidc/oidctest"
+)
+
+func TestDiscover(t *testing.T) {
+	idp := oidctest.NewServer(t, "dashbrr", "secret")
+
+	provider, err := oidc.Discover(context.Background(), nil, idp.Issuer()+"/")
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if provider.TokenEndpoint != idp.URL+"/token" {
+		t.Errorf("Unexpected token endpoint %s", provider.TokenEndpoint)
+	}
+
+	if _, err := oidc.Discover(context.Background(), nil, idp.URL+"/other"); err == nil {
+		t.Error("Expected discovery against an unknown path to fail")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	idp := oidctest.NewServer(t, "dashbrr", "secret")
+	provider, err := oidc.Discover(context.Background(), nil, idp.Issuer())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	opts := oidc.VerifyOptions{ClientID: "dashbrr", Nonce: "nonce-1"}
+
+	valid := idp.SignIDToken(idp.IDTokenClaims("nonce-1"))
+	token, err := provider.Verify(context.Background(), valid, opts)
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	if token.Subject != "user-1" {
+		t.Errorf("Expected subject user-1, got %s", token.Subject)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(map[string]interface{})
+	}{
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "someone-else" }},
+		{"wrong azp", func(c map[string]interface{}) { c["aud"] = []string{"dashbrr", "other"}; c["azp"] = "other" }},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"wrong nonce", func(c map[string]interface{}) { c["nonce"] = "replayed" }},
+		{"missing subject", func(c map[string]interface{}) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.IDTokenClaims("nonce-1")
+			tt.mutate(claims)
+			_, err := provider.Verify(context.Background(), idp.SignIDToken(claims), opts)
+			if !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+
+	t.Run("tampered payload", func(t *testing.T) {
+		parts := strings.Split(valid, ".")
+		other := strings.Split(idp.SignIDToken(idp.IDTokenClaims("nonce-2")), ".")
+		forged := parts[0] + "." + other[1] + "." + parts[2]
+		if _, err := provider.Verify(context.Background(), forged, oidc.VerifyOptions{ClientID: "dashbrr", Nonce: "nonce-2"}); err == nil {
+			t.Error("Expected tampered token to be rejected")
+		}
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		parts := strings.Split(valid, ".")
+		unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+		if _, err := provider.Verify(context.Background(), unsigned, opts); err == nil {
+			t.Error("Expected unsigned token to be rejected")
+		}
+	})
+}
+
+func TestVerifyAfterKeyRotation(t *testing.T) {
+	idp := oidctest.NewServer(t, "dashbrr", "secret")
+	provider, err := oidc.Discover(context.Background(), nil, idp.Issuer())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	opts := oidc.VerifyOptions{ClientID: "dashbrr", Nonce: "n"}
+
+	// Load the initial key set
+	if _, err := provider.Verify(context.Background(), idp.SignIDToken(idp.IDTokenClaims("n")), opts); err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+
+	// A rotated key is picked up once the refresh interval has passed; right
+	// after a fetch, unknown keys are rejected without hitting the provider
+	idp.RotateKey(t, "rotated")
+	if _, err := provider.Verify(context.Background(), idp.SignIDToken(idp.IDTokenClaims("n")), opts); err == nil {
+		t.Error("Expected unknown key to be rejected within the refresh interval")
+	}
+}
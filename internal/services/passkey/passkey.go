@@ -0,0 +1,229 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package passkey registers WebAuthn credentials for local accounts and
+// uses them for passwordless logins
+package passkey
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+// DefaultDisplayName is shown by authenticators when none is configured
+const DefaultDisplayName = "Dashbrr"
+
+var (
+	// ErrInvalidCredential is returned when a ceremony response does not verify
+	ErrInvalidCredential = errors.New("passkey: invalid credential")
+	// ErrUnknownCredential is returned when a passkey is not registered
+	ErrUnknownCredential = errors.New("passkey: unknown credential")
+)
+
+// Service runs the WebAuthn registration and login ceremonies
+type Service struct {
+	db       *database.DB
+	webauthn *webauthn.WebAuthn
+}
+
+// New creates a passkey service. Without origins, https://<rp id> is used.
+func New(db *database.DB, config types.WebAuthnConfig) (*Service, error) {
+	if config.RPDisplayName == "" {
+		config.RPDisplayName = DefaultDisplayName
+	}
+	if len(config.RPOrigins) == 0 {
+		config.RPOrigins = []string{"https://" + config.RPID}
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          config.RPID,
+		RPDisplayName: config.RPDisplayName,
+		RPOrigins:     config.RPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid passkey configuration: %w", err)
+	}
+
+	return &Service{db: db, webauthn: w}, nil
+}
+
+// BeginRegistration starts registering a new passkey for a user. Passkeys
+// the user already has are excluded so an authenticator is not added twice.
+func (s *Service) BeginRegistration(user *types.User) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	u, err := s.loadUser(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(u.credentials))
+	for _, credential := range u.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	return s.webauthn.BeginRegistration(u,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+}
+
+// FinishRegistration verifies the authenticator's response and stores the
+// new passkey under name
+func (s *Service) FinishRegistration(user *types.User, session webauthn.SessionData, name string, r *http.Request) (*types.Passkey, error) {
+	u, err := s.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.FinishRegistration(u, session, r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, protocolDetails(err))
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey := &types.Passkey{
+		UserID:       user.ID,
+		Name:         name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Credential:   string(data),
+	}
+	if err := s.db.CreatePasskey(passkey); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// BeginLogin starts a passwordless login. The authenticator offers the
+// passkeys it holds for this site, so no username is needed.
+func (s *Service) BeginLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return s.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+// FinishLogin verifies the authenticator's response and returns the user
+// owning the passkey
+func (s *Service) FinishLogin(session webauthn.SessionData, r *http.Request) (*types.User, error) {
+	var owner *user
+	credential, err := s.webauthn.FinishDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		userID, err := strconv.ParseInt(string(userHandle), 10, 64)
+		if err != nil {
+			return nil, ErrUnknownCredential
+		}
+		account, err := s.db.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			return nil, ErrUnknownCredential
+		}
+		owner, err = s.loadUser(account)
+		return owner, err
+	}, session, r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredential, protocolDetails(err))
+	}
+
+	// A signature counter that went backwards points to a cloned authenticator
+	if credential.Authenticator.CloneWarning {
+		return nil, fmt.Errorf("%w: signature counter did not increase", ErrInvalidCredential)
+	}
+
+	passkey := owner.passkey(credential.ID)
+	if passkey == nil {
+		return nil, ErrUnknownCredential
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.UpdatePasskeyUse(passkey.ID, string(data), time.Now()); err != nil {
+		return nil, err
+	}
+
+	return owner.User, nil
+}
+
+// loadUser loads the passkeys of a user for a ceremony
+func (s *Service) loadUser(account *types.User) (*user, error) {
+	passkeys, err := s.db.ListPasskeys(account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &user{User: account, passkeys: passkeys}
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(passkey.Credential), &credential); err != nil {
+			return nil, fmt.Errorf("failed to decode passkey %d: %w", passkey.ID, err)
+		}
+		u.credentials = append(u.credentials, credential)
+	}
+	return u, nil
+}
+
+// protocolDetails includes the details of WebAuthn protocol errors, which
+// say which check failed
+func protocolDetails(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.DevInfo != "" {
+		return protocolErr.Details + ": " + protocolErr.DevInfo
+	}
+	return err.Error()
+}
+
+// user adapts a local account to the WebAuthn library
+type user struct {
+	*types.User
+	passkeys    []types.Passkey
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID returns the user handle stored on the authenticator. It is
+// the account ID, which never changes, unlike the username.
+func (u *user) WebAuthnID() []byte {
+	return []byte(strconv.FormatInt(u.ID, 10))
+}
+
+func (u *user) WebAuthnName() string {
+	return u.Username
+}
+
+func (u *user) WebAuthnDisplayName() string {
+	return u.Username
+}
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (u *user) WebAuthnIcon() string {
+	return ""
+}
+
+// passkey returns the stored passkey for a credential ID
+func (u *user) passkey(credentialID []byte) *types.Passkey {
+	for i, credential := range u.credentials {
+		if bytes.Equal(credential.ID, credentialID) {
+			return &u.passkeys[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package passkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/services/passkey/passkeytest"
+	"github.com/autobrr/dashbrr/internal/types"
+)
+
+const testOrigin = "https://dashbrr.example.com"
+
+func setupTestDB(t *testing.T) *database.DB {
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// roundTrip encodes ceremony options as JSON, like the browser receives them
+func roundTrip(t *testing.T, in, out interface{}) {
+	data, err := json.Marshal(in)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, out))
+}
+
+func request(t *testing.T, body []byte) *http.Request {
+	r, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	require.NoError(t, err)
+	return r
+}
+
+func TestService(t *testing.T) {
+	db := setupTestDB(t)
+	service, err := New(db, types.WebAuthnConfig{RPID: "dashbrr.example.com"})
+	require.NoError(t, err)
+
+	user := &types.User{Username: "alice", Email: "alice@example.com", Role: types.RoleAdmin}
+	require.NoError(t, db.CreateUser(user))
+
+	authenticator := passkeytest.New(testOrigin)
+
+	// Register
+	options, session, err := service.BeginRegistration(user)
+	require.NoError(t, err)
+	var creation protocol.CredentialCreation
+	roundTrip(t, options, &creation)
+	response, err := authenticator.Register(creation)
+	require.NoError(t, err)
+
+	passkey, err := service.FinishRegistration(user, *session, "Laptop", request(t, response))
+	require.NoError(t, err)
+	assert.Equal(t, "Laptop", passkey.Name)
+	assert.NotEmpty(t, passkey.CredentialID)
+
+	// Registered passkeys are excluded from further registrations
+	options, _, err = service.BeginRegistration(user)
+	require.NoError(t, err)
+	require.Len(t, options.Response.CredentialExcludeList, 1)
+
+	// Log in without a username
+	assertion, session, err := service.BeginLogin()
+	require.NoError(t, err)
+	var assertionOptions protocol.CredentialAssertion
+	roundTrip(t, assertion, &assertionOptions)
+	response, err = authenticator.Login(assertionOptions)
+	require.NoError(t, err)
+
+	loggedIn, err := service.FinishLogin(*session, request(t, response))
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+
+	stored, err := db.GetPasskeyByID(passkey.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	// Replaying the response against a new challenge fails
+	_, session, err = service.BeginLogin()
+	require.NoError(t, err)
+	_, err = service.FinishLogin(*session, request(t, response))
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+
+	// A counter that went backwards is refused
+	authenticator.ResetCounter()
+	assertion, session, err = service.BeginLogin()
+	require.NoError(t, err)
+	roundTrip(t, assertion, &assertionOptions)
+	response, err = authenticator.Login(assertionOptions)
+	require.NoError(t, err)
+	_, err = service.FinishLogin(*session, request(t, response))
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+
+	// Deleted passkeys no longer sign in
+	require.NoError(t, db.DeletePasskey(passkey.ID))
+	assertion, session, err = service.BeginLogin()
+	require.NoError(t, err)
+	roundTrip(t, assertion, &assertionOptions)
+	response, err = authenticator.Login(assertionOptions)
+	require.NoError(t, err)
+	_, err = service.FinishLogin(*session, request(t, response))
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+}
+
+func TestService_WrongOrigin(t *testing.T) {
+	db := setupTestDB(t)
+	service, err := New(db, types.WebAuthnConfig{RPID: "dashbrr.example.com"})
+	require.NoError(t, err)
+
+	user := &types.User{Username: "bob", Email: "bob@example.com", Role: types.RoleViewer}
+	require.NoError(t, db.CreateUser(user))
+
+	options, session, err := service.BeginRegistration(user)
+	require.NoError(t, err)
+	var creation protocol.CredentialCreation
+	roundTrip(t, options, &creation)
+	response, err := passkeytest.New("https://evil.example.net").Register(creation)
+	require.NoError(t, err)
+
+	_, err = service.FinishRegistration(user, *session, "Phone", request(t, response))
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+
+	passkeys, err := db.ListPasskeys(user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, passkeys)
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package passkeytest provides a software authenticator for testing
+// passkey registration and login without a browser
+package passkeytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+// Authenticator flags, see https://www.w3.org/TR/webauthn/#authdata-flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// Authenticator is an in-memory platform authenticator holding ES256
+// passkeys. It answers ceremonies as a browser would for Origin.
+type Authenticator struct {
+	Origin string
+
+	// Synced authenticators keep their signature counter at zero, as
+	// passkeys synced between devices do
+	Synced bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	counter    uint32
+}
+
+// New creates an authenticator for pages served from origin
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Register creates a passkey for the creation options and returns the
+// JSON the browser would send to the relying party
+func (a *Authenticator) Register(options protocol.CredentialCreation) ([]byte, error) {
+	opts := options.Response
+	userHandle, err := userID(opts.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{id: id, rpID: opts.RelyingParty.ID, userHandle: userHandle, key: key}
+
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attested credential data: AAGUID, credential ID length and ID, key
+	attested := make([]byte, 16, 16+2+len(id)+len(publicKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, publicKey...)
+
+	authData := append(cred.authData(flagUserPresent|flagUserVerified|flagAttestedData), attested...)
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := a.clientData("webauthn.create", opts.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials = append(a.credentials, cred)
+	return json.Marshal(map[string]interface{}{
+		"id":    encode(id),
+		"rawId": encode(id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"attestationObject": encode(attestation),
+		},
+	})
+}
+
+// Login signs the assertion options with a passkey for the relying party
+// and returns the JSON the browser would send. When the options list
+// allowed credentials, only those are used.
+func (a *Authenticator) Login(options protocol.CredentialAssertion) ([]byte, error) {
+	opts := options.Response
+	cred := a.find(opts.RelyingPartyID, opts.AllowedCredentials)
+	if cred == nil {
+		return nil, errors.New("passkeytest: no passkey for relying party")
+	}
+
+	if !a.Synced {
+		cred.counter++
+	}
+	authData := cred.authData(flagUserPresent | flagUserVerified)
+	clientData, err := a.clientData("webauthn.get", opts.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":    encode(cred.id),
+		"rawId": encode(cred.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(cred.userHandle),
+		},
+	})
+}
+
+// ResetCounter sets the signature counter of every passkey to zero, as a
+// cloned authenticator would report
+func (a *Authenticator) ResetCounter() {
+	for _, cred := range a.credentials {
+		cred.counter = 0
+	}
+}
+
+func (a *Authenticator) find(rpID string, allowed []protocol.CredentialDescriptor) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID != rpID {
+			continue
+		}
+		if len(allowed) == 0 {
+			return cred
+		}
+		for _, descriptor := range allowed {
+			if string(descriptor.CredentialID) == string(cred.id) {
+				return cred
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": encode(challenge),
+		"origin":    a.Origin,
+	})
+}
+
+// authData returns the RP ID hash, flags and signature counter
+func (c *credential) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, c.counter)
+}
+
+// userID decodes the user handle of creation options, which is a
+// base64url string once the options went through JSON
+func userID(id interface{}) ([]byte, error) {
+	switch v := id.(type) {
+	case string:
+		return base64.RawURLEncoding.DecodeString(v)
+	case protocol.URLEncodedBase64:
+		return v, nil
+	case []byte:
+		return v, nil
+	}
+	return nil, fmt.Errorf("passkeytest: unsupported user ID %T", id)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
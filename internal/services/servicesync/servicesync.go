@@ -0,0 +1,187 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package servicesync reconciles the services declared in the config file
+// into the database
+package servicesync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/autobrr/dashbrr/internal/config"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+// auditActor is recorded as the actor of changes made by the config file
+const auditActor = "config"
+
+// Result lists the instance IDs changed by a reconciliation
+type Result struct {
+	Created []string
+	Updated []string
+	// Released services are no longer managed and can be edited again
+	Released []string
+	Deleted  []string
+}
+
+// Reconcile brings the database in line with the declared services
+// according to the sync policy. The declarations are checked before
+// anything is written, so an invalid config file changes nothing.
+func Reconcile(db *database.DB, declared []config.ServiceConfig, policy string) (*Result, error) {
+	policy = strings.ToLower(policy)
+	switch policy {
+	case "":
+		policy = config.ServiceSyncCreate
+	case config.ServiceSyncCreate, config.ServiceSyncSync, config.ServiceSyncPrune:
+	default:
+		return nil, fmt.Errorf("unknown service sync policy %q", policy)
+	}
+
+	desired, err := Desired(declared)
+	if err != nil {
+		return nil, err
+	}
+	managed := policy != config.ServiceSyncCreate
+
+	existing, err := db.GetAllServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch services: %w", err)
+	}
+	current := make(map[string]models.ServiceConfiguration, len(existing))
+	for _, service := range existing {
+		current[service.InstanceID] = service
+	}
+
+	result := &Result{}
+	declaredIDs := make(map[string]bool, len(desired))
+	for _, service := range desired {
+		service := service
+		service.Managed = managed
+		declaredIDs[service.InstanceID] = true
+
+		before, exists := current[service.InstanceID]
+		switch {
+		case !exists:
+			if err := db.CreateService(&service); err != nil {
+				return result, fmt.Errorf("failed to create service %s: %w", service.InstanceID, err)
+			}
+			result.Created = append(result.Created, service.InstanceID)
+			recordAudit(db, models.AuditServiceCreate, nil, &service)
+		case managed && !equal(before, service):
+			if err := db.UpdateService(&service); err != nil {
+				return result, fmt.Errorf("failed to update service %s: %w", service.InstanceID, err)
+			}
+			result.Updated = append(result.Updated, service.InstanceID)
+			recordAudit(db, models.AuditServiceUpdate, &before, &service)
+		}
+	}
+
+	// Services managed by an earlier run that the config file no longer
+	// manages are released, or deleted when pruning
+	for _, service := range existing {
+		if !service.Managed || (managed && declaredIDs[service.InstanceID]) {
+			continue
+		}
+
+		if policy == config.ServiceSyncPrune {
+			if err := db.DeleteService(service.InstanceID); err != nil {
+				return result, fmt.Errorf("failed to delete service %s: %w", service.InstanceID, err)
+			}
+			result.Deleted = append(result.Deleted, service.InstanceID)
+			recordAudit(db, models.AuditServiceDelete, &service, nil)
+			continue
+		}
+
+		service.Managed = false
+		if err := db.UpdateService(&service); err != nil {
+			return result, fmt.Errorf("failed to release service %s: %w", service.InstanceID, err)
+		}
+		result.Released = append(result.Released, service.InstanceID)
+	}
+
+	log.Info().
+		Str("policy", policy).
+		Int("created", len(result.Created)).
+		Int("updated", len(result.Updated)).
+		Int("released", len(result.Released)).
+		Int("deleted", len(result.Deleted)).
+		Msg("Reconciled services from config file")
+
+	return result, nil
+}
+
+// Desired converts the declared services into service configurations,
+// resolving API key references
+func Desired(declared []config.ServiceConfig) ([]models.ServiceConfiguration, error) {
+	services := make([]models.ServiceConfiguration, 0, len(declared))
+	seen := make(map[string]bool, len(declared))
+	counts := make(map[string]int)
+
+	for i, decl := range declared {
+		serviceType := strings.ToLower(decl.Type)
+		if !models.IsServiceType(serviceType) {
+			return nil, fmt.Errorf("services[%d]: unknown service type %q", i, decl.Type)
+		}
+		if decl.URL == "" {
+			return nil, fmt.Errorf("services[%d]: url is required", i)
+		}
+
+		counts[serviceType]++
+		instanceID := decl.InstanceID(counts[serviceType])
+		if seen[instanceID] {
+			return nil, fmt.Errorf("services[%d]: duplicate instance ID %s", i, instanceID)
+		}
+		seen[instanceID] = true
+
+		apiKey, err := decl.ResolveAPIKey()
+		if err != nil {
+			return nil, fmt.Errorf("services[%d]: %w", i, err)
+		}
+
+		name := decl.Name
+		if name == "" {
+			name = serviceType
+		}
+
+		services = append(services, models.ServiceConfiguration{
+			InstanceID:    instanceID,
+			DisplayName:   name,
+			URL:           strings.TrimRight(decl.URL, "/"),
+			APIKey:        apiKey,
+			Tags:          decl.Tags,
+			CheckInterval: int64(time.Duration(decl.CheckInterval) / time.Second),
+		})
+	}
+	return services, nil
+}
+
+// equal reports whether a stored service already matches the declaration
+func equal(a, b models.ServiceConfiguration) bool {
+	return a.Managed == b.Managed &&
+		len(models.ServiceConfigChanges(&a, &b)) == 0
+}
+
+// recordAudit records a change made by the config file
+func recordAudit(db *database.DB, action string, before, after *models.ServiceConfiguration) {
+	target := ""
+	if after != nil {
+		target = after.InstanceID
+	} else if before != nil {
+		target = before.InstanceID
+	}
+
+	event := models.AuditEvent{
+		Actor:   auditActor,
+		Action:  action,
+		Target:  target,
+		Changes: models.ServiceConfigChanges(before, after),
+	}
+	if err := db.CreateAuditEvent(&event); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("Failed to record audit event")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package servicesync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/autobrr/dashbrr/internal/config"
+	"github.com/autobrr/dashbrr/internal/database"
+	"github.com/autobrr/dashbrr/internal/models"
+)
+
+func setupTestDB(t *testing.T) *database.DB {
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestDesired(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "radarr_key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("radarr-key\n"), 0o600))
+	t.Setenv("SONARR_KEY", "sonarr-key")
+
+	services, err := Desired([]config.ServiceConfig{
+		{Type: "Sonarr", URL: "http://sonarr:8989/", APIKeyEnv: "SONARR_KEY", Tags: []string{"media"}},
+		{Type: "sonarr", ID: "4k", Name: "Sonarr 4K", URL: "http://sonarr-4k:8989", APIKey: "inline"},
+		{Type: "radarr", URL: "http://radarr:7878", APIKeyFile: keyFile, CheckInterval: config.Duration(2 * time.Minute)},
+	})
+	require.NoError(t, err)
+	require.Len(t, services, 3)
+
+	assert.Equal(t, "sonarr-config-1", services[0].InstanceID)
+	assert.Equal(t, "sonarr", services[0].DisplayName)
+	assert.Equal(t, "http://sonarr:8989", services[0].URL)
+	assert.Equal(t, "sonarr-key", services[0].APIKey)
+	assert.Equal(t, []string{"media"}, services[0].Tags)
+
+	assert.Equal(t, "sonarr-4k", services[1].InstanceID)
+	assert.Equal(t, "Sonarr 4K", services[1].DisplayName)
+	assert.Equal(t, "inline", services[1].APIKey)
+
+	assert.Equal(t, "radarr-config-1", services[2].InstanceID)
+	assert.Equal(t, "radarr-key", services[2].APIKey)
+	assert.Equal(t, int64(120), services[2].CheckInterval)
+
+	for _, declared := range [][]config.ServiceConfig{
+		{{Type: "unknown", URL: "http://example"}},
+		{{Type: "plex"}},
+		{{Type: "plex", ID: "a", URL: "http://a"}, {Type: "plex", ID: "a", URL: "http://b"}},
+		{{Type: "plex", URL: "http://plex", APIKeyEnv: "DASHBRR_TEST_UNSET_KEY"}},
+	} {
+		_, err := Desired(declared)
+		assert.Error(t, err, declared)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	db := setupTestDB(t)
+
+	manual := &models.ServiceConfiguration{InstanceID: "plex-1", DisplayName: "Plex", URL: "http://plex"}
+	require.NoError(t, db.CreateService(manual))
+
+	declared := []config.ServiceConfig{
+		{Type: "sonarr", URL: "http://sonarr", APIKey: "key"},
+		{Type: "radarr", ID: "main", URL: "http://radarr", APIKey: "key"},
+	}
+
+	// Create only adds missing services and leaves them editable
+	result, err := Reconcile(db, declared, "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"sonarr-config-1", "radarr-main"}, result.Created)
+
+	sonarr, err := db.GetServiceByInstanceID("sonarr-config-1")
+	require.NoError(t, err)
+	assert.False(t, sonarr.Managed)
+
+	sonarr.DisplayName = "Edited"
+	require.NoError(t, db.UpdateService(sonarr))
+	result, err = Reconcile(db, declared, config.ServiceSyncCreate)
+	require.NoError(t, err)
+	assert.Empty(t, result.Created)
+	assert.Empty(t, result.Updated)
+
+	// Sync updates services to match and marks them as managed
+	result, err = Reconcile(db, declared, config.ServiceSyncSync)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"sonarr-config-1", "radarr-main"}, result.Updated)
+
+	sonarr, err = db.GetServiceByInstanceID("sonarr-config-1")
+	require.NoError(t, err)
+	assert.True(t, sonarr.Managed)
+	assert.Equal(t, "sonarr", sonarr.DisplayName)
+
+	result, err = Reconcile(db, declared, config.ServiceSyncSync)
+	require.NoError(t, err)
+	assert.Empty(t, result.Updated, "an unchanged config file changes nothing")
+
+	// Dropping a declaration releases the service under sync...
+	result, err = Reconcile(db, declared[:1], config.ServiceSyncSync)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"radarr-main"}, result.Released)
+
+	radarr, err := db.GetServiceByInstanceID("radarr-main")
+	require.NoError(t, err)
+	require.NotNil(t, radarr)
+	assert.False(t, radarr.Managed)
+
+	// ...and deletes managed services when pruning, never manual ones
+	_, err = Reconcile(db, declared, config.ServiceSyncSync)
+	require.NoError(t, err)
+	result, err = Reconcile(db, declared[:1], config.ServiceSyncPrune)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"radarr-main"}, result.Deleted)
+
+	radarr, err = db.GetServiceByInstanceID("radarr-main")
+	require.NoError(t, err)
+	assert.Nil(t, radarr)
+
+	plex, err := db.GetServiceByInstanceID("plex-1")
+	require.NoError(t, err)
+	assert.NotNil(t, plex)
+
+	// Switching back to create releases everything
+	result, err = Reconcile(db, declared[:1], config.ServiceSyncCreate)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sonarr-config-1"}, result.Released)
+
+	events, err := db.ListAuditEvents(models.AuditFilter{Actor: auditActor})
+	require.NoError(t, err)
+	assert.NotEmpty(t, events)
+
+	_, err = Reconcile(db, declared, "mirror")
+	assert.Error(t, err)
+}
@@ -3,7 +3,76 @@
 
 package types
 
-import "time"
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// User roles, from least to most privileged
+const (
+	RoleViewer   = "viewer"   // read-only dashboards
+	RoleOperator = "operator" // can act on queues, requests and webhooks
+	RoleAdmin    = "admin"    // can manage services and users
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// IsValidRole reports whether role is one of the known roles
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants the permissions of required.
+// Unknown roles never grant anything.
+func RoleAtLeast(role, required string) bool {
+	have, ok := roleLevels[role]
+	if !ok {
+		return false
+	}
+	return have >= roleLevels[required]
+}
+
+// API token scopes, each capping the role a token can act with
+const (
+	TokenScopeRead  = "read"  // viewer access
+	TokenScopeWrite = "write" // operator access
+	TokenScopeAdmin = "admin" // admin access
+)
+
+// APITokenPrefix marks bearer tokens that are API tokens rather than sessions
+const APITokenPrefix = "dbr_"
+
+var tokenScopeRoles = map[string]string{
+	TokenScopeRead:  RoleViewer,
+	TokenScopeWrite: RoleOperator,
+	TokenScopeAdmin: RoleAdmin,
+}
+
+// IsValidTokenScope reports whether scope is one of the known token scopes
+func IsValidTokenScope(scope string) bool {
+	_, ok := tokenScopeRoles[scope]
+	return ok
+}
+
+// TokenRole returns the role a token acts with: the user's role, capped by
+// the token's scope
+func TokenRole(userRole, scope string) string {
+	scopeRole, ok := tokenScopeRoles[scope]
+	if !ok {
+		return ""
+	}
+	if RoleAtLeast(userRole, scopeRole) {
+		return scopeRole
+	}
+	return userRole
+}
 
 // AuthConfig holds the OIDC configuration
 type AuthConfig struct {
@@ -11,6 +80,177 @@ type AuthConfig struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
+	Scopes       []string // defaults to openid, profile and email
+
+	// Group claim to role mapping
+	GroupsClaim    string
+	AdminGroups    []string
+	OperatorGroups []string
+	DefaultRole    string
+}
+
+// RoleForGroups maps the groups from an identity provider to a role.
+// Without any group mapping configured every OIDC user is an admin,
+// matching the behaviour before roles existed.
+func (c *AuthConfig) RoleForGroups(groups []string) string {
+	if len(c.AdminGroups) == 0 && len(c.OperatorGroups) == 0 && !IsValidRole(c.DefaultRole) {
+		return RoleAdmin
+	}
+	return roleForGroups(groups, c.AdminGroups, c.OperatorGroups, c.DefaultRole)
+}
+
+// roleForGroups returns the most privileged role any of the groups maps
+// to, or defaultRole (viewer if unset) when none match
+func roleForGroups(groups, adminGroups, operatorGroups []string, defaultRole string) string {
+	if containsAnyFold(groups, adminGroups) {
+		return RoleAdmin
+	}
+	if containsAnyFold(groups, operatorGroups) {
+		return RoleOperator
+	}
+	if IsValidRole(defaultRole) {
+		return defaultRole
+	}
+	return RoleViewer
+}
+
+// GroupRoleMapping maps directory or proxy groups to roles
+type GroupRoleMapping struct {
+	AdminGroups    []string
+	OperatorGroups []string
+	DefaultRole    string
+}
+
+// MapsGroups reports whether groups decide user roles. Without a group
+// mapping, roles are managed in dashbrr.
+func (m *GroupRoleMapping) MapsGroups() bool {
+	return len(m.AdminGroups) > 0 || len(m.OperatorGroups) > 0
+}
+
+// RoleForGroups maps groups to a role
+func (m *GroupRoleMapping) RoleForGroups(groups []string) string {
+	return roleForGroups(groups, m.AdminGroups, m.OperatorGroups, m.DefaultRole)
+}
+
+// InitialRole returns the role for a user created from a directory or
+// proxy login. Without a group mapping, the first account administers the
+// instance like with registration, and later ones get the default role.
+func (m *GroupRoleMapping) InitialRole(groups []string, firstUser bool) string {
+	switch {
+	case m.MapsGroups():
+		return m.RoleForGroups(groups)
+	case firstUser:
+		return RoleAdmin
+	case IsValidRole(m.DefaultRole):
+		return m.DefaultRole
+	}
+	return RoleViewer
+}
+
+// ProxyAuthConfig configures authentication by a trusted reverse proxy
+// (forward auth) that passes the logged-in user in request headers
+type ProxyAuthConfig struct {
+	TrustedProxies []*net.IPNet
+	UserHeader     string
+	EmailHeader    string
+	GroupsHeader   string
+
+	GroupRoleMapping
+}
+
+// IsTrusted reports whether ip belongs to one of the trusted proxy networks
+func (c *ProxyAuthConfig) IsTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LDAPConfig configures password login against an LDAP directory
+type LDAPConfig struct {
+	URL                string // ldap://host:389 or ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+
+	// Service account used to search for users and groups; empty for
+	// anonymous binds
+	BindDN       string
+	BindPassword string
+
+	BaseDN            string
+	UserFilter        string // {username} is replaced with the escaped login name
+	UsernameAttribute string
+	EmailAttribute    string
+
+	GroupBaseDN        string
+	GroupFilter        string // {dn} and {username} are replaced with the escaped values
+	GroupNameAttribute string
+
+	GroupRoleMapping
+}
+
+// LockoutConfig configures brute-force protection for password logins
+type LockoutConfig struct {
+	Threshold  int           // failures before an account is locked
+	Duration   time.Duration // how long a lockout lasts
+	WebhookURL string        // optional URL notified of lockouts
+}
+
+// LoginLockout tracks failed logins for a username. Unknown usernames are
+// tracked too, so responses do not reveal which accounts exist.
+type LoginLockout struct {
+	Username      string    `json:"username"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LastIP        string    `json:"last_ip"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// Locked reports whether logins for the username are currently refused
+func (l *LoginLockout) Locked() bool {
+	return time.Now().Before(l.LockedUntil)
+}
+
+// ParseTrustedProxies parses CIDRs and plain IP addresses into networks
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network %q: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// containsAnyFold reports whether any value is in candidates, ignoring case
+func containsAnyFold(values, candidates []string) bool {
+	for _, v := range values {
+		for _, c := range candidates {
+			if strings.EqualFold(v, c) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // SessionData holds the session information
@@ -22,27 +262,154 @@ type SessionData struct {
 	ExpiresAt    time.Time `json:"expires_at"`
 	UserID       int64     `json:"user_id,omitempty"`   // Added for built-in auth
 	AuthType     string    `json:"auth_type,omitempty"` // "oidc" or "builtin"
+	Role         string    `json:"role,omitempty"`      // Role for sessions without a database user
+	Subject      string    `json:"subject,omitempty"`   // Identity provider subject or username
 }
 
+// SessionTTL is how long a password session lasts without activity. Each
+// request renews it.
+const SessionTTL = 24 * time.Hour
+
+// Session describes a signed-in browser or client of a password login
+type Session struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Where an account comes from. Accounts created by an external login
+// before the source was recorded are marked external.
+const (
+	AuthSourceLocal    = "local"
+	AuthSourceProxy    = "proxy"
+	AuthSourceLDAP     = "ldap"
+	AuthSourceExternal = "external"
+)
+
 // User represents a user in the system
 type User struct {
 	ID           int64     `json:"id"`
 	Username     string    `json:"username"`
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	AuthSource   string    `json:"auth_source"`
+	Disabled     bool      `json:"disabled"`
+	TOTPSecret   string    `json:"-"`
+	TOTPEnabled  bool      `json:"totp_enabled"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// WebAuthnConfig configures passkey logins
+type WebAuthnConfig struct {
+	RPID          string   // domain the passkeys are bound to, e.g. dash.example.com
+	RPDisplayName string   // shown by the authenticator
+	RPOrigins     []string // origins the dashboard is served from
+}
+
+// Passkey is a WebAuthn credential registered by a user
+type Passkey struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"credential_id"` // base64url encoded
+	Credential   string     `json:"-"`             // JSON encoded credential data
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Invite lets a new user register after the first account exists
+type Invite struct {
+	ID        int64      `json:"id"`
+	Email     string     `json:"email,omitempty"` // optional, restricts the invite to one address
+	Role      string     `json:"role"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// Usable reports whether the invite can still be redeemed
+func (i *Invite) Usable() bool {
+	return i.UsedAt == nil && time.Now().Before(i.ExpiresAt)
+}
+
+// APIToken is a long-lived credential for scripts, owned by a user
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the token, for identification
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether the token can no longer be used
+func (t *APIToken) Expired() bool {
+	return !time.Now().Before(t.ExpiresAt)
+}
+
+// CreateTokenRequest represents a new API token
+type CreateTokenRequest struct {
+	Name      string `json:"name" binding:"required,max=64"`
+	Scope     string `json:"scope"`
+	ExpiresIn string `json:"expires_in"` // Go duration, defaults to 90 days
+}
+
 // LoginRequest represents the login credentials
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// TwoFactorLoginRequest completes a login that requires a second factor.
+// Either a code from the authenticator app or a recovery code is needed.
+type TwoFactorLoginRequest struct {
+	Challenge    string `json:"challenge" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorCodeRequest confirms a two-factor change with a current code
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
 // RegisterRequest represents the registration data
 type RegisterRequest struct {
+	Username    string `json:"username" binding:"required,min=3,max=32"`
+	Email       string `json:"email" binding:"required,email"`
+	Password    string `json:"password" binding:"required,min=8"`
+	InviteToken string `json:"invite_token,omitempty"` // required once a user exists
+}
+
+// CreateUserRequest represents a user created by an admin
+type CreateUserRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=32"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
+	Role     string `json:"role"`
+}
+
+// UpdateUserRequest represents changes an admin makes to a user
+type UpdateUserRequest struct {
+	Role     *string `json:"role,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+}
+
+// CreateInviteRequest represents a new invite
+type CreateInviteRequest struct {
+	Email     string `json:"email" binding:"omitempty,email"`
+	Role      string `json:"role"`
+	ExpiresIn string `json:"expires_in"` // Go duration, defaults to 72h
 }
@@ -9,6 +9,8 @@ import (
 	"fmt"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/autobrr/dashbrr/internal/types"
 )
 
 const (
@@ -55,6 +57,16 @@ func GenerateSecureToken(length int) (string, error) {
 	return encoded[:length], nil
 }
 
+// GenerateAPIToken generates an API token secret. The fixed prefix lets the
+// auth middleware tell API tokens apart from session tokens.
+func GenerateAPIToken() (string, error) {
+	token, err := GenerateSecureToken(40)
+	if err != nil {
+		return "", err
+	}
+	return types.APITokenPrefix + token, nil
+}
+
 // ValidatePassword checks if a password meets security requirements
 func ValidatePassword(password string) error {
 	if len(password) < 8 {
@@ -96,3 +108,24 @@ func ValidatePassword(password string) error {
 
 	return nil
 }
+
+// GenerateRecoveryCode generates a two-factor recovery code formatted as two
+// groups of five characters, e.g. "k7p2m-x9qrt"
+func GenerateRecoveryCode() (string, error) {
+	// Lowercase base32, 32 symbols so every random byte maps without bias
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %v", err)
+	}
+
+	code := make([]byte, 0, 11)
+	for i, b := range bytes {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, alphabet[b&31])
+	}
+	return string(code), nil
+}
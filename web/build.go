@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"embed"
 	"fmt"
+	"html"
 	"io"
 	"io/fs"
 	"net/http"
@@ -67,8 +68,11 @@ func subFS(currentFs fs.FS, root string) (fs.FS, error) {
 	return fs.Sub(currentFs, root)
 }
 
-// ServeStatic registers static file handlers with Gin
-func ServeStatic(r *gin.Engine) {
+// ServeStatic registers static file handlers with Gin. The frontend is
+// served under basePath, which is empty when dashbrr runs at the root.
+func ServeStatic(r *gin.Engine, basePath string) {
+	g := r.Group(basePath)
+
 	// Helper function to serve static files with proper headers
 	serveStaticFile := func(c *gin.Context, filepath string, contentType string) {
 		file, err := DistDirFS.Open(filepath)
@@ -94,7 +98,7 @@ func ServeStatic(r *gin.Engine) {
 		if strings.Contains(filepath, "sw.js") || strings.Contains(filepath, "manifest.json") {
 			c.Header("Cache-Control", "no-cache")
 			if strings.Contains(filepath, "sw.js") {
-				c.Header("Service-Worker-Allowed", "/")
+				c.Header("Service-Worker-Allowed", basePath+"/")
 			}
 		} else {
 			c.Header("Cache-Control", "public, max-age=31536000")
@@ -106,63 +110,63 @@ func ServeStatic(r *gin.Engine) {
 	}
 
 	// Serve static files from root path
-	r.GET("/logo.svg", func(c *gin.Context) {
+	g.GET("/logo.svg", func(c *gin.Context) {
 		serveStaticFile(c, "logo.svg", "image/svg+xml")
 	})
 
-	r.GET("/masked-icon.svg", func(c *gin.Context) {
+	g.GET("/masked-icon.svg", func(c *gin.Context) {
 		serveStaticFile(c, "masked-icon.svg", "image/svg+xml")
 	})
 
-	r.GET("/favicon.ico", func(c *gin.Context) {
+	g.GET("/favicon.ico", func(c *gin.Context) {
 		serveStaticFile(c, "favicon.ico", "image/x-icon")
 	})
 
-	r.GET("/apple-touch-icon.png", func(c *gin.Context) {
+	g.GET("/apple-touch-icon.png", func(c *gin.Context) {
 		serveStaticFile(c, "apple-touch-icon.png", "image/png")
 	})
 
-	r.GET("/apple-touch-icon-iphone-60x60.png", func(c *gin.Context) {
+	g.GET("/apple-touch-icon-iphone-60x60.png", func(c *gin.Context) {
 		serveStaticFile(c, "apple-touch-icon-iphone-60x60.png", "image/png")
 	})
 
-	r.GET("/apple-touch-icon-ipad-76x76.png", func(c *gin.Context) {
+	g.GET("/apple-touch-icon-ipad-76x76.png", func(c *gin.Context) {
 		serveStaticFile(c, "apple-touch-icon-ipad-76x76.png", "image/png")
 	})
 
-	r.GET("/apple-touch-icon-iphone-retina-120x120.png", func(c *gin.Context) {
+	g.GET("/apple-touch-icon-iphone-retina-120x120.png", func(c *gin.Context) {
 		serveStaticFile(c, "apple-touch-icon-iphone-retina-120x120.png", "image/png")
 	})
 
-	r.GET("/apple-touch-icon-ipad-retina-152x152.png", func(c *gin.Context) {
+	g.GET("/apple-touch-icon-ipad-retina-152x152.png", func(c *gin.Context) {
 		serveStaticFile(c, "apple-touch-icon-ipad-retina-152x152.png", "image/png")
 	})
 
-	r.GET("/pwa-192x192.png", func(c *gin.Context) {
+	g.GET("/pwa-192x192.png", func(c *gin.Context) {
 		serveStaticFile(c, "pwa-192x192.png", "image/png")
 	})
 
-	r.GET("/pwa-512x512.png", func(c *gin.Context) {
+	g.GET("/pwa-512x512.png", func(c *gin.Context) {
 		serveStaticFile(c, "pwa-512x512.png", "image/png")
 	})
 
 	// Serve manifest.json
-	r.GET("/manifest.json", func(c *gin.Context) {
+	g.GET("/manifest.json", func(c *gin.Context) {
 		serveStaticFile(c, "manifest.json", "application/manifest+json; charset=utf-8")
 	})
 
 	// Serve service worker
-	r.GET("/sw.js", func(c *gin.Context) {
+	g.GET("/sw.js", func(c *gin.Context) {
 		serveStaticFile(c, "sw.js", "text/javascript; charset=utf-8")
 	})
 
 	// Serve workbox files
-	r.GET("/workbox-:hash.js", func(c *gin.Context) {
-		serveStaticFile(c, c.Request.URL.Path[1:], "text/javascript; charset=utf-8")
+	g.GET("/workbox-:hash.js", func(c *gin.Context) {
+		serveStaticFile(c, path.Base(c.Request.URL.Path), "text/javascript; charset=utf-8")
 	})
 
 	// Serve assets directory
-	r.GET("/assets/*filepath", func(c *gin.Context) {
+	g.GET("/assets/*filepath", func(c *gin.Context) {
 		filepath := strings.TrimPrefix(c.Param("filepath"), "/")
 		fullPath := path.Join("assets", filepath)
 
@@ -194,14 +198,30 @@ func ServeStatic(r *gin.Engine) {
 	})
 
 	// Serve index.html for root path and direct requests
-	r.GET("/", serveIndex)
-	r.GET("/index.html", serveIndex)
+	serveIndex := func(c *gin.Context) {
+		serveIndexFile(c, basePath)
+	}
+	g.GET("/", serveIndex)
+	g.GET("/index.html", serveIndex)
 
 	// Handle all other routes
 	r.NoRoute(func(c *gin.Context) {
+		requestPath := c.Request.URL.Path
+
+		// Send visitors of the bare host to the app when it lives under a
+		// base path, and leave other paths outside of it alone
+		if basePath != "" && requestPath != basePath && !strings.HasPrefix(requestPath, basePath+"/") {
+			if requestPath == "/" {
+				c.Redirect(http.StatusTemporaryRedirect, basePath+"/")
+				return
+			}
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
 		// Don't serve index.html for API routes
-		if strings.HasPrefix(c.Request.URL.Path, "/api") {
-			c.AbortWithStatus(404)
+		if strings.HasPrefix(requestPath, basePath+"/api") {
+			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
 
@@ -210,8 +230,8 @@ func ServeStatic(r *gin.Engine) {
 	})
 }
 
-// serveIndex serves index.html with proper headers
-func serveIndex(c *gin.Context) {
+// serveIndexFile serves index.html with proper headers
+func serveIndexFile(c *gin.Context, basePath string) {
 	file, err := DistDirFS.Open("index.html")
 	if err != nil {
 		c.Status(http.StatusNotFound)
@@ -219,10 +239,37 @@ func serveIndex(c *gin.Context) {
 	}
 	defer file.Close()
 
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("Expires", "0")
 
-	io.Copy(c.Writer, file)
+	// Client-side routes reach here through NoRoute, which presets a 404
+	c.Status(http.StatusOK)
+	c.Writer.Write(rewriteIndex(data, basePath))
+}
+
+// rewriteIndex adds a <base> element to index.html. The frontend is built
+// with relative asset URLs, so the element decides where assets load from
+// and lets the app find its base path at runtime.
+func rewriteIndex(data []byte, basePath string) []byte {
+	head := []byte("<head>")
+	i := bytes.Index(data, head)
+	if i < 0 {
+		return data
+	}
+	i += len(head)
+
+	base := fmt.Sprintf("\n    <base href=\"%s/\" />", html.EscapeString(basePath))
+
+	rewritten := make([]byte, 0, len(data)+len(base))
+	rewritten = append(rewritten, data[:i]...)
+	rewritten = append(rewritten, base...)
+	return append(rewritten, data[i:]...)
 }
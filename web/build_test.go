@@ -0,0 +1,50 @@
+// Copyright (c) 2024, s0up and the autobrr contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeStatic_BasePath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	ServeStatic(router, "/dashbrr")
+
+	for path, want := range map[string]int{
+		"/dashbrr/":              http.StatusOK,
+		"/dashbrr/index.html":    http.StatusOK,
+		"/dashbrr/login":         http.StatusOK,
+		"/dashbrr/api/unknown":   http.StatusNotFound,
+		"/":                      http.StatusTemporaryRedirect,
+		"/login":                 http.StatusNotFound,
+		"/dashbrrx/login":        http.StatusNotFound,
+		"/dashbrr/assets/x.js":   http.StatusNotFound,
+		"/dashbrr/manifest.json": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, w.Code, path)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "/dashbrr/", w.Header().Get("Location"))
+}
+
+func TestRewriteIndex(t *testing.T) {
+	index := []byte("<html><head><script src=\"./assets/index.js\"></script></head></html>")
+
+	assert.Equal(t,
+		"<html><head>\n    <base href=\"/dashbrr/\" /><script src=\"./assets/index.js\"></script></head></html>",
+		string(rewriteIndex(index, "/dashbrr")))
+	assert.Contains(t, string(rewriteIndex(index, "")), "<base href=\"/\" />")
+	assert.Equal(t, "<html></html>", string(rewriteIndex([]byte("<html></html>"), "/dashbrr")))
+}
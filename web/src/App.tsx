@@ -19,10 +19,12 @@ import { BrowserRouter, Routes, Route, Navigate } from "react-router-dom";
 import { ProtectedRoute } from "./components/auth/ProtectedRoute";
 import { LoginPage } from "./components/auth/LoginPage";
 import { CallbackPage } from "./components/auth/CallbackPage";
+import { RegisterPage } from "./components/auth/RegisterPage";
 import { ServiceType } from "./types/service";
 import { ArrowRightStartOnRectangleIcon } from "@heroicons/react/20/solid";
 import { StatusCounters } from "./components/shared/StatusCounters";
 import { useServiceHealth } from "./hooks/useServiceHealth";
+import { BASE_PATH } from "./utils/basePath";
 
 // Preload the logo image
 const preloadLogo = new Image();
@@ -30,12 +32,13 @@ preloadLogo.src = logo;
 
 function App() {
   return (
-    <BrowserRouter>
+    <BrowserRouter basename={BASE_PATH || "/"}>
       <AuthProvider>
         <ConfigurationProvider>
           <Suspense fallback={<LoadingSkeleton />}>
             <Routes>
               <Route path="/login" element={<LoginPage />} />
+              <Route path="/register" element={<RegisterPage />} />
               <Route path="/auth/callback" element={<CallbackPage />} />
               <Route
                 path="/"
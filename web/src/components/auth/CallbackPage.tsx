@@ -6,6 +6,7 @@
 import { useEffect, useState } from "react";
 import { useNavigate, useSearchParams } from "react-router-dom";
 import { useAuth } from "../../contexts/AuthContext";
+import { OIDC_COOKIE_SESSION } from "../../config/auth";
 
 export function CallbackPage() {
   const [error, setError] = useState<string | null>(null);
@@ -15,15 +16,11 @@ export function CallbackPage() {
 
   useEffect(() => {
     const handleCallback = async () => {
-      // First check for tokens in URL (in case of direct callback from Auth0)
-      const accessToken = searchParams.get("access_token");
-      const idToken = searchParams.get("id_token");
-
-      if (accessToken && idToken) {
-        // Store tokens
-        localStorage.setItem("access_token", accessToken);
-        localStorage.setItem("id_token", idToken);
-        // Remove tokens from URL
+      // A successful OIDC login only sets the HttpOnly session cookie
+      if (searchParams.get("auth") === "oidc") {
+        localStorage.setItem("access_token", OIDC_COOKIE_SESSION);
+        localStorage.removeItem("id_token");
+        localStorage.setItem("auth_type", "oidc");
         window.history.replaceState(
           {},
           document.title,
@@ -34,7 +31,7 @@ export function CallbackPage() {
         return;
       }
 
-      // If no tokens in URL, check for error
+      // Otherwise check for an error
       const error = searchParams.get("error");
       const errorDescription = searchParams.get("error_description");
 
@@ -43,7 +40,7 @@ export function CallbackPage() {
         return;
       }
 
-      // If no tokens and no error, redirect to home
+      // If no login and no error, redirect to home
       navigate("/", { replace: true });
     };
 
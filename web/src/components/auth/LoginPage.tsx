@@ -7,6 +7,9 @@ import { useEffect, useState } from "react";
 import { useNavigate, useLocation } from "react-router-dom";
 import { useAuth } from "../../contexts/AuthContext";
 import { RegisterCredentials } from "../../types/auth";
+import { TWO_FACTOR_REQUIRED } from "../../config/auth";
+import { isPasskeySupported } from "../../utils/webauthn";
+import { withBasePath } from "../../utils/basePath";
 import { toast } from "react-hot-toast";
 import { FontAwesomeIcon } from "@fortawesome/react-fontawesome";
 import { faOpenid } from "@fortawesome/free-brands-svg-icons";
@@ -21,6 +24,7 @@ export function LoginPage() {
     loading,
     login,
     loginWithOIDC,
+    loginWithPasskey,
     register,
     authConfig,
   } = useAuth();
@@ -31,6 +35,8 @@ export function LoginPage() {
   const [registrationEnabled, setRegistrationEnabled] =
     useState<boolean>(false);
   const [checkingRegistration, setCheckingRegistration] = useState(true);
+  const [needsTwoFactor, setNeedsTwoFactor] = useState(false);
+  const [twoFactorCode, setTwoFactorCode] = useState("");
 
   // Form state
   const [formData, setFormData] = useState<
@@ -64,7 +70,7 @@ export function LoginPage() {
       }
 
       try {
-        const response = await fetch("/api/auth/registration-status");
+        const response = await fetch(withBasePath("/api/auth/registration-status"));
         const data = await response.json();
         setRegistrationEnabled(data.registrationEnabled);
         if (data.registrationEnabled && !data.hasUsers) {
@@ -115,6 +121,17 @@ export function LoginPage() {
     setError(null);
   };
 
+  const handlePasskeyLogin = async () => {
+    setError(null);
+    try {
+      await loginWithPasskey();
+    } catch (err) {
+      const message = err instanceof Error ? err.message : "Passkey login failed";
+      setError(message);
+      toast.custom((t) => <Toast type="error" body={message} t={t} />);
+    }
+  };
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError(null);
@@ -184,12 +201,18 @@ export function LoginPage() {
           await login({
             username: formData.username,
             password: formData.password,
+            code: needsTwoFactor ? twoFactorCode : undefined,
           });
           toast.custom((t) => (
             <Toast type="success" body="Login successful!" t={t} />
           ));
         } catch (err) {
           const errorMessage = err instanceof Error ? err.message : String(err);
+          if (errorMessage === TWO_FACTOR_REQUIRED) {
+            setNeedsTwoFactor(true);
+            setError(null);
+            return;
+          }
           // Check if the error indicates no users exist
           if (errorMessage.includes("User not found") && registrationEnabled) {
             setIsRegistering(true); // Switch to registration mode
@@ -292,6 +315,26 @@ export function LoginPage() {
                   onChange={handleInputChange}
                 />
               </div>
+              {needsTwoFactor && !isRegistering && (
+                <div className="pt-4">
+                  <label htmlFor="twoFactorCode" className="sr-only">
+                    Two-factor code
+                  </label>
+                  <input
+                    id="twoFactorCode"
+                    name="twoFactorCode"
+                    type="text"
+                    inputMode="numeric"
+                    autoComplete="one-time-code"
+                    autoFocus
+                    required
+                    className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-700 dark:border-gray-900 bg-gray-700 text-gray-300 placeholder-gray-500 focus:outline-none focus:ring-blue-500 focus:border-blue-500 focus:z-10 sm:text-sm"
+                    placeholder="Authenticator or recovery code"
+                    value={twoFactorCode}
+                    onChange={(e) => setTwoFactorCode(e.target.value)}
+                  />
+                </div>
+              )}
               {isRegistering && (
                 <div>
                   <label htmlFor="confirmPassword" className="sr-only">
@@ -401,6 +444,17 @@ export function LoginPage() {
               >
                 {isRegistering ? "Register" : "Sign in"}
               </button>
+              {!isRegistering &&
+                authConfig.methods.passkey &&
+                isPasskeySupported() && (
+                  <button
+                    type="button"
+                    onClick={handlePasskeyLogin}
+                    className="mt-3 w-full flex justify-center py-2 px-4 border border-gray-750 rounded-md shadow-sm bg-gray-800 hover:bg-gray-825 text-sm font-medium text-white hover:text-blue-450 focus:outline-none focus:ring-1 focus:ring-gray-700"
+                  >
+                    Sign in with passkey
+                  </button>
+                )}
             </div>
           </form>
         )}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2024, s0up and the autobrr contributors.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+import { useEffect, useState } from "react";
+import { Navigate, useNavigate, useSearchParams } from "react-router-dom";
+import { useAuth } from "../../contexts/AuthContext";
+import { toast } from "react-hot-toast";
+import { FontAwesomeIcon } from "@fortawesome/react-fontawesome";
+import { faCheck, faTimes } from "@fortawesome/free-solid-svg-icons";
+import Toast from "../Toast";
+import logo from "../../assets/logo.svg";
+import { Footer } from "../shared/Footer";
+
+const inputClassName =
+  "appearance-none relative block w-full px-3 py-2 border border-gray-700 dark:border-gray-900 bg-gray-700 text-gray-300 placeholder-gray-500 focus:outline-none focus:ring-blue-500 focus:border-blue-500 focus:z-10 sm:text-sm";
+
+// RegisterPage redeems an invite link created by an administrator
+export function RegisterPage() {
+  const { isAuthenticated, loading, register } = useAuth();
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const inviteToken = searchParams.get("invite") || "";
+  const [error, setError] = useState<string | null>(null);
+  const [submitting, setSubmitting] = useState(false);
+
+  const [formData, setFormData] = useState({
+    username: "",
+    email: "",
+    password: "",
+    confirmPassword: "",
+  });
+
+  const requirements = [
+    { label: "Minimum 8 characters", met: formData.password.length >= 8 },
+    {
+      label: "At least one uppercase letter",
+      met: /[A-Z]/.test(formData.password),
+    },
+    {
+      label: "At least one lowercase letter",
+      met: /[a-z]/.test(formData.password),
+    },
+    { label: "At least one number", met: /[0-9]/.test(formData.password) },
+    {
+      label: "Passwords match",
+      met:
+        formData.password !== "" &&
+        formData.password === formData.confirmPassword,
+    },
+  ];
+
+  useEffect(() => {
+    if (isAuthenticated && !loading) {
+      navigate("/", { replace: true });
+    }
+  }, [isAuthenticated, loading, navigate]);
+
+  const handleInputChange = (e: React.ChangeEvent<HTMLInputElement>) => {
+    const { name, value } = e.target;
+    setFormData((prev) => ({
+      ...prev,
+      [name]: value,
+    }));
+    setError(null);
+  };
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+
+    if (!requirements.every((requirement) => requirement.met)) {
+      setError("Please meet all password requirements");
+      return;
+    }
+
+    setSubmitting(true);
+    try {
+      await register({
+        username: formData.username,
+        email: formData.email,
+        password: formData.password,
+        invite_token: inviteToken,
+      });
+      toast.custom((t) => (
+        <Toast type="success" body="Registration successful!" t={t} />
+      ));
+    } catch (err) {
+      const errorMessage =
+        err instanceof Error ? err.message : "Registration failed";
+      setError(errorMessage);
+      toast.custom((t) => <Toast type="error" body={errorMessage} t={t} />);
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  if (!inviteToken) {
+    return <Navigate to="/login" replace />;
+  }
+
+  if (loading) {
+    return (
+      <div className="flex items-center justify-center min-h-screen bg-gray-900 pattern">
+        <div className="animate-spin rounded-full h-8 w-8 border-t-2 border-b-2 border-blue-500"></div>
+      </div>
+    );
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-900 pattern">
+      <div className="max-w-md w-full space-y-8 p-8 bg-gray-850/40 border border-black/40 rounded-lg shadow-lg">
+        <div className="flex flex-col items-center">
+          <img
+            src={logo}
+            alt="Dashbrr Logo"
+            className="text-white h-16 w-16 mb-2 select-none pointer-events-none"
+          />
+          <h2 className="text-3xl font-bold text-white pointer-events-none select-none">
+            Dashbrr
+          </h2>
+          <p className="mt-2 text-sm text-gray-400">
+            You have been invited to create an account
+          </p>
+        </div>
+
+        {error && (
+          <div className="bg-red-500 bg-opacity-10 border border-red-500 text-red-500 px-4 py-3 rounded">
+            <span className="block sm:inline">{error}</span>
+          </div>
+        )}
+
+        <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+          <div className="rounded-md shadow-sm -space-y-px">
+            <div>
+              <label htmlFor="username" className="sr-only">
+                Username
+              </label>
+              <input
+                id="username"
+                name="username"
+                type="text"
+                autoComplete="username"
+                required
+                className={`${inputClassName} rounded-t-md`}
+                placeholder="Username"
+                value={formData.username}
+                onChange={handleInputChange}
+              />
+            </div>
+            <div>
+              <label htmlFor="email" className="sr-only">
+                Email
+              </label>
+              <input
+                id="email"
+                name="email"
+                type="email"
+                autoComplete="email"
+                required
+                className={inputClassName}
+                placeholder="Email"
+                value={formData.email}
+                onChange={handleInputChange}
+              />
+            </div>
+            <div>
+              <label htmlFor="password" className="sr-only">
+                Password
+              </label>
+              <input
+                id="password"
+                name="password"
+                type="password"
+                autoComplete="new-password"
+                required
+                className={inputClassName}
+                placeholder="Password"
+                value={formData.password}
+                onChange={handleInputChange}
+              />
+            </div>
+            <div>
+              <label htmlFor="confirmPassword" className="sr-only">
+                Confirm Password
+              </label>
+              <input
+                id="confirmPassword"
+                name="confirmPassword"
+                type="password"
+                autoComplete="new-password"
+                required
+                className={`${inputClassName} rounded-b-md`}
+                placeholder="Confirm Password"
+                value={formData.confirmPassword}
+                onChange={handleInputChange}
+              />
+            </div>
+          </div>
+
+          <div className="rounded-md bg-blue-900 bg-opacity-20 p-4">
+            <div className="text-sm">
+              <h4 className="font-medium mb-2 text-blue-400">
+                Password Requirements:
+              </h4>
+              <ul className="space-y-1">
+                {requirements.map((requirement) => (
+                  <li
+                    key={requirement.label}
+                    className={`flex items-center ${
+                      requirement.met ? "text-green-400" : "text-blue-400"
+                    }`}
+                  >
+                    <FontAwesomeIcon
+                      icon={requirement.met ? faCheck : faTimes}
+                      className="w-4 h-4 mr-2"
+                    />
+                    {requirement.label}
+                  </li>
+                ))}
+              </ul>
+            </div>
+          </div>
+
+          <button
+            type="submit"
+            disabled={submitting}
+            className="group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500 disabled:opacity-50"
+          >
+            Create account
+          </button>
+        </form>
+        <Footer />
+      </div>
+    </div>
+  );
+}
@@ -163,6 +163,7 @@ export const ServiceCard: React.FC<ServiceCardProps> = ({
                   onRemove();
                 }}
                 needsConfiguration={needsConfiguration}
+                managed={service.managed}
                 status={service.status}
               />
             </div>
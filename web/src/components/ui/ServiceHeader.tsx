@@ -7,6 +7,7 @@ import React, { useState } from "react";
 import {
   ArrowTopRightOnSquareIcon,
   Cog6ToothIcon,
+  LockClosedIcon,
   TrashIcon,
 } from "@heroicons/react/20/solid";
 import AnimatedModal from "./AnimatedModal";
@@ -23,6 +24,7 @@ interface ServiceHeaderProps {
   onConfigure: (e?: React.MouseEvent) => void;
   onRemove: (e?: React.MouseEvent) => void;
   needsConfiguration?: boolean;
+  managed?: boolean;
   status?: ServiceStatus;
 }
 
@@ -34,6 +36,7 @@ export const ServiceHeader: React.FC<ServiceHeaderProps> = ({
   onConfigure,
   onRemove,
   needsConfiguration,
+  managed,
   status,
 }) => {
   const [showRemoveModal, setShowRemoveModal] = useState(false);
@@ -105,33 +108,42 @@ export const ServiceHeader: React.FC<ServiceHeaderProps> = ({
           </div>
         </div>
         <div className="flex items-center space-x-2 ml-4">
-          <div
-            className={`flex items-center ${
-              needsConfiguration ? "" : "opacity-0 group-hover:opacity-100"
-            } transition-all duration-200`}
-          >
-            <button
-              onClick={(e) => {
-                e.stopPropagation();
-                onConfigure(e);
-              }}
-              className={`p-1.5 rounded-full transition-all duration-200 ${
-                needsConfiguration
-                  ? "text-blue-600 dark:text-blue-400 hover:bg-blue-50 dark:hover:bg-blue-500/20"
-                  : "text-gray-400 hover:text-gray-600 dark:hover:text-white hover:bg-gray-100 dark:hover:bg-gray-700"
-              }`}
-              title="Configure service"
+          {managed ? (
+            <span
+              className="p-1.5 text-gray-400 dark:text-gray-500"
+              title="Managed by the config file"
             >
-              <Cog6ToothIcon className="h-4 w-4" />
-            </button>
-            <button
-              onClick={handleRemoveClick}
-              className="p-1.5 rounded-full text-red-500 hover:text-red-700 dark:text-red-400 dark:hover:text-red-300 hover:bg-red-50 dark:hover:bg-red-500/20 transition-all duration-200"
-              title="Remove service"
+              <LockClosedIcon className="h-4 w-4" />
+            </span>
+          ) : (
+            <div
+              className={`flex items-center ${
+                needsConfiguration ? "" : "opacity-0 group-hover:opacity-100"
+              } transition-all duration-200`}
             >
-              <TrashIcon className="h-4 w-4" />
-            </button>
-          </div>
+              <button
+                onClick={(e) => {
+                  e.stopPropagation();
+                  onConfigure(e);
+                }}
+                className={`p-1.5 rounded-full transition-all duration-200 ${
+                  needsConfiguration
+                    ? "text-blue-600 dark:text-blue-400 hover:bg-blue-50 dark:hover:bg-blue-500/20"
+                    : "text-gray-400 hover:text-gray-600 dark:hover:text-white hover:bg-gray-100 dark:hover:bg-gray-700"
+                }`}
+                title="Configure service"
+              >
+                <Cog6ToothIcon className="h-4 w-4" />
+              </button>
+              <button
+                onClick={handleRemoveClick}
+                className="p-1.5 rounded-full text-red-500 hover:text-red-700 dark:text-red-400 dark:hover:text-red-300 hover:bg-red-50 dark:hover:bg-red-500/20 transition-all duration-200"
+                title="Remove service"
+              >
+                <TrashIcon className="h-4 w-4" />
+              </button>
+            </div>
+          )}
           {status && (
             <div className="flex-shrink-0">
               <StatusIcon status={status as StatusType} />
@@ -12,6 +12,7 @@ export const API_BASE_URL = import.meta.env.DEV
 export const API_PREFIX = '/api';
 
 import { api } from '../utils/api';
+import { withBasePath } from '../utils/basePath';
 
 interface ApiResponse {
   success: boolean;
@@ -105,7 +106,7 @@ export const getBackendUrl = (path: string) => {
   const apiPath = path.startsWith('/api') ? path : `${API_PREFIX}${path}`;
   return import.meta.env.DEV
     ? `http://localhost:8080${apiPath}`  // Development
-    : apiPath;                           // Production
+    : withBasePath(apiPath);             // Production
 };
 
 export const getPlexSessions = async (baseUrl: string, apiKey: string): Promise<PlexSession[]> => {
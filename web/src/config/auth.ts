@@ -3,40 +3,56 @@
  * SPDX-License-Identifier: GPL-2.0-or-later
  */
 
+import { BASE_PATH, withBasePath } from '../utils/basePath';
+
 // Get the current frontend URL
 const getFrontendUrl = () => {
   // In development, use localhost:3000
   if (import.meta.env.DEV) {
     return 'http://localhost:3000';
   }
-  // In production, use the current origin
-  return window.location.origin;
+  // In production, use the current origin and base path
+  return `${window.location.origin}${BASE_PATH}`;
 };
 
 // Common auth endpoints
 const COMMON_ENDPOINTS = {
-  config: '/api/auth/config',
-  userInfo: '/api/auth/userinfo',
+  config: withBasePath('/api/auth/config'),
+  userInfo: withBasePath('/api/auth/userinfo'),
 };
 
 // OIDC-specific endpoints
 const OIDC_ENDPOINTS = {
-  login: `/api/auth/oidc/login?frontendUrl=${encodeURIComponent(getFrontendUrl())}`,
-  callback: `/api/auth/oidc/callback?frontendUrl=${encodeURIComponent(getFrontendUrl())}`,
-  logout: `/api/auth/oidc/logout?frontendUrl=${encodeURIComponent(getFrontendUrl())}`,
-  refresh: '/api/auth/oidc/refresh',
-  verify: '/api/auth/oidc/verify',
-  userInfo: '/api/auth/oidc/userinfo',
+  login: withBasePath(`/api/auth/oidc/login?frontendUrl=${encodeURIComponent(getFrontendUrl())}`),
+  callback: withBasePath(`/api/auth/oidc/callback?frontendUrl=${encodeURIComponent(getFrontendUrl())}`),
+  logout: withBasePath(`/api/auth/oidc/logout?frontendUrl=${encodeURIComponent(getFrontendUrl())}`),
+  refresh: withBasePath('/api/auth/oidc/refresh'),
+  verify: withBasePath('/api/auth/oidc/verify'),
+  userInfo: withBasePath('/api/auth/oidc/userinfo'),
 };
 
 // Built-in auth endpoints
 const BUILTIN_ENDPOINTS = {
-  login: '/api/auth/login',
-  register: '/api/auth/register',
-  logout: '/api/auth/logout',
-  verify: '/api/auth/verify',
+  login: withBasePath('/api/auth/login'),
+  loginTwoFactor: withBasePath('/api/auth/login/2fa'),
+  passkeyLoginBegin: withBasePath('/api/auth/passkey/login/begin'),
+  passkeyLoginFinish: withBasePath('/api/auth/passkey/login/finish'),
+  register: withBasePath('/api/auth/register'),
+  logout: withBasePath('/api/auth/logout'),
+  verify: withBasePath('/api/auth/verify'),
 };
 
+// Error message used when a login needs a two-factor code
+export const TWO_FACTOR_REQUIRED = 'Two-factor code required';
+
+// Placeholder stored as the access token after an OIDC login. The real
+// session is an HttpOnly cookie the browser sends automatically.
+export const OIDC_COOKIE_SESSION = 'oidc-cookie-session';
+
+// Placeholder stored as the access token when a trusted reverse proxy
+// authenticates every request
+export const PROXY_SESSION = 'proxy-session';
+
 export const AUTH_URLS = {
   ...COMMON_ENDPOINTS,
   oidc: OIDC_ENDPOINTS,
@@ -47,8 +63,10 @@ export interface AuthConfig {
   methods: {
     builtin: boolean;
     oidc: boolean;
+    proxy?: boolean;
+    passkey?: boolean;
   };
-  default: 'builtin' | 'oidc';
+  default: 'builtin' | 'oidc' | 'proxy';
 }
 
 export async function getAuthConfig(): Promise<AuthConfig> {
@@ -17,7 +17,16 @@ import {
   LoginCredentials,
   RegisterCredentials,
 } from "../types/auth";
-import { AUTH_URLS, getAuthConfig, AuthConfig } from "../config/auth";
+import {
+  AUTH_URLS,
+  getAuthConfig,
+  AuthConfig,
+  OIDC_COOKIE_SESSION,
+  PROXY_SESSION,
+  TWO_FACTOR_REQUIRED,
+} from "../config/auth";
+import { getPasskeyAssertion } from "../utils/webauthn";
+import { csrfHeaders } from "../utils/csrf";
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined);
 
@@ -71,6 +80,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
       const currentAuthType = localStorage.getItem("auth_type") as
         | "oidc"
         | "builtin"
+        | "proxy"
         | null;
 
       if (!accessToken || !currentAuthType) {
@@ -84,10 +94,14 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
       );
 
       // First verify the token
+      // Proxy users have no dashbrr session; the user info endpoint checks
+      // the proxy headers instead
       const verifyUrl =
         currentAuthType === "oidc"
           ? AUTH_URLS.oidc.verify
-          : AUTH_URLS.builtin.verify;
+          : currentAuthType === "proxy"
+            ? AUTH_URLS.userInfo
+            : AUTH_URLS.builtin.verify;
 
       console.log("[AuthProvider] Verifying token at:", verifyUrl);
 
@@ -191,18 +205,23 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     getAuthConfig().then((config) => {
       console.log("[AuthProvider] Received auth config:", config);
       setAuthConfig(config);
+
+      // The reverse proxy has logged the user in, skip the login screen
+      if (config.default === "proxy") {
+        localStorage.setItem("access_token", PROXY_SESSION);
+        localStorage.setItem("auth_type", "proxy");
+        checkAuthStatus();
+      }
     });
 
-    // Check for OIDC auth tokens in URL (after callback)
+    // Check for a completed OIDC login (after callback). The session itself
+    // lives in an HttpOnly cookie; the stored token is only a marker.
     const params = new URLSearchParams(window.location.search);
-    const accessToken = params.get("access_token");
-    const idToken = params.get("id_token");
-
-    if (accessToken && idToken) {
-      console.log("[AuthProvider] Found OIDC tokens in URL");
-      // Store tokens and remove them from URL
-      localStorage.setItem("access_token", accessToken);
-      localStorage.setItem("id_token", idToken);
+
+    if (params.get("auth") === "oidc") {
+      console.log("[AuthProvider] Completed OIDC login");
+      localStorage.setItem("access_token", OIDC_COOKIE_SESSION);
+      localStorage.removeItem("id_token");
       localStorage.setItem("auth_type", "oidc");
       window.history.replaceState({}, document.title, window.location.pathname);
       debouncedCheckAuth();
@@ -225,7 +244,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
         setLoading(false);
       }
     }
-  }, [debouncedCheckAuth]);
+  }, [debouncedCheckAuth, checkAuthStatus]);
 
   const clearAuth = () => {
     console.log("[AuthProvider] Clearing authentication state");
@@ -256,22 +275,52 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     }
 
     try {
+      const { code, ...passwordCredentials } = credentials;
       const response = await fetch(AUTH_URLS.builtin.login, {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          ...(await csrfHeaders()),
         },
-        body: JSON.stringify(credentials),
+        body: JSON.stringify(passwordCredentials),
         credentials: "include",
       });
 
       if (!response.ok) {
         const error = await response.json();
         console.error("[AuthProvider] Login failed:", error);
-        throw new Error(error.message || "Login failed");
+        throw new Error(error.message || error.error || "Login failed");
+      }
+
+      let data = await response.json();
+      if (data.two_factor_required) {
+        if (!code) {
+          throw new Error(TWO_FACTOR_REQUIRED);
+        }
+
+        // Six digits are an authenticator code, anything else a recovery code
+        const trimmed = code.replace(/\s/g, "");
+        const secondFactor = /^\d{6}$/.test(trimmed)
+          ? { code: trimmed }
+          : { recovery_code: trimmed };
+        const twoFactorResponse = await fetch(AUTH_URLS.builtin.loginTwoFactor, {
+          method: "POST",
+          headers: {
+            "Content-Type": "application/json",
+            ...(await csrfHeaders()),
+          },
+          body: JSON.stringify({ challenge: data.challenge, ...secondFactor }),
+          credentials: "include",
+        });
+
+        if (!twoFactorResponse.ok) {
+          const error = await twoFactorResponse.json();
+          console.error("[AuthProvider] Two-factor login failed:", error);
+          throw new Error(error.error || "Invalid two-factor code");
+        }
+        data = await twoFactorResponse.json();
       }
 
-      const data = await response.json();
       console.log("[AuthProvider] Login successful");
       localStorage.setItem("access_token", data.access_token);
       localStorage.setItem("auth_type", "builtin");
@@ -282,6 +331,50 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     }
   };
 
+  const loginWithPasskey = async () => {
+    console.log("[AuthProvider] Passkey login attempt");
+    try {
+      const beginResponse = await fetch(AUTH_URLS.builtin.passkeyLoginBegin, {
+        method: "POST",
+        headers: await csrfHeaders(),
+        credentials: "include",
+      });
+      if (!beginResponse.ok) {
+        const error = await beginResponse.json();
+        throw new Error(error.error || "Passkey login failed");
+      }
+      const { session, options } = await beginResponse.json();
+
+      const assertion = await getPasskeyAssertion(options);
+      const response = await fetch(
+        `${AUTH_URLS.builtin.passkeyLoginFinish}?session=${encodeURIComponent(session)}`,
+        {
+          method: "POST",
+          headers: {
+            "Content-Type": "application/json",
+            ...(await csrfHeaders()),
+          },
+          body: JSON.stringify(assertion),
+          credentials: "include",
+        }
+      );
+      if (!response.ok) {
+        const error = await response.json();
+        console.error("[AuthProvider] Passkey login failed:", error);
+        throw new Error(error.error || "Passkey login failed");
+      }
+
+      const data = await response.json();
+      console.log("[AuthProvider] Passkey login successful");
+      localStorage.setItem("access_token", data.access_token);
+      localStorage.setItem("auth_type", "builtin");
+      await debouncedCheckAuth();
+    } catch (error) {
+      console.error("[AuthProvider] Passkey login error:", error);
+      throw error;
+    }
+  };
+
   const register = async (credentials: RegisterCredentials) => {
     console.log("[AuthProvider] Registration attempt");
     try {
@@ -289,6 +382,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          ...(await csrfHeaders()),
         },
         body: JSON.stringify(credentials),
         credentials: "include",
@@ -297,7 +391,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
       if (!response.ok) {
         const error = await response.json();
         console.error("[AuthProvider] Registration failed:", error);
-        throw new Error(error.message || "Registration failed");
+        throw new Error(error.error || error.message || "Registration failed");
       }
 
       console.log(
@@ -333,11 +427,10 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
 
       const response = await fetch(logoutUrl, {
         method: "POST",
-        headers: accessToken
-          ? {
-              Authorization: `Bearer ${accessToken}`,
-            }
-          : undefined,
+        headers: {
+          ...(accessToken ? { Authorization: `Bearer ${accessToken}` } : {}),
+          ...(await csrfHeaders()),
+        },
         credentials: "include",
       });
 
@@ -361,6 +454,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     user,
     login,
     loginWithOIDC,
+    loginWithPasskey,
     register,
     logout,
     loading,
@@ -5,6 +5,8 @@
 
 import { useState, useEffect, ReactNode, useCallback } from "react";
 import { API_BASE_URL, API_PREFIX } from "../config/api";
+import { withBasePath } from "../utils/basePath";
+import { csrfHeaders } from "../utils/csrf";
 import { ServiceConfig } from "../types/service";
 import { useAuth } from "./AuthContext";
 import { ConfigurationContext } from "./context";
@@ -20,7 +22,7 @@ export function ConfigurationProvider({ children }: { children: ReactNode }) {
 
   const buildUrl = useCallback((path: string) => {
     const apiPath = path.startsWith("/api") ? path : `${API_PREFIX}${path}`;
-    return `${API_BASE_URL}${apiPath}`;
+    return `${API_BASE_URL}${withBasePath(apiPath)}`;
   }, []);
 
   const getAuthHeaders = useCallback(() => {
@@ -75,7 +77,7 @@ export function ConfigurationProvider({ children }: { children: ReactNode }) {
       setError(null);
       const response = await fetch(buildUrl(`/settings/${instanceId}`), {
         method: "POST",
-        headers: getAuthHeaders(),
+        headers: { ...getAuthHeaders(), ...(await csrfHeaders()) },
         body: JSON.stringify(config),
       });
 
@@ -106,7 +108,7 @@ export function ConfigurationProvider({ children }: { children: ReactNode }) {
       setError(null);
       const response = await fetch(buildUrl(`/settings/${instanceId}`), {
         method: "DELETE",
-        headers: getAuthHeaders(),
+        headers: { ...getAuthHeaders(), ...(await csrfHeaders()) },
       });
 
       if (!response.ok) {
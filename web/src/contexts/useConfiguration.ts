@@ -5,6 +5,7 @@
 
 import { useContext } from 'react';
 import { ConfigurationContext } from './context';
+import { withBasePath } from '../utils/basePath';
 
 export const useConfiguration = () => {
   const context = useContext(ConfigurationContext);
@@ -25,7 +26,7 @@ export const useConfiguration = () => {
       }
       
       // Construct the health check URL
-      const healthCheckUrl = `/health/${type.toLowerCase()}?${params.toString()}`;
+      const healthCheckUrl = withBasePath(`/health/${type.toLowerCase()}?${params.toString()}`);
       
       const response = await fetch(healthCheckUrl, {
         method: 'GET',
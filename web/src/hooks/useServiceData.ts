@@ -266,6 +266,8 @@ export const useServiceData = () => {
       url: config.url,
       apiKey: config.apiKey,
       displayName: config.displayName,
+      managed: config.managed,
+      tags: config.tags,
       healthEndpoint: template?.healthEndpoint,
       message: hasRequiredConfig ? 'Loading service status' : 'Service not configured',
       stats: {},
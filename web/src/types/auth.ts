@@ -16,16 +16,18 @@ export interface User {
   preferred_username?: string;
   email_verified?: boolean;
   username?: string;
-  auth_type?: 'oidc' | 'builtin';
+  auth_type?: 'oidc' | 'builtin' | 'proxy';
 }
 
 export interface LoginCredentials {
   username: string;
   password: string;
+  code?: string; // TOTP or recovery code for accounts with two-factor enabled
 }
 
 export interface RegisterCredentials extends LoginCredentials {
   email: string;
+  invite_token?: string;
 }
 
 export interface AuthResponse {
@@ -47,6 +49,7 @@ export interface AuthContextType extends AuthState {
   register: (credentials: RegisterCredentials) => Promise<void>;
   logout: () => Promise<void>;
   loginWithOIDC: () => void;
+  loginWithPasskey: () => Promise<void>;
 }
 
 export interface AuthError {
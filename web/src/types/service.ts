@@ -33,12 +33,17 @@ export interface Service {
   stats?: ServiceStats;
   details?: ServiceDetails;
   health?: ServiceHealth;
+  // Declared in the config file and read-only in the UI
+  managed?: boolean;
+  tags?: string[];
 }
 
 export interface ServiceConfig {
   url: string;
   apiKey?: string;
   displayName: string;
+  managed?: boolean;
+  tags?: string[];
 }
 
 // Autobrr Types
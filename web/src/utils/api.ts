@@ -3,6 +3,9 @@
  * SPDX-License-Identifier: GPL-2.0-or-later
  */
 
+import { csrfHeaders, isCsrfFailure, resetCsrfToken } from './csrf';
+import { withBasePath } from './basePath';
+
 interface RequestOptions {
   method: string;
   headers?: Record<string, string>;
@@ -142,7 +145,7 @@ const handleRequest = async <T>(
   
   try {
     const apiPath = path.startsWith('/api') ? path : `/api${path}`;
-    const url = apiPath;
+    const url = withBasePath(apiPath);
 
     const controller = new AbortController();
     const timeoutId = setTimeout(() => controller.abort(), timeout);
@@ -151,17 +154,26 @@ const handleRequest = async <T>(
       ...options,
       signal: controller.signal,
     };
+    if (options.method !== 'GET') {
+      requestOptions.headers = { ...options.headers, ...(await csrfHeaders()) };
+    }
 
     const response = await fetch(url, requestOptions);
     clearTimeout(timeoutId);
 
+    // The CSRF token expired, fetch a new one and try again
+    if (retryCount === 0 && (await isCsrfFailure(response))) {
+      resetCsrfToken();
+      return handleRequest<T>(path, options, retryCount + 1, customTimeout);
+    }
+
     if (response.status === 401) {
       // Clear auth tokens and unregister service worker before redirecting
       localStorage.removeItem('access_token');
       localStorage.removeItem('id_token');
       localStorage.removeItem('auth_type');
       await unregisterServiceWorker();
-      window.location.href = '/login';
+      window.location.href = withBasePath('/login');
       throw new Error('Authentication required');
     }
 
@@ -216,5 +228,5 @@ export const api = {
 
 export const getEventSourceUrl = (path: string): string => {
   const apiPath = path.startsWith('/api') ? path : `/api${path}`;
-  return `${window.location.origin}${apiPath}`;
+  return `${window.location.origin}${withBasePath(apiPath)}`;
 };
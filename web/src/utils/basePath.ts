@@ -0,0 +1,16 @@
+/*
+ * Copyright (c) 2024, s0up and the autobrr contributors.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+// The server adds a <base> element to index.html when serving it, pointing
+// at the configured base path. The Vite dev server has none and serves the
+// app from the root.
+const baseHref = document.querySelector('base')?.getAttribute('href') ?? '/';
+
+// BASE_PATH is the path dashbrr is served under, such as "/dashbrr", or an
+// empty string at the root
+export const BASE_PATH = baseHref.replace(/\/+$/, '');
+
+// withBasePath prefixes an absolute path with the base path
+export const withBasePath = (path: string): string => `${BASE_PATH}${path}`;
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2024, s0up and the autobrr contributors.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+import { withBasePath } from './basePath';
+
+// State-changing requests authenticated by the session cookie must echo
+// the CSRF token in this header
+export const CSRF_HEADER = 'X-CSRF-Token';
+
+const CSRF_URL = withBasePath('/api/auth/csrf');
+
+let csrfToken: Promise<string> | null = null;
+
+// getCsrfToken returns the CSRF token, fetching it once per page load
+export function getCsrfToken(): Promise<string> {
+  if (!csrfToken) {
+    csrfToken = fetch(CSRF_URL, { credentials: 'include' })
+      .then(async (response) => {
+        if (!response.ok) {
+          throw new Error('Failed to fetch CSRF token');
+        }
+        const data = await response.json();
+        return data.csrf_token as string;
+      })
+      .catch((error) => {
+        csrfToken = null;
+        throw error;
+      });
+  }
+  return csrfToken;
+}
+
+// resetCsrfToken forgets the token, for example after the server rejected it
+export function resetCsrfToken() {
+  csrfToken = null;
+}
+
+export async function csrfHeaders(): Promise<Record<string, string>> {
+  return { [CSRF_HEADER]: await getCsrfToken() };
+}
+
+// isCsrfFailure reports whether a 403 response is a rejected CSRF token
+export async function isCsrfFailure(response: Response): Promise<boolean> {
+  if (response.status !== 403) {
+    return false;
+  }
+  try {
+    const data = await response.clone().json();
+    return typeof data.error === 'string' && data.error.startsWith('CSRF token');
+  } catch {
+    return false;
+  }
+}
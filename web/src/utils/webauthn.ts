@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2024, s0up and the autobrr contributors.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+// The server sends and expects binary WebAuthn fields as base64url strings
+
+function fromBase64Url(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+  const padded = base64.padEnd(base64.length + ((4 - (base64.length % 4)) % 4), "=");
+  const binary = atob(padded);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+}
+
+function toBase64Url(buffer: ArrayBuffer | null): string | undefined {
+  if (!buffer) {
+    return undefined;
+  }
+  let binary = "";
+  new Uint8Array(buffer).forEach((byte) => {
+    binary += String.fromCharCode(byte);
+  });
+  return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+interface AssertionOptions {
+  publicKey: Omit<PublicKeyCredentialRequestOptions, "challenge" | "allowCredentials"> & {
+    challenge: string;
+    allowCredentials?: { id: string; type: PublicKeyCredentialType; transports?: AuthenticatorTransport[] }[];
+  };
+}
+
+export function isPasskeySupported(): boolean {
+  return typeof window !== "undefined" && !!window.PublicKeyCredential;
+}
+
+// getPasskeyAssertion asks the browser to sign the login challenge with a
+// passkey and returns the response in the form the server expects
+export async function getPasskeyAssertion(options: AssertionOptions) {
+  const { challenge, allowCredentials, ...publicKey } = options.publicKey;
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64Url(challenge),
+      allowCredentials: allowCredentials?.map((descriptor) => ({
+        ...descriptor,
+        id: fromBase64Url(descriptor.id),
+      })),
+    },
+  })) as PublicKeyCredential | null;
+
+  if (!credential) {
+    throw new Error("No passkey was selected");
+  }
+
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64Url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64Url(response.clientDataJSON),
+      authenticatorData: toBase64Url(response.authenticatorData),
+      signature: toBase64Url(response.signature),
+      userHandle: toBase64Url(response.userHandle),
+    },
+  };
+}
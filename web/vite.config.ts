@@ -5,7 +5,9 @@ import tailwindcss from 'tailwindcss'
 import autoprefixer from 'autoprefixer'
 
 export default defineConfig(({ mode }) => ({
-  base: "/",
+  // Relative asset URLs let the server pick the base path at runtime by
+  // adding a <base> element to index.html
+  base: "./",
   build: {
     outDir: 'dist',
     manifest: true,
@@ -73,47 +75,47 @@ export default defineConfig(({ mode }) => ({
         display: 'standalone',
         icons: [
           {
-            src: '/pwa-192x192.png',
+            src: 'pwa-192x192.png',
             sizes: '192x192',
             type: 'image/png'
           },
           {
-            src: '/pwa-512x512.png',
+            src: 'pwa-512x512.png',
             sizes: '512x512',
             type: 'image/png',
             purpose: 'any maskable'
           },
           {
-            src: '/apple-touch-icon-iphone-60x60.png',
+            src: 'apple-touch-icon-iphone-60x60.png',
             sizes: '60x60',
             type: 'image/png'
           },
           {
-            src: '/apple-touch-icon-ipad-76x76.png',
+            src: 'apple-touch-icon-ipad-76x76.png',
             sizes: '76x76',
             type: 'image/png'
           },
           {
-            src: '/apple-touch-icon-iphone-retina-120x120.png',
+            src: 'apple-touch-icon-iphone-retina-120x120.png',
             sizes: '120x120',
             type: 'image/png'
           },
           {
-            src: '/apple-touch-icon-ipad-retina-152x152.png',
+            src: 'apple-touch-icon-ipad-retina-152x152.png',
             sizes: '152x152',
             type: 'image/png'
           }
         ],
-        start_url: '/',
-        scope: '/'
+        start_url: './',
+        scope: './'
       },
       workbox: mode === 'production' ? {
         globDirectory: 'dist',
         globPatterns: [
           '**/*.{js,css,html,ico,png,svg}'
         ],
-        navigateFallback: '/index.html',
-        navigateFallbackDenylist: [/^\/api\//],
+        navigateFallback: 'index.html',
+        navigateFallbackDenylist: [/\/api\//],
         runtimeCaching: [
           {
             urlPattern: /^https:\/\/fonts\.googleapis\.com\/.*/i,